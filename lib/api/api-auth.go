@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/security"
+	"msh/lib/servctrl"
+)
+
+// authorize checks that the request contains one of Api.Tokens as "Authorization: Bearer <token>" header
+// and returns the token. If no token is configured, authenticated endpoints are disabled.
+func authorize(r *http.Request) (string, *errco.Error) {
+	if len(config.ConfigRuntime.Api.Tokens) == 0 {
+		return "", errco.NewErr(errco.ERROR_API_UNAUTHORIZED, errco.LVL_D, "authorize", "no api token configured: endpoint disabled")
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, t := range config.ConfigRuntime.Api.Tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return t, nil
+		}
+	}
+
+	// requests with a wrong token are reported (requests without token are likely clients not configured yet)
+	if token != "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		security.Report(security.REASON_UNAUTHORIZED, host, "", "api token is not valid")
+	}
+
+	return "", errco.NewErr(errco.ERROR_API_UNAUTHORIZED, errco.LVL_B, "authorize", "api token is not valid (request from "+r.RemoteAddr+")")
+}
+
+// authorizeControl checks the authorization of a request that controls msh or the minecraft server state
+// (start, freeze, restart, drain, keep-alive, profile switch): tokens listed in Api.CommandAllowlist are not allowed,
+// they can only run their allowed commands.
+func authorizeControl(r *http.Request) *errco.Error {
+	token, errMsh := authorize(r)
+	if errMsh != nil {
+		return errMsh.AddTrace("authorizeControl")
+	}
+
+	if _, restricted := tokenAllowlist(token); restricted {
+		return errco.NewErr(errco.ERROR_API_FORBIDDEN, errco.LVL_B, "authorizeControl", "api token is restricted to the commands of Api.CommandAllowlist")
+	}
+
+	return nil
+}
+
+// commandAllowed checks that token is allowed to run the minecraft server command.
+// Tokens listed in Api.CommandAllowlist can only run commands that start with one of their entries
+// (ex: "whitelist add" allows "whitelist add player"), other tokens can run any command.
+// Commands containing control characters are never allowed (a "\r" would run a second command).
+func commandAllowed(token, command string) *errco.Error {
+	if !servctrl.ValidCommand(command) {
+		return errco.NewErr(errco.ERROR_API_FORBIDDEN, errco.LVL_B, "commandAllowed", "command contains control characters")
+	}
+
+	allowlist, restricted := tokenAllowlist(token)
+	if !restricted {
+		return nil
+	}
+
+	command = strings.TrimPrefix(strings.TrimSpace(command), "/")
+	for _, allowed := range allowlist {
+		allowed = strings.TrimPrefix(strings.TrimSpace(allowed), "/")
+		if allowed != "" && (command == allowed || strings.HasPrefix(command, allowed+" ")) {
+			return nil
+		}
+	}
+
+	return errco.NewErr(errco.ERROR_API_FORBIDDEN, errco.LVL_B, "commandAllowed", "command not allowed for api token: "+command)
+}
+
+// tokenAllowlist returns the commands allowed to token by Api.CommandAllowlist and true if token is restricted.
+// If a token of Api.CommandAllowlist is an unresolved secret reference, all tokens are restricted
+// without allowed commands: the restricted token can't be recognized.
+func tokenAllowlist(token string) ([]string, bool) {
+	allowlist, restricted := config.ConfigRuntime.Api.CommandAllowlist[token]
+	if restricted {
+		return allowlist, true
+	}
+
+	for t := range config.ConfigRuntime.Api.CommandAllowlist {
+		if config.UnresolvedRef(t) {
+			return nil, true
+		}
+	}
+
+	return nil, false
+}
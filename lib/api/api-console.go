@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/websocket"
+)
+
+// consoleBufferSize is the amount of console lines buffered for each websocket console
+const consoleBufferSize = 256
+
+// consolePingInterval is the interval between pings sent to keep idle websocket consoles open
+const consolePingInterval = 30 * time.Second
+
+// consoleMaxMessage is the maximum size of a message received from a websocket console
+const consoleMaxMessage = 64 * 1024
+
+// handleConsole streams the minecraft server console over a websocket and executes the commands received
+// (one command per text message). Requires authorization (Api.Tokens): browsers can't set the Authorization header
+// on websockets, so the token can also be passed as query parameter.
+// query parameters:
+// token	api token (if the Authorization header is not set)
+// lines	recent console lines sent on connection (default 100, 0 for none)
+func handleConsole(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if r.Header.Get("Authorization") == "" && q.Get("token") != "" {
+		r.Header.Set("Authorization", "Bearer "+q.Get("token"))
+	}
+	token, errMsh := authorize(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleConsole"))
+		return
+	}
+
+	lines := 100
+	if l := q.Get("lines"); l != "" {
+		var err error
+		lines, err = strconv.Atoi(l)
+		if err != nil || lines < 0 {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleConsole", "lines parameter is not valid"))
+			return
+		}
+	}
+
+	ws, err := websocket.Upgrade(w, r, consoleMaxMessage)
+	if err != nil {
+		writeErr(w, errco.NewErr(errco.ERROR_API_WEBSOCKET, errco.LVL_D, "handleConsole", err.Error()))
+		return
+	}
+	defer ws.Close()
+
+	errco.Logln(errco.LVL_B, "api console opened from %s", r.RemoteAddr)
+
+	// subscribe before sending the recent lines to avoid missing lines
+	lineC, unsubscribe := servctrl.SubscribeConsole("api console "+r.RemoteAddr, consoleBufferSize)
+	defer unsubscribe()
+
+	recent := []errco.LogLine{}
+	for _, l := range errco.LogBuf.Get(0, 0, "") {
+		if l.Type == "serv" {
+			recent = append(recent, l)
+		}
+	}
+	if len(recent) > lines {
+		recent = recent[len(recent)-lines:]
+	}
+	for _, l := range recent {
+		consoleSend(ws, servctrl.ConsoleLine{Time: l.Time, Text: l.Text})
+	}
+
+	go consoleWriter(ws, lineC)
+
+	for {
+		message, err := ws.ReadMessage()
+		if err != nil {
+			errco.Logln(errco.LVL_B, "api console closed from %s", r.RemoteAddr)
+			return
+		}
+
+		command := strings.TrimSpace(string(message))
+		if command == "" || !servctrl.ValidCommand(command) {
+			consoleSendErr(ws, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleConsole", "command is not valid"))
+			continue
+		}
+
+		errMsh = commandAllowed(token, command)
+		if errMsh != nil {
+			consoleSendErr(ws, errMsh.AddTrace("handleConsole"))
+			continue
+		}
+
+		// the command output is received as console lines
+		_, errMsh = servctrl.Execute(command, "api console")
+		if errMsh != nil {
+			consoleSendErr(ws, errMsh.AddTrace("handleConsole"))
+		}
+	}
+}
+
+// handleConsolePage responds with a web page that connects to the websocket console (/api/console)
+func handleConsolePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(consolePage))
+}
+
+// consoleWriter sends the console lines received on lineC to the websocket console and pings it when idle.
+// Returns when lineC is closed or the websocket can't be written.
+// [goroutine]
+func consoleWriter(ws *websocket.Conn, lineC chan servctrl.ConsoleLine) {
+	ticker := time.NewTicker(consolePingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+
+		select {
+		case line, ok := <-lineC:
+			if !ok {
+				return
+			}
+			err = consoleSend(ws, line)
+		case <-ticker.C:
+			err = ws.WriteFrame(websocket.OpPing, nil)
+		}
+
+		if err != nil {
+			// closing the connection stops the reader in handleConsole
+			ws.Close()
+			return
+		}
+	}
+}
+
+// consoleSend sends a console line to the websocket console as json
+func consoleSend(ws *websocket.Conn, line servctrl.ConsoleLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	return ws.WriteFrame(websocket.OpText, data)
+}
+
+// consoleSendErr logs the msh error and sends it to the websocket console as json
+func consoleSendErr(ws *websocket.Conn, errMsh *errco.Error) {
+	errco.LogMshErr(errMsh)
+
+	data, err := json.Marshal(newApiError(errMsh))
+	if err != nil {
+		return
+	}
+
+	ws.WriteFrame(websocket.OpText, data)
+}
+
+// consolePage is a minimal web console usable from a phone browser (the token is stored in the browser)
+const consolePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>msh console</title>
+<style>
+body { margin: 0; display: flex; flex-direction: column; height: 100vh; background: #111; color: #ddd; font-family: monospace; }
+#log { flex: 1; overflow-y: auto; margin: 0; padding: 8px; white-space: pre-wrap; word-break: break-all; font-size: 12px; }
+.err { color: #f66; } .stderr { color: #fc6; } .msh { color: #6cf; }
+form { display: flex; border-top: 1px solid #333; }
+input { flex: 1; padding: 10px; background: #222; color: #ddd; border: 0; font-family: monospace; font-size: 16px; }
+</style>
+</head>
+<body>
+<pre id="log"></pre>
+<form id="form"><input id="cmd" autocomplete="off" placeholder="command"></form>
+<script>
+var log = document.getElementById("log"), cmd = document.getElementById("cmd"), ws;
+function print(text, cls) {
+	var el = document.createElement("div");
+	el.textContent = text;
+	if (cls) el.className = cls;
+	var bottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+	log.appendChild(el);
+	if (bottom) log.scrollTop = log.scrollHeight;
+}
+function connect() {
+	var token = localStorage.getItem("msh-token") || prompt("api token");
+	if (!token) return;
+	localStorage.setItem("msh-token", token);
+	ws = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") + location.host + "/api/console?token=" + encodeURIComponent(token));
+	ws.onopen = function () { ws.opened = true; print("connected", "msh"); };
+	ws.onmessage = function (e) {
+		var m = JSON.parse(e.data);
+		if (m.error) print(m.error, "err");
+		else print(m.text, m.stderr ? "stderr" : "");
+	};
+	ws.onclose = function (e) {
+		print("disconnected: reconnecting in 5 seconds", "msh");
+		// the token is asked again if the connection was refused
+		if (!ws.opened) localStorage.removeItem("msh-token");
+		setTimeout(connect, 5000);
+	};
+}
+document.getElementById("form").onsubmit = function (e) {
+	e.preventDefault();
+	if (ws && ws.readyState == 1 && cmd.value) {
+		print("> " + cmd.value, "msh");
+		ws.send(cmd.value);
+		cmd.value = "";
+	}
+};
+connect();
+</script>
+</body>
+</html>
+`
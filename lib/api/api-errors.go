@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+
+	"msh/lib/errco"
+)
+
+// errStatus is the http status code and the grpc status code of the api responses for a msh error
+type errStatus struct {
+	http int
+	grpc int
+}
+
+// errStatuses maps the msh error codes to the status codes of the api responses.
+// Errors not listed are internal errors (500 / INTERNAL).
+var errStatuses = map[int]errStatus{
+	// request not valid
+	errco.ERROR_API_REQUEST:   {http.StatusBadRequest, grpcInvalidArgument},
+	errco.ERROR_API_METHOD:    {http.StatusMethodNotAllowed, grpcUnimplemented},
+	errco.ERROR_API_WEBSOCKET: {http.StatusBadRequest, grpcInvalidArgument},
+	errco.ERROR_COMMAND_INPUT: {http.StatusBadRequest, grpcInvalidArgument},
+
+	// authorization
+	errco.ERROR_API_UNAUTHORIZED: {http.StatusUnauthorized, grpcUnauthenticated},
+	errco.ERROR_API_FORBIDDEN:    {http.StatusForbidden, grpcPermissionDenied},
+	errco.ERROR_QUOTA_TOKEN:      {http.StatusForbidden, grpcPermissionDenied},
+	errco.ERROR_PLUGIN_VETO:      {http.StatusForbidden, grpcPermissionDenied},
+
+	// minecraft server state does not allow the request
+	errco.ERROR_SERVER_NOT_ONLINE:   {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_TERMINAL_NOT_ACTIVE: {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_NOT_EMPTY:    {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_MUST_WAIT:    {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_ALWAYS_ON:    {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_LOCKED:       {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_RELEASED:     {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_DRAINING:     {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_KEEPALIVE:    {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_SERVER_MIN_ONLINE:   {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_CONFIG_PROFILE:      {http.StatusConflict, grpcFailedPrecondition},
+	errco.ERROR_HANDOVER:            {http.StatusConflict, grpcFailedPrecondition},
+
+	// limits
+	errco.ERROR_WAKE_LIMIT:     {http.StatusTooManyRequests, grpcResourceExhausted},
+	errco.ERROR_WAKE_COOLDOWN:  {http.StatusTooManyRequests, grpcResourceExhausted},
+	errco.ERROR_QUOTA_EXCEEDED: {http.StatusTooManyRequests, grpcResourceExhausted},
+
+	// not available
+	errco.ERROR_EXECUTE_TIMEOUT:      {http.StatusGatewayTimeout, grpcDeadlineExceeded},
+	errco.ERROR_OS_NOT_SUPPORTED:     {http.StatusNotImplemented, grpcUnimplemented},
+	errco.ERROR_SYSMON_NOT_SUPPORTED: {http.StatusNotImplemented, grpcUnimplemented},
+	errco.ERROR_CHAOS_INJECTED:       {http.StatusServiceUnavailable, grpcUnavailable},
+}
+
+// statusOf returns the status codes of the api responses for the msh error
+func statusOf(errMsh *errco.Error) errStatus {
+	if s, ok := errStatuses[errMsh.Cod]; ok {
+		return s
+	}
+
+	return errStatus{http.StatusInternalServerError, grpcInternal}
+}
+
+// apiError is the json representation of a msh error in the api responses
+type apiError struct {
+	Error    string `json:"error"`    // trace and message of the error
+	Code     string `json:"code"`     // hex error code (ex: 0x0000f100)
+	Name     string `json:"name"`     // error code name (ex: ERROR_SERVER_NOT_ONLINE)
+	Severity string `json:"severity"` // warning, error or fatal
+	Trace    string `json:"trace"`    // functions that returned the error
+	Message  string `json:"message"`
+}
+
+// newApiError returns the json representation of the msh error
+func newApiError(errMsh *errco.Error) apiError {
+	info := errco.Info(errMsh.Cod)
+
+	return apiError{
+		Error:    errMsh.Ori + ": " + errMsh.Str,
+		Code:     info.Hex,
+		Name:     info.Name,
+		Severity: info.Severity,
+		Trace:    errMsh.Ori,
+		Message:  errMsh.Str,
+	}
+}
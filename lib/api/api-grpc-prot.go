@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoMessage is a protobuf message being encoded
+type protoMessage []byte
+
+// varint appends a varint field (int32, int64, uint64, bool); zero values are omitted
+func (pm *protoMessage) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	*pm = appendUvarint(appendUvarint(*pm, uint64(field)<<3|wireVarint), v)
+}
+
+// double appends a fixed64 double field; zero values are omitted
+func (pm *protoMessage) double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	*pm = appendUvarint(*pm, uint64(field)<<3|wireFixed64)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+	*pm = append(*pm, buf...)
+}
+
+// str appends a string field; empty strings are omitted
+func (pm *protoMessage) str(field int, s string) {
+	if s == "" {
+		return
+	}
+	pm.repeated(field, s)
+}
+
+// repeated appends an element of a repeated string field (empty strings included)
+func (pm *protoMessage) repeated(field int, s string) {
+	*pm = appendUvarint(appendUvarint(*pm, uint64(field)<<3|wireBytes), uint64(len(s)))
+	*pm = append(*pm, s...)
+}
+
+// appendUvarint appends a protobuf varint
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+// protoFields are the fields of a decoded protobuf message (last value of each field)
+type protoFields struct {
+	varints map[int]uint64
+	bytes   map[int][]byte
+}
+
+// decodeProto decodes the varint and length delimited fields of a protobuf message (other fields are skipped)
+func decodeProto(b []byte) (protoFields, error) {
+	pf := protoFields{map[int]uint64{}, map[int][]byte{}}
+
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return pf, errors.New("field key is not valid")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return pf, errors.New("varint field is not valid")
+			}
+			pf.varints[field] = v
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return pf, errors.New("length delimited field is not valid")
+			}
+			pf.bytes[field] = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return pf, errors.New("fixed64 field is not valid")
+			}
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return pf, errors.New("fixed32 field is not valid")
+			}
+			b = b[4:]
+		default:
+			return pf, errors.New("wire type not supported")
+		}
+	}
+
+	return pf, nil
+}
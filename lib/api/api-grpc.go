@@ -0,0 +1,326 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// grpc status codes
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// grpcMaxMessageSize is the maximum size of a grpc request message
+const grpcMaxMessageSize = 1 << 20
+
+// grpcService is the path prefix of the msh grpc service methods (package msh.v1 of msh.proto)
+const grpcService = "/msh.v1.Msh/"
+
+// grpcMethods are the methods of the msh grpc service.
+// A method writes its response messages and returns the error sent as grpc status.
+var grpcMethods = map[string]func(w http.ResponseWriter, r *http.Request, req protoFields) *errco.Error{
+	"Status":      grpcStatus,
+	"Start":       grpcStart,
+	"Freeze":      grpcFreeze,
+	"Exec":        grpcExec,
+	"WatchEvents": grpcWatchEvents,
+}
+
+// GrpcManager starts the msh grpc server (if Api.GrpcPort is set).
+// grpc requires http/2, that the go http server supports only over tls (Api.TLSCertFile and Api.TLSKeyFile
+// or a self-signed certificate generated by msh, Api.TLSClientCAFile for mtls).
+// [goroutine]
+func GrpcManager() {
+	if config.ConfigRuntime.Api.GrpcPort <= 0 {
+		errco.Logln(errco.LVL_D, "GrpcManager: grpc api disabled")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(grpcService, handleGrpc)
+
+	cfg, errMsh := tlsConfig()
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("GrpcManager"))
+		return
+	}
+
+	address := net.JoinHostPort(config.ConfigRuntime.Api.ListenHost, strconv.Itoa(config.ConfigRuntime.Api.GrpcPort))
+	errco.Logln(errco.LVL_D, "listening for grpc requests on %s...", address)
+
+	// use the listener passed by the previous msh process (seamless restart) if any
+	listener, err := handover.Listen("grpc", address)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_API_LISTEN, errco.LVL_B, "GrpcManager", err.Error()))
+		return
+	}
+
+	// certificates are set in the tls config
+	server := &http.Server{Handler: mux, TLSConfig: cfg}
+	err = server.ServeTLS(listener, "", "")
+	if err != nil && !handover.HandedOver() {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_API_LISTEN, errco.LVL_B, "GrpcManager", err.Error()))
+	}
+}
+
+// handleGrpc reads the request message of a grpc call, executes the method and writes the grpc status
+func handleGrpc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleGrpc", "not a grpc request"))
+		return
+	}
+
+	// grpc status (and msh error details) is sent in the trailers
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message, Msh-Error-Code, Msh-Error-Name, Msh-Error-Severity")
+	w.WriteHeader(http.StatusOK)
+
+	method, ok := grpcMethods[strings.TrimPrefix(r.URL.Path, grpcService)]
+	if !ok {
+		writeGrpcStatus(w, grpcUnimplemented, "method not found: "+r.URL.Path)
+		return
+	}
+
+	req, errMsh := readGrpcMessage(r.Body)
+	if errMsh != nil {
+		writeGrpcErr(w, errMsh.AddTrace("handleGrpc"))
+		return
+	}
+
+	errMsh = method(w, r, req)
+	if errMsh != nil {
+		writeGrpcErr(w, errMsh.AddTrace("handleGrpc"))
+		return
+	}
+
+	writeGrpcStatus(w, grpcOK, "")
+}
+
+// grpcStatus responds with the minecraft server status and resource usage
+func grpcStatus(w http.ResponseWriter, r *http.Request, req protoFields) *errco.Error {
+	var msg protoMessage
+
+	servstats.Stats.M.Lock()
+	msg.varint(1, uint64(servstats.Stats.Status))
+	msg.varint(2, uint64(int64(servstats.Stats.PlayerCount)))
+	for _, p := range servstats.Stats.Players {
+		msg.repeated(3, p)
+	}
+	for _, p := range servstats.Stats.LastPlayers {
+		msg.repeated(4, p)
+	}
+	msg.str(5, servstats.Stats.LastWakePlayer)
+	msg.str(6, servstats.Stats.LoadProgress)
+	msg.str(7, servstats.Stats.LoadStage)
+	msg.double(8, servstats.Stats.CPUUsage)
+	msg.varint(9, servstats.Stats.MemoryUsage)
+	servstats.Stats.M.Unlock()
+
+	return writeGrpcMessage(w, msg)
+}
+
+// grpcStart starts the minecraft server (token required)
+func grpcStart(w http.ResponseWriter, r *http.Request, req protoFields) *errco.Error {
+	errMsh := authorizeControl(r)
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcStart")
+	}
+
+	errMsh = servctrl.StartMS(history.By(history.SOURCE_GRPC))
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcStart")
+	}
+
+	return writeGrpcMessage(w, nil)
+}
+
+// grpcFreeze stops the minecraft server (token required)
+func grpcFreeze(w http.ResponseWriter, r *http.Request, req protoFields) *errco.Error {
+	errMsh := authorizeControl(r)
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcFreeze")
+	}
+
+	errMsh = servctrl.StopMS(false, history.By(history.SOURCE_GRPC))
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcFreeze")
+	}
+
+	return writeGrpcMessage(w, nil)
+}
+
+// grpcExec executes a minecraft server command and responds with the captured console output (token required)
+func grpcExec(w http.ResponseWriter, r *http.Request, req protoFields) *errco.Error {
+	token, errMsh := authorize(r)
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcExec")
+	}
+
+	command := string(req.bytes[1])
+	if command == "" || !servctrl.ValidCommand(command) {
+		return errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "grpcExec", "command is not valid")
+	}
+
+	errMsh = commandAllowed(token, command)
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcExec")
+	}
+
+	timeout := int(int32(req.varints[2]))
+	if timeout == 0 {
+		timeout = 5
+	}
+	if timeout < 0 || timeout > 60 {
+		return errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "grpcExec", "timeout_seconds is not valid (1-60)")
+	}
+
+	output, errMsh := servctrl.ExecuteCapture(command, "grpc", nil, 500*time.Millisecond, time.Duration(timeout)*time.Second)
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcExec")
+	}
+
+	var msg protoMessage
+	for _, l := range output {
+		msg.repeated(1, l)
+	}
+
+	return writeGrpcMessage(w, msg)
+}
+
+// grpcWatchEvents streams the msh lifecycle events until the client cancels the call (token required)
+func grpcWatchEvents(w http.ResponseWriter, r *http.Request, req protoFields) *errco.Error {
+	_, errMsh := authorize(r)
+	if errMsh != nil {
+		return errMsh.AddTrace("grpcWatchEvents")
+	}
+
+	eventC := events.Subscribe(100)
+	defer events.Unsubscribe(eventC)
+
+	// send the headers so that the client knows that the stream is open
+	w.(http.Flusher).Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+
+		case e := <-eventC:
+			var msg protoMessage
+			msg.varint(1, uint64(e.Time.UnixNano()/int64(time.Millisecond)))
+			msg.str(2, e.Type)
+			if e.Data != nil {
+				data, err := json.Marshal(e.Data)
+				if err != nil {
+					return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "grpcWatchEvents", err.Error())
+				}
+				msg.str(3, string(data))
+			}
+
+			errMsh := writeGrpcMessage(w, msg)
+			if errMsh != nil {
+				return errMsh.AddTrace("grpcWatchEvents")
+			}
+		}
+	}
+}
+
+// readGrpcMessage reads and decodes the (uncompressed) request message of a grpc call
+func readGrpcMessage(body io.Reader) (protoFields, *errco.Error) {
+	// message prefix: compressed flag (1 byte), message length (4 bytes big endian)
+	prefix := make([]byte, 5)
+	_, err := io.ReadFull(body, prefix)
+	if err != nil {
+		return protoFields{}, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "readGrpcMessage", "request message missing: "+err.Error())
+	}
+	if prefix[0] != 0 {
+		return protoFields{}, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "readGrpcMessage", "compressed messages are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > grpcMaxMessageSize {
+		return protoFields{}, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "readGrpcMessage", fmt.Sprintf("request message is too big: %d bytes", length))
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(body, data)
+	if err != nil {
+		return protoFields{}, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "readGrpcMessage", err.Error())
+	}
+
+	req, err := decodeProto(data)
+	if err != nil {
+		return protoFields{}, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "readGrpcMessage", err.Error())
+	}
+
+	return req, nil
+}
+
+// writeGrpcMessage writes a length prefixed response message of a grpc call
+func writeGrpcMessage(w http.ResponseWriter, msg protoMessage) *errco.Error {
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+
+	_, err := w.Write(append(prefix, msg...))
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "writeGrpcMessage", err.Error())
+	}
+	w.(http.Flusher).Flush()
+
+	return nil
+}
+
+// writeGrpcErr logs the msh error and writes it as grpc status (see errStatuses)
+// with the msh error code, name and severity as trailer metadata
+func writeGrpcErr(w http.ResponseWriter, errMsh *errco.Error) {
+	errco.LogMshErr(errMsh)
+
+	e := newApiError(errMsh)
+	w.Header().Set("Msh-Error-Code", e.Code)
+	w.Header().Set("Msh-Error-Name", e.Name)
+	w.Header().Set("Msh-Error-Severity", e.Severity)
+
+	writeGrpcStatus(w, statusOf(errMsh).grpc, e.Error)
+}
+
+// writeGrpcStatus sets the grpc status trailers of the response
+func writeGrpcStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+
+	// grpc-message is percent encoded
+	encoded := ""
+	for _, b := range []byte(message) {
+		if b < 0x20 || b > 0x7e || b == '%' {
+			encoded += fmt.Sprintf("%%%02X", b)
+		} else {
+			encoded += string(b)
+		}
+	}
+	if encoded != "" {
+		w.Header().Set("Grpc-Message", encoded)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"msh/lib/history"
+	"msh/lib/servstats"
+)
+
+// handleMetrics responds with msh and minecraft server metrics in prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	sum, errMsh := history.Summarize()
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleMetrics"))
+		return
+	}
+
+	servstats.Stats.M.Lock()
+	status, players, cpu, memory := servstats.Stats.Status, servstats.Stats.PlayerCount, servstats.Stats.CPUUsage, servstats.Stats.MemoryUsage
+	servstats.Stats.M.Unlock()
+
+	conns, totals := len(servstats.Conns()), servstats.ProxyTotals.Snapshot()
+
+	metrics := []struct {
+		name  string
+		typ   string
+		help  string
+		value float64
+	}{
+		{"msh_server_status", "gauge", "minecraft server status (0 offline, 1 starting, 2 online, 3 stopping)", float64(status)},
+		{"msh_players_online", "gauge", "players online on the minecraft server", float64(players)},
+		{"msh_server_cpu_usage_percent", "gauge", "minecraft server cpu usage (percentage of 1 core)", cpu},
+		{"msh_server_memory_bytes", "gauge", "minecraft server resident memory", float64(memory)},
+		{"msh_proxy_connections", "gauge", "open proxied connections", float64(conns)},
+		{"msh_proxy_bytes_to_server_total", "counter", "bytes forwarded from clients to the minecraft server", float64(totals.BytesToServer)},
+		{"msh_proxy_bytes_to_clients_total", "counter", "bytes forwarded from the minecraft server to clients", float64(totals.BytesToClient)},
+		{"msh_proxy_packets_to_server_total", "counter", "packets forwarded from clients to the minecraft server (buffered forward)", float64(totals.PacketsToServer)},
+		{"msh_proxy_packets_to_clients_total", "counter", "packets forwarded from the minecraft server to clients (buffered forward)", float64(totals.PacketsToClient)},
+		{"msh_proxy_stalled_connections_total", "counter", "proxied connections closed because the client stalled", float64(totals.Stalled)},
+		{"msh_wakes_total", "counter", "minecraft server starts", float64(sum.Wakes)},
+		{"msh_startup_seconds_avg", "gauge", "average minecraft server startup duration", sum.AvgStartupSeconds},
+		{"msh_player_sessions_total", "counter", "player sessions", float64(sum.PlayerSessions)},
+		{"msh_online_seconds_total", "counter", "time the minecraft server has been running", sum.OnlineHours * 3600},
+		{"msh_hibernated_seconds_total", "counter", "time the minecraft server has been hibernated", sum.HibernatedHours * 3600},
+		{"msh_server_cpu_seconds_total", "counter", "cpu time used by the minecraft server", sum.CPUHours * 3600},
+		{"msh_server_cpu_seconds_saved", "gauge", "estimated cpu time saved by hibernation", sum.CPUHoursSaved * 3600},
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.typ, m.name, m.value)
+	}
+}
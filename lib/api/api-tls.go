@@ -0,0 +1,172 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// self-signed certificate validity and the time before expiration at which it is renewed
+const (
+	selfSignedValidity = 2 * 365 * 24 * time.Hour
+	selfSignedRenew    = 30 * 24 * time.Hour
+)
+
+var (
+	tlsM   sync.Mutex
+	tlsCfg *tls.Config // tls config of the api servers (nil until loaded)
+)
+
+// tlsConfig returns the tls config of the api servers (Api.TLS and Api.GrpcPort):
+// the certificate of Api.TLSCertFile and Api.TLSKeyFile or, if not set, a self-signed certificate generated by msh,
+// and the verification of the client certificates if Api.TLSClientCAFile is set (mtls).
+// The config is loaded only once.
+func tlsConfig() (*tls.Config, *errco.Error) {
+	tlsM.Lock()
+	defer tlsM.Unlock()
+
+	if tlsCfg != nil {
+		return tlsCfg, nil
+	}
+
+	certFile, keyFile := config.ConfigRuntime.Api.TLSCertFile, config.ConfigRuntime.Api.TLSKeyFile
+	if certFile == "" {
+		certFile, keyFile = config.ApiSelfSignedCertFile, config.ApiSelfSignedKeyFile
+		errMsh := ensureSelfSigned(certFile, keyFile)
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("tlsConfig")
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "tlsConfig", err.Error())
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caFile := config.ConfigRuntime.Api.TLSClientCAFile; caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "tlsConfig", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "tlsConfig", "no valid pem certificate found in "+caFile)
+		}
+
+		// the tls handshake fails for clients without a certificate signed by the ca
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		errco.Logln(errco.LVL_D, "tlsConfig: api clients must present a certificate signed by %s", caFile)
+	}
+
+	tlsCfg = cfg
+
+	return tlsCfg, nil
+}
+
+// ensureSelfSigned generates a self-signed certificate for the api if the certificate files do not exist
+// or the certificate expires within selfSignedRenew.
+// The certificate is valid for localhost, the loopback addresses, the host name and Api.ListenHost.
+func ensureSelfSigned(certFile, keyFile string) *errco.Error {
+	if data, err := ioutil.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && time.Until(cert.NotAfter) > selfSignedRenew {
+				if _, err := os.Stat(keyFile); err == nil {
+					errco.Logln(errco.LVL_D, "ensureSelfSigned: using api certificate %s (sha256 fingerprint %s)", certFile, fingerprint(cert.Raw))
+					return nil
+				}
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "ensureSelfSigned", err.Error())
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "ensureSelfSigned", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "msh api"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if host := config.ConfigRuntime.Api.ListenHost; host != "" {
+		if ip := net.ParseIP(host); ip == nil {
+			template.DNSNames = append(template.DNSNames, host)
+		} else if !ip.IsUnspecified() && !ip.IsLoopback() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "ensureSelfSigned", err.Error())
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "ensureSelfSigned", err.Error())
+	}
+
+	// the private key is readable only by the msh user
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "ensureSelfSigned", err.Error())
+	}
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_API_TLS, errco.LVL_B, "ensureSelfSigned", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "generated self-signed api certificate %s (sha256 fingerprint %s)", certFile, fingerprint(der))
+
+	return nil
+}
+
+// fingerprint returns the sha256 fingerprint of a der certificate (ex: "ab:cd:...")
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	h := hex.EncodeToString(sum[:])
+
+	fp := ""
+	for i := 0; i < len(h); i += 2 {
+		if i > 0 {
+			fp += ":"
+		}
+		fp += h[i : i+2]
+	}
+
+	return fp
+}
@@ -0,0 +1,520 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"msh/lib/chaos"
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/progmgr"
+	"msh/lib/security"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+	"msh/lib/usage"
+)
+
+// ApiManager starts the msh api http server (if Api.ListenPort is set)
+// [goroutine]
+func ApiManager() {
+	if config.ConfigRuntime.Api.ListenPort <= 0 {
+		errco.Logln(errco.LVL_D, "ApiManager: api disabled")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/logs", handleLogs)
+	mux.HandleFunc("/api/stats", handleStats)
+	mux.HandleFunc("/api/connections", handleConnections)
+	mux.HandleFunc("/api/waiting", handleWaiting)
+	mux.HandleFunc("/api/security", handleSecurity)
+	mux.HandleFunc("/api/quota/override", handleQuotaOverride)
+	mux.HandleFunc("/api/usage", handleUsage)
+	mux.HandleFunc("/api/history", handleHistory)
+	mux.HandleFunc("/api/command", handleCommand)
+	mux.HandleFunc("/api/restart", handleRestart)
+	mux.HandleFunc("/api/drain", handleDrain)
+	mux.HandleFunc("/api/keepalive", handleKeepAlive)
+	mux.HandleFunc("/api/profile", handleProfile)
+	mux.HandleFunc("/api/console", handleConsole)
+	mux.HandleFunc("/console", handleConsolePage)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	address := net.JoinHostPort(config.ConfigRuntime.Api.ListenHost, strconv.Itoa(config.ConfigRuntime.Api.ListenPort))
+
+	// the api and the web console are served over https if Api.TLS is set
+	server := &http.Server{Handler: mux}
+	if config.ConfigRuntime.Api.TLS {
+		cfg, errMsh := tlsConfig()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("ApiManager"))
+			return
+		}
+		server.TLSConfig = cfg
+	}
+
+	errco.Logln(errco.LVL_D, "listening for api requests on %s (tls: %t)...", address, config.ConfigRuntime.Api.TLS)
+
+	// use the listener passed by the previous msh process (seamless restart) if any
+	listener, err := handover.Listen("api", address)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_API_LISTEN, errco.LVL_B, "ApiManager", err.Error()))
+		return
+	}
+
+	if server.TLSConfig != nil {
+		// certificates are set in the tls config
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && !handover.HandedOver() {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_API_LISTEN, errco.LVL_B, "ApiManager", err.Error()))
+	}
+}
+
+// handleLogs responds with the most recent log lines stored in the log buffer.
+// query parameters:
+// lines	maximum number of lines returned (default 100, 0 for all)
+// since	only lines with a higher sequence number are returned
+// filter	only lines that contain the filter string are returned
+// Requires authorization (Api.Tokens): the log contains the minecraft server console (player names and ips).
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	_, errMsh := authorize(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleLogs"))
+		return
+	}
+
+	var err error
+
+	lines := 100
+	if l := r.URL.Query().Get("lines"); l != "" {
+		lines, err = strconv.Atoi(l)
+		if err != nil {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleLogs", "lines parameter is not valid: "+err.Error()))
+			return
+		}
+	}
+
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleLogs", "since parameter is not valid: "+err.Error()))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Lines []errco.LogLine `json:"lines"`
+	}{
+		errco.LogBuf.Get(lines, since, r.URL.Query().Get("filter")),
+	})
+}
+
+// handleStats responds with the minecraft server status and resource usage
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	servstats.Stats.M.Lock()
+	stats := struct {
+		Status         int      `json:"status"`
+		PlayerCount    int      `json:"playerCount"`
+		Players        []string `json:"players"`
+		LastPlayers    []string `json:"lastPlayers"`
+		LastWakePlayer string   `json:"lastWakePlayer"`
+		LoadProgress   string   `json:"loadProgress"`
+		LoadStage      string   `json:"loadStage"`
+		StartError     string   `json:"startError,omitempty"`
+		StartFix       string   `json:"startFix,omitempty"`
+		CPUUsage       float64  `json:"cpuUsage"`
+		MemoryUsage    uint64   `json:"memoryUsage"`
+	}{
+		servstats.Stats.Status,
+		servstats.Stats.PlayerCount,
+		append([]string{}, servstats.Stats.Players...),
+		append([]string{}, servstats.Stats.LastPlayers...),
+		servstats.Stats.LastWakePlayer,
+		servstats.Stats.LoadProgress,
+		servstats.Stats.LoadStage,
+		servstats.Stats.StartError,
+		servstats.Stats.StartFix,
+		servstats.Stats.CPUUsage,
+		servstats.Stats.MemoryUsage,
+	}
+	servstats.Stats.M.Unlock()
+
+	// inject corrupted status (chaos testing)
+	if chaos.CorruptStatus() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "corrupt`))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleRestart replaces msh with a new msh process without disconnecting players (token required)
+func handleRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleRestart", "method not allowed: "+r.Method))
+		return
+	}
+
+	errMsh := authorizeControl(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleRestart"))
+		return
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		writeErr(w, errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_B, "handleRestart", err.Error()))
+		return
+	}
+
+	errMsh = progmgr.SeamlessRestart(exePath)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleRestart"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Restarted bool `json:"restarted"`
+	}{true})
+}
+
+// handleDrain sets (POST) or ends (DELETE) the draining mode (token required).
+// query parameters:
+// reason	reason shown to players (POST)
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	errMsh := authorizeControl(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleDrain"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		errMsh = servctrl.Drain(r.URL.Query().Get("reason"))
+	case http.MethodDelete:
+		errMsh = servctrl.Undrain()
+	default:
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleDrain", "method not allowed: "+r.Method))
+		return
+	}
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleDrain"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Draining bool `json:"draining"`
+	}{r.Method == http.MethodPost})
+}
+
+// handleKeepAlive sets (POST) or ends (DELETE) the keep-alive override of the empty server hibernation (token required).
+// query parameters:
+// for	keep-alive duration (POST, ex: 2h)
+func handleKeepAlive(w http.ResponseWriter, r *http.Request) {
+	errMsh := authorizeControl(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleKeepAlive"))
+		return
+	}
+
+	var k *servctrl.KeepAliveMode
+
+	switch r.Method {
+	case http.MethodPost:
+		d, err := time.ParseDuration(r.URL.Query().Get("for"))
+		if err != nil {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleKeepAlive", "for parameter is not valid"))
+			return
+		}
+		k, errMsh = servctrl.KeepAlive(d)
+	case http.MethodDelete:
+		errMsh = servctrl.EndKeepAlive()
+	default:
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleKeepAlive", "method not allowed: "+r.Method))
+		return
+	}
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleKeepAlive"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		KeepAlive *servctrl.KeepAliveMode `json:"keepAlive"`
+	}{k})
+}
+
+// handleProfile responds with the active config profile and the available ones (GET)
+// or switches to another config profile, restarting the minecraft server (POST, token required).
+// query parameters:
+// name	config profile to use ("base" for the base config) (POST)
+func handleProfile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		errMsh := authorizeControl(r)
+		if errMsh != nil {
+			writeErr(w, errMsh.AddTrace("handleProfile"))
+			return
+		}
+
+		errMsh = servctrl.UseProfile(r.URL.Query().Get("name"), history.By(history.SOURCE_API))
+		if errMsh != nil {
+			writeErr(w, errMsh.AddTrace("handleProfile"))
+			return
+		}
+	default:
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleProfile", "method not allowed: "+r.Method))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Active   string   `json:"active"`
+		Profiles []string `json:"profiles"`
+	}{config.ConfigDefault.Profile, config.ProfileNames()})
+}
+
+// handleConnections responds with the traffic of the open proxied connections and of all proxied connections.
+// Requires authorization (Api.Tokens): the connections contain the player names and ips.
+func handleConnections(w http.ResponseWriter, r *http.Request) {
+	_, errMsh := authorize(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleConnections"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Connections []servstats.ConnStats `json:"connections"`
+		Totals      servstats.ConnStats   `json:"totals"`
+	}{
+		servstats.Conns(),
+		servstats.ProxyTotals.Snapshot(),
+	})
+}
+
+// handleWaiting responds with the players that tried to join while the minecraft server was starting
+// and did not join the online server yet
+func handleWaiting(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Status  string                    `json:"status"`
+		Players []servstats.WaitingPlayer `json:"players"`
+	}{
+		servstats.StatusName(servstats.Stats.Status),
+		servstats.Waiting(),
+	})
+}
+
+// handleSecurity responds with the clients recently refused for suspicious behavior (security log).
+// Requires authorization (Api.Tokens).
+// query parameters:
+// since	duration of the period to list (default 24h)
+func handleSecurity(w http.ResponseWriter, r *http.Request) {
+	_, errMsh := authorize(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleSecurity"))
+		return
+	}
+
+	since := 24 * time.Hour
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleSecurity", "since parameter is not valid"))
+			return
+		}
+		since = d
+	}
+
+	writeJSON(w, http.StatusOK, security.Recent(time.Now().Add(-since)))
+}
+
+// handleHealthz responds with msh health and minecraft server state
+// (status code 503 if msh is not healthy, 200 also when the minecraft server is hibernating)
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h := servctrl.Health()
+
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, h)
+}
+
+// handleQuotaOverride suspends the playtime quota enforcement.
+// query parameters:
+// token	one of Quota.OverrideTokens
+// hours	duration of the override (default 1)
+func handleQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleQuotaOverride", "method not allowed: "+r.Method))
+		return
+	}
+
+	hours := 1
+	if h := r.URL.Query().Get("hours"); h != "" {
+		var err error
+		hours, err = strconv.Atoi(h)
+		if err != nil || hours <= 0 {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleQuotaOverride", "hours parameter is not valid"))
+			return
+		}
+	}
+
+	errMsh := usage.Override(r.URL.Query().Get("token"), time.Duration(hours)*time.Hour)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleQuotaOverride"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Hours int `json:"hours"`
+	}{hours})
+}
+
+// handleUsage responds with the server online/hibernated hours per calendar month.
+// query parameters:
+// format	json (default) or csv
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		csv, errMsh := usage.ReportCSV()
+		if errMsh != nil {
+			writeErr(w, errMsh.AddTrace("handleUsage"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(csv))
+
+	case "", "json":
+		report, errMsh := usage.Report()
+		if errMsh != nil {
+			writeErr(w, errMsh.AddTrace("handleUsage"))
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+
+	default:
+		writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleUsage", "format parameter is not valid"))
+	}
+}
+
+// handleHistory responds with the aggregated history of wakes, startup durations, player sessions and daily uptime
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	sum, errMsh := history.Summarize()
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleHistory"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sum)
+}
+
+// handleCommand executes a minecraft server command and responds with the captured console output.
+// Requires authorization (Api.Tokens).
+// query parameters:
+// command	minecraft server command
+// match	regex matching the last output line of the command (optional)
+// quiet	milliseconds without output after which the output is considered complete (default 500 if match is not set)
+// timeout	maximum seconds to wait for the output (default 5, max 60)
+func handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, errco.NewErr(errco.ERROR_API_METHOD, errco.LVL_D, "handleCommand", "method not allowed: "+r.Method))
+		return
+	}
+
+	token, errMsh := authorize(r)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleCommand"))
+		return
+	}
+
+	q := r.URL.Query()
+
+	command := q.Get("command")
+	if command == "" || !servctrl.ValidCommand(command) {
+		writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleCommand", "command parameter is not valid"))
+		return
+	}
+
+	errMsh = commandAllowed(token, command)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleCommand"))
+		return
+	}
+
+	var match *regexp.Regexp
+	if m := q.Get("match"); m != "" {
+		var err error
+		match, err = regexp.Compile(m)
+		if err != nil {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleCommand", "match parameter is not valid: "+err.Error()))
+			return
+		}
+	}
+
+	quiet := 0
+	if match == nil {
+		quiet = 500
+	}
+	if qs := q.Get("quiet"); qs != "" {
+		var err error
+		quiet, err = strconv.Atoi(qs)
+		if err != nil || quiet < 0 {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleCommand", "quiet parameter is not valid"))
+			return
+		}
+	}
+
+	timeout := 5
+	if ts := q.Get("timeout"); ts != "" {
+		var err error
+		timeout, err = strconv.Atoi(ts)
+		if err != nil || timeout <= 0 || timeout > 60 {
+			writeErr(w, errco.NewErr(errco.ERROR_API_REQUEST, errco.LVL_D, "handleCommand", "timeout parameter is not valid (1-60)"))
+			return
+		}
+	}
+
+	output, errMsh := servctrl.ExecuteCapture(command, "api", match, time.Duration(quiet)*time.Millisecond, time.Duration(timeout)*time.Second)
+	if errMsh != nil {
+		writeErr(w, errMsh.AddTrace("handleCommand"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Command string   `json:"command"`
+		Output  []string `json:"output"`
+	}{command, output})
+}
+
+// writeJSON writes the status code and the json encoded data to the response
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "writeJSON", err.Error()))
+	}
+}
+
+// writeErr logs the msh error and writes it to the response with the status code of the error (see errStatuses)
+func writeErr(w http.ResponseWriter, errMsh *errco.Error) {
+	errco.LogMshErr(errMsh)
+
+	writeJSON(w, statusOf(errMsh).http, newApiError(errMsh))
+}
@@ -0,0 +1,46 @@
+package chaos
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// chaos package injects failures on purpose (Chaos config section)
+// so that tools built on msh api can be tested without breaking a real server.
+
+// StartFailure returns an error when minecraft server start failures should be injected
+func StartFailure() *errco.Error {
+	if !config.ConfigRuntime.Chaos.FailStart {
+		return nil
+	}
+
+	return errco.NewErr(errco.ERROR_CHAOS_INJECTED, errco.LVL_B, "StartFailure", "injected minecraft server start failure")
+}
+
+// SlowStartup waits the configured amount of time before the minecraft server is considered online
+// [blocking]
+func SlowStartup() {
+	if config.ConfigRuntime.Chaos.SlowStartSeconds <= 0 {
+		return
+	}
+
+	errco.Logln(errco.LVL_B, "chaos: delaying minecraft server startup by %d seconds", config.ConfigRuntime.Chaos.SlowStartSeconds)
+	time.Sleep(time.Duration(config.ConfigRuntime.Chaos.SlowStartSeconds) * time.Second)
+}
+
+// DropConnection returns true when a proxied connection should be dropped
+// (each call has DropConnectionPercent probability of returning true)
+func DropConnection() bool {
+	if config.ConfigRuntime.Chaos.DropConnectionPercent <= 0 {
+		return false
+	}
+
+	return int(time.Now().UnixNano()%100) < config.ConfigRuntime.Chaos.DropConnectionPercent
+}
+
+// CorruptStatus returns true when status responses should be corrupted
+func CorruptStatus() bool {
+	return config.ConfigRuntime.Chaos.CorruptStatus
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// serverJarRe matches the names of the usual minecraft server jars
+// (preferred when the server folder contains several jars, ex: libraries or installers)
+var serverJarRe = regexp.MustCompile(`(?i)server|paper|purpur|spigot|fabric|forge|quilt|minecraft`)
+
+// initConfig is the first-run setup wizard: it detects the server jar, reads server.properties, asks a handful of questions
+// (server folder, ports, memory, idle timeout) and writes a valid config file.
+// The existing config file is used as starting point, otherwise the default configuration.
+// Answers are read from stdin (the default answer is used for empty answers and when stdin ends).
+// [blocking]
+func initConfig(args []string) *errco.Error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	folder := fs.String("folder", ".", "Specify the minecraft server folder proposed.")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "initConfig", err.Error())
+	}
+
+	// only the wizard is printed
+	errco.DebugLvl = errco.LVL_A
+
+	in := bufio.NewReader(os.Stdin)
+
+	errMsh := config.ConfigDefaultFileRead()
+	if errMsh == nil {
+		fmt.Println("msh-config.json found: its parameters are proposed and the other parameters are kept")
+	} else {
+		config.ConfigDefault, errMsh = config.DefaultConfig()
+		if errMsh != nil {
+			return errMsh.AddTrace("initConfig")
+		}
+	}
+	cfg := &config.ConfigDefault
+
+	// ------------- server folder and jar ------------- //
+
+	if info, err := os.Stat(cfg.Server.Folder); err != nil || !info.IsDir() {
+		cfg.Server.Folder = *folder
+	}
+	cfg.Server.Folder = ask(in, "minecraft server folder", cfg.Server.Folder)
+	if abs, err := filepath.Abs(cfg.Server.Folder); err == nil {
+		cfg.Server.Folder = abs
+	}
+	if info, err := os.Stat(cfg.Server.Folder); err != nil || !info.IsDir() {
+		fmt.Printf("warning: %s is not an existing folder\n", cfg.Server.Folder)
+	}
+
+	jars, _ := filepath.Glob(filepath.Join(cfg.Server.Folder, "*.jar"))
+	if len(jars) > 0 {
+		jar := filepath.Base(jars[0])
+		for _, j := range jars {
+			if serverJarRe.MatchString(filepath.Base(j)) {
+				jar = filepath.Base(j)
+				break
+			}
+		}
+		fmt.Printf("server jars found: %d\n", len(jars))
+		cfg.Server.FileName = ask(in, "minecraft server jar", jar)
+	} else {
+		fmt.Println("no server jar found in the server folder: msh can download it on first start")
+		if cfg.Provision.Flavor == "" {
+			cfg.Provision.Flavor = "vanilla"
+		}
+		cfg.Provision.Flavor = ask(in, "server jar to download (vanilla - paper - fabric, none to skip)", cfg.Provision.Flavor)
+		if cfg.Provision.Flavor == "none" {
+			cfg.Provision.Flavor = ""
+			cfg.Server.FileName = ask(in, "minecraft server jar", cfg.Server.FileName)
+		} else {
+			cfg.Server.FileName = "server.jar"
+			cfg.Provision.AcceptEula = ask(in, "accept the minecraft EULA (https://aka.ms/MinecraftEULA)? (yes - no)", "no") == "yes"
+			if !cfg.Provision.AcceptEula {
+				fmt.Println("warning: the minecraft server does not start until the EULA is accepted (Provision.AcceptEula)")
+			}
+		}
+	}
+
+	// ---------------- server.properties --------------- //
+
+	config.ConfigRuntime.Server.Folder = cfg.Server.Folder
+	props, errMsh := config.ReadServerProperties()
+	if errMsh == nil {
+		fmt.Printf("server.properties: server-port %s, max-players %s, motd \"%s\"\n", props["server-port"], props["max-players"], props["motd"])
+	} else {
+		fmt.Println("server.properties not found: it's created with the minecraft server port")
+		props = map[string]string{}
+	}
+
+	// ---------------------- ports --------------------- //
+
+	cfg.Msh.ListenPort = askInt(in, "msh port (players connect to this port)", cfg.Msh.ListenPort)
+
+	serverPort, err := strconv.Atoi(props["server-port"])
+	if err != nil {
+		// minecraft server default
+		serverPort = 25565
+	}
+	if serverPort == cfg.Msh.ListenPort || props["server-port"] == "" {
+		if serverPort == cfg.Msh.ListenPort {
+			serverPort++
+		}
+		serverPort = askInt(in, "minecraft server port (server-port, reached by players only through msh)", serverPort)
+		errMsh = config.SetServerPort(serverPort)
+		if errMsh != nil {
+			fmt.Println("warning: server-port not written to server.properties: " + errMsh.Str)
+		}
+	}
+
+	// ---------------- memory and idle ----------------- //
+
+	memory := askInt(in, "minecraft server memory (GB)", 2)
+	cfg.Commands.StartServerParam = fmt.Sprintf("-Xmx%dG -Xms%dG", memory, memory)
+	if !strings.Contains(cfg.Commands.StartServer, "<Commands.StartServerParam>") {
+		if cfg.Commands.StartServer == "" || strings.HasPrefix(cfg.Commands.StartServer, "java ") {
+			cfg.Commands.StartServer = "java <Commands.StartServerParam> -jar <Server.FileName> nogui"
+		} else {
+			fmt.Println("warning: custom Commands.StartServer does not contain <Commands.StartServerParam>: memory not applied")
+		}
+	}
+
+	cfg.Msh.TimeBeforeStoppingEmptyServer = int64(askInt(in, "seconds before the empty server hibernates", int(cfg.Msh.TimeBeforeStoppingEmptyServer)))
+
+	// ------------------- config file ------------------ //
+
+	errMsh = config.ConfigDefaultFileWrite()
+	if errMsh != nil {
+		return errMsh.AddTrace("initConfig")
+	}
+	fmt.Println("config written to msh-config.json")
+
+	problems := config.Check()
+	if len(problems) == 0 {
+		fmt.Println("config is valid: start msh to hibernate the minecraft server")
+		return nil
+	}
+	fmt.Println("problems to fix before starting msh (check them again with msh config check):")
+	for _, p := range problems {
+		fmt.Printf("- %s\n", errco.Redact(p.Str))
+	}
+
+	return nil
+}
+
+// ask prints question with the default answer and returns the answer read from in
+// (the default answer if the answer is empty or in ended)
+func ask(in *bufio.Reader, question, def string) string {
+	fmt.Printf("%s [%s]: ", question, def)
+
+	line, err := in.ReadString('\n')
+	if err != nil {
+		// stdin ended: the prompt line is terminated
+		fmt.Println()
+	}
+
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+
+	return def
+}
+
+// askInt asks question until the answer is a number (see ask)
+func askInt(in *bufio.Reader, question string, def int) int {
+	for {
+		n, err := strconv.Atoi(ask(in, question, strconv.Itoa(def)))
+		if err == nil {
+			return n
+		}
+		fmt.Println("not a valid number")
+	}
+}
@@ -0,0 +1,619 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+	"msh/lib/usage"
+)
+
+// Run executes the specified msh subcommand (args[0]) and returns when completed
+// (version is the msh version)
+// [blocking]
+func Run(args []string, version string) *errco.Error {
+	switch args[0] {
+	case "logs":
+		errMsh := logs(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "usage":
+		errMsh := usageReport(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "status":
+		errMsh := status()
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "stats":
+		errMsh := stats(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "history":
+		errMsh := auditHistory(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "report":
+		errMsh := report(args[1:], version)
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "lock":
+		errMsh := lock(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "unlock":
+		errMsh := servctrl.Unlock()
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "drain":
+		errMsh := drain(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "undrain":
+		errMsh := servctrl.Undrain()
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "keepalive":
+		errMsh := keepAlive(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "errors":
+		errMsh := errorCodes(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "config":
+		errMsh := configCmd(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	case "init":
+		errMsh := initConfig(args[1:])
+		if errMsh != nil {
+			return errMsh.AddTrace("Run")
+		}
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "Run", "unknown subcommand: "+args[0]+" (logs - status - usage - stats - history - report - lock - unlock - drain - undrain - keepalive - errors - config - init)")
+	}
+
+	return nil
+}
+
+// logs prints the log lines of the running msh instance retrieved from its api.
+// With -tail, new log lines are printed as soon as they are available.
+// [blocking]
+func logs(args []string) *errco.Error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	lines := fs.Int("lines", 100, "Specify the number of log lines to print (0 for all).")
+	filter := fs.String("filter", "", "Specify a string that printed log lines must contain.")
+	tail := fs.Bool("tail", false, "Keep printing new log lines.")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "logs", err.Error())
+	}
+
+	address, errMsh := apiAddress()
+	if errMsh != nil {
+		return errMsh.AddTrace("logs")
+	}
+
+	var since uint64
+
+	for {
+		logLines := struct {
+			Lines []errco.LogLine `json:"lines"`
+		}{}
+
+		query := url.Values{}
+		query.Set("lines", strconv.Itoa(*lines))
+		query.Set("since", strconv.FormatUint(since, 10))
+		query.Set("filter", *filter)
+
+		errMsh := apiGet(address, "/api/logs?"+query.Encode(), &logLines)
+		if errMsh != nil {
+			return errMsh.AddTrace("logs")
+		}
+
+		for _, l := range logLines.Lines {
+			// not using errco.Logln since log lines already contain log time
+			fmt.Printf("%s [%-5s] %s\n", l.Time.Format("2006/01/02 15:04:05"), l.Type, l.Text)
+			since = l.Seq
+		}
+
+		if !*tail {
+			return nil
+		}
+
+		// when tailing, all new lines are requested
+		*lines = 0
+		time.Sleep(time.Second)
+	}
+}
+
+// status prints the minecraft server status and online players of the running msh instance retrieved from its api
+// [blocking]
+func status() *errco.Error {
+	address, errMsh := apiAddress()
+	if errMsh != nil {
+		return errMsh.AddTrace("status")
+	}
+
+	stats := struct {
+		Status      int      `json:"status"`
+		PlayerCount int      `json:"playerCount"`
+		Players     []string `json:"players"`
+		LastPlayers []string `json:"lastPlayers"`
+		StartError  string   `json:"startError"`
+		StartFix    string   `json:"startFix"`
+	}{}
+	errMsh = apiGet(address, "/api/stats", &stats)
+	if errMsh != nil {
+		return errMsh.AddTrace("status")
+	}
+
+	fmt.Printf("minecraft server: %s\n", servstats.StatusName(stats.Status))
+	fmt.Printf("players online:   %d %s\n", stats.PlayerCount, strings.Join(stats.Players, ", "))
+	if len(stats.LastPlayers) > 0 {
+		fmt.Printf("last online:      %s\n", strings.Join(stats.LastPlayers, ", "))
+	}
+	if stats.StartError != "" {
+		fmt.Printf("startup failed:   %s\n", stats.StartError)
+		fmt.Printf("suggested fix:    %s\n", stats.StartFix)
+	}
+
+	return nil
+}
+
+// lock prevents the minecraft server managed by msh from waking up until unlocked (or for the specified duration).
+// A running minecraft server is not stopped: use the "msh freeze" console command.
+// [blocking]
+func lock(args []string) *errco.Error {
+	fs := flag.NewFlagSet("lock", flag.ContinueOnError)
+	d := fs.Duration("for", 0, "Specify the lock duration (0 to lock until unlocked).")
+	reason := fs.String("reason", "", "Specify the reason shown to players.")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "lock", err.Error())
+	}
+
+	errMsh := servctrl.Lock(*d, *reason)
+	if errMsh != nil {
+		return errMsh.AddTrace("lock")
+	}
+
+	return nil
+}
+
+// drain puts the msh instance in draining mode: players already connected keep playing,
+// new connections get the maintenance message and the minecraft server is frozen as soon as it's empty.
+// [blocking]
+func drain(args []string) *errco.Error {
+	fs := flag.NewFlagSet("drain", flag.ContinueOnError)
+	reason := fs.String("reason", "", "Specify the reason shown to players.")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "drain", err.Error())
+	}
+
+	errMsh := servctrl.Drain(*reason)
+	if errMsh != nil {
+		return errMsh.AddTrace("drain")
+	}
+
+	return nil
+}
+
+// keepAlive suspends the hibernation of the empty minecraft server managed by msh for the specified duration
+// ("off" to end the keep-alive)
+// [blocking]
+func keepAlive(args []string) *errco.Error {
+	if len(args) != 1 {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "keepAlive", "usage: msh keepalive <duration|off>")
+	}
+
+	_, errMsh := servctrl.KeepAliveCommand(args[0])
+	if errMsh != nil {
+		return errMsh.AddTrace("keepAlive")
+	}
+
+	return nil
+}
+
+// usageReport prints the server online/hibernated hours per calendar month reading the usage file
+// [blocking]
+func usageReport(args []string) *errco.Error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	format := fs.String("format", "csv", "Specify the output format (csv - json).")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "usageReport", err.Error())
+	}
+
+	switch *format {
+	case "csv":
+		csv, errMsh := usage.ReportCSV()
+		if errMsh != nil {
+			return errMsh.AddTrace("usageReport")
+		}
+		fmt.Print(csv)
+
+	case "json":
+		report, errMsh := usage.Report()
+		if errMsh != nil {
+			return errMsh.AddTrace("usageReport")
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_A, "usageReport", err.Error())
+		}
+		fmt.Println(string(data))
+
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "usageReport", "unknown format: "+*format)
+	}
+
+	return nil
+}
+
+// stats prints wakes, startup durations, player sessions and uptime reading the history file
+// [blocking]
+func stats(args []string) *errco.Error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	format := fs.String("format", "text", "Specify the output format (text - json).")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "stats", err.Error())
+	}
+
+	sum, errMsh := history.Summarize()
+	if errMsh != nil {
+		return errMsh.AddTrace("stats")
+	}
+
+	switch *format {
+	case "text":
+		fmt.Print(sum.Text())
+
+	case "json":
+		data, err := json.MarshalIndent(sum, "", "  ")
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_A, "stats", err.Error())
+		}
+		fmt.Println(string(data))
+
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "stats", "unknown format: "+*format)
+	}
+
+	return nil
+}
+
+// reportPeriods are the days covered by the uptime report periods
+var reportPeriods = map[string]int{"day": 1, "week": 7, "month": 30}
+
+// uptimeReport prints online/hibernated hours, estimated savings, wakes, startup time and peak players
+// of the last day, week or month reading the history file
+// [blocking]
+func uptimeReport(period string, args []string) *errco.Error {
+	days, ok := reportPeriods[period]
+	if !ok {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "uptimeReport", "unknown report period: "+period+" (day - week - month)")
+	}
+
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("format", "text", "Specify the output format (text - json).")
+	coreWatts := fs.Float64("core-watts", 10, "Specify the power drawn by a busy cpu core (W) to estimate the energy saved.")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "uptimeReport", err.Error())
+	}
+
+	r, errMsh := history.PeriodReport(days, *coreWatts)
+	if errMsh != nil {
+		return errMsh.AddTrace("uptimeReport")
+	}
+
+	switch *format {
+	case "text":
+		fmt.Print(r.Text())
+
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_A, "uptimeReport", err.Error())
+		}
+		fmt.Println(string(data))
+
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "uptimeReport", "unknown format: "+*format)
+	}
+
+	return nil
+}
+
+// auditHistory prints who or what woke and froze the minecraft server (audit file)
+// [blocking]
+func auditHistory(args []string) *errco.Error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	since := fs.Duration("since", 7*24*time.Hour, "Specify how far back entries are printed (0 for all).")
+	action := fs.String("action", "", "Specify the action of printed entries (wake - freeze - crash).")
+	who := fs.String("who", "", "Specify the player name or ip of printed entries.")
+	format := fs.String("format", "text", "Specify the output format (text - json).")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "auditHistory", err.Error())
+	}
+
+	var sinceT time.Time
+	if *since > 0 {
+		sinceT = time.Now().Add(-*since)
+	}
+
+	entries, errMsh := history.AuditLog(sinceT, *action, *who)
+	if errMsh != nil {
+		return errMsh.AddTrace("auditHistory")
+	}
+
+	switch *format {
+	case "text":
+		fmt.Print(history.AuditText(entries))
+
+	case "json":
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_A, "auditHistory", err.Error())
+		}
+		fmt.Println(string(data))
+
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "auditHistory", "unknown format: "+*format)
+	}
+
+	return nil
+}
+
+// errorCodes prints the registry of msh error codes (code, severity, category, exit code and description)
+// [blocking]
+func errorCodes(args []string) *errco.Error {
+	fs := flag.NewFlagSet("errors", flag.ContinueOnError)
+	format := fs.String("format", "text", "Specify the output format (text - json).")
+	err := fs.Parse(args)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "errorCodes", err.Error())
+	}
+
+	switch *format {
+	case "text":
+		fmt.Printf("%-10s  %-27s  %-8s  %-9s  %-4s  %s\n", "CODE", "NAME", "SEVERITY", "CATEGORY", "EXIT", "DESCRIPTION")
+		for _, info := range errco.Registry() {
+			fmt.Printf("%-10s  %-27s  %-8s  %-9s  %-4d  %s\n", info.Hex, info.Name, info.Severity, info.Category, info.Exit, info.Desc)
+		}
+
+	case "json":
+		data, err := json.MarshalIndent(errco.Registry(), "", "  ")
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_A, "errorCodes", err.Error())
+		}
+		fmt.Println(string(data))
+
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "errorCodes", "unknown format: "+*format)
+	}
+
+	return nil
+}
+
+// apiAddress returns the api url of the running msh instance reading it from the config file (ex: https://127.0.0.1:8080)
+func apiAddress() (string, *errco.Error) {
+	errMsh := config.ConfigDefaultFileRead()
+	if errMsh != nil {
+		return "", errMsh.AddTrace("apiAddress")
+	}
+	if config.ConfigDefault.Api.ListenPort <= 0 {
+		return "", errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiAddress", "msh api is disabled (set Api.ListenPort in config)")
+	}
+
+	// if the api listens on all interfaces, connect through localhost
+	host := config.ConfigDefault.Api.ListenHost
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http://"
+	if config.ConfigDefault.Api.TLS {
+		scheme = "https://"
+	}
+
+	return scheme + net.JoinHostPort(host, strconv.Itoa(config.ConfigDefault.Api.ListenPort)), nil
+}
+
+// apiGetResponse sends a GET request to the api of the running msh instance,
+// authenticated with the first of Api.Tokens (if set)
+func apiGetResponse(address, path string) (*http.Response, *errco.Error) {
+	client, errMsh := apiClient()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("apiGetResponse")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, address+path, nil)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiGetResponse", err.Error())
+	}
+
+	if len(config.ConfigDefault.Api.Tokens) > 0 {
+		token, errMsh := config.ResolveRef(config.ConfigDefault.Api.Tokens[0])
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("apiGetResponse")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiGetResponse", err.Error())
+	}
+
+	return resp, nil
+}
+
+// apiClient returns the http client for the api of the running msh instance.
+// If Api.TLS is set, only the api certificate (Api.TLSCertFile or the self-signed certificate generated by msh)
+// is trusted and, if set, the client certificate Api.CliCertFile is presented (mtls).
+func apiClient() (*http.Client, *errco.Error) {
+	client := &http.Client{Timeout: 4 * time.Second}
+	if !config.ConfigDefault.Api.TLS {
+		return client, nil
+	}
+
+	certFile := config.ConfigDefault.Api.TLSCertFile
+	if certFile == "" {
+		certFile = config.ApiSelfSignedCertFile
+	}
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiClient", "api certificate can't be read: "+err.Error())
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiClient", "api certificate is not a valid pem certificate: "+certFile)
+	}
+	apiCert := block.Bytes
+
+	tlsConfig := &tls.Config{
+		// the certificate is pinned instead of verified: the api is contacted through a loopback address
+		// that the certificate might not be valid for
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], apiCert) {
+				return fmt.Errorf("api certificate does not match %s", certFile)
+			}
+			return nil
+		},
+	}
+
+	if config.ConfigDefault.Api.CliCertFile != "" {
+		pair, err := tls.LoadX509KeyPair(config.ConfigDefault.Api.CliCertFile, config.ConfigDefault.Api.CliKeyFile)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiClient", "client certificate can't be loaded: "+err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+
+	return client, nil
+}
+
+// apiGet sends a GET request to the api of the running msh instance and decodes the json response into data
+func apiGet(address, path string, data interface{}) *errco.Error {
+	resp, errMsh := apiGetResponse(address, path)
+	if errMsh != nil {
+		return errMsh.AddTrace("apiGet")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// the api responds with the msh error that caused the failure
+		var apiErr struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Name != "" {
+			return errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiGet", "api responded with status: "+resp.Status+": "+apiErr.Name+": "+apiErr.Message)
+		}
+		return errco.NewErr(errco.ERROR_CLI_API_CALL, errco.LVL_A, "apiGet", "api responded with status: "+resp.Status)
+	}
+
+	err := json.NewDecoder(resp.Body).Decode(data)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_A, "apiGet", err.Error())
+	}
+
+	return nil
+}
+
+// configCmd executes the config subcommand:
+//
+//	check	validate the config file and print the problems found (exit code 2 if there are problems)
+//
+// [blocking]
+func configCmd(args []string) *errco.Error {
+	if len(args) == 0 || args[0] != "check" {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "configCmd", "specify config subcommand (check)")
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	format := fs.String("format", "text", "Specify the output format (text - json).")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "configCmd", err.Error())
+	}
+
+	// only the report is printed
+	errco.DebugLvl = errco.LVL_A
+
+	type problem struct {
+		errco.ErrInfo
+		Origin  string `json:"origin"`
+		Message string `json:"message"`
+	}
+	problems := []problem{}
+	for _, errMsh := range config.Check() {
+		problems = append(problems, problem{errco.Info(errMsh.Cod), errMsh.Ori, errco.Redact(errMsh.Str)})
+	}
+
+	switch *format {
+	case "text":
+		if len(problems) == 0 {
+			fmt.Println("config is valid")
+			break
+		}
+		fmt.Printf("%-10s  %-27s  %-8s  %s\n", "CODE", "NAME", "SEVERITY", "PROBLEM")
+		for _, p := range problems {
+			fmt.Printf("%-10s  %-27s  %-8s  %s\n", p.Hex, p.Name, p.Severity, p.Message)
+		}
+
+	case "json":
+		data, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_A, "configCmd", err.Error())
+		}
+		fmt.Println(string(data))
+
+	default:
+		return errco.NewErr(errco.ERROR_CLI_COMMAND, errco.LVL_A, "configCmd", "unknown format: "+*format)
+	}
+
+	if len(problems) > 0 {
+		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_A, "configCmd", fmt.Sprintf("%d config problems found", len(problems)))
+	}
+
+	return nil
+}
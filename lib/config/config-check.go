@@ -0,0 +1,140 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"msh/lib/errco"
+)
+
+// Check loads the config file and returns all the problems found in the configuration (msh config check):
+// parameters, ports, paths, start command executable, regexes and time expressions.
+// Unlike LoadConfig, it does not stop at the first problem and does not apply the configuration.
+func Check() []*errco.Error {
+	errMsh := ConfigDefaultFileRead()
+	if errMsh != nil {
+		return []*errco.Error{errMsh.AddTrace("Check")}
+	}
+
+	problems := []*errco.Error{}
+
+	ConfigRuntime, errMsh = profileConfig(ConfigDefault.Profile)
+	if errMsh != nil {
+		problems = append(problems, errMsh.AddTrace("Check"))
+	}
+
+	// the parameters with unresolved secret references are checked as they are
+	errMsh = resolveSecrets()
+	if errMsh != nil {
+		problems = append(problems, errMsh.AddTrace("Check"))
+	}
+
+	// a mirror msh instance does not manage a minecraft server
+	if ConfigRuntime.Mirror.PrimaryApi == "" {
+		problems = append(problems, configProblems()...)
+	}
+
+	for _, r := range ConfigRuntime.Console.Rules {
+		_, err := errco.NewConsoleRule(r.Match, r.Action, r.Color)
+		if err != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "Check", "Console.Rules: "+err.Error()))
+		}
+	}
+
+	errMsh = loadLogProfile()
+	if errMsh != nil {
+		problems = append(problems, errMsh.AddTrace("Check"))
+	}
+
+	problems = append(problems, portProblems()...)
+	problems = append(problems, pathProblems()...)
+
+	return problems
+}
+
+// portProblems returns the problems found checking the msh, api and minecraft server ports
+func portProblems() []*errco.Error {
+	problems := []*errco.Error{}
+
+	ports := []struct {
+		name     string
+		port     int
+		optional bool // 0 disables the listener
+	}{
+		{"Msh.ListenPort", ConfigRuntime.Msh.ListenPort, false},
+		{"Api.ListenPort", ConfigRuntime.Api.ListenPort, true},
+		{"Api.GrpcPort", ConfigRuntime.Api.GrpcPort, true},
+	}
+	used := map[int]string{}
+	for _, p := range ports {
+		switch {
+		case p.optional && p.port == 0:
+			continue
+		case p.port < 1 || p.port > 65535:
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "portProblems", fmt.Sprintf("%s is not a valid port: %d", p.name, p.port)))
+			continue
+		}
+		if other, ok := used[p.port]; ok {
+			problems = append(problems, errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "portProblems", fmt.Sprintf("%s and %s are both %d", other, p.name, p.port)))
+			continue
+		}
+		used[p.port] = p.name
+
+		// the msh port is checked with the minecraft server port
+		if p.name != "Msh.ListenPort" && !portFree(ConfigRuntime.Api.ListenHost, p.port) {
+			problems = append(problems, errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "portProblems", fmt.Sprintf("%s %d is already in use by another process (another msh instance?)", p.name, p.port)))
+		}
+	}
+
+	// ports of mirror instances, kubernetes and pterodactyl servers are not on the msh host
+	if ConfigRuntime.Mirror.PrimaryApi != "" || ConfigRuntime.Server.Backend == "kubernetes" || ConfigRuntime.Server.Backend == "pterodactyl" {
+		return problems
+	}
+
+	// msh port, minecraft server port and server.properties
+	_, _, _, _, errMsh := getIpPorts()
+	if errMsh != nil {
+		return append(problems, errMsh.AddTrace("portProblems"))
+	}
+
+	// the minecraft server port is busy if the minecraft server is running
+	// (docker servers are reached through the published port)
+	if ConfigRuntime.Server.Backend != "docker" && !ConfigRuntime.Msh.AutoPort && !portFree("", TargetPort) {
+		problems = append(problems, errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "portProblems", fmt.Sprintf("minecraft server port %d (server-port in server.properties) is already in use by another process: free it, change server-port or enable Msh.AutoPort", TargetPort)))
+	}
+
+	return problems
+}
+
+// pathProblems returns the problems found checking the files and folders used by msh
+// (the server folder and the start command executable are checked by configProblems)
+func pathProblems() []*errco.Error {
+	problems := []*errco.Error{}
+
+	if f := ConfigRuntime.World.BackupFolder; f != "" {
+		if info, err := os.Stat(f); err != nil || !info.IsDir() {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "pathProblems", "World.BackupFolder is not an existing folder: "+f))
+		}
+	}
+
+	if ConfigRuntime.Api.TLSCertFile != "" || ConfigRuntime.Api.TLSKeyFile != "" {
+		_, err := tls.LoadX509KeyPair(ConfigRuntime.Api.TLSCertFile, ConfigRuntime.Api.TLSKeyFile)
+		if err != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "pathProblems", "Api.TLSCertFile and Api.TLSKeyFile can't be loaded: "+err.Error()))
+		}
+	}
+
+	if f := ConfigRuntime.Api.TLSClientCAFile; f != "" {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "pathProblems", "Api.TLSClientCAFile can't be read: "+err.Error()))
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "pathProblems", "Api.TLSClientCAFile does not contain valid pem certificates: "+f))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// defaultConfigJSON contains the parameters of the default configuration that are not zero values
+// (as in the msh-config.json distributed with msh)
+const defaultConfigJSON string = `{
+	"Server": {"FileName": "server.jar", "Backend": "process"},
+	"Proxy": {"BufferSize": 1024, "StallTimeout": 60},
+	"Docker": {"Host": "unix:///var/run/docker.sock"},
+	"Kubernetes": {"Namespace": "default", "Kind": "deployment", "TargetPort": 25565},
+	"Pterodactyl": {"TargetPort": 25565},
+	"Commands": {
+		"StartServer": "java <Commands.StartServerParam> -jar <Server.FileName> nogui",
+		"StartServerParam": "-Xmx2G -Xms2G",
+		"JavaMemory": {"MinMB": 1024},
+		"StopServer": "stop",
+		"StopServerAllowKill": 10,
+		"StopServerTermGrace": 10,
+		"CrashRestartMax": 3,
+		"CrashRestartDelay": 10,
+		"StartTimeout": 600,
+		"ReadinessProbe": "log",
+		"PreStopCommands": [{"Command": "save-all flush", "Match": "Saved the game", "Timeout": 60}]
+	},
+	"Msh": {
+		"Debug": 1,
+		"Language": "en",
+		"WelcomeBack": "player",
+		"NotifyUpdate": true,
+		"UpdateCheckInterval": 4,
+		"UpdateChannel": "stable",
+		"UpdateUserAgent": "full",
+		"ListenPort": 25565,
+		"TimeBeforeStoppingEmptyServer": 300,
+		"LogBufferSize": 5000,
+		"EventFileMaxSize": 10,
+		"WakeOnPingDebounce": 600,
+		"StatusMaxPlayers": -1,
+		"StatusProtocol": "server"
+	},
+	"LogProfile": {"Preset": "vanilla"},
+	"ScheduledRestart": {"OnlyWhenEmpty": true, "WarningSeconds": 60},
+	"Priority": {"Starting": -5, "Empty": 10},
+	"WakeCooldown": {"PeriodMinutes": 60},
+	"Webhooks": {"MaxRetries": 3},
+	"Notify": {"Gotify": {"Priority": 5}},
+	"Mqtt": {"ClientId": "msh", "TopicPrefix": "msh"},
+	"Wake": {"Imap": {"Mailbox": "INBOX", "Interval": 60}},
+	"Hooks": {"Timeout": 60},
+	"Preflight": {"MinFreeDiskMB": 1024, "CheckJava": true},
+	"Api": {"ListenHost": "127.0.0.1"}
+}`
+
+// DefaultConfig returns the default configuration (msh init uses it when there is no config file to start from)
+func DefaultConfig() (model.Configuration, *errco.Error) {
+	cfg := model.Configuration{}
+	err := json.Unmarshal([]byte(defaultConfigJSON), &cfg)
+	if err != nil {
+		return cfg, errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "DefaultConfig", err.Error())
+	}
+
+	// lists and maps are saved to the config file as empty instead of null (easier to edit)
+	fillEmpty(reflect.ValueOf(&cfg).Elem())
+
+	return cfg, nil
+}
+
+// fillEmpty replaces the nil slices and maps contained in v with empty ones (recursively)
+func fillEmpty(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fillEmpty(v.Field(i))
+		}
+	case reflect.Slice:
+		if v.IsNil() && v.CanSet() && v.Type().Elem().Kind() != reflect.Uint8 {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		for i := 0; i < v.Len(); i++ {
+			fillEmpty(v.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() && v.CanSet() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// javaFlagPresets are the curated java flags presets (Commands.JavaFlags)
+var javaFlagPresets = map[string]string{
+	// Aikar's flags: G1 garbage collector tuned for minecraft servers (https://docs.papermc.io/paper/aikars-flags)
+	"aikar": "-XX:+UseG1GC -XX:+ParallelRefProcEnabled -XX:MaxGCPauseMillis=200 -XX:+UnlockExperimentalVMOptions -XX:+DisableExplicitGC -XX:+AlwaysPreTouch " +
+		"-XX:G1NewSizePercent=30 -XX:G1MaxNewSizePercent=40 -XX:G1HeapRegionSize=8M -XX:G1ReservePercent=20 -XX:G1HeapWastePercent=5 " +
+		"-XX:G1MixedGCCountTarget=4 -XX:InitiatingHeapOccupancyPercent=15 -XX:G1MixedGCLiveThresholdPercent=90 -XX:G1RSetUpdatingPauseTimePercent=5 " +
+		"-XX:SurvivorRatio=32 -XX:+PerfDisableSharedMem -XX:MaxTenuringThreshold=1 -Dusing.aikars.flags=https://mcflags.emc.gs -Daikars.new.flags=true",
+}
+
+// aikarLargeHeap replaces some of Aikar's flags for heaps of 12GB or more
+var aikarLargeHeap = strings.NewReplacer(
+	"-XX:G1NewSizePercent=30", "-XX:G1NewSizePercent=40",
+	"-XX:G1MaxNewSizePercent=40", "-XX:G1MaxNewSizePercent=50",
+	"-XX:G1HeapRegionSize=8M", "-XX:G1HeapRegionSize=16M",
+	"-XX:G1ReservePercent=20", "-XX:G1ReservePercent=15",
+	"-XX:InitiatingHeapOccupancyPercent=15", "-XX:InitiatingHeapOccupancyPercent=20",
+)
+
+// heapFlagRe matches the java heap size flags (replaced when the heap size is computed by msh)
+var heapFlagRe = regexp.MustCompile(`(^|\s)-Xm[sx]\S*`)
+
+// startServerTemplate is Commands.StartServer before its placeholders are replaced
+// (the start command is resolved again at every start when the java parameters are tuned by msh)
+var startServerTemplate string
+
+// resolveStartCommand returns Commands.StartServer with the placeholders replaced (param replaces <Commands.StartServerParam>)
+func resolveStartCommand(param string) string {
+	command := strings.ReplaceAll(startServerTemplate, "<Server.FileName>", ConfigRuntime.Server.FileName)
+	return strings.ReplaceAll(command, "<Commands.StartServerParam>", param)
+}
+
+// StartCommand returns the minecraft server start command.
+// If Commands.JavaMemory or Commands.JavaFlags are set, Commands.StartServerParam is tuned before every start:
+// the heap size is computed from the memory available on the host and the java flags preset is added.
+func StartCommand() string {
+	j := ConfigRuntime.Commands.JavaMemory
+	if j.Percent == 0 && j.HeadroomMB == 0 && ConfigRuntime.Commands.JavaFlags == "" {
+		return ConfigRuntime.Commands.StartServer
+	}
+
+	if !strings.Contains(startServerTemplate, "<Commands.StartServerParam>") {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_JAVA_TUNING, errco.LVL_B, "StartCommand", "Commands.StartServer does not contain <Commands.StartServerParam>: Commands.JavaMemory and Commands.JavaFlags are not applied"))
+		return ConfigRuntime.Commands.StartServer
+	}
+
+	param, errMsh := javaParam()
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("StartCommand"))
+		return ConfigRuntime.Commands.StartServer
+	}
+
+	command := resolveStartCommand(param)
+	errco.Logln(errco.LVL_D, "StartCommand: resolved start command: %s", command)
+
+	return command
+}
+
+// javaParam returns Commands.StartServerParam with the heap size computed by msh (Commands.JavaMemory)
+// and the java flags preset (Commands.JavaFlags)
+func javaParam() (string, *errco.Error) {
+	param := ConfigRuntime.Commands.StartServerParam
+	j := ConfigRuntime.Commands.JavaMemory
+
+	heapMB := 0
+	if j.Percent > 0 || j.HeadroomMB > 0 {
+		available, errMsh := opsys.HostMemAvailable()
+		if errMsh != nil {
+			return "", errMsh.AddTrace("javaParam")
+		}
+		availableMB := int(available / (1024 * 1024))
+
+		// with both percentage and headroom set, the smallest heap is used
+		heapMB = availableMB
+		if j.Percent > 0 {
+			heapMB = availableMB * j.Percent / 100
+		}
+		if j.HeadroomMB > 0 && availableMB-j.HeadroomMB < heapMB {
+			heapMB = availableMB - j.HeadroomMB
+		}
+		if heapMB < j.MinMB {
+			heapMB = j.MinMB
+		}
+		if j.MaxMB > 0 && heapMB > j.MaxMB {
+			heapMB = j.MaxMB
+		}
+		if heapMB <= 0 {
+			return "", errco.NewErr(errco.ERROR_JAVA_TUNING, errco.LVL_B, "javaParam", fmt.Sprintf("not enough host memory available for the minecraft server heap: %d MB available", availableMB))
+		}
+
+		errco.Logln(errco.LVL_B, "java heap size set to %d MB (%d MB available on the host)", heapMB, availableMB)
+
+		// same initial and maximum heap size: the heap is never resized
+		param = strings.TrimSpace(heapFlagRe.ReplaceAllString(param, ""))
+		param = strings.TrimSpace(fmt.Sprintf("-Xms%dM -Xmx%dM %s", heapMB, heapMB, param))
+	}
+
+	if preset := ConfigRuntime.Commands.JavaFlags; preset != "" {
+		flags := javaFlagPresets[preset]
+		if preset == "aikar" && heapMB >= 12*1024 {
+			flags = aikarLargeHeap.Replace(flags)
+		}
+		param += " " + flags
+	}
+
+	return param, nil
+}
+
+// checkJavaTuning returns an error if Commands.JavaMemory or Commands.JavaFlags are not valid
+func checkJavaTuning() *errco.Error {
+	j := ConfigRuntime.Commands.JavaMemory
+	if j.Percent < 0 || j.Percent > 100 || j.HeadroomMB < 0 || j.MinMB < 0 || j.MaxMB < 0 || (j.MaxMB > 0 && j.MaxMB < j.MinMB) {
+		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "checkJavaTuning", "Commands.JavaMemory is not valid: Percent must be 0-100, HeadroomMB, MinMB and MaxMB must not be negative, MaxMB must not be less than MinMB")
+	}
+
+	if preset := ConfigRuntime.Commands.JavaFlags; preset != "" {
+		if _, ok := javaFlagPresets[preset]; !ok {
+			return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "checkJavaTuning", "Commands.JavaFlags is not valid: "+preset+" (aikar)")
+		}
+	}
+
+	return nil
+}
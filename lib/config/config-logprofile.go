@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"msh/lib/errco"
+)
+
+// LogProfile contains the compiled regexes used to parse the minecraft server log
+var LogProfile *logProfile
+
+// logProfile contains the regexes used to parse the minecraft server log.
+// Line splits a log line into header and content, Info is matched against the header,
+// Chat, Join, Login, Leave and Stopping are matched against the content,
+// Done, Progress and Stage are matched against the whole line.
+type logProfile struct {
+	Line     *regexp.Regexp // groups: header, content
+	Info     *regexp.Regexp
+	Chat     *regexp.Regexp
+	Done     *regexp.Regexp
+	Progress *regexp.Regexp // groups: progress
+	Stage    *regexp.Regexp // groups: startup stage
+	Join     *regexp.Regexp // nil if players are counted on login
+	Login    *regexp.Regexp
+	Leave    *regexp.Regexp // groups: player name
+	Stopping *regexp.Regexp
+}
+
+// logProfilePresets are the built-in log profiles (regexes as in the LogProfile config section)
+var logProfilePresets = map[string]map[string]string{
+	"vanilla": {
+		"Line":     `^(.*?): (.*)$`,
+		"Info":     `INFO`,
+		"Chat":     `^[<\[]`,
+		"Done":     `INFO.*: Done \(`,
+		"Progress": `INFO.*Preparing spawn area: (.*)`,
+		"Stage":    `INFO.*?: (Loading \d+ mods|Forge mod loading|Loading libraries|Loading properties|Preparing level|Preparing start region)`,
+		"Join":     `UUID of player`,
+		"Login":    `logged in with entity id`,
+		"Leave":    `^(.*?) lost connection`,
+		"Stopping": `Stopping`,
+	},
+	// plugins, mods and their libraries log "Stopping ..." lines:
+	// only the server shutdown log is used
+	"paper": {
+		"Stopping": `^Stopping (the )?server`,
+	},
+	"forge": {
+		"Stopping": `^Stopping (the )?server`,
+	},
+	"fabric": {
+		"Stopping": `^Stopping (the )?server`,
+	},
+	// minecraft server v1.6 and older:
+	// 2013-07-01 12:00:00 [INFO] Done (3.21s)! For help, type "help" or "?"
+	"legacy": {
+		"Line":     `^(.*?\[[A-Z]+\]) (.*)$`,
+		"Info":     `\[INFO\]`,
+		"Done":     `\[INFO\] Done \(`,
+		"Progress": `\[INFO\] Preparing spawn area: (.*)`,
+		"Stage":    `\[INFO\] (Loading properties|Preparing level|Preparing start region)`,
+		"Join":     ``,
+		"Stopping": `^Stopping (the )?server`,
+	},
+}
+
+// loadLogProfile compiles the log profile selected by LogProfile.Preset with the LogProfile regexes overrides
+func loadLogProfile() *errco.Error {
+	c := ConfigRuntime.LogProfile
+
+	preset := c.Preset
+	if preset == "" {
+		preset = "vanilla"
+	}
+	presetPatterns, ok := logProfilePresets[preset]
+	if !ok {
+		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "loadLogProfile", "LogProfile.Preset is not valid: "+preset+" (vanilla - paper - forge - fabric - legacy)")
+	}
+
+	// presets are vanilla patterns with some replacements,
+	// non empty config regexes replace preset patterns
+	patterns := map[string]string{}
+	for k, v := range logProfilePresets["vanilla"] {
+		patterns[k] = v
+	}
+	for k, v := range presetPatterns {
+		patterns[k] = v
+	}
+	for k, v := range map[string]string{"Line": c.Line, "Info": c.Info, "Chat": c.Chat, "Done": c.Done, "Progress": c.Progress, "Stage": c.Stage, "Join": c.Join, "Login": c.Login, "Leave": c.Leave, "Stopping": c.Stopping} {
+		if v != "" {
+			patterns[k] = v
+		}
+	}
+
+	// required amount of groups for each pattern
+	groups := map[string]int{"Line": 2, "Progress": 1, "Stage": 1, "Leave": 1}
+
+	compiled := map[string]*regexp.Regexp{}
+	for k, v := range patterns {
+		if v == "" {
+			continue
+		}
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "loadLogProfile", fmt.Sprintf("LogProfile.%s is not valid: %s", k, err.Error()))
+		}
+		if re.NumSubexp() < groups[k] {
+			return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "loadLogProfile", fmt.Sprintf("LogProfile.%s must contain %d groups", k, groups[k]))
+		}
+		compiled[k] = re
+	}
+
+	LogProfile = &logProfile{
+		Line:     compiled["Line"],
+		Info:     compiled["Info"],
+		Chat:     compiled["Chat"],
+		Done:     compiled["Done"],
+		Progress: compiled["Progress"],
+		Stage:    compiled["Stage"],
+		Join:     compiled["Join"],
+		Login:    compiled["Login"],
+		Leave:    compiled["Leave"],
+		Stopping: compiled["Stopping"],
+	}
+
+	errco.Logln(errco.LVL_D, "minecraft server log profile: %s", preset)
+
+	return nil
+}
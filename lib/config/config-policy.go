@@ -0,0 +1,91 @@
+package config
+
+import (
+	"strings"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// actions taken by msh on client requests (config Policy)
+const (
+	ACTION_INFO  = "info"  // answer with the msh emulated server status
+	ACTION_WAKE  = "wake"  // start the minecraft server
+	ACTION_PROXY = "proxy" // forward the connection to the minecraft server
+	ACTION_KICK  = "kick"  // disconnect the player with a message
+	ACTION_HOLD  = "hold"  // keep the player connection open until the minecraft server is online
+	ACTION_DENY  = "deny"  // close the connection without answering
+)
+
+// policyActions are the actions allowed for each server state and request type
+// (there is no suspended state: the server is stopped to hibernate, ACTION_INFO answers with the cached status)
+var policyActions = map[string]map[string][]string{
+	"Offline":  {"Status": {ACTION_INFO, ACTION_WAKE, ACTION_DENY}, "Login": {ACTION_WAKE, ACTION_HOLD, ACTION_KICK, ACTION_DENY}},
+	"Starting": {"Status": {ACTION_INFO, ACTION_DENY}, "Login": {ACTION_HOLD, ACTION_KICK, ACTION_DENY}},
+	"Online":   {"Status": {ACTION_INFO, ACTION_PROXY, ACTION_DENY}, "Login": {ACTION_PROXY, ACTION_KICK, ACTION_DENY}},
+	"Stopping": {"Status": {ACTION_INFO, ACTION_DENY}, "Login": {ACTION_KICK, ACTION_DENY}},
+}
+
+// Policy returns the status and login rules of config Policy for the minecraft server status
+// (empty actions are replaced with the default behavior)
+func Policy(status int) (model.PolicyRule, model.PolicyRule) {
+	var state model.PolicyState
+	statusAction, loginAction := ACTION_INFO, ACTION_KICK
+
+	switch status {
+	case errco.SERVER_STATUS_OFFLINE:
+		state = ConfigRuntime.Policy.Offline
+		loginAction = ACTION_WAKE
+		if ConfigRuntime.Msh.WakeOnPing {
+			statusAction = ACTION_WAKE
+		}
+	case errco.SERVER_STATUS_STARTING:
+		state = ConfigRuntime.Policy.Starting
+	case errco.SERVER_STATUS_ONLINE:
+		state = ConfigRuntime.Policy.Online
+		statusAction, loginAction = ACTION_PROXY, ACTION_PROXY
+	case errco.SERVER_STATUS_STOPPING:
+		state = ConfigRuntime.Policy.Stopping
+	}
+
+	if state.Status.Action == "" {
+		state.Status.Action = statusAction
+	}
+	if state.Login.Action == "" {
+		state.Login.Action = loginAction
+	}
+
+	return state.Status, state.Login
+}
+
+// checkPolicy returns an error if an action of config Policy is not allowed
+func checkPolicy() *errco.Error {
+	states := map[string]model.PolicyState{
+		"Offline":  ConfigRuntime.Policy.Offline,
+		"Starting": ConfigRuntime.Policy.Starting,
+		"Online":   ConfigRuntime.Policy.Online,
+		"Stopping": ConfigRuntime.Policy.Stopping,
+	}
+
+	for name, state := range states {
+		for req, action := range map[string]string{"Status": state.Status.Action, "Login": state.Login.Action} {
+			if action == "" || policyAllowed(policyActions[name][req], action) {
+				continue
+			}
+			return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "checkPolicy", "Policy."+name+"."+req+".Action is not valid: "+action+" ("+strings.Join(policyActions[name][req], " - ")+")")
+		}
+	}
+
+	return nil
+}
+
+// policyAllowed returns true if action is one of the allowed actions
+func policyAllowed(allowed []string, action string) bool {
+	for _, a := range allowed {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// maximum amount of ports tried when looking for a free minecraft server port
+const freePortAttempts = 100
+
+// CheckTargetPort verifies that the minecraft server port (server-port of server.properties) is free
+// before the minecraft server is started.
+// If Msh.AutoPort is set, a busy port is replaced with a free port in server.properties.
+func CheckTargetPort() *errco.Error {
+	// ports of docker, kubernetes and pterodactyl backends are not on the msh host
+	if ConfigRuntime.Server.Backend == "docker" || ConfigRuntime.Server.Backend == "kubernetes" || ConfigRuntime.Server.Backend == "pterodactyl" {
+		return nil
+	}
+
+	// the minecraft server listens on all interfaces (if server-ip is not set)
+	if portFree("", TargetPort) {
+		return nil
+	}
+
+	if !ConfigRuntime.Msh.AutoPort {
+		return errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "CheckTargetPort", fmt.Sprintf("minecraft server port %d (server-port in server.properties) is already in use by another process: free it, change server-port or enable Msh.AutoPort", TargetPort))
+	}
+
+	errMsh := negotiatePort(TargetPort)
+	if errMsh != nil {
+		return errMsh.AddTrace("CheckTargetPort")
+	}
+
+	return nil
+}
+
+// negotiatePort chooses a free minecraft server port and writes it to server.properties
+func negotiatePort(busyPort int) *errco.Error {
+	port := -1
+	for p := busyPort + 1; p < busyPort+1+freePortAttempts && p <= 65535; p++ {
+		if p != ConfigRuntime.Msh.ListenPort && portFree("", p) {
+			port = p
+			break
+		}
+	}
+	if port == -1 {
+		return errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "negotiatePort", fmt.Sprintf("no free port found after %d", busyPort))
+	}
+
+	errMsh := SetServerPort(port)
+	if errMsh != nil {
+		return errMsh.AddTrace("negotiatePort")
+	}
+
+	TargetPort = port
+	errco.Logln(errco.LVL_A, "minecraft server port %d is not available: server-port set to %d in server.properties", busyPort, port)
+
+	return nil
+}
+
+// portFree returns true if a listener can be opened on host:port
+func portFree(host string, port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+
+	return true
+}
+
+// SetServerPort writes server-port to server.properties of the server folder
+// (a missing server.properties is created: the minecraft server adds the other properties on start)
+func SetServerPort(port int) *errco.Error {
+	path := filepath.Join(ConfigRuntime.Server.Folder, "server.properties")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "SetServerPort", err.Error())
+	}
+
+	lines := []string{}
+	if len(data) > 0 {
+		lines = strings.Split(string(data), "\n")
+	}
+	found := false
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "server-port=") {
+			lines[i] = "server-port=" + strconv.Itoa(port)
+			if strings.HasSuffix(l, "\r") {
+				lines[i] += "\r"
+			}
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, "server-port="+strconv.Itoa(port))
+	}
+
+	err = ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "SetServerPort", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"sort"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// profileConfig returns ConfigDefault with the config profile applied ("" for the base config).
+// A profile contains only the config parameters that differ from the base config (ex: Server and Commands of another world).
+func profileConfig(name string) (model.Configuration, *errco.Error) {
+	// ConfigDefault is copied through json so that the profile does not modify its slices and maps
+	cfg := model.Configuration{}
+	data, err := json.Marshal(ConfigDefault)
+	if err != nil {
+		return ConfigDefault, errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "profileConfig", err.Error())
+	}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return ConfigDefault, errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "profileConfig", err.Error())
+	}
+
+	if name == "" {
+		return cfg, nil
+	}
+
+	profile, ok := ConfigDefault.Profiles[name]
+	if !ok {
+		return cfg, errco.NewErr(errco.ERROR_CONFIG_PROFILE, errco.LVL_B, "profileConfig", "config profile not found: "+name)
+	}
+	err = json.Unmarshal(profile, &cfg)
+	if err != nil {
+		return cfg, errco.NewErr(errco.ERROR_CONFIG_PROFILE, errco.LVL_B, "profileConfig", "config profile "+name+" is not valid: "+err.Error())
+	}
+
+	return cfg, nil
+}
+
+// ProfileNames returns the names of the config profiles (sorted)
+func ProfileNames() []string {
+	names := []string{}
+	for name := range ConfigDefault.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// UseProfile makes name the active config profile ("" for the base config) and saves it to the config file.
+// ConfigRuntime is reloaded: the minecraft server must be offline.
+// The msh listen port is not changed (profiles share the msh port).
+func UseProfile(name string) *errco.Error {
+	cfg, errMsh := profileConfig(name)
+	if errMsh != nil {
+		return errMsh.AddTrace("UseProfile")
+	}
+
+	// command line arguments have priority over the profile
+	args := map[string]string{}
+	flag.Visit(func(f *flag.Flag) { args[f.Name] = f.Value.String() })
+
+	prev := ConfigRuntime
+	listenHost, listenPort := ListenHost, ListenPort
+
+	ConfigRuntime = cfg
+	for n, v := range args {
+		flag.Set(n, v)
+	}
+	completeConfigRuntime()
+	ConfigRuntime.Msh.ListenPort = prev.Msh.ListenPort
+
+	errMsh = loadConfigRuntime()
+	if errMsh != nil {
+		// restore the previous profile
+		ConfigRuntime = prev
+		if errRestore := loadConfigRuntime(); errRestore != nil {
+			errco.LogMshErr(errRestore.AddTrace("UseProfile"))
+		}
+		ListenHost, ListenPort = listenHost, listenPort
+		return errco.NewErr(errco.ERROR_CONFIG_PROFILE, errco.LVL_B, "UseProfile", "config profile "+name+" can't be loaded: "+errMsh.Str)
+	}
+	ListenHost, ListenPort = listenHost, listenPort
+
+	ConfigDefault.Profile = name
+	errMsh = ConfigDefaultFileWrite()
+	if errMsh != nil {
+		return errMsh.AddTrace("UseProfile")
+	}
+
+	return nil
+}
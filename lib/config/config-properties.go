@@ -0,0 +1,96 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// ReadServerProperties returns the key-value pairs of the minecraft server server.properties file
+func ReadServerProperties() (map[string]string, *errco.Error) {
+	data, err := ioutil.ReadFile(filepath.Join(ConfigRuntime.Server.Folder, "server.properties"))
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_CONFIG_LOAD, errco.LVL_B, "ReadServerProperties", err.Error())
+	}
+
+	props := map[string]string{}
+	for _, l := range strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n") {
+		l = strings.TrimLeft(l, " \t")
+		if l == "" || l[0] == '#' || l[0] == '!' {
+			continue
+		}
+
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		props[strings.TrimSpace(kv[0])] = unescapeProperty(kv[1])
+	}
+
+	return props, nil
+}
+
+// loadServerProperties sets the max players and the base MOTD shown by msh in the status response
+// from server.properties (Msh.StatusMaxPlayers overrides max-players).
+// If server.properties is not accessible (props == nil), max players is 0.
+func loadServerProperties(props map[string]string) {
+	MaxPlayers = 0
+	if props != nil {
+		// minecraft server default
+		MaxPlayers = 20
+	}
+	if n, err := strconv.Atoi(props["max-players"]); err == nil {
+		MaxPlayers = n
+	}
+	if ConfigRuntime.Msh.StatusMaxPlayers >= 0 {
+		MaxPlayers = ConfigRuntime.Msh.StatusMaxPlayers
+	}
+
+	Motd = props["motd"]
+
+	// rcon and management passwords of the minecraft server are redacted from the log output
+	errco.AddSecrets(props["rcon.password"], props["management-server-secret"])
+
+	errco.Logln(errco.LVL_D, "server.properties: max players %d, motd \"%s\"", MaxPlayers, Motd)
+}
+
+// unescapeProperty returns the value of a java properties file entry without escape sequences
+// (ex: "\u00A7bA Minecraft Server" -> "§bA Minecraft Server")
+func unescapeProperty(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+
+	out := []rune{}
+	r := []rune(v)
+	for i := 0; i < len(r); i++ {
+		if r[i] != '\\' || i+1 == len(r) {
+			out = append(out, r[i])
+			continue
+		}
+
+		i++
+		switch r[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			if i+4 < len(r) {
+				if c, err := strconv.ParseUint(string(r[i+1:i+5]), 16, 32); err == nil {
+					out = append(out, rune(c))
+					i += 4
+					continue
+				}
+			}
+			out = append(out, 'u')
+		default:
+			out = append(out, r[i])
+		}
+	}
+
+	return string(out)
+}
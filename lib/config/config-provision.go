@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// prepareProvision prepares the server folder for a server jar provisioned by msh (Provision.Flavor):
+// fills the server file name and start command if not set, creates the server folder,
+// accepts the minecraft eula if Provision.AcceptEula is set and writes a minimal server.properties before the first start.
+func prepareProvision() *errco.Error {
+	p := ConfigRuntime.Provision
+	if p.Flavor == "" {
+		return nil
+	}
+
+	switch p.Flavor {
+	case "vanilla", "paper", "fabric":
+	default:
+		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "prepareProvision", "Provision.Flavor is not valid: "+p.Flavor+" (vanilla - paper - fabric)")
+	}
+	if ConfigRuntime.Server.Backend != "" && ConfigRuntime.Server.Backend != "process" {
+		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "prepareProvision", "Provision requires the process backend")
+	}
+
+	if ConfigRuntime.Server.FileName == "" {
+		ConfigRuntime.Server.FileName = "server.jar"
+	}
+	if strings.TrimSpace(ConfigRuntime.Commands.StartServer) == "" {
+		startServerTemplate = "java <Commands.StartServerParam> -jar <Server.FileName> nogui"
+		ConfigRuntime.Commands.StartServer = strings.Join(strings.Fields(resolveStartCommand(ConfigRuntime.Commands.StartServerParam)), " ")
+		errco.Logln(errco.LVL_B, "start command set to: %s", ConfigRuntime.Commands.StartServer)
+	}
+
+	err := os.MkdirAll(ConfigRuntime.Server.Folder, 0755)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "prepareProvision", "can't create server folder: "+err.Error())
+	}
+
+	// the minecraft server does not start until the eula is accepted
+	if p.AcceptEula {
+		eulaPath := filepath.Join(ConfigRuntime.Server.Folder, "eula.txt")
+		data, _ := ioutil.ReadFile(eulaPath)
+		if !strings.Contains(string(data), "eula=true") {
+			err = ioutil.WriteFile(eulaPath, []byte("# accepted through msh Provision.AcceptEula (https://aka.ms/MinecraftEULA)\neula=true\n"), 0644)
+			if err != nil {
+				return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "prepareProvision", "can't write eula.txt: "+err.Error())
+			}
+			errco.Logln(errco.LVL_A, "minecraft eula accepted (https://aka.ms/MinecraftEULA)")
+		}
+	}
+
+	// server.properties is generated by the minecraft server on its first start,
+	// msh needs the server port before: the minecraft server completes the file
+	propsPath := filepath.Join(ConfigRuntime.Server.Folder, "server.properties")
+	if _, err = os.Stat(propsPath); os.IsNotExist(err) {
+		err = ioutil.WriteFile(propsPath, []byte("server-port=25565\n"), 0644)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "prepareProvision", "can't write server.properties: "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ProvisionPending returns true if the server jar is provisioned by msh (Provision.Flavor) and was not downloaded yet
+func ProvisionPending() bool {
+	if ConfigRuntime.Provision.Flavor == "" {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(ConfigRuntime.Server.Folder, ConfigRuntime.Server.FileName))
+	return os.IsNotExist(err)
+}
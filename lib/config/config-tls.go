@@ -0,0 +1,8 @@
+package config
+
+// files of the self-signed certificate generated by msh for the api if Api.TLSCertFile and Api.TLSKeyFile are not set
+// (relative to msh working directory)
+const (
+	ApiSelfSignedCertFile = "msh-api-cert.pem"
+	ApiSelfSignedKeyFile  = "msh-api-key.pem"
+)
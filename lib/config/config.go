@@ -5,16 +5,21 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"msh/lib/errco"
+	"msh/lib/handover"
+	"msh/lib/locale"
 	"msh/lib/model"
 	"msh/lib/opsys"
-	"msh/lib/utility"
 )
 
 // configFileName is the config file name
@@ -28,6 +33,16 @@ var (
 	// ServerIcon contains the minecraft server icon
 	ServerIcon string
 
+	// ServerIconFrozen is true if ServerIcon is the user specified server-icon-frozen.png
+	ServerIconFrozen bool
+
+	// MaxPlayers and Motd of the minecraft server (server.properties) shown in the status response
+	MaxPlayers int
+	Motd       string
+
+	// dryRun is set by the dry-run argument (fake minecraft server)
+	dryRun *bool
+
 	// Listen and Target host/port used for proxy connection
 	ListenHost string = "0.0.0.0"
 	ListenPort int
@@ -58,11 +73,39 @@ func LoadConfig() *errco.Error {
 	// --------------- ConfigRuntime --------------- //
 	// from now on only ConfigRuntime should be used //
 
+	errMsh = loadConfigRuntime()
+	if errMsh != nil {
+		return errMsh.AddTrace("LoadConfig")
+	}
+
+	return nil
+}
+
+// loadConfigRuntime checks ConfigRuntime and loads the settings that depend on it
+// (log level, language, console rules, log profile, ip and ports, server infos and icon)
+func loadConfigRuntime() *errco.Error {
+	var errMsh *errco.Error
+
 	errco.Logln(errco.LVL_D, "loading config runtime...")
 
-	errMsh = checkConfigRuntime()
+	// resolve the secret references (${env:NAME}, ${file:path}) before the config is used
+	errMsh = resolveSecrets()
 	if errMsh != nil {
-		return errMsh.AddTrace("LoadConfig")
+		return errMsh.AddTrace("loadConfigRuntime")
+	}
+
+	// a mirror msh instance does not manage a minecraft server
+	if ConfigRuntime.Mirror.PrimaryApi == "" {
+		// prepare the server folder if the server jar is provisioned by msh
+		errMsh = prepareProvision()
+		if errMsh != nil {
+			return errMsh.AddTrace("loadConfigRuntime")
+		}
+
+		errMsh = checkConfigRuntime()
+		if errMsh != nil {
+			return errMsh.AddTrace("loadConfigRuntime")
+		}
 	}
 
 	// as soon as the Config variable is set, set debug level
@@ -70,21 +113,91 @@ func LoadConfig() *errco.Error {
 	errco.DebugLvl = ConfigRuntime.Msh.Debug
 	// LVL_A log level is used to always notice the user of the log level
 	errco.Logln(errco.LVL_A, "log level set to: %d", errco.DebugLvl)
+	errco.LogBuf.SetSize(ConfigRuntime.Msh.LogBufferSize)
 
-	// initialize ip and ports for connection
-	ListenHost, ListenPort, TargetHost, TargetPort, errMsh = getIpPorts()
+	// load player-facing messages in the configured language
+	errMsh = locale.Load(ConfigRuntime.Msh.Language)
 	if errMsh != nil {
-		return errMsh.AddTrace("LoadConfig")
+		// messages fall back to english
+		errco.LogMshErr(errMsh.AddTrace("loadConfigRuntime"))
+	}
+
+	// load minecraft server console rules
+	rules := []*errco.ConsoleRule{}
+	for _, r := range ConfigRuntime.Console.Rules {
+		rule, err := errco.NewConsoleRule(r.Match, r.Action, r.Color)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "loadConfigRuntime", "Console.Rules: "+err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	errco.SetConsoleRules(rules)
+
+	// load minecraft server log parsing regexes
+	errMsh = loadLogProfile()
+	if errMsh != nil {
+		return errMsh.AddTrace("loadConfigRuntime")
+	}
+
+	// warn the user that failures are injected on purpose
+	if ConfigRuntime.Chaos.FailStart || ConfigRuntime.Chaos.SlowStartSeconds > 0 || ConfigRuntime.Chaos.DropConnectionPercent > 0 || ConfigRuntime.Chaos.CorruptStatus {
+		errco.Logln(errco.LVL_A, "chaos testing enabled: msh will inject failures on purpose")
+	}
+
+	// initialize ip and ports for connection
+	switch {
+	case ConfigRuntime.Mirror.PrimaryApi != "":
+		ListenPort = ConfigRuntime.Msh.ListenPort
+		errco.Logln(errco.LVL_B, "msh running as mirror of %s", ConfigRuntime.Mirror.PrimaryApi)
+	case ConfigRuntime.Server.Backend == "kubernetes":
+		// the minecraft server is reached through its kubernetes service
+		ListenPort = ConfigRuntime.Msh.ListenPort
+		TargetHost, TargetPort = ConfigRuntime.Kubernetes.TargetHost, ConfigRuntime.Kubernetes.TargetPort
+		// server.properties is not accessible
+		loadServerProperties(nil)
+	case ConfigRuntime.Server.Backend == "pterodactyl":
+		// the minecraft server is reached through its panel allocation
+		ListenPort = ConfigRuntime.Msh.ListenPort
+		TargetHost, TargetPort = ConfigRuntime.Pterodactyl.TargetHost, ConfigRuntime.Pterodactyl.TargetPort
+		// server.properties is not accessible
+		loadServerProperties(nil)
+	default:
+		ListenHost, ListenPort, TargetHost, TargetPort, errMsh = getIpPorts()
+		if errMsh != nil {
+			return errMsh.AddTrace("loadConfigRuntime")
+		}
 	}
 
 	errco.Logln(errco.LVL_D, "msh proxy setup: %s:%d --> %s:%d", ListenHost, ListenPort, TargetHost, TargetPort)
 
+	// empty infos are taken from the language catalog
+	if ConfigRuntime.Msh.InfoHibernation == "" {
+		ConfigRuntime.Msh.InfoHibernation = locale.T("info.hibernation")
+	}
+	if ConfigRuntime.Msh.InfoStarting == "" {
+		ConfigRuntime.Msh.InfoStarting = locale.T("info.starting")
+	}
+	if ConfigRuntime.Msh.InfoLocked == "" {
+		ConfigRuntime.Msh.InfoLocked = locale.T("info.locked")
+	}
+	if ConfigRuntime.Msh.InfoDraining == "" {
+		ConfigRuntime.Msh.InfoDraining = locale.T("info.draining")
+	}
+	if ConfigRuntime.Mirror.InfoHostOffline == "" {
+		ConfigRuntime.Mirror.InfoHostOffline = locale.T("info.host-offline")
+	}
+
+	// replace server.properties placeholders in hibernation and starting info
+	ConfigRuntime.Msh.InfoHibernation = strings.ReplaceAll(ConfigRuntime.Msh.InfoHibernation, "<motd>", Motd)
+	ConfigRuntime.Msh.InfoStarting = strings.ReplaceAll(ConfigRuntime.Msh.InfoStarting, "<motd>", Motd)
+
 	// set server icon
 	ServerIcon, errMsh = loadIcon(ConfigRuntime.Server.Folder)
+	ServerIconFrozen = ServerIcon != defaultServerIcon
 	if errMsh != nil {
 		// it's enough to log it without returning
 		// since the default icon is loaded by default
-		errco.LogMshErr(errMsh.AddTrace("LoadConfig"))
+		errco.LogMshErr(errMsh.AddTrace("loadConfigRuntime"))
 	}
 
 	return nil
@@ -128,8 +241,9 @@ func ConfigDefaultFileWrite() *errco.Error {
 
 // generateConfigRuntime parses start arguments into ConfigRuntime and replaces placeholders
 func generateConfigRuntime() model.Configuration {
-	// initialize with ConfigDefault
-	ConfigRuntime = ConfigDefault
+	// initialize with ConfigDefault and the active profile
+	// (a profile error is returned by checkConfigRuntime)
+	ConfigRuntime, _ = profileConfig(ConfigDefault.Profile)
 
 	// specify arguments
 	flag.StringVar(&ConfigRuntime.Server.FileName, "f", ConfigRuntime.Server.FileName, "Specify server file name.")
@@ -142,6 +256,19 @@ func generateConfigRuntime() model.Configuration {
 	flag.StringVar(&ConfigRuntime.Msh.InfoStarting, "s", ConfigRuntime.Msh.InfoStarting, "Specify starting info.")
 	flag.IntVar(&ConfigRuntime.Msh.Debug, "d", ConfigRuntime.Msh.Debug, "Specify debug level.")
 
+	// long arguments parameterize msh without editing the config file (ex: systemd templates, docker entrypoints)
+	flag.StringVar(&ConfigRuntime.Server.Folder, "server-dir", ConfigRuntime.Server.Folder, "Specify server folder path (Server.Folder).")
+	flag.StringVar(&ConfigRuntime.Server.FileName, "server-file", ConfigRuntime.Server.FileName, "Specify server file name (Server.FileName).")
+	flag.StringVar(&ConfigRuntime.Commands.StartServerParam, "server-param", ConfigRuntime.Commands.StartServerParam, "Specify start server parameters (Commands.StartServerParam).")
+	flag.IntVar(&ConfigRuntime.Msh.ListenPort, "port", ConfigRuntime.Msh.ListenPort, "Specify msh port (Msh.ListenPort).")
+	flag.Int64Var(&ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer, "timeout", ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer, "Specify seconds before the empty server hibernates (Msh.TimeBeforeStoppingEmptyServer).")
+	flag.IntVar(&ConfigRuntime.Msh.Debug, "debug", ConfigRuntime.Msh.Debug, "Specify debug level (Msh.Debug).")
+	flag.StringVar(&ConfigRuntime.Msh.Language, "language", ConfigRuntime.Msh.Language, "Specify language of the messages (Msh.Language).")
+	flag.StringVar(&ConfigRuntime.Api.ListenHost, "api-host", ConfigRuntime.Api.ListenHost, "Specify api host (Api.ListenHost).")
+	flag.IntVar(&ConfigRuntime.Api.ListenPort, "api-port", ConfigRuntime.Api.ListenPort, "Specify api port, 0 to disable the api (Api.ListenPort).")
+
+	dryRun = flag.Bool("dry-run", false, "Use a fake minecraft server (Server.Backend \"fake\").")
+
 	// specify the usage when there is an error in the arguments
 	flag.Usage = func() {
 		// not using errco.Logln since log time is not needed
@@ -152,55 +279,342 @@ func generateConfigRuntime() model.Configuration {
 	// parse arguments
 	flag.Parse()
 
-	// replace placeholders in ConfigRuntime StartServer command
-	ConfigRuntime.Commands.StartServer = strings.ReplaceAll(ConfigRuntime.Commands.StartServer, "<Server.FileName>", ConfigRuntime.Server.FileName)
-	ConfigRuntime.Commands.StartServer = strings.ReplaceAll(ConfigRuntime.Commands.StartServer, "<Commands.StartServerParam>", ConfigRuntime.Commands.StartServerParam)
+	completeConfigRuntime()
 
 	return ConfigRuntime
 }
 
-// checkConfigRuntime checks different parameters in ConfigRuntime
+// completeConfigRuntime applies the dry-run argument and replaces the placeholders in ConfigRuntime
+func completeConfigRuntime() {
+	if *dryRun {
+		ConfigRuntime.Server.Backend = "fake"
+	}
+
+	// replace placeholders in ConfigRuntime StartServer command
+	startServerTemplate = ConfigRuntime.Commands.StartServer
+	ConfigRuntime.Commands.StartServer = resolveStartCommand(ConfigRuntime.Commands.StartServerParam)
+}
+
+// checkConfigRuntime checks different parameters in ConfigRuntime (the first problem found is returned)
 func checkConfigRuntime() *errco.Error {
+	if ConfigRuntime.Server.Backend == "fake" {
+		errco.Logln(errco.LVL_A, "dry run: msh uses a fake minecraft server (Server.Backend \"fake\")")
+	}
+
+	problems := configProblems()
+	if len(problems) > 0 {
+		return problems[0].AddTrace("checkConfigRuntime")
+	}
+
+	return nil
+}
+
+// configProblems returns the problems found checking the parameters in ConfigRuntime
+func configProblems() []*errco.Error {
+	var err error
+	problems := []*errco.Error{}
+
+	// check that the active profile exists and is valid
+	_, errMsh := profileConfig(ConfigDefault.Profile)
+	if errMsh != nil {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", errMsh.Str))
+	}
+
 	// check if serverFile/serverFolder exists
 	// (if config.Basic.ServerFileName == "", then it will just check if the server folder exist)
-	serverFileFolderPath := filepath.Join(ConfigRuntime.Server.Folder, ConfigRuntime.Server.FileName)
-	_, err := os.Stat(serverFileFolderPath)
-	if os.IsNotExist(err) {
-		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "checkConfigRuntime", "specified server file/folder does not exist: "+serverFileFolderPath)
+	// (kubernetes and pterodactyl backends server files are not accessible)
+	// (a provisioned server file is downloaded after the config is loaded)
+	// (the fake server does not need server files)
+	if ConfigRuntime.Server.Backend != "kubernetes" && ConfigRuntime.Server.Backend != "pterodactyl" && ConfigRuntime.Server.Backend != "fake" && !ProvisionPending() {
+		serverFileFolderPath := filepath.Join(ConfigRuntime.Server.Folder, ConfigRuntime.Server.FileName)
+		_, err = os.Stat(serverFileFolderPath)
+		if os.IsNotExist(err) {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "specified server file/folder does not exist: "+serverFileFolderPath))
+		}
 	}
 
-	// check if java is installed
-	_, err = exec.LookPath("java")
-	if err != nil {
-		return errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "checkConfigRuntime", "java not installed")
+	// world files of the kubernetes and pterodactyl backends are not accessible
+	if ConfigRuntime.World.IntegrityCheck && (ConfigRuntime.Server.Backend == "kubernetes" || ConfigRuntime.Server.Backend == "pterodactyl") {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "World.IntegrityCheck is not supported by the "+ConfigRuntime.Server.Backend+" backend"))
 	}
 
-	return nil
+	// world restore is triggered by a failed integrity check
+	if ConfigRuntime.World.AutoRestore && (!ConfigRuntime.World.IntegrityCheck || ConfigRuntime.World.BackupFolder == "") {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "World.AutoRestore requires World.IntegrityCheck and World.BackupFolder"))
+	}
+
+	// check scheduled restart time of the day
+	if ConfigRuntime.ScheduledRestart.DailyAt != "" {
+		_, err = time.Parse("15:04", ConfigRuntime.ScheduledRestart.DailyAt)
+		if err != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "ScheduledRestart.DailyAt is not valid (expected format: 15:04): "+err.Error()))
+		}
+	}
+
+	// check hibernation periods
+	for _, p := range ConfigRuntime.HibernationPeriods {
+		_, err1 := time.Parse("15:04", p.From)
+		_, err2 := time.Parse("15:04", p.To)
+		if err1 != nil || err2 != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("HibernationPeriods From/To are not valid (expected format: 15:04): %s - %s", p.From, p.To)))
+		}
+		for _, d := range p.Days {
+			switch strings.ToLower(d) {
+			case "mon", "tue", "wed", "thu", "fri", "sat", "sun":
+			default:
+				problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "HibernationPeriods Days are not valid (mon - tue - wed - thu - fri - sat - sun): "+d))
+			}
+		}
+	}
+
+	// api certificate and key are set together (if not set, a self-signed certificate is generated)
+	if (ConfigRuntime.Api.TLSCertFile == "") != (ConfigRuntime.Api.TLSKeyFile == "") {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Api.TLSCertFile and Api.TLSKeyFile must be set together"))
+	}
+	if ConfigRuntime.Api.TLSClientCAFile != "" && !ConfigRuntime.Api.TLS && ConfigRuntime.Api.GrpcPort <= 0 {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Api.TLSClientCAFile requires Api.TLS or Api.GrpcPort"))
+	}
+	if (ConfigRuntime.Api.CliCertFile == "") != (ConfigRuntime.Api.CliKeyFile == "") {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Api.CliCertFile and Api.CliKeyFile must be set together"))
+	}
+
+	// check proxy forwarding mode
+	switch ConfigRuntime.Forwarding.Mode {
+	case "", "bungeecord":
+	case "velocity":
+		if ConfigRuntime.Forwarding.VelocitySecret == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Forwarding.VelocitySecret must be set for velocity forwarding"))
+		}
+	default:
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Forwarding.Mode is not valid: "+ConfigRuntime.Forwarding.Mode))
+	}
+
+	// check java memory and flags tuning
+	errMsh = checkJavaTuning()
+	if errMsh != nil {
+		problems = append(problems, errMsh.AddTrace("configProblems"))
+	}
+
+	// check auxiliary forwards
+	auxNames := map[string]bool{}
+	for _, f := range ConfigRuntime.AuxForwards {
+		// the name identifies the forward listener passed to the new msh process on seamless restart
+		if f.Name == "" || strings.Contains(f.Name, ",") {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "AuxForwards Name must be set and must not contain commas: "+f.Name))
+		}
+		if auxNames[f.Name] {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "AuxForwards Name is not unique: "+f.Name))
+		}
+		auxNames[f.Name] = true
+		if f.Protocol != "tcp" && f.Protocol != "udp" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("AuxForwards %s Protocol is not valid: %s (tcp - udp)", f.Name, f.Protocol)))
+		}
+		if f.ListenPort < 1 || f.ListenPort > 65535 || f.TargetPort < 1 || f.TargetPort > 65535 {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("AuxForwards %s ListenPort and TargetPort must be valid ports: %d - %d", f.Name, f.ListenPort, f.TargetPort)))
+		}
+		if f.Protocol == "tcp" && f.ListenPort == ConfigRuntime.Msh.ListenPort {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("AuxForwards %s ListenPort is Msh.ListenPort: %d", f.Name, f.ListenPort)))
+		}
+		for _, a := range f.WakeAllowlist {
+			if _, _, err := net.ParseCIDR(a); err != nil && net.ParseIP(a) == nil {
+				problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("AuxForwards %s WakeAllowlist entry is not an ip or a cidr network: %s", f.Name, a)))
+			}
+		}
+		if f.WakeDebounce < 0 {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("AuxForwards %s WakeDebounce must not be negative", f.Name)))
+		}
+	}
+
+	// check plugins
+	pluginNames := map[string]bool{}
+	for _, p := range ConfigRuntime.Plugins {
+		if p.Name == "" || p.Command == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Plugins Name and Command must be set: "+p.Name))
+		}
+		if pluginNames[p.Name] {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Plugins Name is not unique: "+p.Name))
+		}
+		pluginNames[p.Name] = true
+		if p.VetoTimeout < 0 {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("Plugins %s VetoTimeout must not be negative", p.Name)))
+		}
+	}
+
+	// check freeze policy
+	if ConfigRuntime.FreezePolicy.MinOnlineMinutes < 0 || ConfigRuntime.FreezePolicy.MaxWakesPerHour < 0 {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "FreezePolicy.MinOnlineMinutes and FreezePolicy.MaxWakesPerHour must not be negative"))
+	}
+
+	// check protocol version answered to status requests
+	switch ConfigRuntime.Msh.StatusProtocol {
+	case "", "server", "client":
+	default:
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Msh.StatusProtocol is not valid: "+ConfigRuntime.Msh.StatusProtocol+" (server - client)"))
+	}
+
+	// check welcome back message of the players that waited for the starting server
+	switch ConfigRuntime.Msh.WelcomeBack {
+	case "", "player", "server":
+	default:
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Msh.WelcomeBack is not valid: "+ConfigRuntime.Msh.WelcomeBack+" (player - server)"))
+	}
+
+	// check client request policy
+	errMsh = checkPolicy()
+	if errMsh != nil {
+		problems = append(problems, errMsh.AddTrace("configProblems"))
+	}
+
+	// check wake channels
+	if ConfigRuntime.Wake.Dns.ListenAddress != "" && ConfigRuntime.Wake.Dns.Name == "" {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Wake.Dns.Name must be set to wake by dns"))
+	}
+	if ConfigRuntime.Wake.Imap.Server != "" && ConfigRuntime.Wake.Imap.Subject == "" {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Wake.Imap.Subject must be set to wake by email"))
+	}
+
+	// check proxy buffers
+	if ConfigRuntime.Proxy.BufferSize < 0 || ConfigRuntime.Proxy.SocketBufferSize < 0 || ConfigRuntime.Proxy.StallTimeout < 0 {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Proxy.BufferSize, Proxy.SocketBufferSize and Proxy.StallTimeout must not be negative"))
+	}
+
+	// check dynamic dns provider
+	switch ConfigRuntime.Ddns.Provider {
+	case "":
+	case "cloudflare":
+		if ConfigRuntime.Ddns.Cloudflare.ApiToken == "" || ConfigRuntime.Ddns.Cloudflare.ZoneId == "" || ConfigRuntime.Ddns.Hostname == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Ddns.Hostname, Ddns.Cloudflare.ApiToken and Ddns.Cloudflare.ZoneId must be set for cloudflare"))
+		}
+	case "duckdns":
+		if ConfigRuntime.Ddns.DuckDns.Token == "" || ConfigRuntime.Ddns.Hostname == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Ddns.Hostname and Ddns.DuckDns.Token must be set for duckdns"))
+		}
+	case "http":
+		if ConfigRuntime.Ddns.Http.UpdateUrl == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Ddns.Http.UpdateUrl must be set for http"))
+		}
+	default:
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Ddns.Provider is not valid: "+ConfigRuntime.Ddns.Provider+" (cloudflare - duckdns - http)"))
+	}
+
+	// check minecraft server process umask
+	if ConfigRuntime.Commands.StartServerUmask != "" {
+		mask, err := strconv.ParseUint(ConfigRuntime.Commands.StartServerUmask, 8, 32)
+		if err != nil || mask > 0777 {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Commands.StartServerUmask is not a valid umask (octal, 0000 - 0777): "+ConfigRuntime.Commands.StartServerUmask))
+		}
+	}
+
+	// check minecraft server readiness probe
+	switch ConfigRuntime.Commands.ReadinessProbe {
+	case "", "log", "tcp", "status", "delay":
+	default:
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Commands.ReadinessProbe is not valid: "+ConfigRuntime.Commands.ReadinessProbe+" (log - tcp - status - delay)"))
+	}
+	if ConfigRuntime.Commands.ReadinessDelay < 0 {
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Commands.ReadinessDelay must not be negative"))
+	}
+
+	// check pre-stop commands confirmation regexes
+	for _, c := range ConfigRuntime.Commands.PreStopCommands {
+		_, err := regexp.Compile(c.Match)
+		if err != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("Commands.PreStopCommands Match of %q is not valid: %s", c.Command, err.Error())))
+		}
+		if c.Timeout < 0 {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", fmt.Sprintf("Commands.PreStopCommands Timeout of %q must not be negative", c.Command)))
+		}
+	}
+
+	switch ConfigRuntime.Server.Backend {
+	case "", "process":
+		// check if the start command executable is installed (ex: java)
+		// (an executable path is relative to the server folder)
+		executable := strings.Trim(strings.Split(strings.TrimSpace(ConfigRuntime.Commands.StartServer), " ")[0], `"'`)
+		if strings.ContainsAny(executable, `/\`) && !filepath.IsAbs(executable) {
+			executable = filepath.Join(ConfigRuntime.Server.Folder, executable)
+		}
+		_, err = exec.LookPath(executable)
+		if err != nil {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "start command executable not found: "+err.Error()))
+		}
+	case "docker":
+		if ConfigRuntime.Docker.Container == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Docker.Container is not set"))
+		}
+	case "fake":
+		// the fake server has no requirements
+	case "kubernetes":
+		if ConfigRuntime.Kubernetes.Name == "" || ConfigRuntime.Kubernetes.TargetHost == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Kubernetes.Name and Kubernetes.TargetHost must be set"))
+		}
+		// the pod readiness is used instead
+		if ConfigRuntime.Commands.ReadinessProbe != "" && ConfigRuntime.Commands.ReadinessProbe != "log" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Commands.ReadinessProbe is not supported by the kubernetes backend"))
+		}
+	case "pterodactyl":
+		p := ConfigRuntime.Pterodactyl
+		if p.PanelUrl == "" || p.ApiToken == "" || p.ServerId == "" || p.TargetHost == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Pterodactyl.PanelUrl, Pterodactyl.ApiToken, Pterodactyl.ServerId and Pterodactyl.TargetHost must be set"))
+		} else if u, err := url.Parse(p.PanelUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Pterodactyl.PanelUrl is not valid: "+p.PanelUrl))
+		}
+	default:
+		problems = append(problems, errco.NewErr(errco.ERROR_CONFIG_CHECK, errco.LVL_B, "configProblems", "Server.Backend is not valid: "+ConfigRuntime.Server.Backend))
+	}
+
+	return problems
 }
 
 // getIpPorts reads server.properties server file and returns the correct ports
+// (max players and MOTD are loaded too)
 func getIpPorts() (string, int, string, int, *errco.Error) {
-	data, err := ioutil.ReadFile(filepath.Join(ConfigRuntime.Server.Folder, "server.properties"))
-	if err != nil {
-		return "", -1, "", -1, errco.NewErr(errco.ERROR_CONFIG_LOAD, errco.LVL_B, "getIpPorts", err.Error())
+	props, errMsh := ReadServerProperties()
+	if errMsh != nil {
+		// the fake server uses the minecraft defaults if server.properties is missing
+		if ConfigRuntime.Server.Backend != "fake" {
+			return "", -1, "", -1, errMsh.AddTrace("getIpPorts")
+		}
+		props = map[string]string{}
 	}
 
-	dataStr := strings.ReplaceAll(string(data), "\r", "")
+	loadServerProperties(props)
+
+	// minecraft server uses the default port if server-port is not set
+	TargetPort = 25565
+	if props["server-port"] == "" {
+		errco.Logln(errco.LVL_B, "server-port not found in server.properties: using minecraft default port %d", TargetPort)
+	} else {
+		var err error
+		TargetPort, err = strconv.Atoi(strings.TrimSpace(props["server-port"]))
+		if err != nil {
+			return "", -1, "", -1, errco.NewErr(errco.ERROR_CONVERSION, errco.LVL_D, "getIpPorts", err.Error())
+		}
+	}
 
-	TargetPortStr, errMsh := utility.StrBetween(dataStr, "server-port=", "\n")
-	if err != nil {
-		return "", -1, "", -1, errMsh.AddTrace("getIpPorts")
+	// minecraft server bound to a specific interface is reached on that interface
+	if ip := strings.TrimSpace(props["server-ip"]); ip != "" && ip != "0.0.0.0" {
+		TargetHost = ip
 	}
 
-	TargetPort, err = strconv.Atoi(TargetPortStr)
-	if err != nil {
-		return "", -1, "", -1, errco.NewErr(errco.ERROR_CONVERSION, errco.LVL_D, "getIpPorts", err.Error())
+	// the listener passed by the previous msh process (seamless restart) uses the port
+	// (and so does msh itself when the config is reloaded by a profile switch)
+	if !handover.Inherited("client") && ListenPort != ConfigRuntime.Msh.ListenPort && !portFree(ListenHost, ConfigRuntime.Msh.ListenPort) {
+		return "", -1, "", -1, errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "getIpPorts", fmt.Sprintf("ListenPort %d is already in use by another process (another msh instance?)", ConfigRuntime.Msh.ListenPort))
 	}
 
 	if TargetPort == ConfigRuntime.Msh.ListenPort {
-		return "", -1, "", -1, errco.NewErr(errco.ERROR_CONFIG_LOAD, errco.LVL_B, "getIpPorts", "TargetPort and ListenPort appear to be the same, please change one of them")
+		if !ConfigRuntime.Msh.AutoPort {
+			return "", -1, "", -1, errco.NewErr(errco.ERROR_PORT_BUSY, errco.LVL_B, "getIpPorts", fmt.Sprintf("TargetPort (server-port in server.properties) and ListenPort are both %d: change one of them or enable Msh.AutoPort", TargetPort))
+		}
+		errMsh = negotiatePort(TargetPort)
+		if errMsh != nil {
+			return "", -1, "", -1, errMsh.AddTrace("getIpPorts")
+		}
 	}
 
+	errco.Logln(errco.LVL_B, "msh listens on port %d, minecraft server port (server-port) is %d", ConfigRuntime.Msh.ListenPort, TargetPort)
+
 	// return ListenHost, TargetHost, TargetPort, nil
 	return ListenHost, ConfigRuntime.Msh.ListenPort, TargetHost, TargetPort, nil
 }
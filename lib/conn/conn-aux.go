@@ -0,0 +1,384 @@
+package conn
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// auxUdpTimeout is the time after which a udp session of an auxiliary forward without replies from the service is closed
+const auxUdpTimeout = 2 * time.Minute
+
+// auxForward is an auxiliary forward (AuxForwards) proxying a service tied to the minecraft server
+type auxForward struct {
+	name      string
+	protocol  string // "tcp" or "udp"
+	listen    string // address msh listens on
+	target    string // address of the service
+	wake      bool   // connections wake the offline minecraft server (the forward is always bound)
+	allowlist []string
+	debounce  time.Duration
+
+	m     sync.Mutex
+	bound bool                 // the forward is bound
+	conns map[io.Closer]bool   // connections closed when the forward is unbound or the minecraft server goes offline
+	wakes map[string]time.Time // time of the last wake triggered by each ip
+}
+
+// AuxForwarder binds the auxiliary forwards when the minecraft server goes online and unbinds them
+// when it goes offline, so that the services tied to the minecraft server (ex: dynmap, voice chat)
+// are reachable through msh only while the server is online.
+// Wake forwards are always bound: their connections start the offline minecraft server.
+// [goroutine]
+func AuxForwarder() {
+	if len(config.ConfigRuntime.AuxForwards) == 0 {
+		return
+	}
+
+	forwards := []*auxForward{}
+	for _, f := range config.ConfigRuntime.AuxForwards {
+		host := f.TargetHost
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		debounce := time.Duration(f.WakeDebounce) * time.Second
+		if debounce <= 0 {
+			debounce = 10 * time.Minute
+		}
+		forwards = append(forwards, &auxForward{
+			name:      f.Name,
+			protocol:  f.Protocol,
+			listen:    ":" + strconv.Itoa(f.ListenPort),
+			target:    net.JoinHostPort(host, strconv.Itoa(f.TargetPort)),
+			wake:      f.Wake,
+			allowlist: f.WakeAllowlist,
+			debounce:  debounce,
+			conns:     map[io.Closer]bool{},
+			wakes:     map[string]time.Time{},
+		})
+	}
+
+	// subscribe before checking the status so that no transition is missed
+	c := events.Subscribe(100)
+
+	// the minecraft server might be online already (ex: msh restarted without stopping it)
+	online := servstats.Stats.Status == errco.SERVER_STATUS_ONLINE
+	for _, f := range forwards {
+		if online || f.wake {
+			f.bind()
+		}
+	}
+
+	for e := range c {
+		switch {
+		case e.Type == events.SERVER_ONLINE && !online:
+			online = true
+			for _, f := range forwards {
+				f.bind()
+			}
+
+		case e.Type == events.SERVER_OFFLINE && online:
+			online = false
+			for _, f := range forwards {
+				if f.wake {
+					f.closeConns()
+				} else {
+					f.unbind()
+				}
+			}
+		}
+	}
+}
+
+// handoverName returns the name of the auxiliary forward listener passed to the new msh process on seamless restart
+func (f *auxForward) handoverName() string {
+	return "aux-" + f.name
+}
+
+// bind starts listening for the auxiliary forward connections (if not bound yet).
+// The listener passed by the previous msh process (seamless restart) is used if any.
+func (f *auxForward) bind() {
+	f.m.Lock()
+	bound := f.bound
+	f.m.Unlock()
+	if bound {
+		return
+	}
+
+	switch f.protocol {
+	case "udp":
+		pc, err := handover.ListenPacket(f.handoverName(), f.listen)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_AUX_FORWARD, errco.LVL_B, "bind", f.name+": "+err.Error()))
+			return
+		}
+		go f.serveUDP(pc)
+
+	default:
+		l, err := handover.Listen(f.handoverName(), f.listen)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_AUX_FORWARD, errco.LVL_B, "bind", f.name+": "+err.Error()))
+			return
+		}
+		go f.serveTCP(l)
+	}
+
+	f.m.Lock()
+	f.bound = true
+	f.m.Unlock()
+
+	errco.Logln(errco.LVL_B, "auxiliary forward %s bound: %s %s -> %s", f.name, f.protocol, f.listen, f.target)
+}
+
+// unbind closes the auxiliary forward listener and connections
+func (f *auxForward) unbind() {
+	f.m.Lock()
+	if !f.bound {
+		f.m.Unlock()
+		return
+	}
+	f.bound = false
+	handover.Close(f.handoverName())
+	f.m.Unlock()
+
+	f.closeConns()
+
+	errco.Logln(errco.LVL_B, "auxiliary forward %s unbound", f.name)
+}
+
+// closeConns closes the auxiliary forward connections
+func (f *auxForward) closeConns() {
+	f.m.Lock()
+	conns := f.conns
+	f.conns = map[io.Closer]bool{}
+	f.m.Unlock()
+
+	for c := range conns {
+		c.Close()
+	}
+}
+
+// track registers connections to be closed when the forward is unbound.
+// Returns false if the forward is not bound (the connections must be closed by the caller).
+func (f *auxForward) track(cs ...io.Closer) bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if !f.bound {
+		return false
+	}
+	for _, c := range cs {
+		f.conns[c] = true
+	}
+
+	return true
+}
+
+// untrack closes connections and removes them from the connections closed when the forward is unbound
+func (f *auxForward) untrack(cs ...io.Closer) {
+	f.m.Lock()
+	for _, c := range cs {
+		delete(f.conns, c)
+	}
+	f.m.Unlock()
+
+	for _, c := range cs {
+		c.Close()
+	}
+}
+
+// serveTCP accepts the auxiliary forward tcp connections until the listener is closed
+// (connections to a wake forward while the minecraft server is not online start it and are closed)
+// [goroutine]
+func (f *auxForward) serveTCP(l net.Listener) {
+	for {
+		client, err := l.Accept()
+		if err != nil {
+			// listener closed: the forward was unbound
+			return
+		}
+
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			f.wakeOnConnect(client.RemoteAddr())
+			client.Close()
+			continue
+		}
+
+		go f.forwardTCP(client)
+	}
+}
+
+// forwardTCP forwards a client tcp connection to the service until one of the two ends closes the connection
+// [goroutine]
+func (f *auxForward) forwardTCP(client net.Conn) {
+	server, err := net.DialTimeout("tcp", f.target, 5*time.Second)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_AUX_FORWARD, errco.LVL_D, "forwardTCP", f.name+": "+err.Error()))
+		client.Close()
+		return
+	}
+
+	if !f.track(client, server) {
+		client.Close()
+		server.Close()
+		return
+	}
+	defer f.untrack(client, server)
+
+	errco.Logln(errco.LVL_D, "auxiliary forward %s: %s connected", f.name, client.RemoteAddr().String())
+
+	doneC := make(chan bool, 2)
+	go func() {
+		io.Copy(server, client)
+		doneC <- true
+	}()
+	go func() {
+		io.Copy(client, server)
+		doneC <- true
+	}()
+
+	// when one direction ends, both connections are closed (by untrack) so that the other ends too
+	<-doneC
+}
+
+// serveUDP forwards the auxiliary forward udp datagrams until the listener is closed.
+// Each client address has a session: a socket connected to the service whose replies are sent back to the client.
+// [goroutine]
+func (f *auxForward) serveUDP(pc net.PacketConn) {
+	var sessionsM sync.Mutex
+	sessions := map[string]net.Conn{}
+
+	buf := make([]byte, 65535)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			// listener closed: the forward was unbound (sessions are closed by unbind)
+			return
+		}
+
+		// datagrams to a wake forward while the minecraft server is not online start it and are dropped
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			f.wakeOnConnect(addr)
+			continue
+		}
+
+		sessionsM.Lock()
+		s, ok := sessions[addr.String()]
+		sessionsM.Unlock()
+
+		if !ok {
+			s, err = net.Dial("udp", f.target)
+			if err != nil {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_AUX_FORWARD, errco.LVL_D, "serveUDP", f.name+": "+err.Error()))
+				continue
+			}
+			if !f.track(s) {
+				s.Close()
+				continue
+			}
+
+			sessionsM.Lock()
+			sessions[addr.String()] = s
+			sessionsM.Unlock()
+
+			// replies of the service are sent back to the client
+			// [goroutine]
+			go func(s net.Conn, addr net.Addr) {
+				defer func() {
+					sessionsM.Lock()
+					delete(sessions, addr.String())
+					sessionsM.Unlock()
+					f.untrack(s)
+				}()
+
+				rbuf := make([]byte, 65535)
+				for {
+					s.SetReadDeadline(time.Now().Add(auxUdpTimeout))
+					n, err := s.Read(rbuf)
+					if err != nil {
+						return
+					}
+					_, err = pc.WriteTo(rbuf[:n], addr)
+					if err != nil {
+						return
+					}
+				}
+			}(s, addr)
+		}
+
+		_, err = s.Write(buf[:n])
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_AUX_FORWARD, errco.LVL_D, "serveUDP", f.name+": "+err.Error()))
+		}
+	}
+}
+
+// wakeOnConnect starts the offline minecraft server on a connection to a wake forward (Wake).
+// Only the ips in WakeAllowlist (all if empty) wake the server and an ip triggers at most a wake every WakeDebounce seconds
+// (default 600), so that clients retrying the connection do not wake again a server hibernated in the meantime.
+func (f *auxForward) wakeOnConnect(addr net.Addr) {
+	if !f.wake || servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		ip = addr.String()
+	}
+
+	if len(f.allowlist) > 0 && !ipAllowed(ip, f.allowlist) {
+		errco.Logln(errco.LVL_D, "auxiliary forward %s: %s is not allowed to wake the minecraft server", f.name, ip)
+		return
+	}
+
+	f.m.Lock()
+	if time.Since(f.wakes[ip]) < f.debounce {
+		f.m.Unlock()
+		return
+	}
+	f.wakes[ip] = time.Now()
+
+	// discard expired entries
+	for i, t := range f.wakes {
+		if time.Since(t) >= f.debounce {
+			delete(f.wakes, i)
+		}
+	}
+	f.m.Unlock()
+
+	errMsh := servctrl.StartMS(history.Cause{Source: history.SOURCE_AUX, Ip: ip})
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("wakeOnConnect"))
+		return
+	}
+
+	errco.Logln(errco.LVL_B, "minecraft server wake triggered by auxiliary forward %s from %s", f.name, ip)
+}
+
+// ipAllowed returns true if ip is one of the ips or in one of the networks (cidr notation) of allowlist
+func ipAllowed(ip string, allowlist []string) bool {
+	parsed := net.ParseIP(ip)
+
+	for _, a := range allowlist {
+		if _, network, err := net.ParseCIDR(a); err == nil {
+			if parsed != nil && network.Contains(parsed) {
+				return true
+			}
+		} else if a == ip {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package conn
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+var (
+	wakesM sync.Mutex
+
+	// wakes contains the times of the recent wakes triggered by each player (lowercase name)
+	wakes = map[string][]time.Time{}
+)
+
+// cooldownPeriod returns the period in which a player can trigger at most WakeCooldown.MaxWakes wakes
+func cooldownPeriod() time.Duration {
+	if config.ConfigRuntime.WakeCooldown.PeriodMinutes <= 0 {
+		return time.Hour
+	}
+
+	return time.Duration(config.ConfigRuntime.WakeCooldown.PeriodMinutes) * time.Minute
+}
+
+// checkWakeCooldown returns an error if the player triggered too many wakes in the cooldown period
+func checkWakeCooldown(playerName string) *errco.Error {
+	maxWakes := config.ConfigRuntime.WakeCooldown.MaxWakes
+	if maxWakes <= 0 {
+		return nil
+	}
+
+	wakesM.Lock()
+	defer wakesM.Unlock()
+
+	// discard wakes older than the cooldown period
+	period := cooldownPeriod()
+	key := strings.ToLower(playerName)
+	recent := []time.Time{}
+	for _, t := range wakes[key] {
+		if time.Since(t) < period {
+			recent = append(recent, t)
+		}
+	}
+	wakes[key] = recent
+
+	if len(recent) < maxWakes {
+		return nil
+	}
+
+	// the oldest recent wake expires first
+	retry := period - time.Since(recent[0])
+	return errco.NewErr(errco.ERROR_WAKE_COOLDOWN, errco.LVL_B, "checkWakeCooldown",
+		locale.T("kick.cooldown", playerName, len(recent), int(period.Minutes()), int(retry.Minutes())+1))
+}
+
+// recordWake records a wake triggered by the player
+func recordWake(playerName string) {
+	wakesM.Lock()
+	key := strings.ToLower(playerName)
+	wakes[key] = append(wakes[key], time.Now())
+	wakesM.Unlock()
+
+	servstats.Stats.M.Lock()
+	servstats.Stats.LastWakePlayer = playerName
+	servstats.Stats.M.Unlock()
+
+	errco.Logln(errco.LVL_B, "minecraft server wake triggered by %s", playerName)
+}
+
+var (
+	pingWakesM sync.Mutex
+
+	// pingWakes contains the time of the last wake on status ping triggered by each ip
+	pingWakes = map[string]time.Time{}
+)
+
+// wakeOnPing starts the minecraft server on a status ping (Msh.WakeOnPing or Policy.Offline.Status "wake")
+// and returns true if it's starting.
+// An ip triggers at most a wake every Msh.WakeOnPingDebounce seconds (default 600), so that server list refreshes
+// do not wake again a server hibernated in the meantime.
+func wakeOnPing(clientAddress string) bool {
+	debounce := time.Duration(config.ConfigRuntime.Msh.WakeOnPingDebounce) * time.Second
+	if debounce <= 0 {
+		debounce = 10 * time.Minute
+	}
+
+	pingWakesM.Lock()
+	if time.Since(pingWakes[clientAddress]) < debounce {
+		pingWakesM.Unlock()
+		return false
+	}
+	pingWakes[clientAddress] = time.Now()
+
+	// discard expired entries
+	for ip, t := range pingWakes {
+		if time.Since(t) >= debounce {
+			delete(pingWakes, ip)
+		}
+	}
+	pingWakesM.Unlock()
+
+	errMsh := servctrl.StartMS(history.Cause{Source: history.SOURCE_PING, Ip: clientAddress})
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("wakeOnPing"))
+		return false
+	}
+
+	errco.Logln(errco.LVL_B, "minecraft server wake triggered by status ping from %s", clientAddress)
+
+	return true
+}
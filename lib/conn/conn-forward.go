@@ -0,0 +1,202 @@
+package conn
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/security"
+)
+
+// velocityChannel is the login plugin channel used by velocity modern forwarding
+const velocityChannel = "velocity:player_info"
+
+// forwardedAddress returns the player ip contained in a bungeecord legacy forwarding handshake packet
+// ("" if Forwarding.Mode is not "bungeecord" or the handshake does not contain forwarding data).
+// Bungeecord appends player ip, uuid and properties to the handshake server address separated by "\x00":
+// [ length | 0x00 | protocol | server address\x00player ip\x00uuid\x00properties | port | next state ]
+func forwardedAddress(packet []byte) string {
+	if config.ConfigRuntime.Forwarding.Mode != "bungeecord" {
+		return ""
+	}
+
+	r := bytes.NewReader(packet)
+
+	// packet length, packet id, protocol version
+	for i := 0; i < 3; i++ {
+		_, err := readVarInt(r)
+		if err != nil {
+			return ""
+		}
+	}
+
+	address, err := readString(r)
+	if err != nil {
+		return ""
+	}
+
+	fields := strings.Split(address, "\x00")
+	if len(fields) < 3 || forgeMarker(fields) != "" {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "forwardedAddress", "handshake does not contain bungeecord forwarding data"))
+		return ""
+	}
+
+	return fields[1]
+}
+
+// velocityForwarding retrieves player name and ip from the proxy with velocity modern forwarding.
+// It sends a login plugin request to the proxy and verifies the response with Forwarding.VelocitySecret.
+// Must be called after the login start packet has been read.
+func velocityForwarding(clientSocket net.Conn) (string, string, *errco.Error) {
+	// login plugin request: [ length | 0x04 | message id | channel | data ]
+	body := append([]byte{0x04}, writeVarInt(1)...)
+	body = append(body, writeString(velocityChannel)...)
+	clientSocket.Write(append(writeVarInt(len(body)), body...))
+
+	clientSocket.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer clientSocket.SetReadDeadline(time.Time{})
+
+	// login plugin response: [ length | 0x02 | message id | successful | data ]
+	length, err := readVarInt(&byteReader{clientSocket})
+	if err != nil || length <= 0 || length > 32767 {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "login plugin response not valid")
+	}
+	packet := make([]byte, length)
+	_, err = io.ReadFull(clientSocket, packet)
+	if err != nil {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", err.Error())
+	}
+
+	r := bytes.NewReader(packet)
+	if id, err := readVarInt(r); err != nil || id != 0x02 {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "unexpected packet instead of login plugin response")
+	}
+	if _, err := readVarInt(r); err != nil {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "login plugin response not valid")
+	}
+	if successful, err := r.ReadByte(); err != nil || successful != 1 {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_B, "velocityForwarding", "proxy did not send forwarding data (is velocity modern forwarding enabled?)")
+	}
+
+	// data: [ signature (32 bytes) | version | player ip | uuid (16 bytes) | player name | properties ]
+	data := packet[len(packet)-r.Len():]
+	if len(data) < 32 {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "forwarding data too short")
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.ConfigRuntime.Forwarding.VelocitySecret))
+	mac.Write(data[32:])
+	if !hmac.Equal(mac.Sum(nil), data[:32]) {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_B, "velocityForwarding", "forwarding data signature not valid (check Forwarding.VelocitySecret)")
+	}
+
+	r = bytes.NewReader(data[32:])
+	if _, err := readVarInt(r); err != nil {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "forwarding version not valid")
+	}
+	playerIP, err := readString(r)
+	if err != nil {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "player ip not valid")
+	}
+	if _, err := r.Seek(16, io.SeekCurrent); err != nil {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "player uuid not valid")
+	}
+	playerName, err := readString(r)
+	if err != nil {
+		return "", "", errco.NewErr(errco.ERROR_FORWARDING, errco.LVL_D, "velocityForwarding", "player name not valid")
+	}
+
+	return playerName, playerIP, nil
+}
+
+// velocityPlayer returns player name and ip retrieved with velocity modern forwarding
+// (if Forwarding.Mode is "velocity", otherwise or in case of error the specified ones are returned)
+func velocityPlayer(clientSocket net.Conn, playerName, clientAddress string) (string, string) {
+	if config.ConfigRuntime.Forwarding.Mode != "velocity" {
+		return playerName, clientAddress
+	}
+
+	fwdName, fwdAddress, errMsh := velocityForwarding(clientSocket)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("velocityPlayer"))
+		security.Report(security.REASON_FORWARDING, socketIp(clientSocket), playerName, errMsh.Str)
+		return playerName, clientAddress
+	}
+
+	return fwdName, fwdAddress
+}
+
+// readVarInt reads a minecraft protocol VarInt
+func readVarInt(r io.ByteReader) (int, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			return int(int32(value)), nil
+		}
+	}
+
+	return 0, io.ErrUnexpectedEOF
+}
+
+// writeVarInt encodes a minecraft protocol VarInt
+func writeVarInt(value int) []byte {
+	buf := make([]byte, binary.MaxVarintLen32)
+	uv := uint32(value)
+	n := 0
+	for {
+		b := byte(uv & 0x7f)
+		uv >>= 7
+		if uv != 0 {
+			b |= 0x80
+		}
+		buf[n] = b
+		n++
+		if uv == 0 {
+			return buf[:n]
+		}
+	}
+}
+
+// readString reads a minecraft protocol string (VarInt length prefixed utf-8)
+func readString(r *bytes.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || length > r.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+
+	return string(buf), err
+}
+
+// writeString encodes a minecraft protocol string
+func writeString(s string) []byte {
+	return append(writeVarInt(len(s)), s...)
+}
+
+// byteReader reads a net.Conn one byte at a time (to read VarInt without buffering the following bytes)
+type byteReader struct {
+	conn net.Conn
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	_, err := io.ReadFull(br.conn, b)
+	return b[0], err
+}
@@ -0,0 +1,107 @@
+package conn
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+)
+
+// client protocol versions that changed the json text component format of the loadscreen messages
+const (
+	protocolCopyToClipboard = 573 // 1.15: "copy_to_clipboard" click event
+	protocolHoverContents   = 735 // 1.16: hover event "contents" replaces "value"
+	protocolSnakeCase       = 770 // 1.21.5: "hover_event" and "click_event" replace "hoverEvent" and "clickEvent"
+)
+
+// component is a json text component
+type component map[string]interface{}
+
+// writeWaitMessage writes the loadscreen text shown to a player waiting for the starting minecraft server,
+// formatted as json text component for the client protocol version (plain text if the handshake is not valid)
+func writeWaitMessage(rc *recordConn, text string) {
+	hs, ok := parseHandshake(rc.rec)
+	if !ok {
+		writeMessage(rc, errco.MESSAGE_FORMAT_TXT, text)
+		return
+	}
+	if config.ConfigRuntime.Msh.KickAddress != "" {
+		hs.address = config.ConfigRuntime.Msh.KickAddress
+	}
+
+	data, err := json.Marshal(waitComponent(text, hs.protocol, hs.address))
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "writeWaitMessage", err.Error()))
+		writeMessage(rc, errco.MESSAGE_FORMAT_TXT, text)
+		return
+	}
+
+	writeMessage(rc, errco.MESSAGE_FORMAT_JSON, string(data))
+}
+
+// waitComponent returns the json text component of the loadscreen text shown to a player waiting for the starting server:
+// text, with the startup progress and estimated time left shown on hover, followed by a hint on when to retry
+// (clients that support it copy the server address clicking on the hint)
+func waitComponent(text string, protocol int, address string) component {
+	c := component{"text": text}
+
+	hover := []string{}
+	if progress := servstats.ProgressText(); progress != "" {
+		hover = append(hover, locale.T("kick.hover-progress", progress))
+	}
+	if eta := history.ETAText(); eta != "" {
+		hover = append(hover, locale.T("kick.hover-eta", eta))
+	}
+	if len(hover) > 0 {
+		setHover(c, protocol, strings.Join(hover, "\n"))
+	}
+
+	if address == "" {
+		return c
+	}
+
+	hint := component{"text": locale.T("kick.retry", address)}
+	if left, ok := history.StartupETA(); ok && left >= 5*time.Second {
+		// rounded up to 5s: players retrying too early are kicked again
+		hint["text"] = locale.T("kick.retry-in", (int(left.Seconds())+4)/5*5, address)
+	}
+	if setCopy(hint, protocol, address) {
+		setHover(hint, protocol, locale.T("kick.copy-address"))
+	}
+
+	c["extra"] = []component{{"text": "\n\n"}, hint}
+
+	return c
+}
+
+// setHover sets the text shown hovering the component
+func setHover(c component, protocol int, text string) {
+	switch {
+	case protocol >= protocolSnakeCase:
+		c["hover_event"] = component{"action": "show_text", "value": text}
+	case protocol >= protocolHoverContents:
+		c["hoverEvent"] = component{"action": "show_text", "contents": text}
+	default:
+		c["hoverEvent"] = component{"action": "show_text", "value": text}
+	}
+}
+
+// setCopy sets text to be copied to the clipboard clicking on the component.
+// Returns false if the client protocol version does not support it.
+func setCopy(c component, protocol int, text string) bool {
+	switch {
+	case protocol >= protocolSnakeCase:
+		c["click_event"] = component{"action": "copy_to_clipboard", "value": text}
+	case protocol >= protocolCopyToClipboard:
+		c["clickEvent"] = component{"action": "copy_to_clipboard", "value": text}
+	default:
+		return false
+	}
+
+	return true
+}
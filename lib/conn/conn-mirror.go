@@ -0,0 +1,129 @@
+package conn
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/locale"
+	"msh/lib/outbound"
+)
+
+// mirrorPollInterval is the time between two primary msh status requests
+const mirrorPollInterval = 10 * time.Second
+
+// primary contains the last status received from the primary msh instance
+var primary struct {
+	m           sync.Mutex
+	reachable   bool // primary api responded to the last request
+	Status      int  `json:"status"`
+	PlayerCount int  `json:"playerCount"`
+}
+
+// MirrorManager periodically retrieves the minecraft server status from the primary msh api (Mirror.PrimaryApi)
+// [goroutine]
+func MirrorManager() {
+	for {
+		errMsh := pollPrimary()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("MirrorManager"))
+		}
+
+		time.Sleep(mirrorPollInterval)
+	}
+}
+
+// pollPrimary updates the primary status requesting it to the primary msh api
+func pollPrimary() *errco.Error {
+	client, errMsh := outbound.Client(4 * time.Second)
+	if errMsh != nil {
+		return errMsh.AddTrace("pollPrimary")
+	}
+
+	primary.m.Lock()
+	defer primary.m.Unlock()
+
+	primary.reachable = false
+
+	resp, err := client.Get(strings.TrimSuffix(config.ConfigRuntime.Mirror.PrimaryApi, "/") + "/api/stats")
+	if err != nil {
+		return errco.NewErr(errco.ERROR_MIRROR_PRIMARY, errco.LVL_D, "pollPrimary", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errco.NewErr(errco.ERROR_MIRROR_PRIMARY, errco.LVL_D, "pollPrimary", "primary api responded with status: "+resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&primary)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "pollPrimary", err.Error())
+	}
+
+	primary.reachable = true
+
+	return nil
+}
+
+// HandleMirrorClientSocket handles a client that is connecting to a mirror msh instance.
+// Server info requests are answered with the mirrored primary status, join requests are refused.
+// [goroutine]
+func HandleMirrorClientSocket(clientSocket net.Conn) {
+	defer clientSocket.Close()
+
+	// handling of ipv6 addresses
+	li := strings.LastIndex(clientSocket.RemoteAddr().String(), ":")
+	clientAddress := clientSocket.RemoteAddr().String()[:li]
+
+	reqType, playerName, _, errMsh := getReqType(clientSocket)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("HandleMirrorClientSocket"))
+		return
+	}
+
+	primary.m.Lock()
+	reachable, status, playerCount := primary.reachable, primary.Status, primary.PlayerCount
+	primary.m.Unlock()
+
+	// select the message describing the primary status
+	info := config.ConfigRuntime.Mirror.InfoHostOffline
+	if reachable {
+		switch status {
+		case errco.SERVER_STATUS_OFFLINE:
+			info = config.ConfigRuntime.Msh.InfoHibernation
+		case errco.SERVER_STATUS_STARTING:
+			// the startup progress and estimate of the primary are not known
+			info = strings.NewReplacer("<progress>", "", "<eta>", "").Replace(config.ConfigRuntime.Msh.InfoStarting)
+		default:
+			info = locale.T("info.online", playerCount)
+		}
+	}
+
+	switch reqType {
+	case errco.CLIENT_REQ_INFO:
+		errco.Logln(errco.LVL_D, "%s requested server info from %s to mirror msh", playerName, clientAddress)
+
+		mes := buildMessage(errco.MESSAGE_FORMAT_INFO, info)
+		clientSocket.Write(mes)
+		errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+		errMsh = getPing(clientSocket)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("HandleMirrorClientSocket"))
+		}
+
+	case errco.CLIENT_REQ_JOIN:
+		errco.Logln(errco.LVL_D, "%s tried to join from %s to mirror msh", playerName, clientAddress)
+
+		mes := buildMessage(errco.MESSAGE_FORMAT_TXT, locale.T("kick.host-unreachable"))
+		if reachable {
+			mes = buildMessage(errco.MESSAGE_FORMAT_TXT, locale.T("kick.host-reachable"))
+		}
+		clientSocket.Write(mes)
+		errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+	}
+}
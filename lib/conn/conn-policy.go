@@ -0,0 +1,318 @@
+package conn
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/model"
+	"msh/lib/security"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// holdTimeout is the maximum time a login is held waiting for the minecraft server to be online
+// (the minecraft client disconnects after 30 seconds without answer)
+const holdTimeout = 25 * time.Second
+
+// recordConn is a client connection that records the data read, so that it can be replayed to the minecraft server
+type recordConn struct {
+	net.Conn
+	rec []byte
+}
+
+// Read reads data from the connection and records it
+func (rc *recordConn) Read(b []byte) (int, error) {
+	n, err := rc.Conn.Read(b)
+	rc.rec = append(rc.rec, b[:n]...)
+	return n, err
+}
+
+// handleStatus executes the policy rule on a status request.
+// Returns true if the connection is proxied to the minecraft server (it must not be closed).
+func handleStatus(rc *recordConn, status int, rule model.PolicyRule, clientAddress string) bool {
+	switch rule.Action {
+	case config.ACTION_PROXY:
+		proxyClient(rc.Conn, rc.rec, "")
+		return true
+	case config.ACTION_DENY:
+		return false
+	}
+
+	// answer to client with emulated server info
+	info := statusInfo(status, rule)
+	if status == errco.SERVER_STATUS_OFFLINE {
+		if l := servctrl.LockStatus(); l != nil {
+			info = l.Message()
+		} else if rule.Action == config.ACTION_WAKE && wakeOnPing(clientAddress) {
+			info = startingInfo()
+		}
+	}
+	writeStatus(rc, status, info)
+
+	// answer to client ping
+	errMsh := getPing(rc)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("handleStatus"))
+	}
+
+	return false
+}
+
+// handleLogin executes the policy rule on a login request.
+// Returns true if the connection is proxied to the minecraft server (it must not be closed).
+func handleLogin(rc *recordConn, status int, rule model.PolicyRule, playerName, clientAddress string) bool {
+	switch rule.Action {
+	case config.ACTION_PROXY:
+		proxyClient(rc.Conn, rc.rec, playerName)
+		return true
+
+	case config.ACTION_DENY:
+		return false
+
+	case config.ACTION_HOLD:
+		// the login is replayed to the minecraft server: velocity forwarding is answered by the server
+		if status == errco.SERVER_STATUS_OFFLINE {
+			errMsh := wakeForPlayer(rc, playerName, clientAddress)
+			if errMsh != nil {
+				writeMessage(rc, errco.MESSAGE_FORMAT_TXT, startErrorMessage(errMsh))
+				return false
+			}
+		}
+		addWaiting(playerName)
+		return holdLogin(rc, playerName)
+
+	case config.ACTION_WAKE:
+		playerName, clientAddress = velocityPlayer(rc, playerName, clientAddress)
+
+		// server is OFFLINE --> issue StartMS() (if the player is not in wake cooldown)
+		errMsh := wakeForPlayer(rc, playerName, clientAddress)
+		if errMsh != nil {
+			writeMessage(rc, errco.MESSAGE_FORMAT_TXT, startErrorMessage(errMsh))
+			return false
+		}
+		addWaiting(playerName)
+		writeWaitMessage(rc, wakeMessage(rule.Message, playerName))
+
+	default:
+		playerName, _ = velocityPlayer(rc, playerName, clientAddress)
+		if status == errco.SERVER_STATUS_STARTING {
+			addWaiting(playerName)
+			writeWaitMessage(rc, kickMessage(status, rule, playerName))
+			break
+		}
+		writeMessage(rc, errco.MESSAGE_FORMAT_TXT, kickMessage(status, rule, playerName))
+	}
+
+	return false
+}
+
+// wakeForPlayer starts the minecraft server on a player join attempt (if the player is not in wake cooldown)
+func wakeForPlayer(rc *recordConn, playerName, clientAddress string) *errco.Error {
+	errMsh := checkWakeCooldown(playerName)
+	if errMsh != nil {
+		security.Report(security.REASON_RATE_LIMIT, socketIp(rc), playerName, "too many wakes in the cooldown period")
+		return errMsh.AddTrace("wakeForPlayer")
+	}
+
+	errMsh = servctrl.StartMS(history.Cause{Source: history.SOURCE_PLAYER, Player: playerName, Ip: clientAddress})
+	if errMsh != nil {
+		return errMsh.AddTrace("wakeForPlayer")
+	}
+
+	recordWake(playerName)
+
+	return nil
+}
+
+// startErrorMessage logs a minecraft server start error and returns the text shown to the player
+func startErrorMessage(errMsh *errco.Error) string {
+	errco.LogMshErr(errMsh.AddTrace("startErrorMessage"))
+
+	switch errMsh.Cod {
+	case errco.ERROR_QUOTA_EXCEEDED, errco.ERROR_SERVER_LOCKED, errco.ERROR_WAKE_COOLDOWN, errco.ERROR_WAKE_LIMIT, errco.ERROR_PLUGIN_VETO:
+		return errMsh.Str
+	default:
+		return locale.T("kick.start-error")
+	}
+}
+
+// holdLogin keeps the player connection open until the starting minecraft server is online (at most holdTimeout),
+// then forwards it to the server. Returns true if the connection is proxied.
+func holdLogin(rc *recordConn, playerName string) bool {
+	errco.Logln(errco.LVL_D, "holding %s login until the minecraft server is online", playerName)
+
+	deadline := time.Now().Add(holdTimeout)
+	for servstats.Stats.Status == errco.SERVER_STATUS_STARTING && time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+		writeWaitMessage(rc, kickMessage(errco.SERVER_STATUS_STARTING, model.PolicyRule{}, playerName))
+		return false
+	}
+
+	proxyClient(rc.Conn, rc.rec, playerName)
+	return true
+}
+
+// statusInfo returns the server description answered to status requests (rule message or default for the status)
+func statusInfo(status int, rule model.PolicyRule) string {
+	if rule.Message != "" {
+		return renderTemplate(rule.Message, "")
+	}
+
+	switch status {
+	case errco.SERVER_STATUS_STARTING:
+		return startingInfo()
+	case errco.SERVER_STATUS_ONLINE:
+		return locale.T("info.online", servstats.Stats.PlayerCount)
+	default:
+		return config.ConfigRuntime.Msh.InfoHibernation
+	}
+}
+
+// kickMessage returns the loadscreen text shown to a player kicked by the policy (rule message or default for the status)
+func kickMessage(status int, rule model.PolicyRule, playerName string) string {
+	if rule.Message != "" {
+		return renderTemplate(rule.Message, playerName)
+	}
+
+	switch status {
+	case errco.SERVER_STATUS_OFFLINE:
+		return locale.T("kick.hibernating")
+	case errco.SERVER_STATUS_STARTING:
+		if config.ConfigRuntime.Msh.InfoStartingKick != "" {
+			return renderTemplate(config.ConfigRuntime.Msh.InfoStartingKick, playerName)
+		}
+		return waitMessage(locale.T("kick.starting"))
+	case errco.SERVER_STATUS_ONLINE:
+		return locale.T("kick.online")
+	default:
+		return locale.T("kick.stopping")
+	}
+}
+
+// writeMessage writes a message (TXT/INFO/JSON) to the client
+func writeMessage(clientSocket net.Conn, messageFormat int, message string) {
+	mes := buildMessage(messageFormat, message)
+	clientSocket.Write(mes)
+	errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+}
+
+// writeStatus writes the server info to a client status request.
+// If Msh.StatusProtocol is "client", the protocol version of the client is answered while the server is not online
+// so that the client does not show the hibernating server as incompatible.
+func writeStatus(rc *recordConn, status int, info string) {
+	hs, ok := parseHandshake(rc.rec)
+
+	// protocol -1 is sent by clients that don't know the server version (ex: server list pingers)
+	if config.ConfigRuntime.Msh.StatusProtocol != "client" || status == errco.SERVER_STATUS_ONLINE || !ok || hs.protocol <= 0 {
+		writeMessage(rc, errco.MESSAGE_FORMAT_INFO, info)
+		return
+	}
+
+	data := statusData(info)
+	data.Version.Protocol = hs.protocol
+
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "writeStatus", err.Error()))
+		writeMessage(rc, errco.MESSAGE_FORMAT_INFO, info)
+		return
+	}
+
+	writeMessage(rc, errco.MESSAGE_FORMAT_JSON, string(dataJSON))
+}
+
+// proxyClient opens a connection with the minecraft server, replays the client data already read and forwards
+// the connection in both directions (playerName is empty if the player is not known)
+func proxyClient(clientSocket net.Conn, replay []byte, playerName string) {
+	serverSocket, err := net.Dial("tcp", net.JoinHostPort(config.TargetHost, strconv.Itoa(config.TargetPort)))
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_DIAL, errco.LVL_D, "proxyClient", err.Error()))
+		// report dial error to client with text in the loadscreen
+		writeMessage(clientSocket, errco.MESSAGE_FORMAT_TXT, locale.T("kick.dial-error"))
+		clientSocket.Close()
+		return
+	}
+
+	if len(replay) > 0 {
+		_, err = serverSocket.Write(replay)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_DIAL, errco.LVL_D, "proxyClient", err.Error()))
+			serverSocket.Close()
+			clientSocket.Close()
+			return
+		}
+	}
+
+	tuneConn(clientSocket)
+	tuneConn(serverSocket)
+
+	// stopC is used to close serv->client and client->serv at the same time
+	stopC := make(chan bool, 1)
+
+	// cs counts the traffic of the connection until it's closed
+	cs := servstats.OpenConn(clientSocket.RemoteAddr().String(), playerName)
+	trackProxied(cs, clientSocket, serverSocket)
+
+	// closeProxied closes the connection when the first direction ends:
+	// the opposite forward might be blocked on a read until its timeout, closing both sockets stops it
+	var closeOnce sync.Once
+	closeProxied := func() {
+		closeOnce.Do(func() {
+			clientSocket.Close()
+			serverSocket.Close()
+			untrackProxied(cs)
+			servstats.CloseConn(cs)
+			s := cs.Snapshot()
+			errco.Logln(errco.LVL_D, "proxyClient: connection %s closed (%d bytes to server, %d bytes to client)", s.Client, s.BytesToServer, s.BytesToClient)
+		})
+	}
+
+	// launch proxy client -> server
+	go func() {
+		forward(clientSocket, serverSocket, false, stopC, cs)
+		closeProxied()
+	}()
+
+	// launch proxy server -> client
+	go func() {
+		forward(serverSocket, clientSocket, true, stopC, cs)
+		closeProxied()
+	}()
+}
+
+// tuneConn applies config Proxy tcp options to a proxied connection
+func tuneConn(c net.Conn) {
+	tcpConn, ok := c.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	p := config.ConfigRuntime.Proxy
+
+	if p.DisableNoDelay {
+		tcpConn.SetNoDelay(false)
+	}
+
+	switch {
+	case p.KeepAliveSeconds > 0:
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(time.Duration(p.KeepAliveSeconds) * time.Second)
+	case p.KeepAliveSeconds < 0:
+		tcpConn.SetKeepAlive(false)
+	}
+
+	if p.SocketBufferSize > 0 {
+		tcpConn.SetReadBuffer(p.SocketBufferSize)
+		tcpConn.SetWriteBuffer(p.SocketBufferSize)
+	}
+}
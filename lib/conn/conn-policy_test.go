@@ -0,0 +1,70 @@
+package conn
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// TestProxyClientClose proxies a connection to a fake minecraft server through the zero-copy fast path
+// and through the buffered forward and checks that the connection is released when the client disconnects
+func TestProxyClientClose(t *testing.T) {
+	config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer = 60
+
+	for name, debugLvl := range map[string]int{"splice": errco.LVL_B, "buffered": errco.LVL_D} {
+		t.Run(name, func(t *testing.T) {
+			errco.DebugLvl = debugLvl
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			config.TargetHost = "127.0.0.1"
+			config.TargetPort = ln.Addr().(*net.TCPAddr).Port
+
+			// the fake minecraft server answers "pong" to the replayed "ping" and keeps the connection open
+			serverC := make(chan net.Conn, 1)
+			go func() {
+				server, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				serverC <- server
+				buf := make([]byte, 4)
+				if _, err := io.ReadFull(server, buf); err == nil && string(buf) == "ping" {
+					server.Write([]byte("pong"))
+				}
+			}()
+
+			client, mshSide := tcpPair(t)
+			proxyClient(mshSide, []byte("ping"), "alice")
+
+			buf := make([]byte, 4)
+			client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "pong" {
+				t.Fatalf("proxied answer: %q, %v", buf, err)
+			}
+			if n := len(servstats.Conns()); n != 1 {
+				t.Fatalf("open connections while proxying: %d, expected 1", n)
+			}
+
+			// the server keeps its side open: the connection must be released anyway
+			client.Close()
+			defer (<-serverC).Close()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for len(servstats.Conns()) > 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("open connections after the client disconnected: %d, expected 0", len(servstats.Conns()))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -2,17 +2,23 @@ package conn
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"io"
 	"math/big"
 	"net"
+	"strconv"
 	"strings"
 
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/locale"
 	"msh/lib/model"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
 )
 
-// buildMessage takes the message format (TXT/INFO) and a message to write to the client
+// buildMessage takes the message format (TXT/INFO/JSON) and a message to write to the client
 func buildMessage(messageFormat int, message string) []byte {
 	// mountHeader mounts the full header to a specified message
 	var mountHeader = func(data []byte) []byte {
@@ -65,17 +71,7 @@ func buildMessage(messageFormat int, message string) []byte {
 	case errco.MESSAGE_FORMAT_INFO:
 		// send server info
 
-		// "&" [\x26] is converted to "§" [\xc2\xa7]
-		// this step is not strictly necessary if in msh-config is used the character "§"
-		message = strings.ReplaceAll(message, "&", "§")
-
-		messageStruct := &model.DataInfo{}
-		messageStruct.Description.Text = message
-		messageStruct.Players.Max = 0
-		messageStruct.Players.Online = 0
-		messageStruct.Version.Name = config.ConfigRuntime.Server.Version
-		messageStruct.Version.Protocol = config.ConfigRuntime.Server.Protocol
-		messageStruct.Favicon = "data:image/png;base64," + config.ServerIcon
+		messageStruct := statusData(message)
 
 		dataInfJSON, err := json.Marshal(messageStruct)
 		if err != nil {
@@ -86,18 +82,90 @@ func buildMessage(messageFormat int, message string) []byte {
 
 		return mountHeader(dataInfJSON)
 
+	case errco.MESSAGE_FORMAT_JSON:
+		// send json data (text component to be shown in the loadscreen or server info) already formatted for the client version
+
+		return mountHeader([]byte(message))
+
 	default:
 		return nil
 	}
 }
 
-// getReqType returns the request type (INFO or JOIN) and playerName of the client
-func getReqType(clientSocket net.Conn) (int, string, *errco.Error) {
+// statusData returns the server info answered by msh to status requests with the specified description
+func statusData(message string) *model.DataInfo {
+	// "&" [\x26] is converted to "§" [\xc2\xa7]
+	// this step is not strictly necessary if in msh-config is used the character "§"
+	message = strings.ReplaceAll(message, "&", "§")
+
+	messageStruct := &model.DataInfo{}
+	messageStruct.Description.Text = message
+	messageStruct.Players.Max = config.MaxPlayers
+	messageStruct.Players.Online = 0
+
+	// hover sample on the player count shows the players that were online most recently
+	if _, lastPlayers := servstats.PlayerLists(); len(lastPlayers) > 0 {
+		messageStruct.Players.Sample = append(messageStruct.Players.Sample, struct {
+			Name string `json:"name"`
+			Id   string `json:"id"`
+		}{locale.T("info.last-online", strings.Join(lastPlayers, ", ")), "00000000-0000-0000-0000-000000000000"})
+	}
+	// while the server is starting, the hover sample also shows the players waiting for it
+	if waiting := servstats.Waiting(); len(waiting) > 0 && servstats.Stats.Status == errco.SERVER_STATUS_STARTING {
+		names := []string{}
+		for _, w := range waiting {
+			names = append(names, w.Name)
+		}
+		messageStruct.Players.Sample = append(messageStruct.Players.Sample, struct {
+			Name string `json:"name"`
+			Id   string `json:"id"`
+		}{locale.T("info.waiting-players", strings.Join(names, ", ")), "00000000-0000-0000-0000-000000000000"})
+	}
+	messageStruct.Version.Name = config.ConfigRuntime.Server.Version
+	messageStruct.Version.Protocol = config.ConfigRuntime.Server.Protocol
+	messageStruct.Favicon = "data:image/png;base64," + config.ServerIcon
+
+	// replay the status of the last online session so that clients see the real server version and icon
+	// (server-icon-frozen.png and Msh.StatusMaxPlayers have priority)
+	if cache, ok := servctrl.CachedStatus(); ok {
+		messageStruct.Version.Name = cache.Version + versionSuffix()
+		messageStruct.Version.Protocol = cache.Protocol
+		if cache.Favicon != "" && !config.ServerIconFrozen {
+			messageStruct.Favicon = cache.Favicon
+		}
+		if config.ConfigRuntime.Msh.StatusMaxPlayers < 0 {
+			messageStruct.Players.Max = cache.MaxPlayers
+		}
+		messageStruct.ModInfo = cache.ModInfo
+		messageStruct.ForgeData = cache.ForgeData
+	}
+
+	return messageStruct
+}
+
+// versionSuffix returns the suffix of the version name replayed from the status cache for the minecraft server status
+// (ex: "1.20.4 (hibernating)")
+func versionSuffix() string {
+	switch servstats.Stats.Status {
+	case errco.SERVER_STATUS_OFFLINE:
+		return locale.T("version.hibernating")
+	case errco.SERVER_STATUS_STARTING:
+		return locale.T("version.starting")
+	default:
+		return ""
+	}
+}
+
+// getReqType returns the request type (INFO or JOIN), playerName of the client
+// and the player address forwarded by bungeecord ("" if not forwarded)
+func getReqType(clientSocket net.Conn) (int, string, string, *errco.Error) {
 	reqPacket, errMsh := getClientPacket(clientSocket)
 	if errMsh != nil {
-		return errco.ERROR_CLIENT_REQ, "", errMsh.AddTrace("getReqType")
+		return errco.ERROR_CLIENT_REQ, "", "", errMsh.AddTrace("getReqType")
 	}
 
+	fwdAddress := forwardedAddress(reqPacket)
+
 	// generate flags
 	listenPortByt := big.NewInt(int64(config.ListenPort)).Bytes() // calculates listen port in BigEndian bytes
 	reqFlagInfo := append(listenPortByt, byte(1))                 // flag contained in INFO request packet -> [99 211 1]
@@ -110,16 +178,16 @@ func getReqType(clientSocket net.Conn) (int, string, *errco.Error) {
 		// client is requesting server info and ping
 		// client first packet:	[ ... x x x (listenPortBytes) 1 1 0] or [ ... x x x (listenPortBytes) 1 ]
 		//                      [           ^---reqFlagInfo---^    ]    [           ^---reqFlagInfo---^ ]
-		return errco.CLIENT_REQ_INFO, playerName, nil
+		return errco.CLIENT_REQ_INFO, playerName, fwdAddress, nil
 
 	case bytes.Contains(reqPacket, reqFlagJoin):
 		// client is trying to join the server
 		// client first packet:	[ ... x x x (listenPortBytes) 2 ] or [ ... x x x (listenPortBytes) 2 x x x (player name) ]
 		//                      [           ^---reqFlagJoin---^ ]    [           ^---reqFlagJoin---^                     ]
-		return errco.CLIENT_REQ_JOIN, playerName, nil
+		return errco.CLIENT_REQ_JOIN, playerName, fwdAddress, nil
 
 	default:
-		return errco.CLIENT_REQ_UNKN, "", errco.NewErr(errco.CLIENT_REQ_UNKN, errco.LVL_D, "getReqType", "client request unknown")
+		return errco.CLIENT_REQ_UNKN, "", "", errco.NewErr(errco.CLIENT_REQ_UNKN, errco.LVL_D, "getReqType", "client request unknown")
 	}
 }
 
@@ -205,3 +273,59 @@ func extractPlayerName(data, reqFlagJoin []byte, clientSocket net.Conn) string {
 		return string(data[3:])
 	}
 }
+
+// handshake contains the fields of a client handshake packet used by msh
+type handshake struct {
+	protocol int    // protocol version of the client
+	address  string // server address the client connected to (host, port omitted if 25565)
+	forge    string // forge handshake marker of modded clients ("FML", "FML2", "FML3", "" for vanilla clients)
+}
+
+// parseHandshake parses the handshake packet at the start of data (false if data does not start with a valid handshake)
+func parseHandshake(data []byte) (handshake, bool) {
+	// handshake packet:
+	// [ packet length | packet id (0) | protocol version | server address | server port | next state ]
+	// [ VarInt        | VarInt        | VarInt           | String         | uint16      | VarInt     ]
+	r := bytes.NewReader(data)
+
+	if _, err := readVarInt(r); err != nil {
+		return handshake{}, false
+	}
+	if id, err := readVarInt(r); err != nil || id != 0 {
+		return handshake{}, false
+	}
+	protocol, err := readVarInt(r)
+	if err != nil {
+		return handshake{}, false
+	}
+	host, err := readString(r)
+	if err != nil {
+		return handshake{}, false
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return handshake{}, false
+	}
+
+	// forge marker ("\x00FML2\x00") and bungeecord forwarding data are appended to the host
+	fields := strings.Split(host, "\x00")
+	hs := handshake{protocol: protocol, forge: forgeMarker(fields)}
+
+	hs.address = strings.TrimSuffix(fields[0], ".")
+	if p := binary.BigEndian.Uint16(port); p != 25565 {
+		hs.address = net.JoinHostPort(hs.address, strconv.Itoa(int(p)))
+	}
+
+	return hs, true
+}
+
+// forgeMarker returns the forge marker contained in the "\x00" separated fields of a handshake server address
+// ("" if the client is not modded)
+func forgeMarker(fields []string) string {
+	// forge 1.7-1.12: FML, forge 1.13-1.17: FML2, forge 1.18+: FML3
+	if len(fields) > 1 && strings.HasPrefix(fields[1], "FML") {
+		return fields[1]
+	}
+
+	return ""
+}
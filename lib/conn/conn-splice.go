@@ -0,0 +1,72 @@
+package conn
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// spliceChunk is the maximum amount of bytes moved by the kernel before forwardSplice regains control
+const spliceChunk = 64 * 1024
+
+// canSplice returns true if the connection can be forwarded through the zero-copy fast path:
+// on linux, data between tcp connections is moved by the kernel (splice) without user-space buffers.
+// The buffered forward is used when packets must be inspected (debug log level with data rates and packet dumps,
+// chaos connection drops).
+func canSplice(source, destination net.Conn) bool {
+	if runtime.GOOS != "linux" || errco.DebugLvl >= errco.LVL_D || config.ConfigRuntime.Chaos.DropConnectionPercent > 0 {
+		return false
+	}
+
+	_, srcTCP := source.(*net.TCPConn)
+	_, dstTCP := destination.(*net.TCPConn)
+
+	return srcTCP && dstTCP
+}
+
+// forwardSplice forwards source to destination through the zero-copy fast path
+// (isServerToClient used to know the forward direction, the traffic is counted in cs by chunk).
+// Read and write timeouts are not applied as the kernel moves the data: dead peers are detected by tcp keepalive
+// and both connections are closed when the forward ends, so that the opposite forward stops too.
+// [blocking]
+func forwardSplice(source, destination net.Conn, isServerToClient bool, stopC chan bool, cs *servstats.ConnStats) {
+	source.SetDeadline(time.Time{})
+	destination.SetDeadline(time.Time{})
+
+	dst := destination.(*net.TCPConn)
+	lr := &io.LimitedReader{R: source}
+
+	for {
+		// if stopC receives true, close the source connection, otherwise continue
+		select {
+		case <-stopC:
+			source.Close()
+			return
+		default:
+		}
+
+		// (*net.TCPConn).ReadFrom splices from a *net.TCPConn wrapped in a *io.LimitedReader
+		lr.N = spliceChunk
+		n, err := dst.ReadFrom(lr)
+		cs.Count(isServerToClient, int(n), 0)
+
+		// the chunk was not filled: the source reached EOF or an error occurred
+		if err != nil || lr.N > 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			errco.Logln(errco.LVL_D, "forwardSplice: closing %15s --> %15s because of: %s", strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0], err.Error())
+
+			stopForward(stopC)
+			source.Close()
+			destination.Close()
+			return
+		}
+	}
+}
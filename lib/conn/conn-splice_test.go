@@ -0,0 +1,92 @@
+package conn
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// benchChunk is the amount of bytes forwarded at each benchmark iteration
+const benchChunk = 32 * 1024
+
+// tcpPair returns the two ends of a loopback tcp connection
+func tcpPair(tb testing.TB) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	acceptedC := make(chan net.Conn)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			acceptedC <- nil
+			return
+		}
+		acceptedC <- c
+	}()
+
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	accepted := <-acceptedC
+	if accepted == nil {
+		tb.Fatal("accept failed")
+	}
+
+	return dialed, accepted
+}
+
+// benchmarkForward measures the throughput of a forward function between two loopback tcp connections
+func benchmarkForward(b *testing.B, fwd func(source, destination net.Conn, isServerToClient bool, stopC chan bool, cs *servstats.ConnStats)) {
+	// the packets must not be logged
+	errco.DebugLvl = errco.LVL_B
+	config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer = 60
+
+	writer, source := tcpPair(b)
+	destination, reader := tcpPair(b)
+	defer reader.Close()
+
+	cs := &servstats.ConnStats{}
+	doneC := make(chan bool)
+	go func() {
+		fwd(source, destination, true, make(chan bool, 1), cs)
+		close(doneC)
+	}()
+
+	data := make([]byte, benchChunk)
+	b.SetBytes(benchChunk)
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			writer.Write(data)
+		}
+		writer.Close()
+	}()
+
+	_, err := io.CopyN(ioutil.Discard, reader, int64(b.N)*benchChunk)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.StopTimer()
+	<-doneC
+}
+
+// BenchmarkForwardSplice measures the zero-copy fast path (splice on linux, plain copy elsewhere)
+func BenchmarkForwardSplice(b *testing.B) {
+	benchmarkForward(b, forwardSplice)
+}
+
+// BenchmarkForwardBuffered measures the buffered forward (Proxy.BufferSize)
+func BenchmarkForwardBuffered(b *testing.B) {
+	benchmarkForward(b, forwardBuffered)
+}
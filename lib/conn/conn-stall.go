@@ -0,0 +1,109 @@
+package conn
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+// stallCheckInterval is the time between two measures of the proxied connections
+const stallCheckInterval = 5 * time.Second
+
+// proxiedConn is an open proxied connection
+type proxiedConn struct {
+	client net.Conn
+	server net.Conn
+}
+
+var (
+	proxiedM sync.Mutex
+	proxied  = map[*servstats.ConnStats]proxiedConn{} // open proxied connections by traffic counters
+)
+
+// trackProxied registers an open proxied connection for the stall monitor
+func trackProxied(cs *servstats.ConnStats, client, server net.Conn) {
+	proxiedM.Lock()
+	defer proxiedM.Unlock()
+
+	proxied[cs] = proxiedConn{client, server}
+}
+
+// untrackProxied removes a closed proxied connection from the stall monitor
+func untrackProxied(cs *servstats.ConnStats) {
+	proxiedM.Lock()
+	defer proxiedM.Unlock()
+
+	delete(proxied, cs)
+}
+
+// StallMonitor measures the throughput and latency of the proxied connections and closes the stalled ones:
+// a client that did not send data for Proxy.StallTimeout seconds (half-open connection, frozen client not reading
+// its socket) or that did not acknowledge the data sent to it for as long.
+// Stalled connections would keep the player online and prevent the minecraft server hibernation.
+// [goroutine]
+func StallMonitor() {
+	last := time.Now()
+
+	for {
+		time.Sleep(stallCheckInterval)
+		interval := time.Since(last)
+		last = time.Now()
+
+		proxiedM.Lock()
+		conns := make(map[*servstats.ConnStats]proxiedConn, len(proxied))
+		for cs, pc := range proxied {
+			conns[cs] = pc
+		}
+		proxiedM.Unlock()
+
+		timeout := time.Duration(config.ConfigRuntime.Proxy.StallTimeout) * time.Second
+
+		for cs, pc := range conns {
+			cs.Measure(interval)
+
+			// the kernel statistics are exact also for the zero-copy fast path (linux)
+			noAck := time.Duration(0)
+			if sc, ok := pc.client.(syscall.Conn); ok {
+				stats, errMsh := opsys.ConnTCPStats(sc)
+				if errMsh == nil {
+					cs.SetLatency(stats.Rtt)
+					cs.SetIdle(stats.LastRecv)
+					if stats.Unacked > 0 {
+						noAck = stats.LastAck
+					}
+				}
+			}
+
+			if timeout <= 0 {
+				continue
+			}
+			reason := ""
+			switch {
+			case cs.Idle() >= timeout:
+				reason = "no data received for " + cs.Idle().Round(time.Second).String()
+			case noAck >= timeout:
+				reason = "data not acknowledged for " + noAck.Round(time.Second).String()
+			default:
+				continue
+			}
+
+			who := pc.client.RemoteAddr().String()
+			if cs.Player != "" {
+				who = cs.Player + " (" + who + ")"
+			}
+			errco.Logln(errco.LVL_B, "closing stalled connection of %s: %s", who, reason)
+			cs.MarkStalled()
+
+			// closing both sockets ends both forwards
+			pc.client.Close()
+			pc.server.Close()
+			untrackProxied(cs)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package conn
+
+import (
+	"encoding/json"
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/locale"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// addWaiting records the join attempt of a player waiting for the minecraft server to be online
+func addWaiting(playerName string) {
+	if playerName == "" {
+		return
+	}
+
+	servstats.AddWaiting(playerName)
+}
+
+// waitingText returns the number of players waiting for the starting minecraft server shown in the server list
+// (ex: "3 players waiting"), empty if no player is waiting
+func waitingText() string {
+	n := len(servstats.Waiting())
+	if n == 0 || servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+		return ""
+	}
+
+	return locale.T("info.waiting", n)
+}
+
+// WaitingList welcomes back the players that tried to join while the minecraft server was starting
+// when they join the online server (Msh.WelcomeBack: "player" sends the message only to the player,
+// "server" to all players) and forgets the waiting players when the server goes offline.
+// [goroutine]
+func WaitingList() {
+	c := events.Subscribe(100)
+
+	for e := range c {
+		switch e.Type {
+		case events.SERVER_ONLINE:
+			waiting := servstats.Waiting()
+			if len(waiting) == 0 {
+				continue
+			}
+			names := []string{}
+			for _, w := range waiting {
+				names = append(names, w.Name)
+			}
+			errco.Logln(errco.LVL_B, "%d players were waiting for the minecraft server: %s", len(names), strings.Join(names, ", "))
+
+		case events.SERVER_OFFLINE:
+			servstats.ClearWaiting()
+
+		case events.PLAYER_JOIN:
+			player, _ := e.Data["player"].(string)
+			if !servstats.RemoveWaiting(player) {
+				continue
+			}
+			welcomeBack(player)
+		}
+	}
+}
+
+// welcomeBack sends the welcome back message to a player that waited for the minecraft server (Msh.WelcomeBack)
+func welcomeBack(player string) {
+	message := locale.T("chat.welcome-back", player)
+
+	var command string
+	switch config.ConfigRuntime.Msh.WelcomeBack {
+	case "player":
+		text, err := json.Marshal(component{"text": message, "color": "gold"})
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "welcomeBack", err.Error()))
+			return
+		}
+		command = "tellraw " + player + " " + string(text)
+	case "server":
+		command = "say " + message
+	default:
+		return
+	}
+
+	_, errMsh := servctrl.Execute(command, "welcomeBack")
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("welcomeBack"))
+	}
+}
@@ -1,140 +1,167 @@
 package conn
 
 import (
-	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
+	"msh/lib/chaos"
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/model"
+	"msh/lib/plugin"
+	"msh/lib/security"
 	"msh/lib/servctrl"
 	"msh/lib/servstats"
 )
 
 // HandleClientSocket handles a client that is connecting.
-// Can handle a client that is requesting server info or trying to join.
+// Can handle a client that is requesting server info or trying to join:
+// the action taken depends on the minecraft server status (config Policy).
 // [goroutine]
 func HandleClientSocket(clientSocket net.Conn) {
-	// handling of ipv6 addresses
-	li := strings.LastIndex(clientSocket.RemoteAddr().String(), ":")
-	clientAddress := clientSocket.RemoteAddr().String()[:li]
+	clientAddress := socketIp(clientSocket)
 
-	switch servstats.Stats.Status {
-	case errco.SERVER_STATUS_OFFLINE:
-		reqType, playerName, errMsh := getReqType(clientSocket)
-		if errMsh != nil {
-			errco.LogMshErr(errMsh.AddTrace("HandleClientSocket"))
-			return
-		}
+	status := servstats.Stats.Status
+	statusRule, loginRule := config.Policy(status)
 
-		switch reqType {
-		case errco.CLIENT_REQ_INFO:
-			// client requests "server info"
-			errco.Logln(errco.LVL_D, "%s requested server info from %s:%d to %s:%d", playerName, clientAddress, config.ListenPort, config.TargetHost, config.TargetPort)
+	// while msh is draining new connections get the maintenance message
+	// (players already connected keep playing)
+	if d := servctrl.DrainStatus(); d != nil {
+		statusRule = model.PolicyRule{Action: config.ACTION_INFO, Message: d.Message()}
+		loginRule = model.PolicyRule{Action: config.ACTION_KICK, Message: d.Message()}
+	}
 
-			// answer to client with emulated server info
-			mes := buildMessage(errco.MESSAGE_FORMAT_INFO, config.ConfigRuntime.Msh.InfoHibernation)
-			clientSocket.Write(mes)
-			errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+	// connections are forwarded without inspecting the requests if all requests are proxied
+	if statusRule.Action == config.ACTION_PROXY && loginRule.Action == config.ACTION_PROXY {
+		proxyClient(clientSocket, nil, "")
+		return
+	}
 
-			// answer to client ping
-			errMsh := getPing(clientSocket)
-			if errMsh != nil {
-				errco.LogMshErr(errMsh.AddTrace("HandleClientSocket"))
-			}
+	// requests are recorded so that they can be replayed to the minecraft server if proxied
+	rc := &recordConn{Conn: clientSocket}
 
-		case errco.CLIENT_REQ_JOIN:
-			// client requests "server join"
-
-			// server is OFFLINE --> issue StartMS()
-			errMsh := servctrl.StartMS()
-			if errMsh != nil {
-				// log to msh console and warn client with text in the loadscreen
-				errco.LogMshErr(errMsh.AddTrace("HandleClientSocket"))
-				mes := buildMessage(errco.MESSAGE_FORMAT_TXT, "An error occurred while starting the server: check the msh log")
-				clientSocket.Write(mes)
-				errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
-			} else {
-				// log to msh console and answer client with text in the loadscreen
-				errco.Logln(errco.LVL_D, "%s tried to join from %s:%d to %s:%d", playerName, clientAddress, config.ListenPort, config.TargetHost, config.TargetPort)
-				mes := buildMessage(errco.MESSAGE_FORMAT_TXT, "Server start command issued. Please wait... "+servstats.Stats.LoadProgress)
-				clientSocket.Write(mes)
-				errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
-			}
+	reqType, playerName, fwdAddress, errMsh := getReqType(rc)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("HandleClientSocket"))
+		if errMsh.Cod == errco.CLIENT_REQ_UNKN {
+			security.Report(security.REASON_MALFORMED, clientAddress, "", errMsh.Str)
 		}
-
-		// close the client connection
-		errco.Logln(errco.LVL_D, "closing connection for: %s", clientAddress)
 		clientSocket.Close()
+		return
+	}
+	// the player ip forwarded by bungeecord is not verified: it's not reported to the security log (see socketIp)
+	if fwdAddress != "" {
+		clientAddress = fwdAddress
+	}
+	if hs, ok := parseHandshake(rc.rec); ok && hs.forge != "" {
+		// the handshake is replayed untouched to the minecraft server, so that the forge login is not broken
+		errco.Logln(errco.LVL_D, "%s is a modded client (forge handshake marker %s)", playerName, hs.forge)
+	}
 
-	case errco.SERVER_STATUS_STARTING:
-		reqType, playerName, errMsh := getReqType(clientSocket)
-		if errMsh != nil {
-			errco.LogMshErr(errMsh.AddTrace("HandleClientSocket"))
+	switch reqType {
+	case errco.CLIENT_REQ_INFO:
+		// client requests "server info"
+		errco.Logln(errco.LVL_D, "%s requested server info from %s:%d to %s:%d (server %s: %s)", playerName, clientAddress, config.ListenPort, config.TargetHost, config.TargetPort, servstats.StatusName(status), statusRule.Action)
+		plugin.Connection("status", "", clientAddress)
+
+		if handleStatus(rc, status, statusRule, clientAddress) {
 			return
 		}
 
-		switch reqType {
-		case errco.CLIENT_REQ_INFO:
-			// client requests "INFO"
-
-			errco.Logln(errco.LVL_D, "%s requested server info from %s:%d to %s:%d during server startup", playerName, clientAddress, config.ListenPort, config.TargetHost, config.TargetPort)
+	case errco.CLIENT_REQ_JOIN:
+		// client requests "server join"
+		errco.Logln(errco.LVL_D, "%s tried to join from %s:%d to %s:%d (server %s: %s)", playerName, clientAddress, config.ListenPort, config.TargetHost, config.TargetPort, servstats.StatusName(status), loginRule.Action)
+		plugin.Connection("join", playerName, clientAddress)
 
-			// answer to client with emulated server info
-			mes := buildMessage(errco.MESSAGE_FORMAT_INFO, config.ConfigRuntime.Msh.InfoStarting)
-			clientSocket.Write(mes)
-			errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		if handleLogin(rc, status, loginRule, playerName, clientAddress) {
+			return
+		}
+	}
 
-			// answer to client ping
-			errMsh = getPing(clientSocket)
-			if errMsh != nil {
-				errco.LogMshErr(errMsh.AddTrace("HandleClientSocket"))
-			}
+	// close the client connection
+	errco.Logln(errco.LVL_D, "closing connection for: %s", clientAddress)
+	clientSocket.Close()
+}
 
-		case errco.CLIENT_REQ_JOIN:
-			// client requests "JOIN"
+// startingInfo returns the server description shown while the minecraft server is starting (Msh.InfoStarting)
+func startingInfo() string {
+	return renderTemplate(config.ConfigRuntime.Msh.InfoStarting, "")
+}
 
-			// log to msh console and answer to client with text in the loadscreen
-			errco.Logln(errco.LVL_D, "%s tried to join from %s:%d to %s:%d during server startup", playerName, clientAddress, config.ListenPort, config.TargetHost, config.TargetPort)
-			mes := buildMessage(errco.MESSAGE_FORMAT_TXT, "Server is starting. Please wait... "+servstats.Stats.LoadProgress)
-			clientSocket.Write(mes)
-			errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
-		}
+// wakeMessage returns the loadscreen text shown to the player that woke the minecraft server:
+// message (or Msh.InfoWake if empty) with placeholders replaced or, if not set, the default wait message
+func wakeMessage(message, playerName string) string {
+	if message == "" {
+		message = config.ConfigRuntime.Msh.InfoWake
+	}
+	if message == "" {
+		return waitMessage(locale.T("kick.wake"))
+	}
 
-		// close the client connection
-		errco.Logln(errco.LVL_D, "closing connection for: %s", clientAddress)
-		clientSocket.Close()
+	return renderTemplate(message, playerName)
+}
 
-	case errco.SERVER_STATUS_ONLINE:
-		// just open a connection with the server and connect it with the client
-		serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.TargetHost, config.TargetPort))
-		if err != nil {
-			errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_DIAL, errco.LVL_D, "HandleClientSocket", err.Error()))
-			// report dial error to client with text in the loadscreen
-			mes := buildMessage(errco.MESSAGE_FORMAT_TXT, "can't connect to server... check if minecraft server is running and set the correct targetPort")
-			clientSocket.Write(mes)
-			errco.Logln(errco.LVL_E, "%smsh --> client%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
-			return
-		}
+// renderTemplate replaces the placeholders of a message shown to players:
+// <player>, <progress>, <eta>, <restart> (next scheduled restart), <idle> (minutes before an empty server hibernates)
+// and <waiting> (players waiting for the starting server)
+func renderTemplate(message, playerName string) string {
+	if !strings.Contains(message, "<") {
+		return message
+	}
 
-		// stopC is used to close serv->client and client->serv at the same time
-		stopC := make(chan bool, 1)
+	restart := locale.T("restart.none")
+	if next, ok := servctrl.NextRestart(); ok {
+		restart = locale.T("restart.in", strings.TrimSuffix(time.Until(next).Round(time.Minute).String(), "0s"))
+	}
 
-		// launch proxy client -> server
-		go forward(clientSocket, serverSocket, false, stopC)
+	return strings.NewReplacer(
+		"<player>", playerName,
+		"<progress>", servstats.ProgressText(),
+		"<eta>", history.ETAText(),
+		"<restart>", restart,
+		"<idle>", strconv.Itoa(int(servctrl.IdleTimeout().Minutes())),
+		"<waiting>", waitingText(),
+	).Replace(message)
+}
 
-		// launch proxy server -> client
-		go forward(serverSocket, clientSocket, true, stopC)
+// waitMessage returns the loadscreen text shown to players while the minecraft server is starting:
+// text followed by the load progress and the estimated time left (ex: "Please wait... Preparing start region 45% (~90s left)")
+func waitMessage(text string) string {
+	text += " " + servstats.ProgressText()
+	if eta := history.ETAText(); eta != "" {
+		text += " (" + eta + ")"
 	}
+
+	return text
 }
 
 // forward takes a source and a destination net.Conn and forwards them.
-// (isServerToClient used to know the forward direction).
-// [goroutine]
-func forward(source, destination net.Conn, isServerToClient bool, stopC chan bool) {
-	data := make([]byte, 1024)
+// (isServerToClient used to know the forward direction, the traffic is counted in cs).
+// [blocking]
+func forward(source, destination net.Conn, isServerToClient bool, stopC chan bool, cs *servstats.ConnStats) {
+	// zero-copy fast path (linux tcp to tcp)
+	if canSplice(source, destination) {
+		forwardSplice(source, destination, isServerToClient, stopC, cs)
+		return
+	}
+
+	forwardBuffered(source, destination, isServerToClient, stopC, cs)
+}
+
+// forwardBuffered forwards source to destination through a user-space buffer (Proxy.BufferSize),
+// so that packets can be inspected.
+// [blocking]
+func forwardBuffered(source, destination net.Conn, isServerToClient bool, stopC chan bool, cs *servstats.ConnStats) {
+	bufferSize := config.ConfigRuntime.Proxy.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+	data := make([]byte, bufferSize)
 
 	for {
 		// if stopC receives true, close the source connection, otherwise continue
@@ -160,13 +187,22 @@ func forward(source, destination net.Conn, isServerToClient bool, stopC chan boo
 			}
 
 			// close the source connection
-			stopC <- true
+			stopForward(stopC)
+			source.Close()
+			return
+		}
+
+		// inject dropped connection (chaos testing)
+		if chaos.DropConnection() {
+			errco.Logln(errco.LVL_B, "chaos: dropping connection %15s --> %15s", strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0])
+			stopForward(stopC)
 			source.Close()
 			return
 		}
 
 		// write data to destination
 		destination.Write(data[:dataLen])
+		cs.Count(isServerToClient, dataLen, 1)
 
 		// calculate bytes/s to client/server
 		if errco.DebugLvl >= errco.LVL_D {
@@ -182,3 +218,20 @@ func forward(source, destination net.Conn, isServerToClient bool, stopC chan boo
 		}
 	}
 }
+
+// stopForward signals the opposite forward to stop.
+// The signal is not sent if it's already pending: the forward that ends second must not block on the full channel.
+func stopForward(stopC chan bool) {
+	select {
+	case stopC <- true:
+	default:
+	}
+}
+
+// socketIp returns the ip of the client connected to the socket (the proxy ip when msh is behind a proxy).
+// Clients are reported to the security log with this ip, since the player ip forwarded by a proxy can be spoofed.
+func socketIp(clientSocket net.Conn) string {
+	// handling of ipv6 addresses
+	li := strings.LastIndex(clientSocket.RemoteAddr().String(), ":")
+	return clientSocket.RemoteAddr().String()[:li]
+}
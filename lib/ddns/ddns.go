@@ -0,0 +1,245 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/outbound"
+)
+
+// ddns package keeps the hostname of a dynamic dns provider (Cloudflare, DuckDNS, generic http)
+// pointed to the current public ip, so that players can always connect by hostname.
+
+// defaultIpUrl is the service that returns the public ip as plain text if Ddns.IpUrl is not set
+const defaultIpUrl = "https://api.ipify.org"
+
+// lastIp is the public ip of the last successful update
+var lastIp string
+
+// Updater updates the dynamic dns hostname when msh starts and when the minecraft server wakes
+// (the public ip can change while the minecraft server is hibernating)
+// [goroutine]
+func Updater() {
+	if config.ConfigRuntime.Ddns.Provider == "" {
+		return
+	}
+
+	// subscribe before the first update so that no wake is missed
+	c := events.Subscribe(100)
+
+	update()
+
+	for e := range c {
+		if e.Type == events.SERVER_STARTING {
+			update()
+		}
+	}
+}
+
+// update updates the dynamic dns hostname if the public ip changed since the last update
+// [blocking]
+func update() {
+	client, errMsh := outbound.Client(15 * time.Second)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("update"))
+		return
+	}
+
+	ip, errMsh := publicIp(client)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("update"))
+		return
+	}
+	if ip == lastIp {
+		errco.Logln(errco.LVL_D, "public ip did not change (%s)", ip)
+		return
+	}
+
+	d := config.ConfigRuntime.Ddns
+
+	var err error
+	switch d.Provider {
+	case "cloudflare":
+		err = updateCloudflare(client, ip)
+	case "duckdns":
+		err = updateDuckDns(client, ip)
+	case "http":
+		err = updateHttp(client, ip)
+	}
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_DDNS_UPDATE, errco.LVL_B, "update", d.Provider+" hostname "+d.Hostname+" not updated: "+err.Error()))
+		return
+	}
+
+	lastIp = ip
+	errco.Logln(errco.LVL_B, "%s hostname %s updated to public ip %s", d.Provider, d.Hostname, ip)
+}
+
+// publicIp returns the public ip of the host (Ddns.IpUrl)
+func publicIp(client *http.Client) (string, *errco.Error) {
+	ipUrl := config.ConfigRuntime.Ddns.IpUrl
+	if ipUrl == "" {
+		ipUrl = defaultIpUrl
+	}
+
+	resp, err := client.Get(ipUrl)
+	if err != nil {
+		return "", errco.NewErr(errco.ERROR_DDNS_IP, errco.LVL_B, "publicIp", "can't get public ip: "+err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 100))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return "", errco.NewErr(errco.ERROR_DDNS_IP, errco.LVL_B, "publicIp", "can't get public ip from "+ipUrl+" (status "+resp.Status+")")
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil || ip.To4() == nil {
+		return "", errco.NewErr(errco.ERROR_DDNS_IP, errco.LVL_B, "publicIp", ipUrl+" did not return an ipv4 address")
+	}
+
+	return ip.String(), nil
+}
+
+// updateCloudflare points the A record Ddns.Hostname of zone Ddns.Cloudflare.ZoneId to ip
+// (the record is created if it does not exist)
+func updateCloudflare(client *http.Client, ip string) error {
+	cf := config.ConfigRuntime.Ddns.Cloudflare
+	hostname := config.ConfigRuntime.Ddns.Hostname
+	records := "https://api.cloudflare.com/client/v4/zones/" + url.PathEscape(cf.ZoneId) + "/dns_records"
+
+	var list struct {
+		Result []struct {
+			Id      string `json:"id"`
+			Content string `json:"content"`
+		} `json:"result"`
+	}
+	err := cloudflareRequest(client, http.MethodGet, records+"?type=A&name="+url.QueryEscape(hostname), nil, &list)
+	if err != nil {
+		return err
+	}
+
+	// minecraft connections can't be proxied by cloudflare
+	record := map[string]interface{}{"type": "A", "name": hostname, "content": ip, "ttl": 60, "proxied": false}
+
+	switch {
+	case len(list.Result) == 0:
+		return cloudflareRequest(client, http.MethodPost, records, record, nil)
+	case list.Result[0].Content == ip:
+		return nil
+	default:
+		return cloudflareRequest(client, http.MethodPut, records+"/"+list.Result[0].Id, record, nil)
+	}
+}
+
+// cloudflareRequest performs a cloudflare api request and decodes the response into v (if not nil)
+func cloudflareRequest(client *http.Client, method, address string, body map[string]interface{}, v interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, address, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigRuntime.Ddns.Cloudflare.ApiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(data, &result) != nil || !result.Success {
+		msg := resp.Status
+		if len(result.Errors) > 0 {
+			msg += ": " + result.Errors[0].Message
+		}
+		return fmt.Errorf("cloudflare api responded with status %s", msg)
+	}
+
+	if v != nil {
+		return json.Unmarshal(data, v)
+	}
+
+	return nil
+}
+
+// updateDuckDns points the DuckDNS subdomain of Ddns.Hostname to ip
+func updateDuckDns(client *http.Client, ip string) error {
+	d := config.ConfigRuntime.Ddns
+
+	query := url.Values{
+		"domains": {strings.TrimSuffix(d.Hostname, ".duckdns.org")},
+		"token":   {d.DuckDns.Token},
+		"ip":      {ip},
+	}
+	resp, err := client.Get("https://www.duckdns.org/update?" + query.Encode())
+	if err != nil {
+		return stripURL(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 100))
+	if strings.TrimSpace(string(body)) != "OK" {
+		return fmt.Errorf("duckdns responded with status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// updateHttp requests Ddns.Http.UpdateUrl (<ip> and <hostname> are replaced)
+func updateHttp(client *http.Client, ip string) error {
+	d := config.ConfigRuntime.Ddns
+
+	address := strings.NewReplacer("<ip>", url.QueryEscape(ip), "<hostname>", url.QueryEscape(d.Hostname)).Replace(d.Http.UpdateUrl)
+	resp, err := client.Get(address)
+	if err != nil {
+		return stripURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("update url responded with status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// stripURL removes the request url from a request error (urls can contain tokens)
+func stripURL(err error) error {
+	if uErr, ok := err.(*url.Error); ok {
+		return uErr.Err
+	}
+
+	return err
+}
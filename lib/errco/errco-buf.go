@@ -0,0 +1,98 @@
+package errco
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogBuf contains the most recent msh and minecraft server log lines
+var LogBuf *logBuffer = &logBuffer{size: 5000}
+
+// logBuffer is a ring buffer of log lines
+type logBuffer struct {
+	m     sync.Mutex
+	lines []LogLine // ring buffer data
+	next  int       // index of lines where the next line is written
+	size  int       // maximum number of lines stored
+	seq   uint64    // sequence number of the last line written
+}
+
+// LogLine is a log line stored in the log buffer
+type LogLine struct {
+	Seq  uint64    `json:"seq"`  // incremental line number
+	Time time.Time `json:"time"` // time of logging
+	Type string    `json:"type"` // log type (info, serv, byte, error)
+	Text string    `json:"text"` // log text without terminal colors
+}
+
+// colorRegexp matches the terminal color codes
+var colorRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// SetSize sets the maximum number of lines stored by the log buffer (the most recent lines are kept)
+func (lb *logBuffer) SetSize(size int) {
+	lines := lb.Get(size, 0, "")
+
+	lb.m.Lock()
+	defer lb.m.Unlock()
+
+	if size <= 0 {
+		lines = nil
+	}
+
+	lb.size = size
+	lb.lines = lines
+	lb.next = 0
+}
+
+// add stores a log line in the log buffer
+func (lb *logBuffer) add(logType, text string) {
+	lb.m.Lock()
+	defer lb.m.Unlock()
+
+	if lb.size <= 0 {
+		return
+	}
+
+	lb.seq++
+	line := LogLine{lb.seq, time.Now(), logType, colorRegexp.ReplaceAllString(text, "")}
+
+	// fill the buffer before starting to overwrite older lines
+	if len(lb.lines) < lb.size {
+		lb.lines = append(lb.lines, line)
+		return
+	}
+
+	lb.lines[lb.next] = line
+	lb.next = (lb.next + 1) % lb.size
+}
+
+// Get returns the last n log lines (from oldest to newest) that have a sequence number higher than since
+// and that contain filter (case insensitive). If n <= 0 all matching lines are returned.
+func (lb *logBuffer) Get(n int, since uint64, filter string) []LogLine {
+	lb.m.Lock()
+	defer lb.m.Unlock()
+
+	filter = strings.ToLower(filter)
+	res := []LogLine{}
+
+	// iterate from newest to oldest line
+	for i := 0; i < len(lb.lines) && (n <= 0 || len(res) < n); i++ {
+		line := lb.lines[(lb.next-1-i+2*len(lb.lines))%len(lb.lines)]
+		if line.Seq <= since {
+			break
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(line.Text), filter) {
+			continue
+		}
+		res = append(res, line)
+	}
+
+	// reverse result to have lines from oldest to newest
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return res
+}
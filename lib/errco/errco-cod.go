@@ -11,6 +11,27 @@ package errco
 0x0005xxxx: utility package
 0x0006xxxx: main
 0x0007xxxx: input package
+0x0008xxxx: api package
+0x0009xxxx: command line package
+0x000axxxx: events package
+0x000bxxxx: outbound package
+0x000cxxxx: system monitor package
+0x000dxxxx: usage package
+0x000exxxx: chaos package
+0x000fxxxx: hooks package
+0x0010xxxx: mqtt package
+0x0011xxxx: world package
+0x0012xxxx: history package
+0x0013xxxx: wake package
+0x0014xxxx: locale package
+0x0015xxxx: notify package
+0x0016xxxx: provision package
+0x0017xxxx: ddns package
+0x0018xxxx: handover package
+0x0019xxxx: security package
+0x001axxxx: plugin package
+
+error codes are stable: new errors must also be registered in errco-reg.go
 */
 
 // ------------------- codes ------------------- //
@@ -36,6 +57,7 @@ const (
 	CLIENT_REQ_JOIN     = 0x00020002 // client request server join
 	MESSAGE_FORMAT_TXT  = 0x00020003 // message to client should be built as TXT
 	MESSAGE_FORMAT_INFO = 0x00020004 // message to client should be built as INFO
+	MESSAGE_FORMAT_JSON = 0x00020005 // message to client is json data (text component or server info)
 )
 
 // ------------------- errors ------------------ //
@@ -50,14 +72,49 @@ const (
 	ERROR_SERVER_MUST_WAIT    = 0x0000f102 // msh issued ms stop ahead of specified wait time
 	ERROR_SERVER_UNEXP_OUTPUT = 0x0000f103 // server output does not adhere to expected log format
 	ERROR_SERVER_KILL         = 0x0000f104 // error while killing server process
+	ERROR_SERVER_CRASHED      = 0x0000f105 // minecraft server process exited unexpectedly
+	ERROR_SERVER_CRASH_LOOP   = 0x0000f106 // minecraft server keeps crashing after restart attempts
+	ERROR_SERVER_HANG         = 0x0000f107 // minecraft server is not responding
+	ERROR_SERVER_NOT_READY    = 0x0000f108 // minecraft server readiness probe failed
+	ERROR_SERVER_ALWAYS_ON    = 0x0000f109 // minecraft server hibernation is disabled by an always-on period
+	ERROR_SERVER_LOCKED       = 0x0000f10a // minecraft server is locked by an admin
+	ERROR_SERVER_RELEASED     = 0x0000f10b // minecraft server is managed by a new msh instance
+	ERROR_SERVER_DRAINING     = 0x0000f10c // msh is draining (maintenance)
+	ERROR_SERVER_KEEPALIVE    = 0x0000f10d // minecraft server hibernation is suspended by a keep-alive
+	ERROR_SERVER_MIN_ONLINE   = 0x0000f10e // minecraft server must stay online longer before freezing
+	ERROR_WAKE_LIMIT          = 0x0000f10f // minecraft server was woken up too many times in the last hour
 	ERROR_PIPE_INPUT_WRITE    = 0x0000f200 // error while writing to terminal input
 	ERROR_PIPE_LOAD           = 0x0000f201 // error while loading pipe
+	ERROR_PIPE_LINE_DROPPED   = 0x0000f202 // terminal output lines dropped
+	ERROR_EXECUTE_TIMEOUT     = 0x0000f203 // terminal command output not completed before timeout
+	ERROR_COMMAND_NOT_VALID   = 0x0000f204 // terminal command contains control characters
 	ERROR_CONVERSION          = 0x0000f300 // error while converting variable
+	ERROR_STATE_FILE          = 0x0000f400 // error while writing state file
+	ERROR_BACKEND             = 0x0000f500 // error in minecraft server backend
+	ERROR_DETACH              = 0x0000f600 // error while detaching/reattaching the minecraft server
+	ERROR_CONSOLE_FILE        = 0x0000f700 // error while writing the console log file
+	ERROR_LOCK_FILE           = 0x0000f800 // error while reading/writing the lock file
+	ERROR_DRAIN_FILE          = 0x0000f801 // error while reading/writing the drain file
+	ERROR_KEEPALIVE_FILE      = 0x0000f802 // error while reading/writing the keep-alive file
+	ERROR_STATUS_CACHE_FILE   = 0x0000f803 // error while reading/writing the status cache file
+	ERROR_PREFLIGHT           = 0x0000f900 // minecraft server preflight check failed (disk space, java)
+	ERROR_CHAT_COMMAND        = 0x0000fa00 // error while handling a msh command sent in game chat
+	ERROR_PRE_STOP_COMMAND    = 0x0000fb00 // pre-stop command failed or did not complete before timeout
+	ERROR_START_EULA          = 0x0000fc00 // minecraft server startup failed: eula not accepted
+	ERROR_START_PORT_BIND     = 0x0000fc01 // minecraft server startup failed: server port can't be bound
+	ERROR_START_JAVA_VERSION  = 0x0000fc02 // minecraft server startup failed: java version not supported
+	ERROR_START_OUT_OF_MEMORY = 0x0000fc03 // minecraft server startup failed: java out of memory
+	ERROR_START_WORLD         = 0x0000fc04 // minecraft server startup failed: world can't be loaded
+	ERROR_START_EXITED        = 0x0000fc05 // minecraft server startup failed: process exited before going online
+	ERROR_START_TIMEOUT       = 0x0000fc06 // minecraft server did not go online before the startup timeout
 
 	// program manager package
 
 	ERROR_VERSION            = 0x0001f000 // check update error
 	ERROR_VERSION_COMPARISON = 0x0001f001 // delta version calculation error
+	ERROR_UPDATE_DOWNLOAD    = 0x0001f100 // error while downloading msh update
+	ERROR_UPDATE_CHECKSUM    = 0x0001f101 // msh update checksum not found or not matching
+	ERROR_UPDATE_INSTALL     = 0x0001f102 // error while replacing msh executable
 
 	// server connection package
 
@@ -68,17 +125,35 @@ const (
 	ERROR_SERVER_REQUEST_INFO = 0x0002f201 // error while msh server info request
 	ERROR_JSON_MARSHAL        = 0x0002f300 // error while exporting struct to json bytes
 	ERROR_JSON_UNMARSHAL      = 0x0002f301 // error while importing struct from json bytes
+	ERROR_MIRROR_PRIMARY      = 0x0002f400 // error while retrieving primary msh status
+	ERROR_FORWARDING          = 0x0002f500 // proxy forwarding data is not valid
+	ERROR_WAKE_COOLDOWN       = 0x0002f600 // player triggered too many wakes in the cooldown period
+	ERROR_AUX_FORWARD         = 0x0002f700 // error in an auxiliary forward
 
 	// config package
 
-	ERROR_CONFIG_LOAD  = 0x0003f000 // error while loading config
-	ERROR_CONFIG_SAVE  = 0x0003f001 // error while saving config to file
-	ERROR_CONFIG_CHECK = 0x0003f002 // error while checking config
-	ERROR_ICON_LOAD    = 0x0003f100 // error while loading icon
+	ERROR_CONFIG_LOAD    = 0x0003f000 // error while loading config
+	ERROR_CONFIG_SAVE    = 0x0003f001 // error while saving config to file
+	ERROR_CONFIG_CHECK   = 0x0003f002 // error while checking config
+	ERROR_CONFIG_PROFILE = 0x0003f003 // error while switching config profile
+	ERROR_CONFIG_SECRET  = 0x0003f004 // error while resolving a config secret reference
+	ERROR_JAVA_TUNING    = 0x0003f005 // error while tuning the java parameters of the start command
+	ERROR_ICON_LOAD      = 0x0003f100 // error while loading icon
+	ERROR_PORT_BUSY      = 0x0003f200 // minecraft server or msh port is not available
 
 	// operative system package
 
 	ERROR_OS_NOT_SUPPORTED = 0x0004f000 // OS not supported
+	ERROR_MSH_RESTART      = 0x0004f001 // error while restarting msh
+	ERROR_PROCESS_PRIORITY = 0x0004f100 // error while setting process priority
+	ERROR_PROCESS_SIGNAL   = 0x0004f101 // error while sending a signal to a process group
+	ERROR_PROCESS_AFFINITY = 0x0004f102 // error while setting process cpu affinity
+	ERROR_PROCESS_TREE     = 0x0004f103 // error while reading the process tree
+	ERROR_FILE_LOCK        = 0x0004f200 // error while checking file lock
+	ERROR_DISK_FREE        = 0x0004f300 // error while reading volume free space
+	ERROR_FIFO_CREATE      = 0x0004f400 // error while creating a named pipe
+	ERROR_HOST_MEMORY      = 0x0004f500 // error while reading host available memory
+	ERROR_TCP_STATS        = 0x0004f600 // error while reading tcp connection statistics
 
 	// utility package
 
@@ -95,4 +170,109 @@ const (
 	ERROR_COMMAND_UNKNOWN   = 0x0007f001 // command is unknown
 	ERROR_INPUT_READ        = 0x0007f100 // error while reading input)
 	ERROR_INPUT_UNAVAILABLE = 0x0007f101 // stdin is not available
+	ERROR_INPUT_FIFO        = 0x0007f102 // error while reading the command fifo
+
+	// api package
+
+	ERROR_API_LISTEN       = 0x0008f000 // error while listening for api requests
+	ERROR_API_REQUEST      = 0x0008f100 // api request is not valid
+	ERROR_API_METHOD       = 0x0008f101 // api request method is not allowed
+	ERROR_API_UNAUTHORIZED = 0x0008f200 // api request is not authorized
+	ERROR_API_FORBIDDEN    = 0x0008f201 // api token is not allowed to perform the request
+	ERROR_API_WEBSOCKET    = 0x0008f300 // error on an api websocket connection
+	ERROR_API_TLS          = 0x0008f400 // error while loading the api tls certificates
+
+	// command line package
+
+	ERROR_CLI_COMMAND  = 0x0009f000 // command line subcommand is unknown or malformed
+	ERROR_CLI_API_CALL = 0x0009f100 // error while calling the api of the running msh instance
+	ERROR_CLI_REPORT   = 0x0009f200 // error while writing the report archive
+
+	// events package
+
+	ERROR_EVENT_DROPPED = 0x000af000 // event dropped since subscriber is full
+	ERROR_EVENT_FILE    = 0x000af100 // error while writing event file
+	ERROR_EVENT_WEBHOOK = 0x000af200 // error while delivering event webhook
+
+	// outbound package
+
+	ERROR_OUTBOUND_PROXY = 0x000bf000 // outbound proxy is not valid
+	ERROR_OUTBOUND_CA    = 0x000bf001 // error while loading additional ca certificates
+	ERROR_OUTBOUND_DIAL  = 0x000bf002 // error while opening an outbound connection
+
+	// system monitor package
+
+	ERROR_SYSMON_NOT_SUPPORTED = 0x000cf000 // resource monitoring is not supported on this OS
+	ERROR_SYSMON_READ          = 0x000cf001 // error while reading resource usage
+
+	// usage package
+
+	ERROR_USAGE_LOAD     = 0x000df000 // error while loading usage file
+	ERROR_USAGE_SAVE     = 0x000df001 // error while saving usage file
+	ERROR_QUOTA_EXCEEDED = 0x000df100 // monthly playtime quota exceeded
+	ERROR_QUOTA_TOKEN    = 0x000df101 // quota override token is not valid
+
+	// chaos package
+
+	ERROR_CHAOS_INJECTED = 0x000ef000 // failure injected on purpose
+
+	// hooks package
+
+	ERROR_HOOK_RUN = 0x000ff000 // error while running hook command
+
+	// mqtt package
+
+	ERROR_MQTT_CONNECTION = 0x0010f000 // error in the connection with the mqtt broker
+	ERROR_MQTT_PROTOCOL   = 0x0010f001 // unexpected or malformed mqtt packet
+
+	// world package
+
+	ERROR_WORLD_LOCKED    = 0x0011f000 // world is locked by another process
+	ERROR_WORLD_CORRUPTED = 0x0011f001 // world files failed the integrity check
+	ERROR_WORLD_BACKUP    = 0x0011f100 // error while reading world backups
+	ERROR_WORLD_RESTORE   = 0x0011f101 // error while restoring world from backup
+
+	// history package
+
+	ERROR_HISTORY_LOAD = 0x0012f000 // error while loading history file
+	ERROR_HISTORY_SAVE = 0x0012f001 // error while saving history file
+	ERROR_AUDIT_FILE   = 0x0012f002 // error while reading or writing the audit file
+
+	// wake package
+
+	ERROR_WAKE_DNS  = 0x0013f000 // error in the dns wake listener
+	ERROR_WAKE_IMAP = 0x0013f100 // error while polling the imap wake mailbox
+
+	// locale package
+
+	ERROR_LOCALE_LOAD = 0x0014f000 // error while loading the language catalog
+
+	// notify package
+
+	ERROR_NOTIFY_DELIVERY = 0x0015f000 // error while delivering a notification
+	ERROR_TELEGRAM_BOT    = 0x0015f100 // error while receiving the telegram bot commands
+
+	// provision package
+
+	ERROR_PROVISION_DOWNLOAD = 0x0016f000 // error while downloading the server jar
+	ERROR_PROVISION_HASH     = 0x0016f001 // downloaded server jar does not match the published checksum
+
+	// ddns package
+
+	ERROR_DDNS_IP     = 0x0017f000 // error while getting the public ip
+	ERROR_DDNS_UPDATE = 0x0017f001 // error while updating the dynamic dns provider
+
+	// handover package
+
+	ERROR_HANDOVER = 0x0018f000 // error while handing over the listeners to a new msh process
+
+	// security package
+
+	ERROR_SECURITY_FILE = 0x0019f000 // error while writing the security log file
+
+	// plugin package
+
+	ERROR_PLUGIN_PROCESS = 0x001af000 // error while starting or running a plugin process
+	ERROR_PLUGIN_RPC     = 0x001af001 // malformed or failed json-rpc message exchanged with a plugin
+	ERROR_PLUGIN_VETO    = 0x001af100 // minecraft server wake-up refused by a plugin
 )
@@ -0,0 +1,127 @@
+package errco
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// console rule actions
+const (
+	RULE_HIDE      = "hide"      // the console line is not printed nor stored in the log buffer
+	RULE_HIGHLIGHT = "highlight" // the console line is printed with the rule color
+)
+
+// ConsoleRule is a rule applied to the minecraft server console lines matching a regex
+type ConsoleRule struct {
+	Match  string `json:"match"`
+	Action string `json:"action"`
+	Color  string `json:"color"`
+	re     *regexp.Regexp
+}
+
+var (
+	rulesM sync.Mutex
+	rules  []*ConsoleRule
+)
+
+// NewConsoleRule returns a new console rule.
+// Color is used by highlight rules (red - green - yellow - blue - purple - cyan, default yellow).
+func NewConsoleRule(match, action, color string) (*ConsoleRule, error) {
+	if action != RULE_HIDE && action != RULE_HIGHLIGHT {
+		return nil, fmt.Errorf("console rule action is not valid: %s (hide - highlight)", action)
+	}
+	switch {
+	case action == RULE_HIDE:
+		color = ""
+	case color == "":
+		color = "yellow"
+	}
+	if _, ok := colorByName(color); !ok && action == RULE_HIGHLIGHT {
+		return nil, fmt.Errorf("console rule color is not valid: %s", color)
+	}
+
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConsoleRule{Match: match, Action: action, Color: color, re: re}, nil
+}
+
+// SetConsoleRules replaces the console rules
+func SetConsoleRules(r []*ConsoleRule) {
+	rulesM.Lock()
+	defer rulesM.Unlock()
+
+	rules = r
+}
+
+// AddConsoleRule appends a console rule
+func AddConsoleRule(r *ConsoleRule) {
+	rulesM.Lock()
+	defer rulesM.Unlock()
+
+	rules = append(rules, r)
+}
+
+// RemoveConsoleRule removes the console rule at index i (returns false if i is not valid)
+func RemoveConsoleRule(i int) bool {
+	rulesM.Lock()
+	defer rulesM.Unlock()
+
+	if i < 0 || i >= len(rules) {
+		return false
+	}
+	rules = append(rules[:i:i], rules[i+1:]...)
+
+	return true
+}
+
+// ConsoleRules returns the console rules
+func ConsoleRules() []*ConsoleRule {
+	rulesM.Lock()
+	defer rulesM.Unlock()
+
+	return append([]*ConsoleRule{}, rules...)
+}
+
+// applyConsoleRules returns whether the console line should be hidden and its highlight color
+// (the first matching rule is applied)
+func applyConsoleRules(line string) (bool, string) {
+	rulesM.Lock()
+	defer rulesM.Unlock()
+
+	for _, r := range rules {
+		if !r.re.MatchString(line) {
+			continue
+		}
+		if r.Action == RULE_HIDE {
+			return true, ""
+		}
+		color, _ := colorByName(r.Color)
+		return false, color
+	}
+
+	return false, ""
+}
+
+// colorByName returns the terminal color with the specified name (false if the name is not valid)
+func colorByName(name string) (string, bool) {
+	switch name {
+	case "red":
+		return COLOR_RED, true
+	case "green":
+		return COLOR_GREEN, true
+	case "yellow":
+		return COLOR_YELLOW, true
+	case "blue":
+		return COLOR_BLUE, true
+	case "purple":
+		return COLOR_PURPLE, true
+	case "cyan":
+		return COLOR_CYAN, true
+	default:
+		return "", false
+	}
+}
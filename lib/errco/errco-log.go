@@ -2,6 +2,7 @@ package errco
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"time"
 )
@@ -18,46 +19,134 @@ const (
 	LVL_E = 4 // BYTE: connection bytes log
 )
 
-// constants to print color text on terminal
-const (
+// colors to print text on terminal
+// (empty when the terminal does not support colors, see colorEnabled)
+var (
 	COLOR_RESET = "\033[0m"
 
 	COLOR_GRAY   = "\033[1;30m" // used for server logs
 	COLOR_RED    = "\033[0;31m" // used for errors
-	COLOR_GREEN  = "\033[0;32m"
-	COLOR_YELLOW = "\033[0;33m" // used for commands
+	COLOR_GREEN  = "\033[0;32m" // used for state changes
+	COLOR_YELLOW = "\033[0;33m" // used for commands and server errors
 	COLOR_BLUE   = "\033[0;34m"
 	COLOR_PURPLE = "\033[0;35m"
 	COLOR_CYAN   = "\033[0;36m"
 )
 
-// Logln prints the args if debug option is set to true
+// log source column: msh messages and minecraft server console lines
+const (
+	sourceMsh  = "msh"
+	sourceServ = "mc "
+)
+
+func init() {
+	if !colorEnabled() {
+		COLOR_RESET, COLOR_GRAY, COLOR_RED, COLOR_GREEN, COLOR_YELLOW, COLOR_BLUE, COLOR_PURPLE, COLOR_CYAN = "", "", "", "", "", "", "", ""
+	}
+}
+
+// colorEnabled returns true if colored output should be printed:
+// NO_COLOR (https://no-color.org) and dumb terminals disable colors,
+// FORCE_COLOR enables colors also when output is not a terminal (ex: docker logs)
+func colorEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	if os.Getenv("FORCE_COLOR") != "" {
+		return true
+	}
+
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// header returns the log line header: time, type, level and source columns
+func header(logType, color string, lvl int, source string) string {
+	return fmt.Sprintf("%s [%s%-5s%s %-4s] %s |", time.Now().Format("2006/01/02 15:04:05"), color, logType, COLOR_RESET, strings.Repeat("*", 4-lvl), source)
+}
+
+// Logln prints the args if debug option is set to true.
+// Base and minecraft server logs are always stored in the log buffer.
+// Secrets are redacted (see AddSecrets).
 func Logln(lvl int, s string, args ...interface{}) {
-	if lvl <= DebugLvl {
-		var logType string
-		switch lvl {
-		case LVL_C:
-			logType = "serv"
-		case LVL_E:
-			logType = "byte"
-		default:
-			logType = "info"
-		}
+	var logType string
+	switch lvl {
+	case LVL_C:
+		logType = "serv"
+	case LVL_E:
+		logType = "byte"
+	default:
+		logType = "info"
+	}
+
+	if lvl > DebugLvl && lvl > LVL_C {
+		return
+	}
 
-		header := fmt.Sprintf("%s [%s%s%s  %-4s]", time.Now().Format("2006/01/02 15:04:05"), COLOR_BLUE, logType, COLOR_RESET, strings.Repeat("*", 4-lvl))
+	text := Redact(fmt.Sprintf(s, args...))
 
+	LogBuf.add(logType, text)
+
+	if lvl <= DebugLvl {
 		// make important logs more visible
 		if lvl == LVL_A {
-			s = COLOR_CYAN + s + COLOR_RESET
+			text = COLOR_CYAN + text + COLOR_RESET
+		}
+
+		fmt.Println(header(logType, COLOR_BLUE, lvl, sourceMsh) + " " + text)
+	}
+}
+
+// LogState prints a minecraft server state change (highlighted)
+func LogState(s string, args ...interface{}) {
+	text := Redact(fmt.Sprintf(s, args...))
+
+	LogBuf.add("info", text)
+
+	if LVL_B <= DebugLvl {
+		fmt.Println(header("info", COLOR_BLUE, LVL_B, sourceMsh) + " " + COLOR_GREEN + text + COLOR_RESET)
+	}
+}
+
+// LogServLine prints a line of the minecraft server console output (stderr lines are highlighted).
+// Minecraft server lines are always stored in the log buffer, unless hidden by a console rule.
+func LogServLine(line string, stderr bool) {
+	hide, ruleColor := applyConsoleRules(line)
+	if hide {
+		return
+	}
+
+	LogBuf.add("serv", line)
+
+	if LVL_C <= DebugLvl {
+		color := COLOR_GRAY
+		if stderr {
+			color = COLOR_YELLOW
+		}
+		if ruleColor != "" {
+			color = ruleColor
 		}
 
-		fmt.Printf(header+" "+s+"\n", args...)
+		fmt.Println(header("serv", COLOR_BLUE, LVL_C, sourceServ) + " " + color + line + COLOR_RESET)
 	}
 }
 
+// LogMshErr prints the msh error if its level is lower or equal than the debug level.
+// Base and minecraft server errors are always stored in the log buffer.
 func LogMshErr(errMsh *Error) {
+	if errMsh.Lvl > DebugLvl && errMsh.Lvl > LVL_C {
+		return
+	}
+
+	text := "[" + CodeString(errMsh.Cod) + "] " + errMsh.Ori + ": " + Redact(errMsh.Str)
+
+	LogBuf.add("error", text)
+
 	if errMsh.Lvl <= DebugLvl {
-		header := fmt.Sprintf("%s [%serror %s%-4s]", time.Now().Format("2006/01/02 15:04:05"), COLOR_RED, COLOR_RESET, strings.Repeat("*", 4-errMsh.Lvl))
-		fmt.Printf(header + " " + errMsh.Ori + ": " + errMsh.Str + "\n")
+		fmt.Println(header("error", COLOR_RED, errMsh.Lvl, sourceMsh) + " " + text)
 	}
 }
@@ -0,0 +1,67 @@
+package errco
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedText replaces the secrets in the log output
+const redactedText = "[redacted]"
+
+// minSecretLen is the minimum length of a redacted secret
+// (shorter values would redact common words and numbers from the log output)
+const minSecretLen = 4
+
+var (
+	secretsM sync.Mutex
+
+	// secrets contains the values redacted from the log output
+	secrets = map[string]bool{}
+
+	// secretsReplacer replaces the secrets with redactedText (nil if there are no secrets)
+	secretsReplacer *strings.Replacer
+)
+
+// AddSecrets adds values (tokens, passwords) to the secrets redacted from the log output
+func AddSecrets(values ...string) {
+	secretsM.Lock()
+	defer secretsM.Unlock()
+
+	changed := false
+	for _, v := range values {
+		if len(v) >= minSecretLen && !secrets[v] {
+			secrets[v] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// longer secrets first: a secret containing another secret is redacted as a whole
+	sorted := []string{}
+	for s := range secrets {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	oldnew := []string{}
+	for _, s := range sorted {
+		oldnew = append(oldnew, s, redactedText)
+	}
+	secretsReplacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact returns s with the secrets replaced by [redacted]
+func Redact(s string) string {
+	secretsM.Lock()
+	r := secretsReplacer
+	secretsM.Unlock()
+
+	if r == nil {
+		return s
+	}
+
+	return r.Replace(s)
+}
@@ -0,0 +1,328 @@
+package errco
+
+import (
+	"fmt"
+	"sort"
+)
+
+// error severities
+const (
+	SEV_WARNING = "warning" // msh keeps working as expected (ex: request refused)
+	SEV_ERROR   = "error"   // an operation failed, msh keeps running
+	SEV_FATAL   = "fatal"   // msh can't start (msh exits with the error exit code)
+)
+
+// msh exit codes
+const (
+	EXIT_OK        = 0 // msh exited normally
+	EXIT_ERROR     = 1 // msh exited because of an error with no specific exit code
+	EXIT_CONFIG    = 2 // config file is missing or not valid
+	EXIT_PORT      = 3 // msh or minecraft server port is already in use
+	EXIT_OS        = 4 // operating system is not supported
+	EXIT_CLI       = 5 // command line subcommand is unknown or malformed
+	EXIT_CLI_CALL  = 6 // running msh instance api is not reachable (command line subcommands)
+	EXIT_PROVISION = 7 // server jar could not be provisioned (Provision)
+)
+
+// ErrInfo describes a msh error code
+type ErrInfo struct {
+	Code     int    `json:"code"`
+	Hex      string `json:"hex"`
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Category string `json:"category"`
+	Exit     int    `json:"exitCode"`
+	Desc     string `json:"description"`
+}
+
+// regEntry is a registered error code
+type regEntry struct {
+	name     string
+	severity string
+	desc     string
+}
+
+// categories are the packages that own the error codes (index: code bits 16-31, see errco-cod.go)
+var categories = []string{
+	"servctrl", "progmgr", "conn", "config", "opsys", "utility", "main", "input", "api", "cli",
+	"events", "outbound", "sysmon", "usage", "chaos", "hooks", "mqtt", "world", "history", "wake", "locale", "notify",
+	"provision", "ddns", "handover", "security", "plugin",
+}
+
+// exitCodes are the msh exit codes of the errors that prevent msh from starting
+var exitCodes = map[int]int{
+	ERROR_CONFIG_LOAD:        EXIT_CONFIG,
+	ERROR_CONFIG_CHECK:       EXIT_CONFIG,
+	ERROR_CONFIG_SECRET:      EXIT_CONFIG,
+	ERROR_PORT_BUSY:          EXIT_PORT,
+	ERROR_CLIENT_LISTEN:      EXIT_PORT,
+	ERROR_OS_NOT_SUPPORTED:   EXIT_OS,
+	ERROR_CLI_COMMAND:        EXIT_CLI,
+	ERROR_CLI_API_CALL:       EXIT_CLI_CALL,
+	ERROR_PROVISION_DOWNLOAD: EXIT_PROVISION,
+	ERROR_PROVISION_HASH:     EXIT_PROVISION,
+}
+
+// registry contains all msh error codes: codes are stable, new errors must be registered here
+var registry = map[int]regEntry{
+	// server control package
+
+	ERROR_TERMINAL_NOT_ACTIVE: {"ERROR_TERMINAL_NOT_ACTIVE", SEV_ERROR, "server terminal is not active"},
+	ERROR_TERMINAL_START:      {"ERROR_TERMINAL_START", SEV_ERROR, "error while starting server terminal"},
+	ERROR_SERVER_NOT_ONLINE:   {"ERROR_SERVER_NOT_ONLINE", SEV_ERROR, "server is not online"},
+	ERROR_SERVER_NOT_EMPTY:    {"ERROR_SERVER_NOT_EMPTY", SEV_WARNING, "minecraft server is not empty"},
+	ERROR_SERVER_MUST_WAIT:    {"ERROR_SERVER_MUST_WAIT", SEV_WARNING, "msh issued ms stop ahead of specified wait time"},
+	ERROR_SERVER_UNEXP_OUTPUT: {"ERROR_SERVER_UNEXP_OUTPUT", SEV_WARNING, "server output does not adhere to expected log format"},
+	ERROR_SERVER_KILL:         {"ERROR_SERVER_KILL", SEV_ERROR, "error while killing server process"},
+	ERROR_SERVER_CRASHED:      {"ERROR_SERVER_CRASHED", SEV_ERROR, "minecraft server process exited unexpectedly"},
+	ERROR_SERVER_CRASH_LOOP:   {"ERROR_SERVER_CRASH_LOOP", SEV_ERROR, "minecraft server keeps crashing after restart attempts"},
+	ERROR_SERVER_HANG:         {"ERROR_SERVER_HANG", SEV_ERROR, "minecraft server is not responding"},
+	ERROR_SERVER_NOT_READY:    {"ERROR_SERVER_NOT_READY", SEV_ERROR, "minecraft server readiness probe failed"},
+	ERROR_SERVER_ALWAYS_ON:    {"ERROR_SERVER_ALWAYS_ON", SEV_WARNING, "minecraft server hibernation is disabled by an always-on period"},
+	ERROR_SERVER_LOCKED:       {"ERROR_SERVER_LOCKED", SEV_WARNING, "minecraft server is locked by an admin"},
+	ERROR_SERVER_RELEASED:     {"ERROR_SERVER_RELEASED", SEV_WARNING, "minecraft server is managed by a new msh instance"},
+	ERROR_SERVER_DRAINING:     {"ERROR_SERVER_DRAINING", SEV_WARNING, "msh is draining (maintenance)"},
+	ERROR_SERVER_KEEPALIVE:    {"ERROR_SERVER_KEEPALIVE", SEV_WARNING, "minecraft server hibernation is suspended by a keep-alive"},
+	ERROR_SERVER_MIN_ONLINE:   {"ERROR_SERVER_MIN_ONLINE", SEV_WARNING, "minecraft server must stay online longer before freezing"},
+	ERROR_WAKE_LIMIT:          {"ERROR_WAKE_LIMIT", SEV_WARNING, "minecraft server was woken up too many times in the last hour"},
+	ERROR_PIPE_INPUT_WRITE:    {"ERROR_PIPE_INPUT_WRITE", SEV_ERROR, "error while writing to terminal input"},
+	ERROR_PIPE_LOAD:           {"ERROR_PIPE_LOAD", SEV_ERROR, "error while loading pipe"},
+	ERROR_PIPE_LINE_DROPPED:   {"ERROR_PIPE_LINE_DROPPED", SEV_WARNING, "terminal output lines dropped"},
+	ERROR_EXECUTE_TIMEOUT:     {"ERROR_EXECUTE_TIMEOUT", SEV_ERROR, "terminal command output not completed before timeout"},
+	ERROR_COMMAND_NOT_VALID:   {"ERROR_COMMAND_NOT_VALID", SEV_ERROR, "terminal command contains control characters"},
+	ERROR_CONVERSION:          {"ERROR_CONVERSION", SEV_ERROR, "error while converting variable"},
+	ERROR_STATE_FILE:          {"ERROR_STATE_FILE", SEV_ERROR, "error while writing state file"},
+	ERROR_BACKEND:             {"ERROR_BACKEND", SEV_ERROR, "error in minecraft server backend"},
+	ERROR_DETACH:              {"ERROR_DETACH", SEV_ERROR, "error while detaching/reattaching the minecraft server"},
+	ERROR_CONSOLE_FILE:        {"ERROR_CONSOLE_FILE", SEV_ERROR, "error while writing the console log file"},
+	ERROR_LOCK_FILE:           {"ERROR_LOCK_FILE", SEV_ERROR, "error while reading/writing the lock file"},
+	ERROR_DRAIN_FILE:          {"ERROR_DRAIN_FILE", SEV_ERROR, "error while reading/writing the drain file"},
+	ERROR_KEEPALIVE_FILE:      {"ERROR_KEEPALIVE_FILE", SEV_ERROR, "error while reading/writing the keep-alive file"},
+	ERROR_STATUS_CACHE_FILE:   {"ERROR_STATUS_CACHE_FILE", SEV_WARNING, "error while reading/writing the status cache file"},
+	ERROR_PREFLIGHT:           {"ERROR_PREFLIGHT", SEV_ERROR, "minecraft server preflight check failed (disk space, java)"},
+	ERROR_CHAT_COMMAND:        {"ERROR_CHAT_COMMAND", SEV_WARNING, "error while handling a msh command sent in game chat"},
+	ERROR_PRE_STOP_COMMAND:    {"ERROR_PRE_STOP_COMMAND", SEV_ERROR, "pre-stop command failed or did not complete before timeout"},
+	ERROR_START_EULA:          {"ERROR_START_EULA", SEV_ERROR, "minecraft server startup failed: eula not accepted"},
+	ERROR_START_PORT_BIND:     {"ERROR_START_PORT_BIND", SEV_ERROR, "minecraft server startup failed: server port can't be bound"},
+	ERROR_START_JAVA_VERSION:  {"ERROR_START_JAVA_VERSION", SEV_ERROR, "minecraft server startup failed: java version not supported"},
+	ERROR_START_OUT_OF_MEMORY: {"ERROR_START_OUT_OF_MEMORY", SEV_ERROR, "minecraft server startup failed: java out of memory"},
+	ERROR_START_WORLD:         {"ERROR_START_WORLD", SEV_ERROR, "minecraft server startup failed: world can't be loaded"},
+	ERROR_START_EXITED:        {"ERROR_START_EXITED", SEV_ERROR, "minecraft server startup failed: process exited before going online"},
+	ERROR_START_TIMEOUT:       {"ERROR_START_TIMEOUT", SEV_ERROR, "minecraft server did not go online before the startup timeout"},
+
+	// program manager package
+
+	ERROR_VERSION:            {"ERROR_VERSION", SEV_WARNING, "check update error"},
+	ERROR_VERSION_COMPARISON: {"ERROR_VERSION_COMPARISON", SEV_WARNING, "delta version calculation error"},
+	ERROR_UPDATE_DOWNLOAD:    {"ERROR_UPDATE_DOWNLOAD", SEV_ERROR, "error while downloading msh update"},
+	ERROR_UPDATE_CHECKSUM:    {"ERROR_UPDATE_CHECKSUM", SEV_ERROR, "msh update checksum not found or not matching"},
+	ERROR_UPDATE_INSTALL:     {"ERROR_UPDATE_INSTALL", SEV_ERROR, "error while replacing msh executable"},
+
+	// server connection package
+
+	ERROR_REQ_FLAG_BUILD:      {"ERROR_REQ_FLAG_BUILD", SEV_ERROR, "error while building request flag"},
+	ERROR_CLIENT_REQ:          {"ERROR_CLIENT_REQ", SEV_ERROR, "client request error"},
+	ERROR_CLIENT_SOCKET_READ:  {"ERROR_CLIENT_SOCKET_READ", SEV_ERROR, "error while reading client socket"},
+	ERROR_SERVER_DIAL:         {"ERROR_SERVER_DIAL", SEV_ERROR, "error while dialing ms server"},
+	ERROR_SERVER_REQUEST_INFO: {"ERROR_SERVER_REQUEST_INFO", SEV_ERROR, "error while msh server info request"},
+	ERROR_JSON_MARSHAL:        {"ERROR_JSON_MARSHAL", SEV_ERROR, "error while exporting struct to json bytes"},
+	ERROR_JSON_UNMARSHAL:      {"ERROR_JSON_UNMARSHAL", SEV_ERROR, "error while importing struct from json bytes"},
+	ERROR_MIRROR_PRIMARY:      {"ERROR_MIRROR_PRIMARY", SEV_ERROR, "error while retrieving primary msh status"},
+	ERROR_FORWARDING:          {"ERROR_FORWARDING", SEV_ERROR, "proxy forwarding data is not valid"},
+	ERROR_WAKE_COOLDOWN:       {"ERROR_WAKE_COOLDOWN", SEV_WARNING, "player triggered too many wakes in the cooldown period"},
+	ERROR_AUX_FORWARD:         {"ERROR_AUX_FORWARD", SEV_ERROR, "error in an auxiliary forward"},
+
+	// config package
+
+	ERROR_CONFIG_LOAD:    {"ERROR_CONFIG_LOAD", SEV_FATAL, "error while loading config"},
+	ERROR_CONFIG_SAVE:    {"ERROR_CONFIG_SAVE", SEV_ERROR, "error while saving config to file"},
+	ERROR_CONFIG_CHECK:   {"ERROR_CONFIG_CHECK", SEV_FATAL, "error while checking config"},
+	ERROR_CONFIG_PROFILE: {"ERROR_CONFIG_PROFILE", SEV_ERROR, "error while switching config profile"},
+	ERROR_CONFIG_SECRET:  {"ERROR_CONFIG_SECRET", SEV_FATAL, "error while resolving a config secret reference"},
+	ERROR_JAVA_TUNING:    {"ERROR_JAVA_TUNING", SEV_WARNING, "error while tuning the java parameters of the start command"},
+	ERROR_ICON_LOAD:      {"ERROR_ICON_LOAD", SEV_ERROR, "error while loading icon"},
+	ERROR_PORT_BUSY:      {"ERROR_PORT_BUSY", SEV_FATAL, "minecraft server or msh port is not available"},
+
+	// operative system package
+
+	ERROR_OS_NOT_SUPPORTED: {"ERROR_OS_NOT_SUPPORTED", SEV_FATAL, "OS not supported"},
+	ERROR_MSH_RESTART:      {"ERROR_MSH_RESTART", SEV_ERROR, "error while restarting msh"},
+	ERROR_PROCESS_PRIORITY: {"ERROR_PROCESS_PRIORITY", SEV_ERROR, "error while setting process priority"},
+	ERROR_PROCESS_SIGNAL:   {"ERROR_PROCESS_SIGNAL", SEV_ERROR, "error while sending a signal to a process group"},
+	ERROR_PROCESS_AFFINITY: {"ERROR_PROCESS_AFFINITY", SEV_ERROR, "error while setting process cpu affinity"},
+	ERROR_PROCESS_TREE:     {"ERROR_PROCESS_TREE", SEV_ERROR, "error while reading the process tree"},
+	ERROR_FILE_LOCK:        {"ERROR_FILE_LOCK", SEV_ERROR, "error while checking file lock"},
+	ERROR_DISK_FREE:        {"ERROR_DISK_FREE", SEV_ERROR, "error while reading volume free space"},
+	ERROR_FIFO_CREATE:      {"ERROR_FIFO_CREATE", SEV_ERROR, "error while creating a named pipe"},
+	ERROR_HOST_MEMORY:      {"ERROR_HOST_MEMORY", SEV_ERROR, "error while reading host available memory"},
+	ERROR_TCP_STATS:        {"ERROR_TCP_STATS", SEV_ERROR, "error while reading tcp connection statistics"},
+
+	// utility package
+
+	ERROR_ANALYSIS: {"ERROR_ANALYSIS", SEV_ERROR, "error while analyzing data"},
+
+	// main
+
+	ERROR_CLIENT_LISTEN: {"ERROR_CLIENT_LISTEN", SEV_FATAL, "error while listening for new clients"},
+	ERROR_CLIENT_ACCEPT: {"ERROR_CLIENT_ACCEPT", SEV_WARNING, "error while accepting new client"},
+
+	// input package
+
+	ERROR_COMMAND_INPUT:     {"ERROR_COMMAND_INPUT", SEV_ERROR, "general error while reading command input"},
+	ERROR_COMMAND_UNKNOWN:   {"ERROR_COMMAND_UNKNOWN", SEV_ERROR, "command is unknown"},
+	ERROR_INPUT_READ:        {"ERROR_INPUT_READ", SEV_ERROR, "error while reading input"},
+	ERROR_INPUT_UNAVAILABLE: {"ERROR_INPUT_UNAVAILABLE", SEV_ERROR, "stdin is not available"},
+	ERROR_INPUT_FIFO:        {"ERROR_INPUT_FIFO", SEV_ERROR, "error while reading the command fifo"},
+
+	// api package
+
+	ERROR_API_LISTEN:       {"ERROR_API_LISTEN", SEV_ERROR, "error while listening for api requests"},
+	ERROR_API_REQUEST:      {"ERROR_API_REQUEST", SEV_ERROR, "api request is not valid"},
+	ERROR_API_METHOD:       {"ERROR_API_METHOD", SEV_ERROR, "api request method is not allowed"},
+	ERROR_API_UNAUTHORIZED: {"ERROR_API_UNAUTHORIZED", SEV_ERROR, "api request is not authorized"},
+	ERROR_API_FORBIDDEN:    {"ERROR_API_FORBIDDEN", SEV_ERROR, "api token is not allowed to perform the request"},
+	ERROR_API_WEBSOCKET:    {"ERROR_API_WEBSOCKET", SEV_ERROR, "error on an api websocket connection"},
+	ERROR_API_TLS:          {"ERROR_API_TLS", SEV_ERROR, "error while loading the api tls certificates"},
+
+	// command line package
+
+	ERROR_CLI_COMMAND:  {"ERROR_CLI_COMMAND", SEV_ERROR, "command line subcommand is unknown or malformed"},
+	ERROR_CLI_API_CALL: {"ERROR_CLI_API_CALL", SEV_ERROR, "error while calling the api of the running msh instance"},
+	ERROR_CLI_REPORT:   {"ERROR_CLI_REPORT", SEV_ERROR, "error while writing the report archive"},
+
+	// events package
+
+	ERROR_EVENT_DROPPED: {"ERROR_EVENT_DROPPED", SEV_WARNING, "event dropped since subscriber is full"},
+	ERROR_EVENT_FILE:    {"ERROR_EVENT_FILE", SEV_ERROR, "error while writing event file"},
+	ERROR_EVENT_WEBHOOK: {"ERROR_EVENT_WEBHOOK", SEV_ERROR, "error while delivering event webhook"},
+
+	// outbound package
+
+	ERROR_OUTBOUND_PROXY: {"ERROR_OUTBOUND_PROXY", SEV_ERROR, "outbound proxy is not valid"},
+	ERROR_OUTBOUND_CA:    {"ERROR_OUTBOUND_CA", SEV_ERROR, "error while loading additional ca certificates"},
+	ERROR_OUTBOUND_DIAL:  {"ERROR_OUTBOUND_DIAL", SEV_ERROR, "error while opening an outbound connection"},
+
+	// system monitor package
+
+	ERROR_SYSMON_NOT_SUPPORTED: {"ERROR_SYSMON_NOT_SUPPORTED", SEV_WARNING, "resource monitoring is not supported on this OS"},
+	ERROR_SYSMON_READ:          {"ERROR_SYSMON_READ", SEV_ERROR, "error while reading resource usage"},
+
+	// usage package
+
+	ERROR_USAGE_LOAD:     {"ERROR_USAGE_LOAD", SEV_ERROR, "error while loading usage file"},
+	ERROR_USAGE_SAVE:     {"ERROR_USAGE_SAVE", SEV_ERROR, "error while saving usage file"},
+	ERROR_QUOTA_EXCEEDED: {"ERROR_QUOTA_EXCEEDED", SEV_WARNING, "monthly playtime quota exceeded"},
+	ERROR_QUOTA_TOKEN:    {"ERROR_QUOTA_TOKEN", SEV_ERROR, "quota override token is not valid"},
+
+	// chaos package
+
+	ERROR_CHAOS_INJECTED: {"ERROR_CHAOS_INJECTED", SEV_WARNING, "failure injected on purpose"},
+
+	// hooks package
+
+	ERROR_HOOK_RUN: {"ERROR_HOOK_RUN", SEV_ERROR, "error while running hook command"},
+
+	// mqtt package
+
+	ERROR_MQTT_CONNECTION: {"ERROR_MQTT_CONNECTION", SEV_ERROR, "error in the connection with the mqtt broker"},
+	ERROR_MQTT_PROTOCOL:   {"ERROR_MQTT_PROTOCOL", SEV_ERROR, "unexpected or malformed mqtt packet"},
+
+	// world package
+
+	ERROR_WORLD_LOCKED:    {"ERROR_WORLD_LOCKED", SEV_ERROR, "world is locked by another process"},
+	ERROR_WORLD_CORRUPTED: {"ERROR_WORLD_CORRUPTED", SEV_ERROR, "world files failed the integrity check"},
+	ERROR_WORLD_BACKUP:    {"ERROR_WORLD_BACKUP", SEV_ERROR, "error while reading world backups"},
+	ERROR_WORLD_RESTORE:   {"ERROR_WORLD_RESTORE", SEV_ERROR, "error while restoring world from backup"},
+
+	// history package
+
+	ERROR_HISTORY_LOAD: {"ERROR_HISTORY_LOAD", SEV_ERROR, "error while loading history file"},
+	ERROR_HISTORY_SAVE: {"ERROR_HISTORY_SAVE", SEV_ERROR, "error while saving history file"},
+	ERROR_AUDIT_FILE:   {"ERROR_AUDIT_FILE", SEV_ERROR, "error while reading or writing the audit file"},
+
+	// wake package
+
+	ERROR_WAKE_DNS:  {"ERROR_WAKE_DNS", SEV_ERROR, "error in the dns wake listener"},
+	ERROR_WAKE_IMAP: {"ERROR_WAKE_IMAP", SEV_ERROR, "error while polling the imap wake mailbox"},
+
+	// locale package
+
+	ERROR_LOCALE_LOAD: {"ERROR_LOCALE_LOAD", SEV_ERROR, "error while loading the language catalog"},
+
+	// notify package
+
+	ERROR_NOTIFY_DELIVERY: {"ERROR_NOTIFY_DELIVERY", SEV_ERROR, "error while delivering a notification"},
+	ERROR_TELEGRAM_BOT:    {"ERROR_TELEGRAM_BOT", SEV_ERROR, "error while receiving the telegram bot commands"},
+
+	// provision package
+
+	ERROR_PROVISION_DOWNLOAD: {"ERROR_PROVISION_DOWNLOAD", SEV_FATAL, "error while downloading the server jar"},
+	ERROR_PROVISION_HASH:     {"ERROR_PROVISION_HASH", SEV_FATAL, "downloaded server jar does not match the published checksum"},
+
+	// ddns package
+
+	ERROR_DDNS_IP:     {"ERROR_DDNS_IP", SEV_ERROR, "error while getting the public ip"},
+	ERROR_DDNS_UPDATE: {"ERROR_DDNS_UPDATE", SEV_ERROR, "error while updating the dynamic dns provider"},
+
+	// handover package
+
+	ERROR_HANDOVER: {"ERROR_HANDOVER", SEV_ERROR, "error while handing over the listeners to a new msh process"},
+
+	// security package
+
+	ERROR_SECURITY_FILE: {"ERROR_SECURITY_FILE", SEV_WARNING, "error while writing the security log file"},
+
+	// plugin package
+
+	ERROR_PLUGIN_PROCESS: {"ERROR_PLUGIN_PROCESS", SEV_ERROR, "error while starting or running a plugin process"},
+	ERROR_PLUGIN_RPC:     {"ERROR_PLUGIN_RPC", SEV_ERROR, "malformed or failed json-rpc message exchanged with a plugin"},
+	ERROR_PLUGIN_VETO:    {"ERROR_PLUGIN_VETO", SEV_WARNING, "minecraft server wake-up refused by a plugin"},
+}
+
+// Info returns the registry description of an error code
+// (unregistered codes are reported with severity error and empty name)
+func Info(code int) ErrInfo {
+	info := ErrInfo{Code: code, Hex: CodeString(code), Severity: SEV_ERROR, Exit: EXIT_ERROR}
+
+	if c := code >> 16; c < len(categories) {
+		info.Category = categories[c]
+	}
+	if e, ok := registry[code]; ok {
+		info.Name, info.Severity, info.Desc = e.name, e.severity, e.desc
+	}
+	if exit, ok := exitCodes[code]; ok {
+		info.Exit = exit
+	}
+
+	return info
+}
+
+// Registry returns the description of all msh error codes sorted by code
+func Registry() []ErrInfo {
+	codes := []int{}
+	for code := range registry {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	infos := []ErrInfo{}
+	for _, code := range codes {
+		infos = append(infos, Info(code))
+	}
+
+	return infos
+}
+
+// CodeString returns the error code as shown in logs (ex: 0x0003f002)
+func CodeString(code int) string {
+	return fmt.Sprintf("0x%08x", code)
+}
+
+// ExitCode returns the msh exit code for the error (EXIT_ERROR if the error has no specific exit code)
+func ExitCode(errMsh *Error) int {
+	if errMsh == nil {
+		return EXIT_OK
+	}
+
+	return Info(errMsh.Cod).Exit
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// FileExporter appends every event as a json line to Msh.EventFile.
+// When the file exceeds Msh.EventFileMaxSize MB, it's rotated to "<EventFile>.1".
+// [goroutine]
+func FileExporter() {
+	path := config.ConfigRuntime.Msh.EventFile
+	if path == "" {
+		return
+	}
+	maxSize := int64(config.ConfigRuntime.Msh.EventFileMaxSize) * 1024 * 1024
+
+	c := Subscribe(100)
+
+	for e := range c {
+		data, err := json.Marshal(e)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "FileExporter", err.Error()))
+			continue
+		}
+
+		// rotate event file if it exceeds the max size
+		if info, err := os.Stat(path); err == nil && maxSize > 0 && info.Size()+int64(len(data)) > maxSize {
+			err = os.Rename(path, path+".1")
+			if err != nil {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_EVENT_FILE, errco.LVL_D, "FileExporter", err.Error()))
+			}
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_EVENT_FILE, errco.LVL_D, "FileExporter", err.Error()))
+			continue
+		}
+		_, err = f.Write(append(data, '\n'))
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_EVENT_FILE, errco.LVL_D, "FileExporter", err.Error()))
+		}
+		f.Close()
+	}
+}
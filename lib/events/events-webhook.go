@@ -0,0 +1,126 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/outbound"
+)
+
+// webhookRetryDelay is the delay before the first webhook retry (doubled at every attempt)
+const webhookRetryDelay = 2 * time.Second
+
+// WebhookExporter POSTs every event (of the types in Webhooks.Events, all if empty) as json to Webhooks.Urls.
+// If Webhooks.Secret is set, the payload is signed with HMAC-SHA256 in the "X-Msh-Signature" header.
+// [goroutine]
+func WebhookExporter() {
+	if len(config.ConfigRuntime.Webhooks.Urls) == 0 {
+		return
+	}
+
+	c := Subscribe(100)
+
+	for e := range c {
+		if !webhookEnabled(e.Type) {
+			continue
+		}
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "WebhookExporter", err.Error()))
+			continue
+		}
+
+		// deliver to each url separately so that a slow endpoint does not delay the others
+		for _, url := range config.ConfigRuntime.Webhooks.Urls {
+			go func(url, eventType string) {
+				errMsh := deliverWebhook(url, eventType, payload)
+				if errMsh != nil {
+					errco.LogMshErr(errMsh.AddTrace("WebhookExporter"))
+				}
+			}(url, e.Type)
+		}
+	}
+}
+
+// deliverWebhook POSTs payload to url, retrying up to Webhooks.MaxRetries times on failure
+// [blocking]
+func deliverWebhook(url, eventType string, payload []byte) *errco.Error {
+	client, errMsh := outbound.Client(10 * time.Second)
+	if errMsh != nil {
+		return errMsh.AddTrace("deliverWebhook")
+	}
+
+	var lastErr string
+	for attempt := 0; attempt <= config.ConfigRuntime.Webhooks.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookRetryDelay << (attempt - 1))
+		}
+
+		req, err := newWebhookRequest(url, eventType, payload)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_EVENT_WEBHOOK, errco.LVL_D, "deliverWebhook", err.Error())
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err.Error()
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = "webhook responded with status: " + resp.Status
+	}
+
+	return errco.NewErr(errco.ERROR_EVENT_WEBHOOK, errco.LVL_B, "deliverWebhook", fmt.Sprintf("%s event not delivered to %s: %s", eventType, url, lastErr))
+}
+
+// newWebhookRequest builds the webhook POST request (signed if Webhooks.Secret is set)
+func newWebhookRequest(url, eventType string, payload []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Msh-Event", eventType)
+	if config.ConfigRuntime.Webhooks.Secret != "" {
+		req.Header.Set("X-Msh-Signature", "sha256="+webhookSignature(config.ConfigRuntime.Webhooks.Secret, payload))
+	}
+
+	return req, nil
+}
+
+// webhookEnabled returns true if events of eventType should be delivered to webhooks
+func webhookEnabled(eventType string) bool {
+	if len(config.ConfigRuntime.Webhooks.Events) == 0 {
+		return true
+	}
+
+	for _, t := range config.ConfigRuntime.Webhooks.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webhookSignature returns the hex encoded HMAC-SHA256 of payload
+func webhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
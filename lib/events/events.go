@@ -0,0 +1,79 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// lifecycle event types
+const (
+	SERVER_STARTING   = "starting"      // minecraft server is starting
+	SERVER_ONLINE     = "online"        // minecraft server is online
+	SERVER_STOPPING   = "stopping"      // minecraft server is stopping
+	SERVER_OFFLINE    = "offline"       // minecraft server is offline
+	SERVER_CRASH      = "crash"         // minecraft server crashed
+	SERVER_CRASH_LOOP = "crash-loop"    // minecraft server keeps crashing
+	SERVER_HANG       = "hang"          // minecraft server is not responding
+	START_FAILURE     = "start-failure" // minecraft server could not be started
+	PLAYER_JOIN       = "player-join"   // a player joined the minecraft server
+	PLAYER_LEAVE      = "player-leave"  // a player left the minecraft server
+	UPDATE_AVAILABLE  = "update"        // a msh update is available
+	WORLD_CORRUPTED   = "corruption"    // world failed the integrity check
+	WORLD_RESTORED    = "restore"       // world was restored from a backup
+)
+
+// Event is a msh lifecycle event
+type Event struct {
+	Time time.Time              `json:"time"`
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+var (
+	subsM sync.Mutex
+	subs  []chan Event // channels of event subscribers
+)
+
+// Subscribe returns a channel on which all published events are received.
+// Events are dropped if the subscriber does not keep up with the buffer size.
+func Subscribe(buffer int) chan Event {
+	subsM.Lock()
+	defer subsM.Unlock()
+
+	c := make(chan Event, buffer)
+	subs = append(subs, c)
+
+	return c
+}
+
+// Unsubscribe stops sending published events to a channel returned by Subscribe
+func Unsubscribe(c chan Event) {
+	subsM.Lock()
+	defer subsM.Unlock()
+
+	for i, s := range subs {
+		if s == c {
+			subs = append(subs[:i], subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish sends a new event to all subscribers
+// [non-blocking]
+func Publish(eventType string, data map[string]interface{}) {
+	e := Event{Time: time.Now(), Type: eventType, Data: data}
+
+	subsM.Lock()
+	defer subsM.Unlock()
+
+	for _, c := range subs {
+		select {
+		case c <- e:
+		default:
+			errco.LogMshErr(errco.NewErr(errco.ERROR_EVENT_DROPPED, errco.LVL_D, "Publish", "event subscriber is full, dropping event: "+eventType))
+		}
+	}
+}
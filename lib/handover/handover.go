@@ -0,0 +1,224 @@
+package handover
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"msh/lib/errco"
+)
+
+// handover package passes the listening sockets of msh to a new msh process (seamless restart):
+// the new process accepts clients without interruption while the previous one drains its connections.
+
+// handoverEnv lists the names of the listeners inherited from the previous msh process
+// (file descriptors 3, 4, ... in the same order)
+const handoverEnv = "MSH_HANDOVER_LISTENERS"
+
+// socket is a tcp listener or a udp socket that can be passed to a new msh process
+type socket interface {
+	File() (*os.File, error)
+	Close() error
+}
+
+var (
+	m sync.Mutex
+
+	// inherited are the tcp listeners passed by the previous msh process (by name)
+	inherited = map[string]net.Listener{}
+
+	// inheritedPacket are the udp sockets passed by the previous msh process (by name)
+	inheritedPacket = map[string]net.PacketConn{}
+
+	// listeners are the tcp listeners and udp sockets opened by Listen and ListenPacket (by name)
+	listeners = map[string]socket{}
+
+	// handedOver is true when the listeners were passed to a new msh process
+	handedOver bool
+)
+
+func init() {
+	names := os.Getenv(handoverEnv)
+	if names == "" {
+		return
+	}
+
+	// the listeners are not passed again to processes started by this msh instance
+	os.Unsetenv(handoverEnv)
+
+	for i, name := range strings.Split(names, ",") {
+		f := os.NewFile(uintptr(3+i), name)
+		if l, err := net.FileListener(f); err == nil {
+			inherited[name] = l
+		} else if pc, errP := net.FilePacketConn(f); errP == nil {
+			inheritedPacket[name] = pc
+		} else {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_B, "init", "inherited listener "+name+" is not valid: "+err.Error()))
+		}
+		f.Close()
+	}
+}
+
+// Supported returns true if the listeners can be passed to a new msh process on the current OS
+func Supported() bool {
+	return runtime.GOOS != "windows"
+}
+
+// Inherited returns true if the listener was passed by the previous msh process
+func Inherited(name string) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	_, ok := inherited[name]
+	_, okPacket := inheritedPacket[name]
+	return ok || okPacket
+}
+
+// Listen returns the listener passed by the previous msh process if it listens on the address port,
+// otherwise it opens a new tcp listener on address.
+// The listener is passed to the next msh process by StartSuccessor.
+func Listen(name, address string) (net.Listener, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	l, ok := inherited[name]
+	delete(inherited, name)
+
+	if ok {
+		_, port, _ := net.SplitHostPort(address)
+		_, inheritedPort, _ := net.SplitHostPort(l.Addr().String())
+		if port != inheritedPort {
+			// the port was changed in config
+			l.Close()
+			ok = false
+		} else {
+			errco.Logln(errco.LVL_D, "Listen: using %s listener inherited from previous msh process", name)
+		}
+	}
+
+	if !ok {
+		var err error
+		l, err = net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tl, isTCP := l.(*net.TCPListener); isTCP {
+		listeners[name] = tl
+	}
+
+	return l, nil
+}
+
+// ListenPacket returns the udp socket passed by the previous msh process if it listens on the address port,
+// otherwise it opens a new udp socket on address.
+// The socket is passed to the next msh process by StartSuccessor.
+func ListenPacket(name, address string) (net.PacketConn, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	pc, ok := inheritedPacket[name]
+	delete(inheritedPacket, name)
+
+	if ok {
+		_, port, _ := net.SplitHostPort(address)
+		_, inheritedPort, _ := net.SplitHostPort(pc.LocalAddr().String())
+		if port != inheritedPort {
+			// the port was changed in config
+			pc.Close()
+			ok = false
+		} else {
+			errco.Logln(errco.LVL_D, "ListenPacket: using %s socket inherited from previous msh process", name)
+		}
+	}
+
+	if !ok {
+		var err error
+		pc, err = net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if uc, isUDP := pc.(*net.UDPConn); isUDP {
+		listeners[name] = uc
+	}
+
+	return pc, nil
+}
+
+// Close closes the listener opened by Listen or ListenPacket, which is no longer passed to the next msh process
+func Close(name string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if l, ok := listeners[name]; ok {
+		l.Close()
+		delete(listeners, name)
+	}
+}
+
+// StartSuccessor starts a new msh process from exePath passing it the listeners,
+// then closes the listeners of this msh process (new clients are accepted by the new process)
+func StartSuccessor(exePath string) *errco.Error {
+	if !Supported() {
+		return errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_B, "StartSuccessor", "seamless restart is not supported on "+runtime.GOOS)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	names := []string{}
+	files := []*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for name, l := range listeners {
+		f, err := l.File()
+		if err != nil {
+			return errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_B, "StartSuccessor", "can't pass "+name+" listener: "+err.Error())
+		}
+		names = append(names, name)
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), handoverEnv+"="+strings.Join(names, ","))
+	cmd.ExtraFiles = files
+
+	err := cmd.Start()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_B, "StartSuccessor", "can't start new msh process: "+err.Error())
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	// the sockets stay open in the new process
+	handedOver = true
+	for name, l := range listeners {
+		l.Close()
+		delete(listeners, name)
+	}
+
+	errco.Logln(errco.LVL_A, "new msh process started (pid %d): listeners handed over (%s)", pid, strings.Join(names, ", "))
+
+	return nil
+}
+
+// HandedOver returns true if the listeners were passed to a new msh process
+func HandedOver() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return handedOver
+}
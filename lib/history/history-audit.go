@@ -0,0 +1,157 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// auditFileName is the file where the causes of the minecraft server state changes are appended (json lines)
+const auditFileName string = "msh-audit.log"
+
+// audited minecraft server state changes
+const (
+	AUDIT_WAKE   = "wake"   // minecraft server started
+	AUDIT_FREEZE = "freeze" // minecraft server stopped
+	AUDIT_CRASH  = "crash"  // minecraft server exited unexpectedly
+)
+
+// sources of the minecraft server state changes
+const (
+	SOURCE_PLAYER   = "player"   // a player joined (Player, Ip)
+	SOURCE_PING     = "ping"     // a status ping (Ip)
+	SOURCE_AUX      = "aux"      // a connection to an auxiliary forward (Ip)
+	SOURCE_CONSOLE  = "console"  // msh console command
+	SOURCE_FIFO     = "fifo"     // msh command written to the command fifo (Msh.CommandFifo)
+	SOURCE_API      = "api"      // http api
+	SOURCE_GRPC     = "grpc"     // grpc api
+	SOURCE_MQTT     = "mqtt"     // mqtt command
+	SOURCE_TELEGRAM = "telegram" // telegram bot command
+	SOURCE_CHAT     = "chat"     // msh command sent in game chat (Player)
+	SOURCE_PLUGIN   = "plugin"   // command sent by a plugin (Plugins)
+	SOURCE_DNS      = "dns"      // dns wake query
+	SOURCE_IMAP     = "imap"     // wake email
+	SOURCE_IDLE     = "idle"     // no player online for Msh.TimeBeforeStoppingEmptyServer
+	SOURCE_SCHEDULE = "schedule" // scheduled restart
+	SOURCE_QUOTA    = "quota"    // playtime quota exceeded
+	SOURCE_DRAIN    = "drain"    // draining mode
+	SOURCE_LOCK     = "lock"     // admin lock
+	SOURCE_MEMORY   = "memory"   // host memory pressure
+	SOURCE_WATCHDOG = "watchdog" // hang watchdog
+	SOURCE_CRASH    = "crash"    // restart after a crash
+	SOURCE_SERVER   = "server"   // the minecraft server itself
+	SOURCE_EXIT     = "exit"     // msh exit
+)
+
+// Cause is who or what triggered a minecraft server state change
+type Cause struct {
+	Source string `json:"source"`
+	Player string `json:"player,omitempty"`
+	Ip     string `json:"ip,omitempty"`
+}
+
+// By returns the cause of a state change triggered by source (without player)
+func By(source string) Cause {
+	return Cause{Source: source}
+}
+
+// String returns the cause as text (ex: "player alice from 1.2.3.4")
+func (c Cause) String() string {
+	s := c.Source
+	if c.Player != "" {
+		s += " " + c.Player
+	}
+	if c.Ip != "" {
+		s += " from " + c.Ip
+	}
+
+	return s
+}
+
+// AuditEntry is a minecraft server state change recorded in the audit file
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Cause
+}
+
+var auditM sync.Mutex
+
+// Audit appends a minecraft server state change and its cause to the audit file
+func Audit(action string, cause Cause) {
+	errco.Logln(errco.LVL_B, "audit: %s by %s", action, cause)
+
+	data, err := json.Marshal(AuditEntry{time.Now(), action, cause})
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "Audit", err.Error()))
+		return
+	}
+
+	auditM.Lock()
+	defer auditM.Unlock()
+
+	f, err := os.OpenFile(auditFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_AUDIT_FILE, errco.LVL_B, "Audit", err.Error()))
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_AUDIT_FILE, errco.LVL_B, "Audit", err.Error()))
+	}
+}
+
+// AuditLog returns the audit entries more recent than since,
+// with the specified action and player or ip (empty strings match all entries)
+func AuditLog(since time.Time, action, who string) ([]AuditEntry, *errco.Error) {
+	auditM.Lock()
+	defer auditM.Unlock()
+
+	entries := []AuditEntry{}
+
+	f, err := os.Open(auditFileName)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, errco.NewErr(errco.ERROR_AUDIT_FILE, errco.LVL_B, "AuditLog", err.Error())
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			// skip lines damaged by a crash while writing
+			continue
+		}
+
+		if e.Time.Before(since) ||
+			(action != "" && e.Action != action) ||
+			(who != "" && !strings.EqualFold(e.Player, who) && e.Ip != who) {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// AuditText returns the audit entries as text (a line for each entry)
+func AuditText(entries []AuditEntry) string {
+	text := ""
+	for _, e := range entries {
+		text += fmt.Sprintf("%s  %-6s  %s\n", e.Time.Format("2006/01/02 15:04:05"), e.Action, e.Cause)
+	}
+
+	return text
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+)
+
+// etaStartups is the amount of recent startups averaged to estimate the startup duration
+const etaStartups = 5
+
+// StartupEstimate returns the rolling estimate of the minecraft server startup duration
+// (average of the most recent startups, false if no startup was recorded)
+func StartupEstimate() (time.Duration, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	var total float64
+	n := 0
+	for i := len(hist.Wakes) - 1; i >= 0 && n < etaStartups; i-- {
+		if hist.Wakes[i].StartupSeconds > 0 {
+			total += hist.Wakes[i].StartupSeconds
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+
+	return time.Duration(total / float64(n) * float64(time.Second)), true
+}
+
+// StartupETA returns the estimated time left before the starting minecraft server is online
+// (false if the server is not starting or no startup was recorded)
+func StartupETA() (time.Duration, bool) {
+	if servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+		return 0, false
+	}
+
+	estimate, ok := StartupEstimate()
+	if !ok {
+		return 0, false
+	}
+
+	// the current wake is the last one if it did not complete
+	// (the starting event might not be recorded yet)
+	m.Lock()
+	var elapsed time.Duration
+	if len(hist.Wakes) > 0 && hist.Wakes[len(hist.Wakes)-1].StartupSeconds == 0 {
+		elapsed = time.Since(hist.Wakes[len(hist.Wakes)-1].Time)
+	}
+	m.Unlock()
+
+	left := estimate - elapsed
+	if left < 0 {
+		left = 0
+	}
+
+	return left, true
+}
+
+// ETAText returns the estimated time left before the starting minecraft server is online
+// as text shown to players (ex: "~90s left"), empty if not available
+func ETAText() string {
+	left, ok := StartupETA()
+	switch {
+	case !ok:
+		return ""
+	case left < 5*time.Second:
+		// the server is slower than usual
+		return locale.T("eta.almost-ready")
+	case left < 2*time.Minute:
+		return locale.T("eta.seconds", int(left.Seconds())/5*5)
+	default:
+		return locale.T("eta.minutes", int(left.Minutes()+0.5))
+	}
+}
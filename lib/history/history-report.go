@@ -0,0 +1,136 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// Report is the history of the last days: the numbers that justify hibernation
+type Report struct {
+	From              string  `json:"from"` // first day of the report ("2006-01-02")
+	To                string  `json:"to"`   // last day of the report ("2006-01-02")
+	OnlineHours       float64 `json:"onlineHours"`
+	HibernatedHours   float64 `json:"hibernatedHours"`
+	HibernatedPercent float64 `json:"hibernatedPercent"`
+	CPUHours          float64 `json:"cpuHours"`       // cpu time used by the minecraft server
+	CPUHoursSaved     float64 `json:"cpuHoursSaved"`  // estimated cpu time saved by hibernation (average online cpu usage * hibernated time)
+	EnergySavedKWh    float64 `json:"energySavedKWh"` // estimated energy saved by hibernation (cpu time saved * power of a busy cpu core)
+	Wakes             int     `json:"wakes"`
+	AvgStartupSeconds float64 `json:"avgStartupSeconds"`
+	PlayerSessions    int     `json:"playerSessions"`
+	PeakPlayers       int     `json:"peakPlayers"` // maximum number of players online at the same time
+}
+
+// PeriodReport returns the history report of the last days (today included).
+// coreWatts is the power drawn by a busy cpu core, used to estimate the energy saved.
+// If the history recorder is not running, the history is loaded from the history file.
+func PeriodReport(days int, coreWatts float64) (*Report, *errco.Error) {
+	errMsh := loadIfEmpty()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("PeriodReport")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	to := now.Format("2006-01-02")
+	from := now.AddDate(0, 0, 1-days).Format("2006-01-02")
+	since, _ := time.ParseInLocation("2006-01-02", from, time.Local)
+
+	r := &Report{From: from, To: to}
+
+	// uptime
+	var online, hibernated int64
+	var cpuSeconds float64
+	for d, u := range hist.Days {
+		if d < from || d > to {
+			continue
+		}
+		online += u.Online
+		hibernated += u.Hibernated
+		cpuSeconds += u.CPUSeconds
+	}
+	r.OnlineHours = float64(online) / 3600
+	r.HibernatedHours = float64(hibernated) / 3600
+	r.CPUHours = cpuSeconds / 3600
+	if online+hibernated > 0 {
+		r.HibernatedPercent = 100 * float64(hibernated) / float64(online+hibernated)
+	}
+	if online > 0 {
+		// the server would have used its average online cpu usage while hibernated
+		r.CPUHoursSaved = cpuSeconds / float64(online) * r.HibernatedHours
+	}
+	r.EnergySavedKWh = r.CPUHoursSaved * coreWatts / 1000
+
+	// wakes
+	startups := 0
+	for _, w := range hist.Wakes {
+		if w.Time.Before(since) {
+			continue
+		}
+		r.Wakes++
+		if w.StartupSeconds > 0 {
+			r.AvgStartupSeconds += w.StartupSeconds
+			startups++
+		}
+	}
+	if startups > 0 {
+		r.AvgStartupSeconds /= float64(startups)
+	}
+
+	// player sessions: the peak is the maximum of players joined and not left yet
+	// (sessions not closed are still open now)
+	type change struct {
+		t     time.Time
+		delta int
+	}
+	changes := []change{}
+	for _, s := range hist.Sessions {
+		leave := s.Leave
+		if leave.IsZero() {
+			leave = now
+		}
+		if leave.Before(since) {
+			continue
+		}
+		if !s.Join.Before(since) {
+			r.PlayerSessions++
+		}
+		changes = append(changes, change{s.Join, 1}, change{leave, -1})
+	}
+	// leaves before joins at the same time: a player reconnecting is not counted twice
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].t.Equal(changes[j].t) {
+			return changes[i].delta < changes[j].delta
+		}
+		return changes[i].t.Before(changes[j].t)
+	})
+	players := 0
+	for _, c := range changes {
+		players += c.delta
+		if players > r.PeakPlayers {
+			r.PeakPlayers = players
+		}
+	}
+
+	return r, nil
+}
+
+// Text returns a human readable version of the report
+func (r *Report) Text() string {
+	text := fmt.Sprintf("period:           %s - %s\n", r.From, r.To)
+	text += fmt.Sprintf("online:           %.1f hours\n", r.OnlineHours)
+	text += fmt.Sprintf("hibernated:       %.1f hours (%.1f%%)\n", r.HibernatedHours, r.HibernatedPercent)
+	text += fmt.Sprintf("cpu time:         %.1f hours used, %.1f hours saved by hibernation\n", r.CPUHours, r.CPUHoursSaved)
+	text += fmt.Sprintf("energy saved:     %.2f kWh (estimated)\n", r.EnergySavedKWh)
+	text += fmt.Sprintf("wakes:            %d\n", r.Wakes)
+	text += fmt.Sprintf("average startup:  %.0fs\n", r.AvgStartupSeconds)
+	text += fmt.Sprintf("player sessions:  %d\n", r.PlayerSessions)
+	text += fmt.Sprintf("peak players:     %d\n", r.PeakPlayers)
+
+	return text
+}
@@ -0,0 +1,313 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/servstats"
+)
+
+// history package records minecraft server wakes, startup durations, player sessions and daily uptime
+// in the history file, so that statistics survive msh restarts.
+
+// historyFileName is the file where the history is persisted
+const historyFileName string = "msh-history.json"
+
+// maximum amount of wakes and player sessions kept in the history file (oldest are discarded)
+const (
+	maxWakes    = 1000
+	maxSessions = 5000
+)
+
+var (
+	m sync.Mutex
+
+	hist = &history{Days: map[string]*day{}}
+)
+
+// history is the content of the history file
+type history struct {
+	Wakes    []*wake         `json:"wakes"`
+	Sessions []*session      `json:"sessions"`
+	Days     map[string]*day `json:"days"` // daily uptime per day ("2006-01-02")
+}
+
+// wake is a minecraft server start
+type wake struct {
+	Time           time.Time `json:"time"`
+	StartupSeconds float64   `json:"startupSeconds"` // time from starting to online (0 if the server did not go online)
+}
+
+// session is a player session on the minecraft server
+type session struct {
+	Player string    `json:"player"`
+	Join   time.Time `json:"join"`
+	Leave  time.Time `json:"leave"` // zero if the session is not closed
+}
+
+// day is the minecraft server uptime in a day
+type day struct {
+	Online     int64   `json:"online"`     // seconds of minecraft server activity (starting, online, stopping)
+	Hibernated int64   `json:"hibernated"` // seconds of msh activity while minecraft server is offline
+	CPUSeconds float64 `json:"cpuSeconds"` // cpu time used by the minecraft server (if resource monitoring is supported)
+}
+
+// Summary is the aggregated history
+type Summary struct {
+	Wakes              int     `json:"wakes"`
+	AvgStartupSeconds  float64 `json:"avgStartupSeconds"`
+	PlayerSessions     int     `json:"playerSessions"`
+	OnlineHours        float64 `json:"onlineHours"`
+	HibernatedHours    float64 `json:"hibernatedHours"`
+	HibernatedPercent  float64 `json:"hibernatedPercent"`
+	CPUHours           float64 `json:"cpuHours"`           // cpu time used by the minecraft server
+	CPUHoursSaved      float64 `json:"cpuHoursSaved"`      // estimated cpu time saved by hibernation (average online cpu usage * hibernated time)
+	Days               []Day   `json:"days"`               // daily uptime (from oldest to newest)
+	LastWake           string  `json:"lastWake,omitempty"` // time of the last wake
+	LastStartupSeconds float64 `json:"lastStartupSeconds"`
+}
+
+// Day is the minecraft server uptime in a day expressed in hours
+type Day struct {
+	Day             string  `json:"day"`
+	OnlineHours     float64 `json:"onlineHours"`
+	HibernatedHours float64 `json:"hibernatedHours"`
+	CPUHours        float64 `json:"cpuHours"`
+}
+
+// HistoryRecorder records lifecycle events and persists them to the history file.
+// The daily uptime is sampled by the usage tracker (see AddUptime).
+// [goroutine]
+func HistoryRecorder() {
+	errMsh := load()
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("HistoryRecorder"))
+	}
+
+	eventC := events.Subscribe(64)
+
+	for e := range eventC {
+		record(e)
+
+		errMsh := save()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("HistoryRecorder"))
+		}
+	}
+}
+
+// AddUptime accounts a usage tracker sample to the daily uptime and persists it to the history file:
+// elapsed is the time until now during which the minecraft server was running (online true) or hibernated.
+func AddUptime(now time.Time, elapsed time.Duration, online bool) {
+	servstats.Stats.M.Lock()
+	cpuUsage := servstats.Stats.CPUUsage
+	servstats.Stats.M.Unlock()
+
+	m.Lock()
+	d := now.Format("2006-01-02")
+	if hist.Days[d] == nil {
+		hist.Days[d] = &day{}
+	}
+	if online {
+		hist.Days[d].Online += int64(elapsed.Seconds())
+		hist.Days[d].CPUSeconds += cpuUsage / 100 * elapsed.Seconds()
+	} else {
+		hist.Days[d].Hibernated += int64(elapsed.Seconds())
+	}
+	m.Unlock()
+
+	errMsh := save()
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("AddUptime"))
+	}
+}
+
+// record updates the history with a lifecycle event
+func record(e events.Event) {
+	m.Lock()
+	defer m.Unlock()
+
+	switch e.Type {
+	case events.SERVER_STARTING:
+		hist.Wakes = append(hist.Wakes, &wake{Time: e.Time})
+		if len(hist.Wakes) > maxWakes {
+			hist.Wakes = hist.Wakes[len(hist.Wakes)-maxWakes:]
+		}
+
+	case events.SERVER_ONLINE:
+		if len(hist.Wakes) > 0 {
+			w := hist.Wakes[len(hist.Wakes)-1]
+			if w.StartupSeconds == 0 {
+				w.StartupSeconds = e.Time.Sub(w.Time).Seconds()
+			}
+		}
+
+	case events.PLAYER_JOIN:
+		player, _ := e.Data["player"].(string)
+		hist.Sessions = append(hist.Sessions, &session{Player: player, Join: e.Time})
+		if len(hist.Sessions) > maxSessions {
+			hist.Sessions = hist.Sessions[len(hist.Sessions)-maxSessions:]
+		}
+
+	case events.PLAYER_LEAVE:
+		// close the most recent open session of the player
+		player, _ := e.Data["player"].(string)
+		for i := len(hist.Sessions) - 1; i >= 0; i-- {
+			if hist.Sessions[i].Player == player && hist.Sessions[i].Leave.IsZero() {
+				hist.Sessions[i].Leave = e.Time
+				break
+			}
+		}
+
+	case events.SERVER_OFFLINE:
+		// players are disconnected when the server goes offline
+		for _, s := range hist.Sessions {
+			if s.Leave.IsZero() {
+				s.Leave = e.Time
+			}
+		}
+	}
+}
+
+// Summarize returns the aggregated history.
+// If the history recorder is not running, the history is loaded from the history file.
+func Summarize() (*Summary, *errco.Error) {
+	errMsh := loadIfEmpty()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("Summarize")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	sum := &Summary{Wakes: len(hist.Wakes), PlayerSessions: len(hist.Sessions), Days: []Day{}}
+
+	startups := 0
+	for _, w := range hist.Wakes {
+		if w.StartupSeconds > 0 {
+			sum.AvgStartupSeconds += w.StartupSeconds
+			startups++
+		}
+	}
+	if startups > 0 {
+		sum.AvgStartupSeconds /= float64(startups)
+	}
+	if len(hist.Wakes) > 0 {
+		lastWake := hist.Wakes[len(hist.Wakes)-1]
+		sum.LastWake = lastWake.Time.Format("2006/01/02 15:04:05")
+		sum.LastStartupSeconds = lastWake.StartupSeconds
+	}
+
+	days := []string{}
+	for d := range hist.Days {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+
+	var online, hibernated int64
+	var cpuSeconds float64
+	for _, d := range days {
+		online += hist.Days[d].Online
+		hibernated += hist.Days[d].Hibernated
+		cpuSeconds += hist.Days[d].CPUSeconds
+		sum.Days = append(sum.Days, Day{d, float64(hist.Days[d].Online) / 3600, float64(hist.Days[d].Hibernated) / 3600, hist.Days[d].CPUSeconds / 3600})
+	}
+
+	sum.OnlineHours = float64(online) / 3600
+	sum.HibernatedHours = float64(hibernated) / 3600
+	sum.CPUHours = cpuSeconds / 3600
+	if online+hibernated > 0 {
+		sum.HibernatedPercent = 100 * float64(hibernated) / float64(online+hibernated)
+	}
+	if online > 0 {
+		// the server would have used its average online cpu usage while hibernated
+		sum.CPUHoursSaved = cpuSeconds / float64(online) * sum.HibernatedHours
+	}
+
+	return sum, nil
+}
+
+// Text returns a human readable version of the summary
+func (sum *Summary) Text() string {
+	text := fmt.Sprintf("wakes:            %d\n", sum.Wakes)
+	if sum.LastWake != "" {
+		text = fmt.Sprintf("wakes:            %d (last: %s, startup %.0fs)\n", sum.Wakes, sum.LastWake, sum.LastStartupSeconds)
+	}
+	text += fmt.Sprintf("average startup:  %.0fs\n", sum.AvgStartupSeconds)
+	text += fmt.Sprintf("player sessions:  %d\n", sum.PlayerSessions)
+	text += fmt.Sprintf("online:           %.1f hours\n", sum.OnlineHours)
+	text += fmt.Sprintf("hibernated:       %.1f hours (%.1f%%)\n", sum.HibernatedHours, sum.HibernatedPercent)
+	text += fmt.Sprintf("cpu time:         %.1f hours used, %.1f hours saved by hibernation\n", sum.CPUHours, sum.CPUHoursSaved)
+
+	return text
+}
+
+// loadIfEmpty reads the history file if the history is empty (the history recorder is not running)
+func loadIfEmpty() *errco.Error {
+	m.Lock()
+	empty := len(hist.Days) == 0 && len(hist.Wakes) == 0
+	m.Unlock()
+
+	if !empty {
+		return nil
+	}
+
+	errMsh := load()
+	if errMsh != nil {
+		return errMsh.AddTrace("loadIfEmpty")
+	}
+
+	return nil
+}
+
+// load reads the history file (if present)
+func load() *errco.Error {
+	data, err := ioutil.ReadFile(historyFileName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_HISTORY_LOAD, errco.LVL_D, "load", err.Error())
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	err = json.Unmarshal(data, hist)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_HISTORY_LOAD, errco.LVL_D, "load", err.Error())
+	}
+	if hist.Days == nil {
+		hist.Days = map[string]*day{}
+	}
+
+	return nil
+}
+
+// save writes the history file
+func save() *errco.Error {
+	m.Lock()
+	data, err := json.Marshal(hist)
+	m.Unlock()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_HISTORY_SAVE, errco.LVL_D, "save", err.Error())
+	}
+
+	// write to a temporary file first so that a crash does not corrupt the history file
+	err = ioutil.WriteFile(historyFileName+".tmp", data, 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_HISTORY_SAVE, errco.LVL_D, "save", err.Error())
+	}
+	err = os.Rename(historyFileName+".tmp", historyFileName)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_HISTORY_SAVE, errco.LVL_D, "save", err.Error())
+	}
+
+	return nil
+}
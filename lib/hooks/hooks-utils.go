@@ -0,0 +1,16 @@
+package hooks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// envName converts an event data key to an environment variable name (ex: "player" -> "PLAYER")
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// toString converts an event data value to string
+func toString(v interface{}) string {
+	return fmt.Sprintf("%v", v)
+}
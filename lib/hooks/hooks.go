@@ -0,0 +1,117 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+// hook names (passed to hook commands as MSH_HOOK)
+const (
+	PRE_START   = "pre-start"   // before the minecraft server is started
+	POST_START  = "post-start"  // after the minecraft server is online
+	PRE_STOP    = "pre-stop"    // before the minecraft server stop command is issued
+	POST_STOP   = "post-stop"   // after the minecraft server is offline
+	PLAYER_JOIN = "player-join" // after a player joined the minecraft server
+)
+
+// defaultTimeout is the maximum execution time of a hook command when Hooks.Timeout is not set
+const defaultTimeout = 60 * time.Second
+
+// Run executes the command configured for the specified hook (if any).
+// data is passed to the command as MSH_<KEY> environment variables, with MSH_HOOK, MSH_STATUS and MSH_PLAYERS.
+// [blocking]
+func Run(hook string, data map[string]interface{}) *errco.Error {
+	command := hookCommand(hook)
+	if command == "" {
+		return nil
+	}
+
+	timeout := defaultTimeout
+	if config.ConfigRuntime.Hooks.Timeout > 0 {
+		timeout = time.Duration(config.ConfigRuntime.Hooks.Timeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := opsys.ShellCommand(ctx, command)
+	cmd.Dir = config.ConfigRuntime.Server.Folder
+	cmd.Env = append(os.Environ(),
+		"MSH_HOOK="+hook,
+		"MSH_STATUS="+servstats.StatusName(servstats.Stats.Status),
+		"MSH_PLAYERS="+strconv.Itoa(servstats.Stats.PlayerCount),
+	)
+	for k, v := range data {
+		cmd.Env = append(cmd.Env, "MSH_"+envName(k)+"="+toString(v))
+	}
+
+	errco.Logln(errco.LVL_D, "running %s hook: %s", hook, command)
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		errco.Logln(errco.LVL_C, "%s hook output: %s", hook, out)
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return errco.NewErr(errco.ERROR_HOOK_RUN, errco.LVL_B, "Run", hook+" hook timed out after "+timeout.String())
+		}
+		return errco.NewErr(errco.ERROR_HOOK_RUN, errco.LVL_B, "Run", hook+" hook failed: "+err.Error())
+	}
+
+	return nil
+}
+
+// HookManager runs post-start, post-stop and player-join hooks when the respective events are published
+// (pre-start and pre-stop hooks are run synchronously by servctrl)
+// [goroutine]
+func HookManager() {
+	eventC := events.Subscribe(32)
+
+	for e := range eventC {
+		var hook string
+		switch e.Type {
+		case events.SERVER_ONLINE:
+			hook = POST_START
+		case events.SERVER_OFFLINE:
+			hook = POST_STOP
+		case events.PLAYER_JOIN:
+			hook = PLAYER_JOIN
+		default:
+			continue
+		}
+
+		// run hook without blocking the event channel
+		go func(hook string, data map[string]interface{}) {
+			errMsh := Run(hook, data)
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("HookManager"))
+			}
+		}(hook, e.Data)
+	}
+}
+
+// hookCommand returns the command configured for the specified hook
+func hookCommand(hook string) string {
+	switch hook {
+	case PRE_START:
+		return config.ConfigRuntime.Hooks.PreStart
+	case POST_START:
+		return config.ConfigRuntime.Hooks.PostStart
+	case PRE_STOP:
+		return config.ConfigRuntime.Hooks.PreStop
+	case POST_STOP:
+		return config.ConfigRuntime.Hooks.PostStop
+	case PLAYER_JOIN:
+		return config.ConfigRuntime.Hooks.PlayerJoin
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,61 @@
+package input
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/opsys"
+)
+
+// FifoInput reads the commands written to the command fifo (Msh.CommandFifo) and executes them as console commands,
+// so that msh running as a service without stdin can be controlled (ex: echo "msh freeze" > /run/msh/cmd).
+// The fifo is created if it does not exist.
+// [goroutine]
+func FifoInput() {
+	path := config.ConfigRuntime.Msh.CommandFifo
+	if path == "" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		errMsh := opsys.MakeFifo(path)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("FifoInput"))
+			return
+		}
+	case err != nil:
+		errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_FIFO, errco.LVL_B, "FifoInput", err.Error()))
+		return
+	case info.Mode()&os.ModeNamedPipe == 0:
+		errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_FIFO, errco.LVL_B, "FifoInput", "Msh.CommandFifo is not a fifo: "+path))
+		return
+	}
+
+	// the fifo is opened for writing too: reading does not end when a writer closes the fifo
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_FIFO, errco.LVL_B, "FifoInput", err.Error()))
+		return
+	}
+	defer f.Close()
+
+	errco.Logln(errco.LVL_B, "reading commands from fifo %s", path)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		command(scanner.Text(), history.SOURCE_FIFO)
+	}
+
+	if err := scanner.Err(); err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_FIFO, errco.LVL_B, "FifoInput", err.Error()))
+	}
+}
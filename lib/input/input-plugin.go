@@ -0,0 +1,16 @@
+package input
+
+import (
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/plugin"
+)
+
+// PluginInput executes the commands sent by plugins as console commands (ex: "msh freeze")
+// [goroutine]
+func PluginInput() {
+	for c := range plugin.CommandC {
+		errco.Logln(errco.LVL_B, "plugin %s sent command: %s", c.Plugin, c.Line)
+		command(c.Line, history.SOURCE_PLUGIN)
+	}
+}
@@ -2,13 +2,21 @@ package input
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/progmgr"
 	"msh/lib/servctrl"
 	"msh/lib/servstats"
+	"msh/lib/usage"
+	"msh/lib/world"
 )
 
 // GetInput is used to read input from user.
@@ -19,87 +27,269 @@ func GetInput() {
 
 	reader := bufio.NewReader(os.Stdin)
 
+	progmgr.SetInputActive(true)
+
 	for {
 		line, err = reader.ReadString('\n')
 		if err != nil {
 			// if stdin is unavailable (msh running as service)
 			// exit from input goroutine to avoid an infinite loop
 			if err == io.EOF {
+				progmgr.SetInputActive(false)
 				// in case input goroutine returns abnormally while msh is running in terminal,
 				// the user must be notified with errco.LVL_B
-				errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_UNAVAILABLE, errco.LVL_B, "GetInput", "stdin unavailable, exiting input goroutine"))
+				errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_UNAVAILABLE, errco.LVL_B, "GetInput", "stdin unavailable, exiting input goroutine (commands can be sent through Msh.CommandFifo)"))
 				return
 			}
 			errco.LogMshErr(errco.NewErr(errco.ERROR_INPUT_READ, errco.LVL_D, "GetInput", err.Error()))
 			continue
 		}
 
-		// make sure that only 1 space separates words
-		line = strings.ReplaceAll(line, "\n", "")
-		line = strings.ReplaceAll(line, "\r", "")
-		line = strings.ReplaceAll(line, "\t", " ")
-		for strings.Contains(line, "  ") {
-			line = strings.ReplaceAll(line, "  ", " ")
+		// the line is the answer to the exit confirmation
+		if progmgr.ConfirmAnswer(line) {
+			continue
 		}
-		lineSplit := strings.Split(line, " ")
 
-		errco.Logln(errco.LVL_D, "GetInput: user input: %s", lineSplit[:])
+		command(line, history.SOURCE_CONSOLE)
+	}
+}
 
-		switch lineSplit[0] {
-		// target msh
-		case "msh":
-			// check that there is a command for the target
-			if len(lineSplit) < 2 {
-				errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "GetInput", "specify msh command (start - freeze - exit)"))
-				continue
-			}
+// command executes a msh or minecraft server command line read from stdin or from the command fifo
+// (source is the cause of the minecraft server state changes)
+func command(line, source string) {
+	// make sure that only 1 space separates words
+	line = strings.ReplaceAll(line, "\n", "")
+	line = strings.ReplaceAll(line, "\r", "")
+	line = strings.ReplaceAll(line, "\t", " ")
+	for strings.Contains(line, "  ") {
+		line = strings.ReplaceAll(line, "  ", " ")
+	}
+	lineSplit := strings.Split(line, " ")
 
-			switch lineSplit[1] {
-			case "start":
-				errMsh := servctrl.StartMS()
-				if errMsh != nil {
-					errco.LogMshErr(errMsh.AddTrace("GetInput"))
-				}
-			case "freeze":
-				// stop minecraft server with no player check
-				errMsh := servctrl.StopMS(false)
-				if errMsh != nil {
-					errco.LogMshErr(errMsh.AddTrace("GetInput"))
-				}
-			case "exit":
-				errMsh := servctrl.StopMS(false)
-				if errMsh != nil {
-					errco.LogMshErr(errMsh.AddTrace("GetInput"))
-				}
-				errco.Logln(errco.LVL_A, "exiting msh")
-				os.Exit(0)
-			default:
-				errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_UNKNOWN, errco.LVL_A, "GetInput", "unknown command (start - freeze - exit)"))
-			}
+	errco.Logln(errco.LVL_D, "command: %s input: %s", source, lineSplit[:])
 
-		// taget minecraft server
-		case "mine":
-			// check that there is a command for the target
-			if len(lineSplit) < 2 {
-				errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "GetInput", "specify mine command"))
-				continue
-			}
+	switch lineSplit[0] {
+	// target msh
+	case "msh":
+		// check that there is a command for the target
+		if len(lineSplit) < 2 {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "command", "specify msh command (start - freeze - exit - detach-exit - restart - quota - restore - filter - lock - unlock - drain - undrain - keepalive - use)"))
+			return
+		}
 
-			// check if server is online
-			if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
-				errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_NOT_ONLINE, errco.LVL_A, "GetInput", "minecraft server is not online (try \"msh start\")"))
-				continue
+		switch lineSplit[1] {
+		case "start":
+			errMsh := servctrl.StartMS(history.By(source))
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
 			}
-
-			// pass the command to the minecraft server terminal
-			_, errMsh := servctrl.Execute(strings.Join(lineSplit[1:], " "), "user input")
+		case "freeze":
+			// stop minecraft server with no player check
+			errMsh := servctrl.StopMS(false, history.By(source))
 			if errMsh != nil {
-				errco.LogMshErr(errMsh.AddTrace("GetInput"))
+				errco.LogMshErr(errMsh.AddTrace("command"))
 			}
-
-		// wrong target
+		case "exit":
+			errMsh := servctrl.StopMS(false, history.By(source))
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+			errco.Logln(errco.LVL_A, "exiting msh")
+			os.Exit(0)
+		case "detach-exit":
+			// exit msh leaving the minecraft server running
+			errMsh := servctrl.Detach()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+				return
+			}
+			errco.Logln(errco.LVL_A, "exiting msh")
+			os.Exit(0)
+		case "restart":
+			// replace msh with a new msh process without disconnecting players
+			exePath, err := os.Executable()
+			if err != nil {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_A, "command", err.Error()))
+				return
+			}
+			errMsh := progmgr.SeamlessRestart(exePath)
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "quota":
+			errco.Logln(errco.LVL_A, "server usage this month: %.1f hours (quota: %d hours)", usage.OnlineHours(time.Now().Format("2006-01")), config.ConfigRuntime.Quota.MonthlyHours)
+		case "restore":
+			// the world can't be replaced while the minecraft server is using it
+			if servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "command", "minecraft server is not offline (try \"msh freeze\")"))
+				return
+			}
+			errMsh := world.Restore()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "filter":
+			errMsh := filterCommand(lineSplit[2:])
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "lock":
+			errMsh := lockCommand(lineSplit[2:])
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "unlock":
+			errMsh := servctrl.Unlock()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "drain":
+			errMsh := servctrl.Drain(strings.Join(lineSplit[2:], " "))
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "undrain":
+			errMsh := servctrl.Undrain()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "keepalive":
+			// suspend the hibernation of the empty server: msh keepalive <duration|off>
+			if len(lineSplit) < 3 {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "command", "specify keep-alive duration or off (msh keepalive 2h)"))
+				return
+			}
+			_, errMsh := servctrl.KeepAliveCommand(lineSplit[2])
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("command"))
+			}
+		case "use":
+			// switch config profile: msh use <profile|base>
+			if len(lineSplit) < 3 {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "command", fmt.Sprintf("specify config profile (msh use <profile|base>), active: \"%s\", available: %s", config.ConfigDefault.Profile, strings.Join(config.ProfileNames(), " - "))))
+				return
+			}
+			// the input is not blocked while the minecraft server of the active profile stops
+			go func(name string) {
+				errMsh := servctrl.UseProfile(name, history.By(source))
+				if errMsh != nil {
+					errco.LogMshErr(errMsh.AddTrace("command"))
+				}
+			}(lineSplit[2])
 		default:
-			errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "GetInput", "specify the target (msh - mine)"))
+			errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_UNKNOWN, errco.LVL_A, "command", "unknown command (start - freeze - exit - detach-exit - restart - quota - restore - filter - lock - unlock - drain - undrain - keepalive - use)"))
+		}
+
+	// taget minecraft server
+	case "mine":
+		// check that there is a command for the target
+		if len(lineSplit) < 2 {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "command", "specify mine command"))
+			return
+		}
+
+		// check if server is online
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_NOT_ONLINE, errco.LVL_A, "command", "minecraft server is not online (try \"msh start\")"))
+			return
+		}
+
+		// pass the command to the minecraft server terminal
+		_, errMsh := servctrl.Execute(strings.Join(lineSplit[1:], " "), "user input")
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("command"))
 		}
+
+	// wrong target
+	default:
+		errco.LogMshErr(errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "command", "specify the target (msh - mine)"))
+	}
+}
+
+// filterCommand lists and edits the minecraft server console rules at runtime:
+//
+//	msh filter list
+//	msh filter hide <regex>
+//	msh filter highlight <color> <regex>
+//	msh filter remove <n>
+func filterCommand(args []string) *errco.Error {
+	if len(args) == 0 {
+		return errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "filterCommand", "specify filter command (list - hide - highlight - remove)")
 	}
+
+	var rule *errco.ConsoleRule
+	var err error
+
+	switch args[0] {
+	case "list":
+		rules := errco.ConsoleRules()
+		if len(rules) == 0 {
+			errco.Logln(errco.LVL_A, "no console rules")
+		}
+		for i, r := range rules {
+			errco.Logln(errco.LVL_A, "console rule %d: %s %s (%s)", i, r.Action, r.Color, r.Match)
+		}
+		return nil
+
+	case "hide":
+		if len(args) < 2 {
+			return errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "filterCommand", "specify regex (msh filter hide <regex>)")
+		}
+		rule, err = errco.NewConsoleRule(strings.Join(args[1:], " "), errco.RULE_HIDE, "")
+
+	case "highlight":
+		if len(args) < 3 {
+			return errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "filterCommand", "specify color and regex (msh filter highlight <color> <regex>)")
+		}
+		rule, err = errco.NewConsoleRule(strings.Join(args[2:], " "), errco.RULE_HIGHLIGHT, args[1])
+
+	case "remove":
+		if len(args) < 2 {
+			return errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "filterCommand", "specify rule number (msh filter remove <n>)")
+		}
+		i, err := strconv.Atoi(args[1])
+		if err != nil || !errco.RemoveConsoleRule(i) {
+			return errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "filterCommand", "console rule not found: "+args[1])
+		}
+		errco.Logln(errco.LVL_A, "console rule %d removed", i)
+		return nil
+
+	default:
+		return errco.NewErr(errco.ERROR_COMMAND_UNKNOWN, errco.LVL_A, "filterCommand", "unknown filter command (list - hide - highlight - remove)")
+	}
+
+	if err != nil {
+		return errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_A, "filterCommand", err.Error())
+	}
+	errco.AddConsoleRule(rule)
+	errco.Logln(errco.LVL_A, "console rule %d added: %s %s (%s)", len(errco.ConsoleRules())-1, rule.Action, rule.Color, rule.Match)
+
+	return nil
+}
+
+// lockCommand locks the minecraft server (no wake until unlocked) and freezes it if running:
+//
+//	msh lock [duration] [reason]
+func lockCommand(args []string) *errco.Error {
+	var d time.Duration
+	if len(args) > 0 {
+		if pd, err := time.ParseDuration(args[0]); err == nil {
+			d = pd
+			args = args[1:]
+		}
+	}
+
+	errMsh := servctrl.Lock(d, strings.Join(args, " "))
+	if errMsh != nil {
+		return errMsh.AddTrace("lockCommand")
+	}
+
+	if servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		errMsh = servctrl.StopMS(false, history.By(history.SOURCE_LOCK))
+		if errMsh != nil {
+			return errMsh.AddTrace("lockCommand")
+		}
+	}
+
+	return nil
 }
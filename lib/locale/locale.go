@@ -0,0 +1,147 @@
+package locale
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"msh/lib/errco"
+)
+
+// locale package contains the player-facing messages (kick texts, server list infos, game chat notifications)
+// in the language set in config (Msh.Language). Messages missing in the language catalog fall back to english.
+
+// langFolder is the folder (relative to msh working directory) that contains the language catalogs (<language>.json)
+const langFolder = "lang"
+
+var (
+	m sync.RWMutex
+
+	// catalog contains the messages of the loaded language
+	catalog = map[string]string{}
+)
+
+// english is the default message catalog (lang/en.json can be used as template for translations).
+// Messages are fmt format strings: translations must keep the same verbs in the same order.
+var english = map[string]string{
+	"info.hibernation":       "                   §fserver status:\n                   §b§lHIBERNATING",
+	"info.starting":          "                   §fserver status: §7<progress>\n                    §6§lWARMING UP §7<eta> §e<waiting>",
+	"info.locked":            "§cserver locked by admin until <until>\n§7<reason>",
+	"info.draining":          "§6server under maintenance, come back later\n§7<reason>",
+	"info.host-offline":      "                   §fserver status:\n                   §c§lHOST OFFLINE",
+	"info.online":            "§fserver online: %d players",
+	"info.last-online":       "§7last online: %s",
+	"info.waiting":           "%d players waiting",
+	"info.waiting-players":   "§ewaiting: %s",
+	"version.hibernating":    " (hibernating)",
+	"version.starting":       " (starting)",
+	"kick.hibernating":       "Server is hibernating. Please retry later",
+	"kick.starting":          "Server is starting. Please wait...",
+	"kick.wake":              "Server start command issued. Please wait...",
+	"kick.online":            "Server is not accepting players",
+	"kick.stopping":          "Server is stopping. Please retry in a moment...",
+	"kick.start-error":       "An error occurred while starting the server: check the msh log",
+	"kick.dial-error":        "can't connect to server... check if minecraft server is running and set the correct targetPort",
+	"kick.host-unreachable":  "Server host is not reachable, please retry later",
+	"kick.host-reachable":    "Server host is reachable again, please reconnect",
+	"kick.cooldown":          "%s already started the server %d times in the last %d minutes: retry in %d minutes",
+	"kick.wake-limit":        "Server was woken up %d times in the last hour: retry in %d minutes",
+	"kick.wake-refused":      "Server can't be started right now, please retry later",
+	"kick.hover-progress":    "§fStartup: §7%s",
+	"kick.hover-eta":         "§fEstimated: §7%s",
+	"kick.retry":             "§7Retry in a moment: §f%s",
+	"kick.retry-in":          "§7Retry in %ds: §f%s",
+	"kick.copy-address":      "Click to copy the server address",
+	"quota.exceeded":         "monthly playtime quota of %d hours exceeded, server available again on %s",
+	"chat.quota":             "%s: server hibernating in 60 seconds",
+	"chat.welcome-back":      "welcome back %s, thanks for waiting!",
+	"chat.restart":           "server restarting in %d seconds",
+	"chat.update":            "msh (%s) is now available: visit github to update!",
+	"chat.cmd-status":        "msh: %d players online, the empty server hibernates after %d minutes",
+	"chat.cmd-stop":          "msh: stopping the server...",
+	"chat.cmd-error":         "msh: command failed: %s",
+	"chat.cmd-help":          "msh commands: %s status - stop - keepalive <duration|off> - help",
+	"chat.cmd-denied":        "msh: you are not allowed to run msh commands",
+	"chat.cmd-keepalive":     "msh: the server is kept online until %s",
+	"chat.cmd-keepalive-off": "msh: keep-alive ended, the empty server hibernates again",
+	"eta.almost-ready":       "almost ready",
+	"eta.seconds":            "~%ds left",
+	"eta.minutes":            "~%dm left",
+	"lock.no-expiration":     "further notice",
+	"restart.none":           "not scheduled",
+	"restart.in":             "in %s",
+}
+
+// verbRegexp matches the fmt verbs of a message
+var verbRegexp = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// Load loads the message catalog of language (language code of a catalog in the lang folder or path to a json file).
+// Messages missing in the catalog, or with different fmt verbs than the english message, fall back to english.
+func Load(language string) *errco.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	catalog = map[string]string{}
+
+	if language == "" || language == "en" {
+		return nil
+	}
+
+	path := language
+	if !strings.HasSuffix(language, ".json") {
+		path = filepath.Join(langFolder, language+".json")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_LOCALE_LOAD, errco.LVL_B, "Load", "language catalog not loaded, using english: "+err.Error())
+	}
+
+	loaded := map[string]string{}
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_LOCALE_LOAD, errco.LVL_B, "Load", "language catalog not valid, using english: "+err.Error())
+	}
+
+	for key, message := range loaded {
+		en, ok := english[key]
+		if !ok {
+			errco.Logln(errco.LVL_D, "language catalog %s: unknown message %s", path, key)
+			continue
+		}
+		if strings.Join(verbRegexp.FindAllString(message, -1), "") != strings.Join(verbRegexp.FindAllString(en, -1), "") {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_LOCALE_LOAD, errco.LVL_B, "Load", fmt.Sprintf("language catalog %s: message %s does not match the english format verbs, using english", path, key)))
+			continue
+		}
+		catalog[key] = message
+	}
+
+	errco.Logln(errco.LVL_D, "loaded %d/%d messages of language catalog %s", len(catalog), len(english), path)
+
+	return nil
+}
+
+// T returns the message of key in the loaded language (formatted with args, if any)
+func T(key string, args ...interface{}) string {
+	m.RLock()
+	message, ok := catalog[key]
+	m.RUnlock()
+
+	if !ok {
+		message, ok = english[key]
+		if !ok {
+			// message keys are constant: a missing key is a bug
+			return key
+		}
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
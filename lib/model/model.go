@@ -1,5 +1,7 @@
 package model
 
+import "encoding/json"
+
 // struct adapted to config file
 type Configuration struct {
 	Server struct {
@@ -7,21 +9,311 @@ type Configuration struct {
 		FileName string `json:"FileName"`
 		Version  string `json:"Version"`
 		Protocol int    `json:"Protocol"`
+		Backend  string `json:"Backend"`
 	} `json:"Server"`
+	Proxy struct {
+		BufferSize       int  `json:"BufferSize"`
+		SocketBufferSize int  `json:"SocketBufferSize"`
+		DisableNoDelay   bool `json:"DisableNoDelay"`
+		KeepAliveSeconds int  `json:"KeepAliveSeconds"`
+		StallTimeout     int  `json:"StallTimeout"`
+	} `json:"Proxy"`
+	Provision struct {
+		Flavor     string `json:"Flavor"`
+		Version    string `json:"Version"`
+		AcceptEula bool   `json:"AcceptEula"`
+	} `json:"Provision"`
+	Docker struct {
+		Host      string `json:"Host"`
+		Container string `json:"Container"`
+	} `json:"Docker"`
+	Kubernetes struct {
+		Kubeconfig string `json:"Kubeconfig"`
+		Namespace  string `json:"Namespace"`
+		Kind       string `json:"Kind"`
+		Name       string `json:"Name"`
+		TargetHost string `json:"TargetHost"`
+		TargetPort int    `json:"TargetPort"`
+	} `json:"Kubernetes"`
+	Pterodactyl struct {
+		PanelUrl   string `json:"PanelUrl"`
+		ApiToken   string `json:"ApiToken"`
+		ServerId   string `json:"ServerId"`
+		TargetHost string `json:"TargetHost"`
+		TargetPort int    `json:"TargetPort"`
+	} `json:"Pterodactyl"`
 	Commands struct {
-		StartServer         string `json:"StartServer"`
-		StartServerParam    string `json:"StartServerParam"`
-		StopServer          string `json:"StopServer"`
-		StopServerAllowKill int    `json:"StopServerAllowKill"`
+		StartServer      string `json:"StartServer"`
+		StartServerParam string `json:"StartServerParam"`
+		JavaMemory       struct {
+			Percent    int `json:"Percent"`
+			HeadroomMB int `json:"HeadroomMB"`
+			MinMB      int `json:"MinMB"`
+			MaxMB      int `json:"MaxMB"`
+		} `json:"JavaMemory"`
+		JavaFlags           string            `json:"JavaFlags"`
+		StartServerEnv      map[string]string `json:"StartServerEnv"`
+		StartServerUmask    string            `json:"StartServerUmask"`
+		StartServerWorkDir  string            `json:"StartServerWorkDir"`
+		StopServer          string            `json:"StopServer"`
+		StopServerAllowKill int               `json:"StopServerAllowKill"`
+		StopServerTermGrace int               `json:"StopServerTermGrace"`
+		CrashRestartMax     int               `json:"CrashRestartMax"`
+		CrashRestartDelay   int               `json:"CrashRestartDelay"`
+		HangTimeout         int               `json:"HangTimeout"`
+		StartTimeout        int               `json:"StartTimeout"`
+		ReadinessProbe      string            `json:"ReadinessProbe"`
+		ReadinessDelay      int               `json:"ReadinessDelay"`
+		PreStopCommands     []struct {
+			Command string `json:"Command"`
+			Delay   int    `json:"Delay"`
+			Match   string `json:"Match"`
+			Timeout int    `json:"Timeout"`
+		} `json:"PreStopCommands"`
 	} `json:"Commands"`
 	Msh struct {
-		Debug                         int    `json:"Debug"`
-		InfoHibernation               string `json:"InfoHibernation"`
-		InfoStarting                  string `json:"InfoStarting"`
-		NotifyUpdate                  bool   `json:"NotifyUpdate"`
-		ListenPort                    int    `json:"ListenPort"`
-		TimeBeforeStoppingEmptyServer int64  `json:"TimeBeforeStoppingEmptyServer"`
+		Debug                         int      `json:"Debug"`
+		InfoHibernation               string   `json:"InfoHibernation"`
+		InfoStarting                  string   `json:"InfoStarting"`
+		InfoLocked                    string   `json:"InfoLocked"`
+		InfoDraining                  string   `json:"InfoDraining"`
+		InfoWake                      string   `json:"InfoWake"`
+		InfoStartingKick              string   `json:"InfoStartingKick"`
+		KickAddress                   string   `json:"KickAddress"`
+		WelcomeBack                   string   `json:"WelcomeBack"`
+		Language                      string   `json:"Language"`
+		NotifyUpdate                  bool     `json:"NotifyUpdate"`
+		SelfUpdate                    bool     `json:"SelfUpdate"`
+		DisableUpdateCheck            bool     `json:"DisableUpdateCheck"`
+		UpdateCheckInterval           int      `json:"UpdateCheckInterval"`
+		UpdateChannel                 string   `json:"UpdateChannel"`
+		UpdateUserAgent               string   `json:"UpdateUserAgent"`
+		Proxy                         string   `json:"Proxy"`
+		NoProxy                       []string `json:"NoProxy"`
+		CACerts                       []string `json:"CACerts"`
+		ListenPort                    int      `json:"ListenPort"`
+		TimeBeforeStoppingEmptyServer int64    `json:"TimeBeforeStoppingEmptyServer"`
+		LogBufferSize                 int      `json:"LogBufferSize"`
+		HostMemoryFreezeThreshold     int      `json:"HostMemoryFreezeThreshold"`
+		EventFile                     string   `json:"EventFile"`
+		EventFileMaxSize              int      `json:"EventFileMaxSize"`
+		SecurityLogFile               string   `json:"SecurityLogFile"`
+		StateFile                     string   `json:"StateFile"`
+		DetachOnExit                  bool     `json:"DetachOnExit"`
+		SeamlessRestart               bool     `json:"SeamlessRestart"`
+		RestartDrainTimeout           int      `json:"RestartDrainTimeout"`
+		TerminalBell                  bool     `json:"TerminalBell"`
+		AutoPort                      bool     `json:"AutoPort"`
+		WakeOnPing                    bool     `json:"WakeOnPing"`
+		WakeOnPingDebounce            int      `json:"WakeOnPingDebounce"`
+		ConsoleLogFile                string   `json:"ConsoleLogFile"`
+		StatusMaxPlayers              int      `json:"StatusMaxPlayers"`
+		StatusProtocol                string   `json:"StatusProtocol"`
+		CommandFifo                   string   `json:"CommandFifo"`
 	} `json:"Msh"`
+	World struct {
+		IntegrityCheck bool   `json:"IntegrityCheck"`
+		BackupFolder   string `json:"BackupFolder"`
+		AutoRestore    bool   `json:"AutoRestore"`
+	} `json:"World"`
+	Console struct {
+		Rules []struct {
+			Match  string `json:"Match"`
+			Action string `json:"Action"`
+			Color  string `json:"Color"`
+		} `json:"Rules"`
+	} `json:"Console"`
+	LogProfile struct {
+		Preset   string `json:"Preset"`
+		Line     string `json:"Line"`
+		Info     string `json:"Info"`
+		Chat     string `json:"Chat"`
+		Done     string `json:"Done"`
+		Progress string `json:"Progress"`
+		Stage    string `json:"Stage"`
+		Join     string `json:"Join"`
+		Login    string `json:"Login"`
+		Leave    string `json:"Leave"`
+		Stopping string `json:"Stopping"`
+	} `json:"LogProfile"`
+	HibernationPeriods []struct {
+		From                          string   `json:"From"`
+		To                            string   `json:"To"`
+		Days                          []string `json:"Days"`
+		TimeBeforeStoppingEmptyServer int64    `json:"TimeBeforeStoppingEmptyServer"`
+		AlwaysOn                      bool     `json:"AlwaysOn"`
+	} `json:"HibernationPeriods"`
+	ScheduledRestart struct {
+		DailyAt        string `json:"DailyAt"`
+		UptimeHours    int    `json:"UptimeHours"`
+		OnlyWhenEmpty  bool   `json:"OnlyWhenEmpty"`
+		WarningSeconds int    `json:"WarningSeconds"`
+	} `json:"ScheduledRestart"`
+	Priority struct {
+		Enabled   bool  `json:"Enabled"`
+		Starting  int   `json:"Starting"`
+		Online    int   `json:"Online"`
+		Empty     int   `json:"Empty"`
+		EmptyCpus []int `json:"EmptyCpus"`
+	} `json:"Priority"`
+	Quota struct {
+		MonthlyHours   int      `json:"MonthlyHours"`
+		OverrideTokens []string `json:"OverrideTokens"`
+	} `json:"Quota"`
+	WakeCooldown struct {
+		MaxWakes      int `json:"MaxWakes"`
+		PeriodMinutes int `json:"PeriodMinutes"`
+	} `json:"WakeCooldown"`
+	FreezePolicy struct {
+		MinOnlineMinutes int `json:"MinOnlineMinutes"`
+		MaxWakesPerHour  int `json:"MaxWakesPerHour"`
+	} `json:"FreezePolicy"`
+	ChatCommands struct {
+		Prefix  string   `json:"Prefix"`
+		Players []string `json:"Players"`
+		Ops     bool     `json:"Ops"`
+	} `json:"ChatCommands"`
+	Forwarding struct {
+		Mode           string `json:"Mode"`
+		VelocitySecret string `json:"VelocitySecret"`
+	} `json:"Forwarding"`
+	AuxForwards []struct {
+		Name          string   `json:"Name"`
+		Protocol      string   `json:"Protocol"`
+		ListenPort    int      `json:"ListenPort"`
+		TargetHost    string   `json:"TargetHost"`
+		TargetPort    int      `json:"TargetPort"`
+		Wake          bool     `json:"Wake"`
+		WakeAllowlist []string `json:"WakeAllowlist"`
+		WakeDebounce  int      `json:"WakeDebounce"`
+	} `json:"AuxForwards"`
+	Mirror struct {
+		PrimaryApi      string `json:"PrimaryApi"`
+		InfoHostOffline string `json:"InfoHostOffline"`
+	} `json:"Mirror"`
+	Webhooks struct {
+		Urls       []string `json:"Urls"`
+		Events     []string `json:"Events"`
+		Secret     string   `json:"Secret"`
+		MaxRetries int      `json:"MaxRetries"`
+	} `json:"Webhooks"`
+	Notify struct {
+		Events    []string          `json:"Events"`
+		Templates map[string]string `json:"Templates"`
+		Telegram  struct {
+			BotToken     string   `json:"BotToken"`
+			ChatId       string   `json:"ChatId"`
+			AdminChatIds []string `json:"AdminChatIds"`
+			Events       []string `json:"Events"`
+		} `json:"Telegram"`
+		Pushover struct {
+			AppToken string   `json:"AppToken"`
+			UserKey  string   `json:"UserKey"`
+			Priority int      `json:"Priority"`
+			Events   []string `json:"Events"`
+		} `json:"Pushover"`
+		Gotify struct {
+			Url      string   `json:"Url"`
+			Token    string   `json:"Token"`
+			Priority int      `json:"Priority"`
+			Events   []string `json:"Events"`
+		} `json:"Gotify"`
+	} `json:"Notify"`
+	Ddns struct {
+		Provider   string `json:"Provider"`
+		Hostname   string `json:"Hostname"`
+		IpUrl      string `json:"IpUrl"`
+		Cloudflare struct {
+			ApiToken string `json:"ApiToken"`
+			ZoneId   string `json:"ZoneId"`
+		} `json:"Cloudflare"`
+		DuckDns struct {
+			Token string `json:"Token"`
+		} `json:"DuckDns"`
+		Http struct {
+			UpdateUrl string `json:"UpdateUrl"`
+		} `json:"Http"`
+	} `json:"Ddns"`
+	Mqtt struct {
+		Broker      string `json:"Broker"`
+		Username    string `json:"Username"`
+		Password    string `json:"Password"`
+		ClientId    string `json:"ClientId"`
+		TopicPrefix string `json:"TopicPrefix"`
+	} `json:"Mqtt"`
+	Wake struct {
+		Dns struct {
+			ListenAddress string `json:"ListenAddress"`
+			Name          string `json:"Name"`
+		} `json:"Dns"`
+		Imap struct {
+			Server   string `json:"Server"`
+			Username string `json:"Username"`
+			Password string `json:"Password"`
+			Mailbox  string `json:"Mailbox"`
+			Subject  string `json:"Subject"`
+			Interval int    `json:"Interval"`
+		} `json:"Imap"`
+	} `json:"Wake"`
+	Hooks struct {
+		PreStart   string `json:"PreStart"`
+		PostStart  string `json:"PostStart"`
+		PreStop    string `json:"PreStop"`
+		PostStop   string `json:"PostStop"`
+		PlayerJoin string `json:"PlayerJoin"`
+		Timeout    int    `json:"Timeout"`
+	} `json:"Hooks"`
+	Plugins []struct {
+		Name        string   `json:"Name"`
+		Command     string   `json:"Command"`
+		Events      []string `json:"Events"`
+		Veto        bool     `json:"Veto"`
+		VetoTimeout int      `json:"VetoTimeout"`
+	} `json:"Plugins"`
+	Chaos struct {
+		FailStart             bool `json:"FailStart"`
+		SlowStartSeconds      int  `json:"SlowStartSeconds"`
+		DropConnectionPercent int  `json:"DropConnectionPercent"`
+		CorruptStatus         bool `json:"CorruptStatus"`
+	} `json:"Chaos"`
+	Preflight struct {
+		MinFreeDiskMB  int  `json:"MinFreeDiskMB"`
+		CheckJava      bool `json:"CheckJava"`
+		JavaMinVersion int  `json:"JavaMinVersion"`
+	} `json:"Preflight"`
+	Policy struct {
+		Offline  PolicyState `json:"Offline"`
+		Starting PolicyState `json:"Starting"`
+		Online   PolicyState `json:"Online"`
+		Stopping PolicyState `json:"Stopping"`
+	} `json:"Policy"`
+	Api struct {
+		ListenHost       string              `json:"ListenHost"`
+		ListenPort       int                 `json:"ListenPort"`
+		GrpcPort         int                 `json:"GrpcPort"`
+		TLS              bool                `json:"TLS"`
+		TLSCertFile      string              `json:"TLSCertFile"`
+		TLSKeyFile       string              `json:"TLSKeyFile"`
+		TLSClientCAFile  string              `json:"TLSClientCAFile"`
+		CliCertFile      string              `json:"CliCertFile"`
+		CliKeyFile       string              `json:"CliKeyFile"`
+		Tokens           []string            `json:"Tokens"`
+		CommandAllowlist map[string][]string `json:"CommandAllowlist"`
+	} `json:"Api"`
+	Profile  string                     `json:"Profile"`
+	Profiles map[string]json.RawMessage `json:"Profiles"`
+}
+
+// PolicyState contains the actions taken by msh on status and login requests in a minecraft server state
+type PolicyState struct {
+	Status PolicyRule `json:"Status"`
+	Login  PolicyRule `json:"Login"`
+}
+
+// PolicyRule is the action taken by msh on a client request and the message (status description or kick text) shown
+type PolicyRule struct {
+	Action  string `json:"Action"`
+	Message string `json:"Message"`
 }
 
 type DataTxt struct {
@@ -35,10 +327,16 @@ type DataInfo struct {
 	Players struct {
 		Max    int `json:"max"`
 		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+			Id   string `json:"id"`
+		} `json:"sample,omitempty"`
 	} `json:"players"`
 	Version struct {
 		Name     string `json:"name"`
 		Protocol int    `json:"protocol"`
 	} `json:"version"`
-	Favicon string `json:"favicon"`
+	Favicon   string          `json:"favicon"`
+	ModInfo   json.RawMessage `json:"modinfo,omitempty"`   // mod list of forge 1.7-1.12 servers
+	ForgeData json.RawMessage `json:"forgeData,omitempty"` // mods and channels of forge 1.13+ servers
 }
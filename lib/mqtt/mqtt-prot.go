@@ -0,0 +1,152 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"msh/lib/errco"
+)
+
+// mqtt 3.1.1 control packet types (fixed header first byte)
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetSubscribe  = 0x82 // subscribe requires flags 0010
+	packetSuback     = 0x90
+	packetPingreq    = 0xc0
+	packetPingresp   = 0xd0
+	packetDisconnect = 0xe0
+)
+
+// buildConnect builds a CONNECT packet with clean session and a retained will message
+func buildConnect(clientID, username, password, willTopic, willMessage string, keepAlive uint16) []byte {
+	var flags byte = 0x02 | 0x04 | 0x20 // clean session, will flag, will retain
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+
+	body := encodeString("MQTT")
+	body = append(body, 0x04, flags) // protocol level 4 (3.1.1)
+	body = append(body, byte(keepAlive>>8), byte(keepAlive))
+
+	body = append(body, encodeString(clientID)...)
+	body = append(body, encodeString(willTopic)...)
+	body = append(body, encodeString(willMessage)...)
+	if username != "" {
+		body = append(body, encodeString(username)...)
+	}
+	if password != "" {
+		body = append(body, encodeString(password)...)
+	}
+
+	return buildPacket(packetConnect, body)
+}
+
+// buildPublish builds a QoS 0 PUBLISH packet
+func buildPublish(topic string, payload []byte, retain bool) []byte {
+	var header byte = packetPublish
+	if retain {
+		header |= 0x01
+	}
+
+	body := encodeString(topic)
+	body = append(body, payload...)
+
+	return buildPacket(header, body)
+}
+
+// buildSubscribe builds a SUBSCRIBE packet for a single topic with QoS 0
+func buildSubscribe(packetID uint16, topic string) []byte {
+	body := []byte{byte(packetID >> 8), byte(packetID)}
+	body = append(body, encodeString(topic)...)
+	body = append(body, 0x00)
+
+	return buildPacket(packetSubscribe, body)
+}
+
+// buildPacket prepends the fixed header (packet type and remaining length) to body
+func buildPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+
+	// remaining length is encoded as variable length integer (7 bits per byte)
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(packet, body...)
+}
+
+// readPacket reads a packet and returns its fixed header first byte and body
+func readPacket(r *bufio.Reader) (byte, []byte, *errco.Error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_D, "readPacket", err.Error())
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errco.NewErr(errco.ERROR_MQTT_PROTOCOL, errco.LVL_D, "readPacket", "remaining length is malformed")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_D, "readPacket", err.Error())
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return 0, nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_D, "readPacket", err.Error())
+	}
+
+	return header, body, nil
+}
+
+// parsePublish returns topic and payload of a PUBLISH packet
+func parsePublish(header byte, body []byte) (string, []byte, *errco.Error) {
+	if len(body) < 2 {
+		return "", nil, errco.NewErr(errco.ERROR_MQTT_PROTOCOL, errco.LVL_D, "parsePublish", "publish packet is too short")
+	}
+
+	topicLen := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+topicLen {
+		return "", nil, errco.NewErr(errco.ERROR_MQTT_PROTOCOL, errco.LVL_D, "parsePublish", "publish topic is malformed")
+	}
+	topic := string(body[2 : 2+topicLen])
+	payload := body[2+topicLen:]
+
+	// QoS > 0 publish packets contain a packet identifier
+	if (header>>1)&0x03 > 0 {
+		if len(payload) < 2 {
+			return "", nil, errco.NewErr(errco.ERROR_MQTT_PROTOCOL, errco.LVL_D, "parsePublish", "publish packet identifier is missing")
+		}
+		payload = payload[2:]
+	}
+
+	return topic, payload, nil
+}
+
+// encodeString encodes a string as length prefixed utf-8
+func encodeString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
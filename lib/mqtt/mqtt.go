@@ -0,0 +1,287 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/outbound"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+const (
+	keepAlive      = 60 * time.Second // keep alive interval declared to the broker
+	reconnectDelay = 10 * time.Second // delay before reconnecting to the broker
+)
+
+// client is a connection to the mqtt broker
+type client struct {
+	m      sync.Mutex // used to write packets one at a time
+	conn   net.Conn
+	prefix string
+}
+
+// MqttManager publishes msh status, player count and events to the mqtt broker (Mqtt.Broker)
+// and executes commands ("start", "freeze") received on "<Mqtt.TopicPrefix>/command".
+// Published topics:
+// <prefix>/availability	msh availability "online"/"offline" (retained)
+// <prefix>/status			minecraft server status (retained)
+// <prefix>/players			online player count (retained)
+// <prefix>/event			json events
+// [goroutine]
+func MqttManager() {
+	if config.ConfigRuntime.Mqtt.Broker == "" {
+		return
+	}
+
+	eventC := events.Subscribe(100)
+
+	for {
+		c, errMsh := connect()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("MqttManager"))
+			time.Sleep(reconnectDelay)
+			continue
+		}
+
+		errco.Logln(errco.LVL_D, "MqttManager: connected to mqtt broker %s", config.ConfigRuntime.Mqtt.Broker)
+
+		errMsh = c.serve(eventC)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("MqttManager"))
+		}
+
+		c.conn.Close()
+
+		// the new msh process took over the mqtt session (seamless restart)
+		if handover.HandedOver() {
+			return
+		}
+
+		time.Sleep(reconnectDelay)
+	}
+}
+
+// connect opens a connection to the broker, subscribes to the command topic and publishes the current state
+func connect() (*client, *errco.Error) {
+	brokerURL, err := url.Parse(config.ConfigRuntime.Mqtt.Broker)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_B, "connect", "broker url is not valid: "+err.Error())
+	}
+
+	var conn net.Conn
+	switch brokerURL.Scheme {
+	case "tcp", "mqtt":
+		conn, err = net.DialTimeout("tcp", hostPort(brokerURL, "1883"), 10*time.Second)
+	case "tls", "ssl", "mqtts":
+		tlsConfig, errMsh := outbound.TLSConfig()
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("connect")
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", hostPort(brokerURL, "8883"), tlsConfig)
+	default:
+		return nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_B, "connect", "broker url scheme not supported (tcp, tls): "+brokerURL.Scheme)
+	}
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_D, "connect", err.Error())
+	}
+
+	c := &client{conn: conn, prefix: strings.TrimSuffix(topicPrefix(), "/")}
+
+	clientID := config.ConfigRuntime.Mqtt.ClientId
+	if clientID == "" {
+		clientID = "msh"
+	}
+
+	// connect with a will message so that the broker marks msh as offline if the connection is lost
+	_, err = conn.Write(buildConnect(clientID, config.ConfigRuntime.Mqtt.Username, config.ConfigRuntime.Mqtt.Password, c.prefix+"/availability", "offline", uint16(keepAlive/time.Second)))
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_D, "connect", err.Error())
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	header, body, errMsh := readPacket(bufio.NewReader(conn))
+	conn.SetReadDeadline(time.Time{})
+	if errMsh != nil {
+		conn.Close()
+		return nil, errMsh.AddTrace("connect")
+	}
+	if header != packetConnack || len(body) < 2 {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_MQTT_PROTOCOL, errco.LVL_D, "connect", "unexpected packet instead of connack")
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_B, "connect", "connection refused by broker (return code "+strconv.Itoa(int(body[1]))+")")
+	}
+
+	errMsh = c.write(buildSubscribe(1, c.prefix+"/command"))
+	if errMsh != nil {
+		conn.Close()
+		return nil, errMsh.AddTrace("connect")
+	}
+
+	errMsh = c.publishState()
+	if errMsh != nil {
+		conn.Close()
+		return nil, errMsh.AddTrace("connect")
+	}
+
+	return c, nil
+}
+
+// serve publishes events, keeps the connection alive and handles commands until the connection is lost
+// [blocking]
+func (c *client) serve(eventC chan events.Event) *errco.Error {
+	readErrC := make(chan *errco.Error, 1)
+
+	// [goroutine]
+	go func() {
+		readErrC <- c.readLoop()
+	}()
+
+	pingTicker := time.NewTicker(keepAlive / 2)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case errMsh := <-readErrC:
+			return errMsh.AddTrace("serve")
+
+		case <-pingTicker.C:
+			errMsh := c.write([]byte{packetPingreq, 0x00})
+			if errMsh != nil {
+				return errMsh.AddTrace("serve")
+			}
+
+		case e := <-eventC:
+			payload, err := json.Marshal(e)
+			if err != nil {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "serve", err.Error()))
+				continue
+			}
+
+			errMsh := c.write(buildPublish(c.prefix+"/event", payload, false))
+			if errMsh != nil {
+				return errMsh.AddTrace("serve")
+			}
+
+			errMsh = c.publishState()
+			if errMsh != nil {
+				return errMsh.AddTrace("serve")
+			}
+		}
+	}
+}
+
+// readLoop reads packets from the broker and executes commands received on the command topic
+// [blocking]
+func (c *client) readLoop() *errco.Error {
+	r := bufio.NewReader(c.conn)
+
+	for {
+		// the broker must answer to pings: consider the connection lost if nothing is received
+		c.conn.SetReadDeadline(time.Now().Add(keepAlive + keepAlive/2))
+
+		header, body, errMsh := readPacket(r)
+		if errMsh != nil {
+			return errMsh.AddTrace("readLoop")
+		}
+
+		if header&0xf0 != packetPublish {
+			// suback, pingresp and other packets do not require an action
+			continue
+		}
+
+		topic, payload, errMsh := parsePublish(header, body)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("readLoop"))
+			continue
+		}
+
+		if topic == c.prefix+"/command" {
+			go command(strings.TrimSpace(string(payload)))
+		}
+	}
+}
+
+// publishState publishes msh availability, minecraft server status and player count as retained messages
+func (c *client) publishState() *errco.Error {
+	for topic, payload := range map[string]string{
+		"availability": "online",
+		"status":       servstats.StatusName(servstats.Stats.Status),
+		"players":      strconv.Itoa(servstats.Stats.PlayerCount),
+	} {
+		errMsh := c.write(buildPublish(c.prefix+"/"+topic, []byte(payload), true))
+		if errMsh != nil {
+			return errMsh.AddTrace("publishState")
+		}
+	}
+
+	return nil
+}
+
+// write sends a packet to the broker
+func (c *client) write(packet []byte) *errco.Error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(packet)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_MQTT_CONNECTION, errco.LVL_D, "write", err.Error())
+	}
+
+	return nil
+}
+
+// command executes a command received on the command topic
+// [goroutine]
+func command(com string) {
+	errco.Logln(errco.LVL_B, "mqtt command received: %s", com)
+
+	var errMsh *errco.Error
+	switch com {
+	case "start":
+		errMsh = servctrl.StartMS(history.By(history.SOURCE_MQTT))
+	case "freeze":
+		errMsh = servctrl.StopMS(false, history.By(history.SOURCE_MQTT))
+	default:
+		errMsh = errco.NewErr(errco.ERROR_COMMAND_UNKNOWN, errco.LVL_B, "command", "unknown mqtt command (start - freeze): "+com)
+	}
+
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("command"))
+	}
+}
+
+// topicPrefix returns the prefix of msh topics (default "msh")
+func topicPrefix() string {
+	if config.ConfigRuntime.Mqtt.TopicPrefix == "" {
+		return "msh"
+	}
+
+	return config.ConfigRuntime.Mqtt.TopicPrefix
+}
+
+// hostPort returns the host:port of the broker url (using defaultPort if not specified)
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	return u.Host
+}
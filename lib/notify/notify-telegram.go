@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/outbound"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+const (
+	telegramPollTimeout = 50 * time.Second // long polling timeout of the getUpdates requests
+	telegramRetryDelay  = 10 * time.Second // delay before polling again after an error
+	telegramMaxText     = 4000             // maximum length of a reply (telegram limit: 4096)
+)
+
+// telegramUpdate is an update received from the Telegram bot api (only text messages are used)
+type telegramUpdate struct {
+	UpdateId int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			Id int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// TelegramBot receives the commands sent to the Telegram bot by the admin chats (Notify.Telegram.AdminChatIds)
+// and replies to them:
+//
+//	/status			minecraft server status and online players
+//	/start			start the minecraft server
+//	/freeze			stop the minecraft server
+//	/exec <command>	execute a minecraft server command and reply with its output
+//
+// Messages are received by long polling, so no http port must be exposed.
+// [goroutine]
+func TelegramBot() {
+	t := config.ConfigRuntime.Notify.Telegram
+	if t.BotToken == "" || len(t.AdminChatIds) == 0 {
+		return
+	}
+
+	client, errMsh := outbound.Client(telegramPollTimeout + 10*time.Second)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("TelegramBot"))
+		return
+	}
+
+	// skip the messages sent while msh was not running (a stale /freeze must not be executed)
+	var offset int64
+	for {
+		updates, errMsh := getUpdates(client, -1, 0)
+		if errMsh == nil {
+			for _, u := range updates {
+				offset = u.UpdateId + 1
+			}
+			break
+		}
+		errco.LogMshErr(errMsh.AddTrace("TelegramBot"))
+		time.Sleep(telegramRetryDelay)
+	}
+
+	errco.Logln(errco.LVL_D, "TelegramBot: receiving commands from %d admin chats", len(t.AdminChatIds))
+
+	for {
+		updates, errMsh := getUpdates(client, offset, telegramPollTimeout)
+
+		// the new msh process receives the commands (seamless restart)
+		if handover.HandedOver() {
+			return
+		}
+
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("TelegramBot"))
+			time.Sleep(telegramRetryDelay)
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateId + 1
+			if u.Message == nil || u.Message.Text == "" {
+				continue
+			}
+
+			go telegramCommand(client, strconv.FormatInt(u.Message.Chat.Id, 10), u.Message.Text)
+		}
+	}
+}
+
+// getUpdates returns the updates of the Telegram bot starting from offset, waiting at most timeout for new updates
+// [blocking]
+func getUpdates(client *http.Client, offset int64, timeout time.Duration) ([]telegramUpdate, *errco.Error) {
+	q := url.Values{
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"timeout":         {strconv.Itoa(int(timeout.Seconds()))},
+		"allowed_updates": {`["message"]`},
+	}
+
+	resp, err := client.Get("https://api.telegram.org/bot" + config.ConfigRuntime.Notify.Telegram.BotToken + "/getUpdates?" + q.Encode())
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_TELEGRAM_BOT, errco.LVL_D, "getUpdates", stripURL(err).Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errco.NewErr(errco.ERROR_TELEGRAM_BOT, errco.LVL_B, "getUpdates", checkResponse(resp).Error())
+	}
+
+	var res struct {
+		Result []telegramUpdate `json:"result"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_TELEGRAM_BOT, errco.LVL_D, "getUpdates", err.Error())
+	}
+
+	return res.Result, nil
+}
+
+// telegramCommand executes a command sent to the Telegram bot and replies to the chat
+// [goroutine]
+func telegramCommand(client *http.Client, chatId, text string) {
+	if !adminChat(chatId) {
+		errco.Logln(errco.LVL_B, "telegram command refused: chat %s is not an admin chat", chatId)
+		telegramReply(client, chatId, "not authorized: add chat id "+chatId+" to Notify.Telegram.AdminChatIds")
+		return
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	// commands can be addressed to the bot in group chats (ex: /status@msh_bot)
+	com := strings.Split(fields[0], "@")[0]
+
+	errco.Logln(errco.LVL_B, "telegram command received from chat %s: %s", chatId, text)
+
+	var reply string
+	switch com {
+	case "/status":
+		servstats.Stats.M.Lock()
+		reply = fmt.Sprintf("minecraft server is %s\n%d players online", servstats.StatusName(servstats.Stats.Status), servstats.Stats.PlayerCount)
+		if len(servstats.Stats.Players) > 0 {
+			reply += ": " + strings.Join(servstats.Stats.Players, ", ")
+		}
+		servstats.Stats.M.Unlock()
+
+	case "/start":
+		errMsh := servctrl.StartMS(history.By(history.SOURCE_TELEGRAM))
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("telegramCommand"))
+			reply = "start failed: " + errMsh.Str
+			break
+		}
+		reply = "minecraft server is starting"
+
+	case "/freeze":
+		errMsh := servctrl.StopMS(false, history.By(history.SOURCE_TELEGRAM))
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("telegramCommand"))
+			reply = "freeze failed: " + errMsh.Str
+			break
+		}
+		reply = "minecraft server is stopping"
+
+	case "/exec":
+		if len(fields) < 2 {
+			reply = "usage: /exec <minecraft server command>"
+			break
+		}
+		output, errMsh := servctrl.ExecuteCapture(strings.Join(fields[1:], " "), "telegram", nil, 500*time.Millisecond, 5*time.Second)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("telegramCommand"))
+			reply = "exec failed: " + errMsh.Str
+			break
+		}
+		reply = strings.Join(output, "\n")
+		if reply == "" {
+			reply = "(no output)"
+		}
+
+	default:
+		reply = "msh commands: /status - /start - /freeze - /exec <command>"
+	}
+
+	telegramReply(client, chatId, reply)
+}
+
+// adminChat returns true if chatId is one of Notify.Telegram.AdminChatIds
+func adminChat(chatId string) bool {
+	for _, id := range config.ConfigRuntime.Notify.Telegram.AdminChatIds {
+		if id == chatId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// telegramReply sends text to the Telegram chat
+func telegramReply(client *http.Client, chatId, text string) {
+	if len(text) > telegramMaxText {
+		text = strings.ToValidUTF8(text[:telegramMaxText], "") + "\n..."
+	}
+
+	err := postJSON(client, "https://api.telegram.org/bot"+config.ConfigRuntime.Notify.Telegram.BotToken+"/sendMessage", map[string]interface{}{
+		"chat_id": chatId,
+		"text":    text,
+	})
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_NOTIFY_DELIVERY, errco.LVL_B, "telegramReply", "telegram reply not delivered: "+err.Error()))
+	}
+}
+
+// telegramChats returns the chats that receive the event notifications (Notify.Telegram ChatId and AdminChatIds)
+func telegramChats() []string {
+	t := config.ConfigRuntime.Notify.Telegram
+
+	chats := []string{}
+	if t.ChatId != "" {
+		chats = append(chats, t.ChatId)
+	}
+	for _, id := range t.AdminChatIds {
+		if id != t.ChatId {
+			chats = append(chats, id)
+		}
+	}
+
+	return chats
+}
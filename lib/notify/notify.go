@@ -0,0 +1,244 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/outbound"
+)
+
+// notify package delivers msh events to the admins through push notification services
+// (Telegram bot, Pushover, Gotify): admins are usually not in game when something breaks.
+
+// defaultEvents are the event types notified if Notify.Events and the channel Events are empty
+var defaultEvents = []string{events.UPDATE_AVAILABLE, events.SERVER_CRASH, events.SERVER_CRASH_LOOP, events.SERVER_HANG, events.START_FAILURE, events.WORLD_CORRUPTED}
+
+// defaultTemplates are the notification texts of the event types if not set in Notify.Templates.
+// <key> placeholders are replaced with the event data (ex: <player>), <type> and <time> with the event type and time.
+var defaultTemplates = map[string]string{
+	events.SERVER_STARTING:   "minecraft server is starting",
+	events.SERVER_ONLINE:     "minecraft server is online",
+	events.SERVER_STOPPING:   "minecraft server is stopping",
+	events.SERVER_OFFLINE:    "minecraft server is offline",
+	events.SERVER_CRASH:      "minecraft server crashed: <exit>",
+	events.SERVER_CRASH_LOOP: "minecraft server keeps crashing (<crashes> crashes)",
+	events.SERVER_HANG:       "minecraft server is not responding",
+	events.START_FAILURE:     "minecraft server failed to start: <error>",
+	events.PLAYER_JOIN:       "<player> joined the minecraft server (<players> online)",
+	events.PLAYER_LEAVE:      "<player> left the minecraft server (<players> online)",
+	events.UPDATE_AVAILABLE:  "msh <version> is available: visit github to update!",
+	events.WORLD_CORRUPTED:   "world failed the integrity check: <error>",
+	events.WORLD_RESTORED:    "world restored from backup <backup>",
+}
+
+// channel is a notification service
+type channel struct {
+	name    string
+	events  []string
+	deliver func(client *http.Client, text string) error
+}
+
+// Notifier delivers the events to the configured notification channels
+// [goroutine]
+func Notifier() {
+	channels := enabledChannels()
+	if len(channels) == 0 {
+		return
+	}
+
+	c := events.Subscribe(100)
+
+	for e := range c {
+		var text string
+		for _, ch := range channels {
+			if !enabled(ch.events, e.Type) {
+				continue
+			}
+			if text == "" {
+				text = render(e)
+			}
+
+			// deliver to each channel separately so that a slow service does not delay the others
+			go func(ch channel, eventType string) {
+				errMsh := send(ch, text)
+				if errMsh != nil {
+					errco.LogMshErr(errMsh.AddTrace("Notifier (" + eventType + ")"))
+				}
+			}(ch, e.Type)
+		}
+	}
+}
+
+// render returns the notification text of the event (Notify.Templates or default template)
+func render(e events.Event) string {
+	template, ok := config.ConfigRuntime.Notify.Templates[e.Type]
+	if !ok {
+		template, ok = defaultTemplates[e.Type]
+	}
+	if !ok {
+		template = "msh event: <type>"
+	}
+
+	// sort keys so that the replacement is deterministic
+	keys := []string{}
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	oldnew := []string{"<type>", e.Type, "<time>", e.Time.Format("2006/01/02 15:04:05")}
+	for _, k := range keys {
+		oldnew = append(oldnew, "<"+k+">", fmt.Sprint(e.Data[k]))
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(template)
+}
+
+// enabledChannels returns the configured notification channels
+func enabledChannels() []channel {
+	n := config.ConfigRuntime.Notify
+	channels := []channel{}
+
+	if n.Telegram.BotToken != "" && len(telegramChats()) > 0 {
+		channels = append(channels, channel{"telegram", channelEvents(n.Telegram.Events), sendTelegram})
+	}
+	if n.Pushover.AppToken != "" && n.Pushover.UserKey != "" {
+		channels = append(channels, channel{"pushover", channelEvents(n.Pushover.Events), sendPushover})
+	}
+	if n.Gotify.Url != "" && n.Gotify.Token != "" {
+		channels = append(channels, channel{"gotify", channelEvents(n.Gotify.Events), sendGotify})
+	}
+
+	return channels
+}
+
+// channelEvents returns the event types notified on a channel
+// (channel Events, otherwise Notify.Events, otherwise the default events)
+func channelEvents(chEvents []string) []string {
+	switch {
+	case len(chEvents) > 0:
+		return chEvents
+	case len(config.ConfigRuntime.Notify.Events) > 0:
+		return config.ConfigRuntime.Notify.Events
+	default:
+		return defaultEvents
+	}
+}
+
+// enabled returns true if eventType is one of types
+func enabled(types []string, eventType string) bool {
+	for _, t := range types {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send delivers text to the notification channel
+// [blocking]
+func send(ch channel, text string) *errco.Error {
+	client, errMsh := outbound.Client(15 * time.Second)
+	if errMsh != nil {
+		return errMsh.AddTrace("send")
+	}
+
+	err := ch.deliver(client, text)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_NOTIFY_DELIVERY, errco.LVL_B, "send", "notification not delivered to "+ch.name+": "+err.Error())
+	}
+
+	return nil
+}
+
+// sendTelegram sends text to Notify.Telegram.ChatId and AdminChatIds through the Telegram bot api
+func sendTelegram(client *http.Client, text string) error {
+	for _, chatId := range telegramChats() {
+		err := postJSON(client, "https://api.telegram.org/bot"+config.ConfigRuntime.Notify.Telegram.BotToken+"/sendMessage", map[string]interface{}{
+			"chat_id": chatId,
+			"text":    text,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendPushover sends text to Notify.Pushover.UserKey through the Pushover api
+func sendPushover(client *http.Client, text string) error {
+	p := config.ConfigRuntime.Notify.Pushover
+
+	resp, err := client.PostForm("https://api.pushover.net/1/messages.json", url.Values{
+		"token":    {p.AppToken},
+		"user":     {p.UserKey},
+		"title":    {"msh"},
+		"message":  {text},
+		"priority": {fmt.Sprint(p.Priority)},
+	})
+	if err != nil {
+		return stripURL(err)
+	}
+
+	return checkResponse(resp)
+}
+
+// sendGotify sends text to the Gotify server at Notify.Gotify.Url
+func sendGotify(client *http.Client, text string) error {
+	g := config.ConfigRuntime.Notify.Gotify
+
+	return postJSON(client, strings.TrimSuffix(g.Url, "/")+"/message?token="+url.QueryEscape(g.Token), map[string]interface{}{
+		"title":    "msh",
+		"message":  text,
+		"priority": g.Priority,
+	})
+}
+
+// postJSON POSTs the json encoded body to address
+func postJSON(client *http.Client, address string, body map[string]interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(address, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return stripURL(err)
+	}
+
+	return checkResponse(resp)
+}
+
+// checkResponse returns an error if the notification service did not accept the notification
+func checkResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+	return fmt.Errorf("service responded with status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// stripURL removes the request url from a request error (urls can contain tokens)
+func stripURL(err error) error {
+	if uErr, ok := err.(*url.Error); ok {
+		return uErr.Err
+	}
+
+	return err
+}
@@ -3,7 +3,14 @@
 package opsys
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+
+	"msh/lib/errco"
 )
 
 func newProcGroupAttr() *syscall.SysProcAttr {
@@ -13,3 +20,132 @@ func newProcGroupAttr() *syscall.SysProcAttr {
 
 	return newProcGroupAttr
 }
+
+func restart(exePath string) *errco.Error {
+	// replace the msh process image keeping pid, arguments and environment
+	err := syscall.Exec(exePath, os.Args, os.Environ())
+	if err != nil {
+		return errco.NewErr(errco.ERROR_MSH_RESTART, errco.LVL_B, "restart", err.Error())
+	}
+
+	return nil
+}
+
+func setPriority(pid, nice int) *errco.Error {
+	// the minecraft server is started in a new process group (pgid = pid):
+	// set the priority of the whole group so that child processes are affected too
+	err := syscall.Setpriority(syscall.PRIO_PGRP, pid, nice)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROCESS_PRIORITY, errco.LVL_D, "setPriority", err.Error())
+	}
+
+	return nil
+}
+
+func setAffinity(pid int, cpus []int) *errco.Error {
+	return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", "cpu affinity not supported on macos")
+}
+
+func fileLocked(path string) (bool, *errco.Error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errco.NewErr(errco.ERROR_FILE_LOCK, errco.LVL_D, "fileLocked", err.Error())
+	}
+	defer f.Close()
+
+	// java FileChannel locks are fcntl locks: ask which lock would block a write lock on the whole file
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	err = syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk)
+	if err != nil {
+		return false, errco.NewErr(errco.ERROR_FILE_LOCK, errco.LVL_D, "fileLocked", err.Error())
+	}
+
+	return lk.Type != syscall.F_UNLCK, nil
+}
+
+func signalGroup(pid int, sig syscall.Signal) *errco.Error {
+	// the tree is read before signaling: the children of an exited process are reparented
+	procs, _ := processes()
+
+	// negative pid: the signal is sent to every process of the process group
+	err := syscall.Kill(-pid, sig)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROCESS_SIGNAL, errco.LVL_D, "signalGroup", err.Error())
+	}
+
+	// processes of the tree that left the process group (ex: started by a wrapper script with setsid)
+	for _, p := range buildTree(pid, procs) {
+		if pgid, err := syscall.Getpgid(p.Pid); err == nil && pgid != pid {
+			syscall.Kill(p.Pid, sig)
+		}
+	}
+
+	return nil
+}
+
+func terminateGroup(pid int) *errco.Error {
+	return signalGroup(pid, syscall.SIGTERM)
+}
+
+func killGroup(pid int) *errco.Error {
+	return signalGroup(pid, syscall.SIGKILL)
+}
+
+func processAlive(pid int) bool {
+	// signal 0 checks the existence of the process without sending a signal
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func diskFree(path string) (uint64, *errco.Error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_DISK_FREE, errco.LVL_D, "diskFree", err.Error())
+	}
+
+	// blocks available to unprivileged users
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+func makeFifo(path string) *errco.Error {
+	err := syscall.Mkfifo(path, 0600)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_FIFO_CREATE, errco.LVL_B, "makeFifo", err.Error())
+	}
+
+	return nil
+}
+
+func hostMemAvailable() (uint64, *errco.Error) {
+	return 0, errco.NewErr(errco.ERROR_HOST_MEMORY, errco.LVL_D, "hostMemAvailable", "host memory is not available on macos")
+}
+
+func connTCPStats(c syscall.Conn) (TCPStats, *errco.Error) {
+	return TCPStats{}, errco.NewErr(errco.ERROR_TCP_STATS, errco.LVL_D, "connTCPStats", "tcp connection statistics are not available on macos")
+}
+
+func processes() ([]Process, *errco.Error) {
+	// 1234  1200 /usr/bin/java
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=", "-o", "comm=").Output()
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_PROCESS_TREE, errco.LVL_D, "processes", err.Error())
+	}
+
+	procs := []Process{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		procs = append(procs, Process{Pid: pid, Ppid: ppid, Name: filepath.Base(strings.Join(fields[2:], " "))})
+	}
+
+	return procs, nil
+}
@@ -3,7 +3,16 @@
 package opsys
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+	"unsafe"
+
+	"msh/lib/errco"
 )
 
 func newProcGroupAttr() *syscall.SysProcAttr {
@@ -13,3 +22,243 @@ func newProcGroupAttr() *syscall.SysProcAttr {
 
 	return newProcGroupAttr
 }
+
+func restart(exePath string) *errco.Error {
+	// replace the msh process image keeping pid, arguments and environment
+	err := syscall.Exec(exePath, os.Args, os.Environ())
+	if err != nil {
+		return errco.NewErr(errco.ERROR_MSH_RESTART, errco.LVL_B, "restart", err.Error())
+	}
+
+	return nil
+}
+
+func setPriority(pid, nice int) *errco.Error {
+	// the minecraft server is started in a new process group (pgid = pid):
+	// set the priority of the whole group so that child processes are affected too
+	err := syscall.Setpriority(syscall.PRIO_PGRP, pid, nice)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROCESS_PRIORITY, errco.LVL_D, "setPriority", err.Error())
+	}
+
+	return nil
+}
+
+func setAffinity(pid int, cpus []int) *errco.Error {
+	// cpu mask for up to 1024 cpus
+	var mask [16]uint64
+	if cpus == nil {
+		// restore the cpus allowed to msh
+		_, _, e := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+		if e != 0 {
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", e.Error())
+		}
+	}
+	for _, c := range cpus {
+		if c < 0 || c >= len(mask)*64 {
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", "cpu number not valid: "+strconv.Itoa(c))
+		}
+		mask[c/64] |= 1 << uint(c%64)
+	}
+
+	// affinity is set per thread: set it for every thread of every process of the group
+	for _, tid := range groupThreads(pid) {
+		_, _, e := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+		if e != 0 && e != syscall.ESRCH {
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", e.Error())
+		}
+	}
+
+	return nil
+}
+
+// groupThreads returns the thread ids of the processes of the process group pgid
+func groupThreads(pgid int) []int {
+	tids := []int{}
+
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, proc := range procs {
+		stat, err := ioutil.ReadFile(filepath.Join(proc, "stat"))
+		if err != nil {
+			continue
+		}
+
+		// fields after the command name (which can contain spaces): state, ppid, pgrp, ...
+		i := strings.LastIndex(string(stat), ")")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat)[i+1:])
+		if len(fields) < 3 || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+
+		tasks, _ := filepath.Glob(filepath.Join(proc, "task", "[0-9]*"))
+		for _, task := range tasks {
+			if tid, err := strconv.Atoi(filepath.Base(task)); err == nil {
+				tids = append(tids, tid)
+			}
+		}
+	}
+
+	return tids
+}
+
+func fileLocked(path string) (bool, *errco.Error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errco.NewErr(errco.ERROR_FILE_LOCK, errco.LVL_D, "fileLocked", err.Error())
+	}
+	defer f.Close()
+
+	// java FileChannel locks are fcntl locks: ask which lock would block a write lock on the whole file
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	err = syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk)
+	if err != nil {
+		return false, errco.NewErr(errco.ERROR_FILE_LOCK, errco.LVL_D, "fileLocked", err.Error())
+	}
+
+	return lk.Type != syscall.F_UNLCK, nil
+}
+
+func signalGroup(pid int, sig syscall.Signal) *errco.Error {
+	// the tree is read before signaling: the children of an exited process are reparented
+	procs, _ := processes()
+
+	// negative pid: the signal is sent to every process of the process group
+	err := syscall.Kill(-pid, sig)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROCESS_SIGNAL, errco.LVL_D, "signalGroup", err.Error())
+	}
+
+	// processes of the tree that left the process group (ex: started by a wrapper script with setsid)
+	for _, p := range buildTree(pid, procs) {
+		if pgid, err := syscall.Getpgid(p.Pid); err == nil && pgid != pid {
+			syscall.Kill(p.Pid, sig)
+		}
+	}
+
+	return nil
+}
+
+func terminateGroup(pid int) *errco.Error {
+	return signalGroup(pid, syscall.SIGTERM)
+}
+
+func killGroup(pid int) *errco.Error {
+	return signalGroup(pid, syscall.SIGKILL)
+}
+
+func processAlive(pid int) bool {
+	// signal 0 checks the existence of the process without sending a signal
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func diskFree(path string) (uint64, *errco.Error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_DISK_FREE, errco.LVL_D, "diskFree", err.Error())
+	}
+
+	// blocks available to unprivileged users
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+func makeFifo(path string) *errco.Error {
+	err := syscall.Mkfifo(path, 0600)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_FIFO_CREATE, errco.LVL_B, "makeFifo", err.Error())
+	}
+
+	return nil
+}
+
+func hostMemAvailable() (uint64, *errco.Error) {
+	data, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_HOST_MEMORY, errco.LVL_D, "hostMemAvailable", err.Error())
+	}
+
+	// MemAvailable:    3868208 kB
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, errco.NewErr(errco.ERROR_HOST_MEMORY, errco.LVL_D, "hostMemAvailable", err.Error())
+			}
+			return kb * 1024, nil
+		}
+	}
+
+	return 0, errco.NewErr(errco.ERROR_HOST_MEMORY, errco.LVL_D, "hostMemAvailable", "MemAvailable not found in /proc/meminfo")
+}
+
+func connTCPStats(c syscall.Conn) (TCPStats, *errco.Error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return TCPStats{}, errco.NewErr(errco.ERROR_TCP_STATS, errco.LVL_D, "connTCPStats", err.Error())
+	}
+
+	var info syscall.TCPInfo
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		size := uint32(unsafe.Sizeof(info))
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.SOL_TCP, syscall.TCP_INFO, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err == nil && errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		return TCPStats{}, errco.NewErr(errco.ERROR_TCP_STATS, errco.LVL_D, "connTCPStats", err.Error())
+	}
+
+	return TCPStats{
+		Rtt:      time.Duration(info.Rtt) * time.Microsecond,
+		LastRecv: time.Duration(info.Last_data_recv) * time.Millisecond,
+		LastAck:  time.Duration(info.Last_ack_recv) * time.Millisecond,
+		Unacked:  int(info.Unacked),
+	}, nil
+}
+
+func processes() ([]Process, *errco.Error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_PROCESS_TREE, errco.LVL_D, "processes", err.Error())
+	}
+
+	procs := []Process{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		// the process might have exited in the meantime
+		data, err := ioutil.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// 1234 (java) S 1200 ...: the process name can contain spaces and parentheses
+		s := string(data)
+		start, end := strings.Index(s, "("), strings.LastIndex(s, ")")
+		if start == -1 || end < start {
+			continue
+		}
+		fields := strings.Fields(s[end+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+
+		procs = append(procs, Process{Pid: pid, Ppid: ppid, Name: s[start+1 : end]})
+	}
+
+	return procs, nil
+}
@@ -3,7 +3,14 @@
 package opsys
 
 import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
 	"syscall"
+	"unsafe"
+
+	"msh/lib/errco"
 )
 
 func newProcGroupAttr() *syscall.SysProcAttr {
@@ -13,3 +20,244 @@ func newProcGroupAttr() *syscall.SysProcAttr {
 
 	return newProcGroupAttr
 }
+
+func restart(exePath string) *errco.Error {
+	// windows does not support exec: start a new msh process and exit
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_MSH_RESTART, errco.LVL_B, "restart", err.Error())
+	}
+
+	os.Exit(0)
+
+	return nil
+}
+
+var (
+	kernel32                   = syscall.NewLazyDLL("kernel32.dll")
+	procSetPriorityClass       = kernel32.NewProc("SetPriorityClass")
+	procGetProcessAffinityMask = kernel32.NewProc("GetProcessAffinityMask")
+	procSetProcessAffinityMask = kernel32.NewProc("SetProcessAffinityMask")
+	procGetDiskFreeSpaceExW    = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procGlobalMemoryStatusEx   = kernel32.NewProc("GlobalMemoryStatusEx")
+)
+
+// access rights to set process priority class and affinity
+const processSetInformation = 0x0200
+
+func setPriority(pid, nice int) *errco.Error {
+	// niceness is mapped to the windows priority classes
+	var class uintptr
+	switch {
+	case nice <= -10:
+		class = 0x00000080 // HIGH_PRIORITY_CLASS
+	case nice < 0:
+		class = 0x00008000 // ABOVE_NORMAL_PRIORITY_CLASS
+	case nice == 0:
+		class = 0x00000020 // NORMAL_PRIORITY_CLASS
+	case nice < 10:
+		class = 0x00004000 // BELOW_NORMAL_PRIORITY_CLASS
+	default:
+		class = 0x00000040 // IDLE_PRIORITY_CLASS
+	}
+
+	// windows has no process groups: the priority class is set on the processes of the tree
+	// (ex: java started by a run.bat wrapper script)
+	for i, p := range treePids(pid) {
+		h, err := syscall.OpenProcess(processSetInformation|syscall.PROCESS_QUERY_INFORMATION, false, uint32(p))
+		if err != nil {
+			if i > 0 {
+				continue
+			}
+			return errco.NewErr(errco.ERROR_PROCESS_PRIORITY, errco.LVL_D, "setPriority", err.Error())
+		}
+
+		r, _, err := procSetPriorityClass.Call(uintptr(h), class)
+		syscall.CloseHandle(h)
+		if r == 0 && i == 0 {
+			return errco.NewErr(errco.ERROR_PROCESS_PRIORITY, errco.LVL_D, "setPriority", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func setAffinity(pid int, cpus []int) *errco.Error {
+	var mask uintptr
+	if cpus == nil {
+		// restore the cpus allowed to msh
+		var processMask, systemMask uintptr
+		h, _ := syscall.GetCurrentProcess()
+		r, _, err := procGetProcessAffinityMask.Call(uintptr(h), uintptr(unsafe.Pointer(&processMask)), uintptr(unsafe.Pointer(&systemMask)))
+		if r == 0 {
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", err.Error())
+		}
+		mask = processMask
+	}
+	for _, c := range cpus {
+		if c < 0 || c >= int(unsafe.Sizeof(mask))*8 {
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", "cpu number not valid: "+strconv.Itoa(c))
+		}
+		mask |= 1 << uint(c)
+	}
+
+	for i, p := range treePids(pid) {
+		h, err := syscall.OpenProcess(processSetInformation|syscall.PROCESS_QUERY_INFORMATION, false, uint32(p))
+		if err != nil {
+			if i > 0 {
+				continue
+			}
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", err.Error())
+		}
+
+		r, _, err := procSetProcessAffinityMask.Call(uintptr(h), mask)
+		syscall.CloseHandle(h)
+		if r == 0 && i == 0 {
+			return errco.NewErr(errco.ERROR_PROCESS_AFFINITY, errco.LVL_D, "setAffinity", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// treePids returns pid followed by the pids of its descendants (only pid if the process tree can't be read)
+func treePids(pid int) []int {
+	procs, errMsh := processes()
+	if errMsh != nil {
+		return []int{pid}
+	}
+
+	pids := []int{}
+	for _, p := range buildTree(pid, procs) {
+		pids = append(pids, p.Pid)
+	}
+	if len(pids) == 0 {
+		pids = append(pids, pid)
+	}
+
+	return pids
+}
+
+func fileLocked(path string) (bool, *errco.Error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errco.NewErr(errco.ERROR_FILE_LOCK, errco.LVL_D, "fileLocked", err.Error())
+	}
+	defer f.Close()
+
+	// reading a region locked by another process (LockFileEx) fails
+	_, err = f.Read(make([]byte, 1))
+	if err != nil && err != io.EOF {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func taskkill(args ...string) *errco.Error {
+	// taskkill /T terminates the process and all its child processes
+	out, err := exec.Command("taskkill", args...).CombinedOutput()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROCESS_SIGNAL, errco.LVL_D, "taskkill", err.Error()+": "+string(out))
+	}
+
+	return nil
+}
+
+func terminateGroup(pid int) *errco.Error {
+	return taskkill("/T", "/PID", strconv.Itoa(pid))
+}
+
+func killGroup(pid int) *errco.Error {
+	return taskkill("/F", "/T", "/PID", strconv.Itoa(pid))
+}
+
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	// exit code of a running process is STILL_ACTIVE (259)
+	var code uint32
+	err = syscall.GetExitCodeProcess(h, &code)
+	return err == nil && code == 259
+}
+
+func diskFree(path string) (uint64, *errco.Error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_DISK_FREE, errco.LVL_D, "diskFree", err.Error())
+	}
+
+	// bytes available to the user running msh (quotas applied)
+	var free uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if r == 0 {
+		return 0, errco.NewErr(errco.ERROR_DISK_FREE, errco.LVL_D, "diskFree", err.Error())
+	}
+
+	return free, nil
+}
+
+func makeFifo(path string) *errco.Error {
+	// windows named pipes are not files: they can't be written with shell redirection
+	return errco.NewErr(errco.ERROR_FIFO_CREATE, errco.LVL_B, "makeFifo", "command fifo is not supported on windows")
+}
+
+func hostMemAvailable() (uint64, *errco.Error) {
+	// MEMORYSTATUSEX structure
+	var st struct {
+		length               uint32
+		memoryLoad           uint32
+		totalPhys            uint64
+		availPhys            uint64
+		totalPageFile        uint64
+		availPageFile        uint64
+		totalVirtual         uint64
+		availVirtual         uint64
+		availExtendedVirtual uint64
+	}
+	st.length = uint32(unsafe.Sizeof(st))
+
+	r, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&st)))
+	if r == 0 {
+		return 0, errco.NewErr(errco.ERROR_HOST_MEMORY, errco.LVL_D, "hostMemAvailable", err.Error())
+	}
+
+	return st.availPhys, nil
+}
+
+func connTCPStats(c syscall.Conn) (TCPStats, *errco.Error) {
+	return TCPStats{}, errco.NewErr(errco.ERROR_TCP_STATS, errco.LVL_D, "connTCPStats", "tcp connection statistics are not available on windows")
+}
+
+func processes() ([]Process, *errco.Error) {
+	h, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_PROCESS_TREE, errco.LVL_D, "processes", err.Error())
+	}
+	defer syscall.CloseHandle(h)
+
+	var e syscall.ProcessEntry32
+	e.Size = uint32(unsafe.Sizeof(e))
+
+	err = syscall.Process32First(h, &e)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_PROCESS_TREE, errco.LVL_D, "processes", err.Error())
+	}
+
+	procs := []Process{}
+	for err == nil {
+		procs = append(procs, Process{Pid: int(e.ProcessID), Ppid: int(e.ParentProcessID), Name: syscall.UTF16ToString(e.ExeFile[:])})
+		err = syscall.Process32Next(h, &e)
+	}
+
+	return procs, nil
+}
@@ -1,8 +1,11 @@
 package opsys
 
 import (
+	"context"
+	"os/exec"
 	"runtime"
 	"syscall"
+	"time"
 
 	"msh/lib/errco"
 )
@@ -23,3 +26,174 @@ func OsSupported() *errco.Error {
 func NewProcGroupAttr() *syscall.SysProcAttr {
 	return newProcGroupAttr()
 }
+
+// ShellCommand returns a cmd that executes command in the OS shell (killed when ctx is done)
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// SetPriority sets the scheduling priority (niceness: -20 highest, 19 lowest) of the process group of pid
+func SetPriority(pid, nice int) *errco.Error {
+	errMsh := setPriority(pid, nice)
+	if errMsh != nil {
+		return errMsh.AddTrace("SetPriority")
+	}
+
+	return nil
+}
+
+// SetAffinity restricts the processes of the process group of pid to the specified cpus
+// (nil: cpus allowed to msh). On windows the processes of the tree of pid are affected.
+func SetAffinity(pid int, cpus []int) *errco.Error {
+	errMsh := setAffinity(pid, cpus)
+	if errMsh != nil {
+		return errMsh.AddTrace("SetAffinity")
+	}
+
+	return nil
+}
+
+// TerminateGroup asks the process group of pid to terminate (SIGTERM, on windows the process tree).
+// On linux and macos, the processes of the tree of pid that left the process group are signaled too.
+func TerminateGroup(pid int) *errco.Error {
+	errMsh := terminateGroup(pid)
+	if errMsh != nil {
+		return errMsh.AddTrace("TerminateGroup")
+	}
+
+	return nil
+}
+
+// KillGroup forcefully kills the process group of pid (SIGKILL, on windows the process tree).
+// On linux and macos, the processes of the tree of pid that left the process group are killed too.
+func KillGroup(pid int) *errco.Error {
+	errMsh := killGroup(pid)
+	if errMsh != nil {
+		return errMsh.AddTrace("KillGroup")
+	}
+
+	return nil
+}
+
+// ProcessAlive returns true if the process with the specified pid is running
+func ProcessAlive(pid int) bool {
+	return processAlive(pid)
+}
+
+// FileLocked returns true if the file at path is locked by another process
+func FileLocked(path string) (bool, *errco.Error) {
+	locked, errMsh := fileLocked(path)
+	if errMsh != nil {
+		return false, errMsh.AddTrace("FileLocked")
+	}
+
+	return locked, nil
+}
+
+// DiskFree returns the free bytes (available to msh user) of the volume that contains path
+func DiskFree(path string) (uint64, *errco.Error) {
+	free, errMsh := diskFree(path)
+	if errMsh != nil {
+		return 0, errMsh.AddTrace("DiskFree")
+	}
+
+	return free, nil
+}
+
+// Restart replaces the running msh process with the executable at exePath
+func Restart(exePath string) *errco.Error {
+	errMsh := restart(exePath)
+	if errMsh != nil {
+		return errMsh.AddTrace("Restart")
+	}
+
+	return nil
+}
+
+// MakeFifo creates a named pipe (fifo) at path, readable and writable only by the msh user
+func MakeFifo(path string) *errco.Error {
+	errMsh := makeFifo(path)
+	if errMsh != nil {
+		return errMsh.AddTrace("MakeFifo")
+	}
+
+	return nil
+}
+
+// HostMemAvailable returns the memory of the host available for new processes (bytes)
+func HostMemAvailable() (uint64, *errco.Error) {
+	available, errMsh := hostMemAvailable()
+	if errMsh != nil {
+		return 0, errMsh.AddTrace("HostMemAvailable")
+	}
+
+	return available, nil
+}
+
+// TCPStats are the kernel statistics of a tcp connection
+type TCPStats struct {
+	Rtt      time.Duration // smoothed round trip time
+	LastRecv time.Duration // time since data was last received
+	LastAck  time.Duration // time since an ack was last received
+	Unacked  int           // segments sent and not acknowledged yet
+}
+
+// ConnTCPStats returns the kernel statistics of a tcp connection (linux only)
+func ConnTCPStats(c syscall.Conn) (TCPStats, *errco.Error) {
+	stats, errMsh := connTCPStats(c)
+	if errMsh != nil {
+		return TCPStats{}, errMsh.AddTrace("ConnTCPStats")
+	}
+
+	return stats, nil
+}
+
+// Process is a process of a process tree
+type Process struct {
+	Pid  int
+	Ppid int    // pid of the parent process
+	Name string // executable name (ex: java, java.exe)
+}
+
+// ProcessTree returns the process with the specified pid followed by all its descendants (parents before children)
+func ProcessTree(pid int) ([]Process, *errco.Error) {
+	procs, errMsh := processes()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("ProcessTree")
+	}
+
+	return buildTree(pid, procs), nil
+}
+
+// buildTree returns the process with the specified pid followed by all its descendants in procs
+func buildTree(pid int, procs []Process) []Process {
+	children := map[int][]Process{}
+	tree := []Process{}
+	for _, p := range procs {
+		if p.Pid == pid {
+			tree = append(tree, p)
+		} else {
+			children[p.Ppid] = append(children[p.Ppid], p)
+		}
+	}
+	if len(tree) == 0 {
+		return tree
+	}
+
+	// the parent pid of a process can be a reused pid (windows): each process is added once
+	seen := map[int]bool{pid: true}
+	for i := 0; i < len(tree); i++ {
+		for _, c := range children[tree[i].Pid] {
+			if !seen[c.Pid] {
+				seen[c.Pid] = true
+				tree = append(tree, c)
+			}
+		}
+	}
+
+	return tree
+}
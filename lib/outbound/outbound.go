@@ -0,0 +1,230 @@
+package outbound
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+var (
+	rootCAsM sync.Mutex
+	rootCAs  *x509.CertPool // system certificates and Msh.CACerts (nil until loaded)
+)
+
+// Client returns an http client for outbound requests with the specified timeout.
+// Requests are sent through Msh.Proxy (except for hosts in Msh.NoProxy) if set,
+// otherwise HTTP_PROXY/HTTPS_PROXY/NO_PROXY env variables are honored.
+// Certificates in Msh.CACerts are trusted in addition to the system ones.
+func Client(timeout time.Duration) (*http.Client, *errco.Error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, errMsh := proxyFunc()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("Client")
+	}
+	transport.Proxy = proxy
+
+	if len(config.ConfigRuntime.Msh.CACerts) > 0 {
+		tlsConfig, errMsh := TLSConfig()
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("Client")
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// Dial opens an outbound tcp connection to address (host:port) for protocols other than http (ex: websockets).
+// The connection is tunneled through the proxy of outbound requests (http CONNECT, see Client) if one applies to host.
+// If useTLS is true, tls is negotiated with host (certificates in Msh.CACerts are trusted in addition to the system ones).
+func Dial(address string, useTLS bool, timeout time.Duration) (net.Conn, *errco.Error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_D, "Dial", err.Error())
+	}
+
+	proxy, errMsh := proxyFunc()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("Dial")
+	}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: address}})
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_PROXY, errco.LVL_B, "Dial", err.Error())
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if proxyURL == nil {
+		conn, err = dialer.Dial("tcp", address)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_D, "Dial", err.Error())
+		}
+	} else {
+		conn, errMsh = dialProxy(dialer, proxyURL, address)
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("Dial")
+		}
+	}
+
+	if !useTLS {
+		return conn, nil
+	}
+
+	tlsConfig, errMsh := TLSConfig()
+	if errMsh != nil {
+		conn.Close()
+		return nil, errMsh.AddTrace("Dial")
+	}
+	tlsConfig.ServerName = host
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	err = tlsConn.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_D, "Dial", err.Error())
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// dialProxy opens a tunnel to address through an http proxy (http CONNECT)
+func dialProxy(dialer *net.Dialer, proxyURL *url.URL, address string) (net.Conn, *errco.Error) {
+	if proxyURL.Scheme != "http" {
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_PROXY, errco.LVL_B, "dialProxy", "only http proxies can tunnel connections: "+proxyURL.Redacted())
+	}
+
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	conn, err := dialer.Dial("tcp", proxyAddress)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_D, "dialProxy", err.Error())
+	}
+
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: address}, Host: address, Header: http.Header{}}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username()+":"+password)))
+	}
+
+	conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_D, "dialProxy", err.Error())
+	}
+	// the proxy does not send data after its response until the client writes: the reader buffer can be dropped
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_D, "dialProxy", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_DIAL, errco.LVL_B, "dialProxy", "proxy refused the connection to "+address+": "+resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// proxyFunc returns the function that selects the proxy of an outbound request:
+// Msh.Proxy (except for hosts in Msh.NoProxy) if set, otherwise HTTP_PROXY/HTTPS_PROXY/NO_PROXY env variables.
+func proxyFunc() (func(*http.Request) (*url.URL, error), *errco.Error) {
+	if config.ConfigRuntime.Msh.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(config.ConfigRuntime.Msh.Proxy)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_OUTBOUND_PROXY, errco.LVL_B, "proxyFunc", "proxy url is not valid: "+err.Error())
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// TLSConfig returns the tls config for outbound connections
+// (certificates in Msh.CACerts are trusted in addition to the system ones)
+func TLSConfig() (*tls.Config, *errco.Error) {
+	pool, errMsh := loadRootCAs()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("TLSConfig")
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// bypassProxy returns true if host matches one of Msh.NoProxy entries.
+// Entries are matched as in NO_PROXY: "*" matches all hosts,
+// "example.com" and ".example.com" match example.com and its subdomains.
+func bypassProxy(host string) bool {
+	host = strings.ToLower(host)
+
+	for _, np := range config.ConfigRuntime.Msh.NoProxy {
+		np = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(np), "."))
+		switch {
+		case np == "":
+			continue
+		case np == "*", host == np, strings.HasSuffix(host, "."+np):
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadRootCAs returns the system certificate pool with the addition of certificates in Msh.CACerts.
+// The pool is loaded only once.
+func loadRootCAs() (*x509.CertPool, *errco.Error) {
+	rootCAsM.Lock()
+	defer rootCAsM.Unlock()
+
+	if rootCAs != nil {
+		return rootCAs, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		// system pool is not available on some platforms: use only the specified certificates
+		pool = x509.NewCertPool()
+	}
+
+	for _, path := range config.ConfigRuntime.Msh.CACerts {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_OUTBOUND_CA, errco.LVL_B, "loadRootCAs", err.Error())
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errco.NewErr(errco.ERROR_OUTBOUND_CA, errco.LVL_B, "loadRootCAs", "no valid pem certificate found in "+path)
+		}
+	}
+
+	rootCAs = pool
+
+	return rootCAs, nil
+}
@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// plugins exchange json-rpc 2.0 messages with msh, one json message per line:
+// msh writes to the plugin stdin and reads the plugin stdout (stderr is written to the msh log).
+//
+// msh --> plugin:
+//   - "event" notification: msh lifecycle event or client connection (params: time, type, data)
+//   - "wake" request (Veto plugins only): params: source, player, ip - result: allow (bool), reason
+//
+// plugin --> msh:
+//   - "status" request: result: status, players, online, progress
+//   - "command" request: params: command (msh or minecraft server console command, ex: "msh freeze")
+//   - "log" request: params: message (written to the msh log)
+
+const jsonrpcVersion = "2.0"
+
+// json-rpc error codes
+const (
+	rpcParseError     = -32700 // message is not valid json
+	rpcInvalidRequest = -32600 // message is not a valid json-rpc request
+	rpcMethodNotFound = -32601 // method does not exist
+	rpcInvalidParams  = -32602 // method parameters are not valid
+	rpcServerError    = -32000 // msh error (data: msh error name)
+)
+
+// rpcMessage is a json-rpc request, notification (request without id) or response
+type rpcMessage struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a json-rpc response
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Command is a msh or minecraft server console command sent by a plugin
+type Command struct {
+	Plugin string // name of the plugin
+	Line   string // command line (ex: "msh freeze")
+}
+
+// CommandC receives the commands sent by plugins (executed by the input package)
+var CommandC = make(chan Command, 16)
+
+// call sends a request to the plugin and waits for the response (at most timeout)
+// [blocking]
+func (p *plugin) call(method string, params interface{}, timeout time.Duration) (json.RawMessage, *errco.Error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "call", err.Error())
+	}
+
+	p.m.Lock()
+	p.lastId++
+	id := strconv.FormatInt(p.lastId, 10)
+	resC := make(chan rpcMessage, 1)
+	p.pending[id] = resC
+	p.m.Unlock()
+
+	defer func() {
+		p.m.Lock()
+		delete(p.pending, id)
+		p.m.Unlock()
+	}()
+
+	errMsh := p.send(rpcMessage{Jsonrpc: jsonrpcVersion, Id: json.RawMessage(id), Method: method, Params: paramsJSON})
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("call")
+	}
+
+	select {
+	case res := <-resC:
+		if res.Error != nil {
+			return nil, errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "call", "plugin "+p.name+" answered "+method+" with error "+strconv.Itoa(res.Error.Code)+": "+res.Error.Message)
+		}
+		return res.Result, nil
+	case <-time.After(timeout):
+		return nil, errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "call", "plugin "+p.name+" did not answer "+method+" within "+timeout.String())
+	}
+}
+
+// notify sends a notification (request without response) to the plugin
+func (p *plugin) notify(method string, params interface{}) *errco.Error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "notify", err.Error())
+	}
+
+	errMsh := p.send(rpcMessage{Jsonrpc: jsonrpcVersion, Method: method, Params: paramsJSON})
+	if errMsh != nil {
+		return errMsh.AddTrace("notify")
+	}
+
+	return nil
+}
+
+// receive handles a message read from the plugin stdout: responses are passed to the pending calls,
+// requests are executed and answered
+func (p *plugin) receive(line []byte) {
+	var msg rpcMessage
+	err := json.Unmarshal(line, &msg)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "receive", "plugin "+p.name+" sent a message that is not valid json: "+err.Error()))
+		p.respond(json.RawMessage("null"), nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+		return
+	}
+
+	// response to a msh request
+	if msg.Method == "" && len(msg.Id) > 0 {
+		p.m.Lock()
+		resC, ok := p.pending[string(msg.Id)]
+		p.m.Unlock()
+		if !ok {
+			errco.Logln(errco.LVL_D, "receive: plugin %s answered to unknown or expired request %s", p.name, msg.Id)
+			return
+		}
+		select {
+		case resC <- msg:
+		default:
+		}
+		return
+	}
+
+	if msg.Jsonrpc != jsonrpcVersion || msg.Method == "" {
+		p.respond(msg.Id, nil, &rpcError{Code: rpcInvalidRequest, Message: "not a json-rpc 2.0 request"})
+		return
+	}
+
+	result, rpcErr := p.handle(msg.Method, msg.Params)
+
+	// notifications are not answered
+	if len(msg.Id) == 0 {
+		if rpcErr != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "receive", "plugin "+p.name+" notification "+msg.Method+" failed: "+rpcErr.Message))
+		}
+		return
+	}
+
+	p.respond(msg.Id, result, rpcErr)
+}
+
+// handle executes a request of the plugin
+func (p *plugin) handle(method string, params json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "status":
+		online, _ := servstats.PlayerLists()
+		return map[string]interface{}{
+			"status":   servstats.StatusName(servstats.Stats.Status),
+			"players":  servstats.Stats.PlayerCount,
+			"online":   online,
+			"progress": servstats.Stats.LoadProgress,
+		}, nil
+
+	case "command":
+		var req struct {
+			Command string `json:"command"`
+		}
+		if json.Unmarshal(params, &req) != nil || req.Command == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "command parameter is required"}
+		}
+		select {
+		case CommandC <- Command{Plugin: p.name, Line: req.Command}:
+		default:
+			return nil, &rpcError{Code: rpcServerError, Message: "too many queued plugin commands", Data: errco.Info(errco.ERROR_PLUGIN_RPC).Name}
+		}
+		return map[string]interface{}{"queued": true}, nil
+
+	case "log":
+		var req struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(params, &req) != nil || req.Message == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "message parameter is required"}
+		}
+		errco.Logln(errco.LVL_B, "plugin %s: %s", p.name, req.Message)
+		return map[string]interface{}{}, nil
+
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// respond sends the response to a plugin request
+func (p *plugin) respond(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	res := rpcMessage{Jsonrpc: jsonrpcVersion, Id: id, Error: rpcErr}
+	if rpcErr == nil {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "respond", err.Error()))
+			return
+		}
+		res.Result = resultJSON
+	}
+
+	errMsh := p.send(res)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("respond"))
+	}
+}
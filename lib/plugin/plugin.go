@@ -0,0 +1,326 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+// plugin package runs the plugin executables configured in Plugins and exchanges json-rpc messages with them
+// (see plugin-rpc.go), so that integrations (custom auth, billing, analytics) can be built without forking msh.
+
+// CONNECTION is the type of the event sent to plugins when a client connects to msh (not published to the other exporters)
+const CONNECTION = "connection"
+
+const (
+	defaultVetoTimeout = 5 * time.Second // maximum time to answer a wake request when Plugins.VetoTimeout is not set
+	restartMin         = 5 * time.Second // time before restarting a plugin that exited (doubled at each consecutive exit)
+	restartMax         = 5 * time.Minute // maximum time before restarting a plugin that exited
+	restartReset       = time.Minute     // a plugin running longer than this is restarted after restartMin
+	outBuffer          = 100             // messages to a plugin queued while it's busy
+)
+
+// plugin is a plugin executable configured in Plugins
+type plugin struct {
+	name        string
+	command     string
+	events      []string      // event types sent to the plugin (all if empty)
+	veto        bool          // plugin is asked whether the minecraft server can be woken up
+	vetoTimeout time.Duration // maximum time to answer a wake request
+
+	m       sync.Mutex
+	outC    chan []byte                // messages to write to the plugin stdin (nil while the plugin is not running)
+	lastId  int64                      // id of the last request sent to the plugin
+	pending map[string]chan rpcMessage // requests waiting for the plugin response (key: request id)
+}
+
+var (
+	pluginsM sync.Mutex
+	plugins  []*plugin // configured plugins
+)
+
+// PluginManager launches the plugins configured in Plugins (restarted if they exit)
+// and sends them the msh lifecycle events.
+// [goroutine]
+func PluginManager() {
+	if len(config.ConfigRuntime.Plugins) == 0 {
+		return
+	}
+
+	pluginsM.Lock()
+	for _, pc := range config.ConfigRuntime.Plugins {
+		p := &plugin{
+			name:        pc.Name,
+			command:     pc.Command,
+			events:      pc.Events,
+			veto:        pc.Veto,
+			vetoTimeout: defaultVetoTimeout,
+			pending:     map[string]chan rpcMessage{},
+		}
+		if pc.VetoTimeout > 0 {
+			p.vetoTimeout = time.Duration(pc.VetoTimeout) * time.Second
+		}
+		plugins = append(plugins, p)
+
+		go p.supervise()
+	}
+	pluginsM.Unlock()
+
+	eventC := events.Subscribe(100)
+	for e := range eventC {
+		Notify(e)
+	}
+}
+
+// Notify sends an event to the running plugins subscribed to its type
+// [non-blocking]
+func Notify(e events.Event) {
+	for _, p := range list() {
+		if !p.subscribed(e.Type) {
+			continue
+		}
+		errMsh := p.notify("event", e)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("Notify"))
+		}
+	}
+}
+
+// Connection sends a connection event to the plugins when a client sends a status or join request (request: "status" or "join")
+// [non-blocking]
+func Connection(request, playerName, clientAddress string) {
+	data := map[string]interface{}{
+		"request": request,
+		"ip":      clientAddress,
+		"status":  servstats.StatusName(servstats.Stats.Status),
+	}
+	if playerName != "" {
+		data["player"] = playerName
+	}
+
+	Notify(events.Event{Time: time.Now(), Type: CONNECTION, Data: data})
+}
+
+// VetoWake asks the plugins with Veto set whether the minecraft server can be woken up (cause is sent to the plugins).
+// A plugin that is not running or does not answer within its VetoTimeout does not prevent the wake-up.
+// [blocking]
+func VetoWake(cause history.Cause) *errco.Error {
+	for _, p := range list() {
+		if !p.veto {
+			continue
+		}
+
+		res, errMsh := p.call("wake", cause, p.vetoTimeout)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("VetoWake"))
+			continue
+		}
+
+		var answer struct {
+			Allow  *bool  `json:"allow"`
+			Reason string `json:"reason"`
+		}
+		if err := json.Unmarshal(res, &answer); err != nil || answer.Allow == nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "VetoWake", "plugin "+p.name+" answered wake without allow field: "+string(res)))
+			continue
+		}
+
+		if !*answer.Allow {
+			errco.Logln(errco.LVL_B, "plugin %s refused the minecraft server wake-up requested by %s", p.name, cause.String())
+			reason := answer.Reason
+			if reason == "" {
+				reason = locale.T("kick.wake-refused")
+			}
+			return errco.NewErr(errco.ERROR_PLUGIN_VETO, errco.LVL_B, "VetoWake", reason)
+		}
+	}
+
+	return nil
+}
+
+// list returns the configured plugins
+func list() []*plugin {
+	pluginsM.Lock()
+	defer pluginsM.Unlock()
+
+	return append([]*plugin{}, plugins...)
+}
+
+// subscribed returns true if the plugin receives the events of the specified type (Plugins.Events)
+func (p *plugin) subscribed(eventType string) bool {
+	if len(p.events) == 0 {
+		return true
+	}
+
+	for _, t := range p.events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// supervise runs the plugin and restarts it when it exits (waiting longer after each consecutive exit)
+// [goroutine]
+func (p *plugin) supervise() {
+	wait := restartMin
+
+	for {
+		startT := time.Now()
+
+		errMsh := p.run()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("supervise"))
+		}
+
+		if time.Since(startT) > restartReset {
+			wait = restartMin
+		}
+		errco.Logln(errco.LVL_B, "plugin %s exited, restarting in %s", p.name, wait)
+		time.Sleep(wait)
+
+		wait *= 2
+		if wait > restartMax {
+			wait = restartMax
+		}
+	}
+}
+
+// run starts the plugin process and exchanges messages with it until it exits
+// [blocking]
+func (p *plugin) run() *errco.Error {
+	cmd := opsys.ShellCommand(context.Background(), p.command)
+	cmd.Env = append(os.Environ(), "MSH_PLUGIN="+p.name)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PLUGIN_PROCESS, errco.LVL_B, "run", err.Error())
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PLUGIN_PROCESS, errco.LVL_B, "run", err.Error())
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PLUGIN_PROCESS, errco.LVL_B, "run", err.Error())
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PLUGIN_PROCESS, errco.LVL_B, "run", "plugin "+p.name+" could not be started: "+err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "plugin %s started (pid %d)", p.name, cmd.Process.Pid)
+
+	outC := make(chan []byte, outBuffer)
+	p.m.Lock()
+	p.outC = outC
+	p.m.Unlock()
+
+	doneC := make(chan bool)
+	stderrDoneC := make(chan bool)
+	go p.write(stdin, outC, doneC)
+	go p.logStderr(stderr, stderrDoneC)
+
+	// messages are read until the plugin closes stdout
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		// the line is copied since the scanner buffer is reused
+		p.receive(append([]byte{}, scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "run", "plugin "+p.name+" output: "+err.Error()))
+	}
+
+	// the requests waiting for a response fail immediately
+	p.m.Lock()
+	p.outC = nil
+	for id, resC := range p.pending {
+		select {
+		case resC <- rpcMessage{Error: &rpcError{Code: rpcServerError, Message: "plugin exited"}}:
+		default:
+		}
+		delete(p.pending, id)
+	}
+	p.m.Unlock()
+	close(doneC)
+
+	// the pipes are closed by Wait: stderr must be read first
+	<-stderrDoneC
+	err = cmd.Wait()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PLUGIN_PROCESS, errco.LVL_B, "run", "plugin "+p.name+" exited with error: "+err.Error())
+	}
+
+	return nil
+}
+
+// send queues a message to write to the plugin stdin
+// [non-blocking]
+func (p *plugin) send(msg rpcMessage) *errco.Error {
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "send", err.Error())
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.outC == nil {
+		return errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_D, "send", "plugin "+p.name+" is not running")
+	}
+
+	select {
+	case p.outC <- append(msgJSON, '\n'):
+		return nil
+	default:
+		return errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_B, "send", "plugin "+p.name+" is not reading its input, dropping message")
+	}
+}
+
+// write writes the queued messages to the plugin stdin until the plugin exits
+// [goroutine]
+func (p *plugin) write(stdin io.WriteCloser, outC chan []byte, doneC chan bool) {
+	defer stdin.Close()
+
+	for {
+		select {
+		case <-doneC:
+			return
+		case msg := <-outC:
+			_, err := stdin.Write(msg)
+			if err != nil {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_PLUGIN_RPC, errco.LVL_D, "write", "plugin "+p.name+" input: "+err.Error()))
+				return
+			}
+		}
+	}
+}
+
+// logStderr writes the plugin stderr to the msh log (doneC is closed when stderr is closed)
+// [goroutine]
+func (p *plugin) logStderr(stderr io.Reader, doneC chan bool) {
+	defer close(doneC)
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		errco.Logln(errco.LVL_C, "plugin %s: %s", p.name, scanner.Text())
+	}
+}
@@ -0,0 +1,37 @@
+package progmgr
+
+import (
+	"fmt"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+)
+
+// TerminalNotifier rings the terminal bell and prints a highlighted line when a player joins
+// or the minecraft server wakes, so that admins with the console open notice it.
+// Only interactive terminals are notified.
+// [goroutine]
+func TerminalNotifier() {
+	if !config.ConfigRuntime.Msh.TerminalBell {
+		return
+	}
+
+	eventC := events.Subscribe(10)
+
+	for e := range eventC {
+		if !interactive() {
+			continue
+		}
+
+		switch e.Type {
+		case events.PLAYER_JOIN:
+			player, _ := e.Data["player"].(string)
+			fmt.Print("\a")
+			errco.LogState("PLAYER %s JOINED THE SERVER!", player)
+		case events.SERVER_STARTING:
+			fmt.Print("\a")
+			errco.LogState("MINECRAFT SERVER IS WAKING UP!")
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package progmgr
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// inputActive is set (1) while GetInput is reading user input from a terminal
+var inputActive int32
+
+var (
+	confirmM sync.Mutex
+	confirmC chan string // channel waiting for the answer to the exit confirmation (nil if not waiting)
+)
+
+// SetInputActive reports whether GetInput is reading user input
+func SetInputActive(active bool) {
+	if active {
+		atomic.StoreInt32(&inputActive, 1)
+	} else {
+		atomic.StoreInt32(&inputActive, 0)
+	}
+}
+
+// ConfirmAnswer passes a user input line to the pending exit confirmation.
+// It returns false if no confirmation is pending (the line should be handled as a command).
+func ConfirmAnswer(line string) bool {
+	confirmM.Lock()
+	defer confirmM.Unlock()
+
+	if confirmC == nil {
+		return false
+	}
+
+	confirmC <- line
+	confirmC = nil
+
+	return true
+}
+
+// interactive returns true if msh is run by a user in a terminal that can answer a confirmation
+func interactive() bool {
+	if atomic.LoadInt32(&inputActive) == 0 {
+		return false
+	}
+
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// awaitConfirm returns a channel on which the user answer to the exit confirmation is received
+func awaitConfirm() chan string {
+	confirmM.Lock()
+	defer confirmM.Unlock()
+
+	confirmC = make(chan string, 1)
+
+	return confirmC
+}
+
+// cancelConfirm stops waiting for the exit confirmation answer
+func cancelConfirm() {
+	confirmM.Lock()
+	defer confirmM.Unlock()
+
+	confirmC = nil
+}
+
+// confirmed returns true if answer is a positive answer
+func confirmed(answer string) bool {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
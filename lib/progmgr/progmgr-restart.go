@@ -0,0 +1,71 @@
+package progmgr
+
+import (
+	"os"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/handover"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// defaultDrainTimeout is the maximum time the proxied connections drain when Msh.RestartDrainTimeout is not set
+const defaultDrainTimeout = 30 * time.Minute
+
+// SeamlessRestart replaces msh with a new msh process started from exePath without disconnecting players:
+// the listeners are passed to the new process, the minecraft server is released to it with a snapshot of its state
+// (msh-detach.json) and the proxied connections drain in this process, which exits when they are closed
+// (or after Msh.RestartDrainTimeout minutes, 30 if not set).
+func SeamlessRestart(exePath string) *errco.Error {
+	if !handover.Supported() {
+		return errco.NewErr(errco.ERROR_HANDOVER, errco.LVL_B, "SeamlessRestart", "seamless restart is not supported on this OS")
+	}
+
+	errMsh := servctrl.Release()
+	if errMsh != nil {
+		return errMsh.AddTrace("SeamlessRestart")
+	}
+
+	errMsh = handover.StartSuccessor(exePath)
+	if errMsh != nil {
+		servctrl.Retain()
+		return errMsh.AddTrace("SeamlessRestart")
+	}
+
+	go drain()
+
+	return nil
+}
+
+// drain waits for the proxied connections to be closed and exits msh
+// [goroutine]
+func drain() {
+	timeout := defaultDrainTimeout
+	if config.ConfigRuntime.Msh.RestartDrainTimeout > 0 {
+		timeout = time.Duration(config.ConfigRuntime.Msh.RestartDrainTimeout) * time.Minute
+	}
+	start := time.Now()
+	lastLog := time.Time{}
+
+	for {
+		conns := len(servstats.Conns())
+		if conns == 0 {
+			break
+		}
+		if time.Since(start) >= timeout {
+			errco.Logln(errco.LVL_A, "drain timeout: closing %d proxied connections", conns)
+			break
+		}
+		if time.Since(lastLog) >= time.Minute {
+			errco.Logln(errco.LVL_A, "waiting for %d proxied connections to close before exiting msh...", conns)
+			lastLog = time.Now()
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	errco.Logln(errco.LVL_A, "exiting msh (replaced by the new msh process)")
+	os.Exit(errco.EXIT_OK)
+}
@@ -0,0 +1,175 @@
+package progmgr
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+	"msh/lib/outbound"
+	"msh/lib/servstats"
+)
+
+// releaseURL is the base url of msh release assets
+const releaseURL = "https://github.com/gekware/minecraft-server-hibernation/releases/download/"
+
+// releaseTagRe matches the msh release tags (ex: v2.4.5, v2.5.0-beta1), used to build the release asset urls
+var releaseTagRe = regexp.MustCompile(`^v(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z]+(\.[0-9A-Za-z]+)*)?$`)
+
+// selfUpdate downloads the msh release asset of the specified version for the current OS/architecture,
+// verifies it against the release checksums, replaces the msh executable and restarts msh
+// as soon as the minecraft server is offline.
+// [blocking]
+func selfUpdate(versOnline string) *errco.Error {
+	if !releaseTagRe.MatchString(versOnline) {
+		return errco.NewErr(errco.ERROR_VERSION, errco.LVL_B, "selfUpdate", fmt.Sprintf("release version is not valid: %q", versOnline))
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_UPDATE_INSTALL, errco.LVL_B, "selfUpdate", err.Error())
+	}
+	exePath, err = filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_UPDATE_INSTALL, errco.LVL_B, "selfUpdate", err.Error())
+	}
+
+	// asset name example: msh-v2.4.5-linux-amd64 (msh-v2.4.5-windows-amd64.exe)
+	assetName := fmt.Sprintf("msh-%s-%s-%s", versOnline, runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		assetName += ".exe"
+	}
+
+	errco.Logln(errco.LVL_B, "self update: downloading %s...", assetName)
+
+	checksum, errMsh := releaseChecksum(versOnline, assetName)
+	if errMsh != nil {
+		return errMsh.AddTrace("selfUpdate")
+	}
+
+	// download the new executable next to the current one so that it can be renamed atomically
+	newPath := exePath + ".new"
+	errMsh = downloadVerified(releaseURL+versOnline+"/"+assetName, newPath, checksum)
+	if errMsh != nil {
+		os.Remove(newPath)
+		return errMsh.AddTrace("selfUpdate")
+	}
+
+	// replace the executable (the running executable can't be overwritten on windows, so it's moved aside)
+	oldPath := exePath + ".old"
+	os.Remove(oldPath)
+	err = os.Rename(exePath, oldPath)
+	if err != nil {
+		os.Remove(newPath)
+		return errco.NewErr(errco.ERROR_UPDATE_INSTALL, errco.LVL_B, "selfUpdate", err.Error())
+	}
+	err = os.Rename(newPath, exePath)
+	if err != nil {
+		// restore the previous executable
+		os.Rename(oldPath, exePath)
+		return errco.NewErr(errco.ERROR_UPDATE_INSTALL, errco.LVL_B, "selfUpdate", err.Error())
+	}
+
+	// replace the msh process without disconnecting players
+	// (if the seamless restart fails, msh restarts when the minecraft server is offline)
+	if config.ConfigRuntime.Msh.SeamlessRestart {
+		errco.Logln(errco.LVL_A, "self update: msh updated to %s, restarting seamlessly", versOnline)
+		errMsh = SeamlessRestart(exePath)
+		if errMsh == nil {
+			return nil
+		}
+		errco.LogMshErr(errMsh.AddTrace("selfUpdate"))
+	}
+
+	errco.Logln(errco.LVL_A, "self update: msh updated to %s, restarting when minecraft server is offline", versOnline)
+
+	// wait for the minecraft server to go offline not to disconnect players
+	for servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		time.Sleep(10 * time.Second)
+	}
+
+	errco.Logln(errco.LVL_A, "restarting msh")
+
+	errMsh = opsys.Restart(exePath)
+	if errMsh != nil {
+		return errMsh.AddTrace("selfUpdate")
+	}
+
+	return nil
+}
+
+// releaseChecksum returns the sha256 checksum of the specified asset reading checksums.txt of the release.
+// checksums.txt has the sha256sum format: "<sha256 hex>  <asset name>"
+func releaseChecksum(versOnline, assetName string) (string, *errco.Error) {
+	client, errMsh := outbound.Client(30 * time.Second)
+	if errMsh != nil {
+		return "", errMsh.AddTrace("releaseChecksum")
+	}
+
+	resp, err := client.Get(releaseURL + versOnline + "/checksums.txt")
+	if err != nil {
+		return "", errco.NewErr(errco.ERROR_UPDATE_DOWNLOAD, errco.LVL_B, "releaseChecksum", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", errco.NewErr(errco.ERROR_UPDATE_DOWNLOAD, errco.LVL_B, "releaseChecksum", "checksums.txt download failed: "+resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == assetName {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+
+	return "", errco.NewErr(errco.ERROR_UPDATE_CHECKSUM, errco.LVL_B, "releaseChecksum", "checksum not found for "+assetName)
+}
+
+// downloadVerified downloads url to path and checks that its sha256 checksum matches
+func downloadVerified(url, path, checksum string) *errco.Error {
+	client, errMsh := outbound.Client(10 * time.Minute)
+	if errMsh != nil {
+		return errMsh.AddTrace("downloadVerified")
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_UPDATE_DOWNLOAD, errco.LVL_B, "downloadVerified", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errco.NewErr(errco.ERROR_UPDATE_DOWNLOAD, errco.LVL_B, "downloadVerified", "download failed: "+resp.Status)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_UPDATE_INSTALL, errco.LVL_B, "downloadVerified", err.Error())
+	}
+	defer f.Close()
+
+	// write file and calculate checksum at the same time
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_UPDATE_DOWNLOAD, errco.LVL_B, "downloadVerified", err.Error())
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != checksum {
+		return errco.NewErr(errco.ERROR_UPDATE_CHECKSUM, errco.LVL_B, "downloadVerified", "checksum of downloaded file does not match")
+	}
+
+	return nil
+}
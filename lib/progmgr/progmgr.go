@@ -1,6 +1,7 @@
 package progmgr
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -15,6 +16,10 @@ import (
 
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/outbound"
 	"msh/lib/servctrl"
 	"msh/lib/servstats"
 )
@@ -27,10 +32,49 @@ func InterruptListener() {
 
 	for {
 		// wait for termination signal
-		<-c
+		sig := <-c
+
+		// leave the minecraft server running (ex: msh upgrade), the next msh instance reattaches to it
+		if config.ConfigRuntime.Msh.DetachOnExit {
+			errMsh := servctrl.Detach()
+			if errMsh == nil {
+				errco.Logln(errco.LVL_A, "exiting msh")
+				os.Exit(0)
+			}
+			errco.LogMshErr(errMsh.AddTrace("InterruptListener"))
+		}
+
+		// an accidental ctrl+c in a terminal should not stop a server full of players:
+		// ask for confirmation (a second ctrl+c confirms)
+		if sig == syscall.SIGINT && interactive() {
+			fmt.Print("\nstop server and exit msh? [y/N] ")
+
+			select {
+			case answer := <-awaitConfirm():
+				if !confirmed(answer) {
+					errco.Logln(errco.LVL_A, "exit canceled")
+					continue
+				}
+			case <-c:
+				cancelConfirm()
+				fmt.Println()
+			}
+		}
+
+		// a further interrupt during shutdown (ex: hung minecraft server) forces msh exit
+		// [goroutine]
+		go func() {
+			<-c
+			errco.Logln(errco.LVL_A, "forcing msh exit")
+			errMsh := servctrl.KillMS()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("InterruptListener"))
+			}
+			os.Exit(1)
+		}()
 
 		// stop the minecraft server with no player check
-		errMsh := servctrl.StopMS(false)
+		errMsh := servctrl.StopMS(false, history.By(history.SOURCE_EXIT))
 		if errMsh != nil {
 			errco.LogMshErr(errMsh.AddTrace("InterruptListener"))
 		}
@@ -50,6 +94,13 @@ func InterruptListener() {
 
 		default:
 			errco.Logln(errco.LVL_D, "InterruptListener: stop command does not seem to be stopping server during forceful shutdown")
+
+			// the server is terminated (SIGTERM, then SIGKILL) after Commands.StopServerAllowKill seconds:
+			// wait for it instead of leaving the minecraft server process running
+			if errMsh == nil && config.ConfigRuntime.Commands.StopServerAllowKill > 0 && servctrl.ServTerm.IsActive {
+				errco.Logln(errco.LVL_D, "InterruptListener: waiting for minecraft server process termination")
+				servctrl.ServTerm.Wg.Wait()
+			}
 		}
 
 		// exit
@@ -64,7 +115,7 @@ var CheckedUpdateC chan bool = make(chan bool, 1)
 // [goroutine]
 func UpdateManager(versClient string) {
 	// protocol version number:		1
-	// connection every:			4 hours
+	// connection every:			Msh.UpdateCheckInterval hours (default 4 hours)
 	// parameters passed to php:	v (prot), version (client)
 	// request headers:				HTTP_USER_AGENT
 	// response:					"latest version: $officialVersion"
@@ -73,25 +124,39 @@ func UpdateManager(versClient string) {
 	deltaT := 4 * time.Hour
 	respHeader := "latest version: "
 
+	if config.ConfigRuntime.Msh.UpdateCheckInterval > 0 {
+		deltaT = time.Duration(config.ConfigRuntime.Msh.UpdateCheckInterval) * time.Hour
+	}
+
+	// when update check is disabled no request is sent
+	if config.ConfigRuntime.Msh.DisableUpdateCheck {
+		errco.Logln(errco.LVL_D, "UpdateManager: update check disabled")
+		CheckedUpdateC <- true
+		return
+	}
+
 	for {
 		errco.Logln(errco.LVL_D, "checking version...")
 
-		status, versOnline, errMsh := checkUpdate(versProt, versClient, respHeader)
+		status, versOnline, fromGithub, errMsh := checkUpdate(versProt, versClient, respHeader)
 		if errMsh != nil {
 			// since UpdateManager is a goroutine, don't return and just log the error
 			errco.LogMshErr(errMsh.AddTrace("UpdateManager"))
 		}
 
+		if status == errco.VERSION_UPDATEAVAILABLE {
+			events.Publish(events.UPDATE_AVAILABLE, map[string]interface{}{"version": versOnline})
+		}
+
 		if config.ConfigRuntime.Msh.NotifyUpdate {
 			switch status {
 			case errco.VERSION_UPDATED:
 				errco.Logln(errco.LVL_A, "msh (%s) is updated", versClient)
 
 			case errco.VERSION_UPDATEAVAILABLE:
-				notification := fmt.Sprintf("msh (%s) is now available: visit github to update!", versOnline)
-				errco.Logln(errco.LVL_A, notification)
+				errco.Logln(errco.LVL_A, "msh (%s) is now available: visit github to update!", versOnline)
 				// notify to game chat every 20 minutes for deltaT time
-				go notifyGameChat(20*time.Minute, deltaT, notification)
+				go notifyGameChat(20*time.Minute, deltaT, locale.T("chat.update", versOnline))
 
 			case errco.VERSION_UNOFFICIALVERSION:
 				errco.Logln(errco.LVL_A, "msh (%s) is running an unofficial release", versClient)
@@ -103,65 +168,190 @@ func UpdateManager(versClient string) {
 		default:
 		}
 
+		// install the update (msh is restarted if successful)
+		// the version returned by the legacy endpoint (http) can be tampered with: updates are installed only from github releases
+		if status == errco.VERSION_UPDATEAVAILABLE && config.ConfigRuntime.Msh.SelfUpdate {
+			if fromGithub {
+				errMsh := selfUpdate(versOnline)
+				if errMsh != nil {
+					errco.LogMshErr(errMsh.AddTrace("UpdateManager"))
+				}
+			} else {
+				errco.Logln(errco.LVL_B, "self update: github releases not reachable, %s is not installed", versOnline)
+			}
+		}
+
 		time.Sleep(deltaT)
 	}
 }
 
-// checkUpdate checks for updates. Returns (update available, online version, error)
-// if error occurred, online version will be "error"
-func checkUpdate(versProt, versClient, respHeader string) (int, string, *errco.Error) {
-	userAgentOs := "osNotSupported"
-	switch runtime.GOOS {
-	case "windows":
-		userAgentOs = "windows"
-	case "linux":
-		userAgentOs = "linux"
-	case "darwin":
-		userAgentOs = "macintosh"
+// checkUpdate checks for updates. Returns (update available, online version, online version from github, error)
+// if error occurred, online version will be "error".
+// The latest version is retrieved from github releases (https), the msh legacy endpoint (http) is used as fallback.
+func checkUpdate(versProt, versClient, respHeader string) (int, string, bool, *errco.Error) {
+	fromGithub := true
+	versOnline, errMsh := latestVersionGithub(versClient)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("checkUpdate"))
+
+		fromGithub = false
+		versOnline, errMsh = latestVersionLegacy(versProt, versClient, respHeader)
+		if errMsh != nil {
+			return errco.ERROR_VERSION, "error", false, errMsh.AddTrace("checkUpdate")
+		}
+	}
+
+	// check which version is more recent
+	delta, errMsh := deltaVersion(versOnline, versClient)
+	if errMsh != nil {
+		return errco.ERROR_VERSION, "error", false, errMsh.AddTrace("checkUpdate")
+	}
+
+	switch {
+	case delta > 0:
+		// an update is available
+		return errco.VERSION_UPDATEAVAILABLE, versOnline, fromGithub, nil
+	case delta < 0:
+		// the runtime version has not yet been officially released
+		return errco.VERSION_UNOFFICIALVERSION, versOnline, fromGithub, nil
+	default:
+		// no update available
+		return errco.VERSION_UPDATED, versOnline, fromGithub, nil
+	}
+}
+
+// github latest release cache (used when github responds "304 Not Modified")
+var (
+	githubETag    string
+	githubVersion string
+)
+
+// latestVersionGithub returns the latest msh version published on github releases (https).
+// With Msh.UpdateChannel "prerelease", the most recent release (including prereleases) is returned.
+// The response ETag is cached so that unchanged responses are not downloaded again.
+func latestVersionGithub(versClient string) (string, *errco.Error) {
+	url := "https://api.github.com/repos/gekware/minecraft-server-hibernation/releases/latest"
+	if config.ConfigRuntime.Msh.UpdateChannel == "prerelease" {
+		// releases are listed from the most recent one
+		url = "https://api.github.com/repos/gekware/minecraft-server-hibernation/releases?per_page=1"
 	}
 
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionGithub", err.Error())
+	}
+	userAgent, _ := updateUserAgent(versClient)
+	req.Header.Add("User-Agent", userAgent)
+	req.Header.Add("Accept", "application/vnd.github.v3+json")
+	if githubETag != "" {
+		req.Header.Add("If-None-Match", githubETag)
+	}
+
+	client, errMsh := outbound.Client(4 * time.Second)
+	if errMsh != nil {
+		return "", errMsh.AddTrace("latestVersionGithub")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionGithub", err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return githubVersion, nil
+	case http.StatusOK:
+	default:
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionGithub", "github responded with status: "+resp.Status)
+	}
+
+	type githubRelease struct {
+		TagName string `json:"tag_name"`
+	}
+	release := githubRelease{}
+	if config.ConfigRuntime.Msh.UpdateChannel == "prerelease" {
+		releases := []githubRelease{}
+		err = json.NewDecoder(resp.Body).Decode(&releases)
+		if len(releases) > 0 {
+			release = releases[0]
+		}
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&release)
+	}
+	if err != nil {
+		return "", errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "latestVersionGithub", err.Error())
+	}
+	if release.TagName == "" {
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionGithub", "release tag not found")
+	}
+
+	githubETag = resp.Header.Get("ETag")
+	githubVersion = release.TagName
+
+	return githubVersion, nil
+}
+
+// latestVersionLegacy returns the latest msh version using the msh legacy endpoint (http)
+func latestVersionLegacy(versProt, versClient, respHeader string) (string, *errco.Error) {
+	userAgent, versParam := updateUserAgent(versClient)
+
 	// build http request
-	url := "http://minecraft-server-hibernation.heliohost.us/latest-version.php?v=" + versProt + "&version=" + versClient
+	url := "http://minecraft-server-hibernation.heliohost.us/latest-version.php?v=" + versProt + versParam
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return errco.ERROR_VERSION, "error", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "checkUpdate", err.Error())
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionLegacy", err.Error())
 	}
-	req.Header.Add("User-Agent", "msh ("+userAgentOs+") msh/"+versClient)
+	req.Header.Add("User-Agent", userAgent)
 
 	// execute http request
-	client := &http.Client{Timeout: 4 * time.Second}
+	client, errMsh := outbound.Client(4 * time.Second)
+	if errMsh != nil {
+		return "", errMsh.AddTrace("latestVersionLegacy")
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return errco.ERROR_VERSION, "error", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "checkUpdate", err.Error())
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionLegacy", err.Error())
 	}
 	defer resp.Body.Close()
 
 	// read http response
 	respByte, err := ioutil.ReadAll(resp.Body)
-	if err != nil || !strings.Contains(string(respByte), respHeader) {
-		return errco.ERROR_VERSION, "error", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "checkUpdate", err.Error())
+	if err != nil {
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionLegacy", err.Error())
+	}
+	if !strings.Contains(string(respByte), respHeader) {
+		return "", errco.NewErr(errco.ERROR_VERSION, errco.LVL_D, "latestVersionLegacy", "unexpected response format")
 	}
 
 	// no error and respByte contains respHeader
-	versOnline := strings.ReplaceAll(string(respByte), respHeader, "")
+	return strings.ReplaceAll(string(respByte), respHeader, ""), nil
+}
 
-	// check which version is more recent
-	delta, errMsh := deltaVersion(versOnline, versClient)
-	if errMsh != nil {
-		return errco.ERROR_VERSION, "error", errMsh.AddTrace("checkUpdate")
+// updateUserAgent returns the user agent and the version url parameter
+// to use for update checks according to Msh.UpdateUserAgent privacy setting
+func updateUserAgent(versClient string) (string, string) {
+	userAgentOs := "osNotSupported"
+	switch runtime.GOOS {
+	case "windows":
+		userAgentOs = "windows"
+	case "linux":
+		userAgentOs = "linux"
+	case "darwin":
+		userAgentOs = "macintosh"
 	}
 
-	switch {
-	case delta > 0:
-		// an update is available
-		return errco.VERSION_UPDATEAVAILABLE, versOnline, nil
-	case delta < 0:
-		// the runtime version has not yet been officially released
-		return errco.VERSION_UNOFFICIALVERSION, versOnline, nil
-	default:
-		// no update available
-		return errco.VERSION_UPDATED, versOnline, nil
+	switch config.ConfigRuntime.Msh.UpdateUserAgent {
+	case "strip":
+		// don't send os and msh version
+		return "msh", ""
+	case "random":
+		// send a random os instead of the real one and don't send msh version,
+		// so that the client can't be identified across update checks
+		randomOs := []string{"windows", "linux", "macintosh"}
+		return "msh (" + randomOs[time.Now().UnixNano()%int64(len(randomOs))] + ")", ""
 	}
+
+	return "msh (" + userAgentOs + ") msh/" + versClient, "&version=" + versClient
 }
 
 // deltaVersion returns the difference between versOnline and versClient:
@@ -173,6 +363,9 @@ func deltaVersion(versOnline, versClient string) (int, *errco.Error) {
 	digitize := func(Version string) (int, error) {
 		versionInt := 0
 
+		// remove prerelease suffix (input: "vx.x.x-beta1" -> "vx.x.x")
+		Version = strings.SplitN(Version, "-", 2)[0]
+
 		// replace and split version (input: "vx.x.x") to get a list of integers
 		versionSplit := strings.Split(strings.ReplaceAll(Version, "v", ""), ".")
 		for n, digit := range versionSplit {
@@ -0,0 +1,288 @@
+package provision
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/outbound"
+)
+
+// download describes the server jar to download
+type download struct {
+	url     string    // server jar url
+	version string    // minecraft version
+	hash    hash.Hash // hash function of the published checksum (nil if no checksum is published)
+	sum     string    // published checksum (hex)
+}
+
+// Provision downloads the server jar of Provision.Flavor and Provision.Version
+// if the server file does not exist yet
+// [blocking]
+func Provision() *errco.Error {
+	if !config.ProvisionPending() {
+		return nil
+	}
+
+	p := config.ConfigRuntime.Provision
+	errco.Logln(errco.LVL_A, "provisioning %s minecraft server (version: %s)...", p.Flavor, versionName(p.Version))
+
+	client, errMsh := outbound.Client(5 * time.Minute)
+	if errMsh != nil {
+		return errMsh.AddTrace("Provision")
+	}
+
+	var d *download
+	switch p.Flavor {
+	case "vanilla":
+		d, errMsh = vanilla(client, p.Version)
+	case "paper":
+		d, errMsh = paper(client, p.Version)
+	case "fabric":
+		d, errMsh = fabric(client, p.Version)
+	}
+	if errMsh != nil {
+		return errMsh.AddTrace("Provision")
+	}
+
+	errMsh = fetch(client, d, filepath.Join(config.ConfigRuntime.Server.Folder, config.ConfigRuntime.Server.FileName))
+	if errMsh != nil {
+		return errMsh.AddTrace("Provision")
+	}
+
+	errco.Logln(errco.LVL_A, "%s minecraft server %s downloaded to %s", p.Flavor, d.version, config.ConfigRuntime.Server.FileName)
+
+	return nil
+}
+
+// vanilla returns the vanilla server jar download from the mojang version manifest
+func vanilla(client *http.Client, version string) (*download, *errco.Error) {
+	var manifest struct {
+		Latest struct {
+			Release string `json:"release"`
+		} `json:"latest"`
+		Versions []struct {
+			Id  string `json:"id"`
+			Url string `json:"url"`
+		} `json:"versions"`
+	}
+	errMsh := getJSON(client, "https://piston-meta.mojang.com/mc/game/version_manifest_v2.json", &manifest)
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("vanilla")
+	}
+
+	if version == "" || version == "latest" {
+		version = manifest.Latest.Release
+	}
+
+	for _, v := range manifest.Versions {
+		if v.Id != version {
+			continue
+		}
+
+		var info struct {
+			Downloads struct {
+				Server struct {
+					Url  string `json:"url"`
+					Sha1 string `json:"sha1"`
+				} `json:"server"`
+			} `json:"downloads"`
+		}
+		errMsh = getJSON(client, v.Url, &info)
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("vanilla")
+		}
+		if info.Downloads.Server.Url == "" {
+			return nil, errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "vanilla", "vanilla version "+version+" has no server jar")
+		}
+
+		return &download{info.Downloads.Server.Url, version, sha1.New(), info.Downloads.Server.Sha1}, nil
+	}
+
+	return nil, errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "vanilla", "vanilla version not found: "+version)
+}
+
+// paper returns the latest paper build download of the minecraft version
+func paper(client *http.Client, version string) (*download, *errco.Error) {
+	const api = "https://api.papermc.io/v2/projects/paper"
+
+	if version == "" || version == "latest" {
+		var project struct {
+			Versions []string `json:"versions"`
+		}
+		errMsh := getJSON(client, api, &project)
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("paper")
+		}
+		if len(project.Versions) == 0 {
+			return nil, errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "paper", "no paper version available")
+		}
+		// versions are sorted from the oldest
+		version = project.Versions[len(project.Versions)-1]
+	}
+
+	var builds struct {
+		Builds []struct {
+			Build     int `json:"build"`
+			Downloads struct {
+				Application struct {
+					Name   string `json:"name"`
+					Sha256 string `json:"sha256"`
+				} `json:"application"`
+			} `json:"downloads"`
+		} `json:"builds"`
+	}
+	errMsh := getJSON(client, api+"/versions/"+version+"/builds", &builds)
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("paper")
+	}
+	if len(builds.Builds) == 0 {
+		return nil, errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "paper", "no paper build available for version "+version)
+	}
+
+	// builds are sorted from the oldest
+	b := builds.Builds[len(builds.Builds)-1]
+	url := fmt.Sprintf("%s/versions/%s/builds/%d/downloads/%s", api, version, b.Build, b.Downloads.Application.Name)
+
+	return &download{url, fmt.Sprintf("%s (build %d)", version, b.Build), sha256.New(), b.Downloads.Application.Sha256}, nil
+}
+
+// fabric returns the fabric server launcher download of the minecraft version
+// with the latest stable loader and installer
+func fabric(client *http.Client, version string) (*download, *errco.Error) {
+	const api = "https://meta.fabricmc.net/v2/versions"
+
+	type entry struct {
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+	}
+
+	// latestStable returns the first stable entry of the list (lists are sorted from the newest)
+	latestStable := func(path string) (string, *errco.Error) {
+		var entries []entry
+		errMsh := getJSON(client, api+path, &entries)
+		if errMsh != nil {
+			return "", errMsh.AddTrace("latestStable")
+		}
+		for _, e := range entries {
+			if e.Stable {
+				return e.Version, nil
+			}
+		}
+		return "", errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "latestStable", "no stable fabric version available at "+path)
+	}
+
+	var errMsh *errco.Error
+	if version == "" || version == "latest" {
+		version, errMsh = latestStable("/game")
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("fabric")
+		}
+	}
+	loader, errMsh := latestStable("/loader")
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("fabric")
+	}
+	installer, errMsh := latestStable("/installer")
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("fabric")
+	}
+
+	url := fmt.Sprintf("%s/loader/%s/%s/%s/server/jar", api, version, loader, installer)
+
+	// fabric does not publish checksums of the server launcher
+	return &download{url, fmt.Sprintf("%s (loader %s)", version, loader), nil, ""}, nil
+}
+
+// fetch downloads the server jar to path verifying its checksum
+// (the jar is written to a temporary file and moved to path only if valid)
+func fetch(client *http.Client, d *download, path string) *errco.Error {
+	resp, errMsh := get(client, d.url)
+	if errMsh != nil {
+		return errMsh.AddTrace("fetch")
+	}
+	defer resp.Body.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".msh-provision-*.jar")
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "fetch", "can't create temporary file: "+err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	sha := sha256.New()
+	w := io.MultiWriter(tmp, sha)
+	if d.hash != nil {
+		w = io.MultiWriter(tmp, sha, d.hash)
+	}
+	_, err = io.Copy(w, resp.Body)
+	tmp.Close()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "fetch", "error while downloading server jar: "+err.Error())
+	}
+
+	if d.hash == nil {
+		errco.Logln(errco.LVL_A, "WARNING: no checksum published for the server jar, sha256: %s", hex.EncodeToString(sha.Sum(nil)))
+	} else if sum := hex.EncodeToString(d.hash.Sum(nil)); !strings.EqualFold(sum, d.sum) {
+		return errco.NewErr(errco.ERROR_PROVISION_HASH, errco.LVL_B, "fetch", "server jar checksum mismatch (expected "+d.sum+", got "+sum+")")
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "fetch", "can't move server jar: "+err.Error())
+	}
+
+	return nil
+}
+
+// getJSON decodes the json response of address into v
+func getJSON(client *http.Client, address string, v interface{}) *errco.Error {
+	resp, errMsh := get(client, address)
+	if errMsh != nil {
+		return errMsh.AddTrace("getJSON")
+	}
+	defer resp.Body.Close()
+
+	err := json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "getJSON", "can't decode response of "+address+": "+err.Error())
+	}
+
+	return nil
+}
+
+// get requests address and returns the response if successful
+// (the caller must close the response body)
+func get(client *http.Client, address string) (*http.Response, *errco.Error) {
+	resp, err := client.Get(address)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "get", err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errco.NewErr(errco.ERROR_PROVISION_DOWNLOAD, errco.LVL_B, "get", address+" responded with status "+resp.Status)
+	}
+
+	return resp, nil
+}
+
+// versionName returns the version as shown in logs
+func versionName(version string) string {
+	if version == "" {
+		return "latest"
+	}
+
+	return version
+}
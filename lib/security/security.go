@@ -0,0 +1,107 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// security package records the clients refused for suspicious behavior in the security log (Msh.SecurityLogFile),
+// one line per refusal in a format that fail2ban/firewalld can match:
+// 2021-07-01 12:00:00 msh-security reason=malformed ip=1.2.3.4 player="-" detail="client request unknown"
+
+// reasons of a security log entry
+const (
+	REASON_WHITELIST    = "whitelist"    // player is not whitelisted on the minecraft server
+	REASON_RATE_LIMIT   = "rate-limit"   // player triggered too many wakes (WakeCooldown)
+	REASON_MALFORMED    = "malformed"    // client sent a malformed handshake
+	REASON_FORWARDING   = "forwarding"   // velocity forwarding data is not valid (client bypassed the proxy?)
+	REASON_UNAUTHORIZED = "unauthorized" // api request with an invalid token
+)
+
+// recentSize is the amount of recent entries kept in memory (api)
+const recentSize = 500
+
+var (
+	m sync.Mutex
+
+	// recent contains the most recent security log entries (oldest first)
+	recent = []Entry{}
+)
+
+// Entry is a client refused for suspicious behavior
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Ip     string    `json:"ip"`
+	Player string    `json:"player,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Line returns the security log line of the entry
+func (e Entry) Line() string {
+	player := e.Player
+	if player == "" {
+		player = "-"
+	}
+
+	return fmt.Sprintf("%s msh-security reason=%s ip=%s player=%q detail=%q", e.Time.Format("2006-01-02 15:04:05"), e.Reason, e.Ip, player, e.Detail)
+}
+
+// Report records a client refused for suspicious behavior
+// (ip without port, player and detail can be empty)
+func Report(reason, ip, player, detail string) {
+	// clients without a known ip can't be banned
+	if ip == "" {
+		return
+	}
+
+	e := Entry{time.Now(), reason, ip, player, detail}
+
+	errco.Logln(errco.LVL_C, "security: %s", strings.TrimPrefix(e.Line(), e.Time.Format("2006-01-02 15:04:05")+" "))
+
+	m.Lock()
+	defer m.Unlock()
+
+	recent = append(recent, e)
+	if len(recent) > recentSize {
+		recent = recent[len(recent)-recentSize:]
+	}
+
+	path := config.ConfigRuntime.Msh.SecurityLogFile
+	if path == "" {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SECURITY_FILE, errco.LVL_D, "Report", err.Error()))
+		return
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(e.Line() + "\n")
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SECURITY_FILE, errco.LVL_D, "Report", err.Error()))
+	}
+}
+
+// Recent returns the security log entries more recent than since (oldest first)
+func Recent(since time.Time) []Entry {
+	m.Lock()
+	defer m.Unlock()
+
+	entries := []Entry{}
+	for _, e := range recent {
+		if e.Time.After(since) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
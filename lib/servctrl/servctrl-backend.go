@@ -0,0 +1,197 @@
+package servctrl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// backend is the driver that runs the minecraft server and exposes its console
+type backend interface {
+	// start starts the minecraft server and returns its console pipes (stdout, stderr, stdin)
+	start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error)
+	// wait blocks until the minecraft server exits and returns the exit error (nil on clean exit)
+	wait() error
+	// terminate asks the minecraft server to terminate (ex: SIGTERM)
+	terminate() error
+	// kill forcefully terminates the minecraft server
+	kill() error
+	// pid returns the host pid of the minecraft server process (-1 if not available)
+	pid() int
+}
+
+// stopper is implemented by backends that stop the minecraft server by themselves
+// instead of executing Commands.StopServer on the minecraft server console
+type stopper interface {
+	stop() *errco.Error
+}
+
+// newBackend returns the backend specified by Server.Backend
+func newBackend(dir, command string) (backend, *errco.Error) {
+	switch config.ConfigRuntime.Server.Backend {
+	case "", "process":
+		return &processBackend{dir: dir, command: command}, nil
+	case "docker":
+		return &dockerBackend{container: config.ConfigRuntime.Docker.Container}, nil
+	case "kubernetes":
+		return &k8sBackend{}, nil
+	case "pterodactyl":
+		return &pteroBackend{}, nil
+	case "fake":
+		return &fakeBackend{}, nil
+	default:
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "newBackend", "server backend not supported: "+config.ConfigRuntime.Server.Backend)
+	}
+}
+
+// processBackend runs the minecraft server as a child process of msh
+type processBackend struct {
+	dir     string
+	command string
+	cmd     *exec.Cmd
+	proc    serverProcess // java process started by the command (ex: by a wrapper script)
+}
+
+func (pb *processBackend) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	cSplit := splitCommand(pb.command)
+	if len(cSplit) == 0 {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_TERMINAL_START, errco.LVL_B, "start", "start command is empty")
+	}
+
+	// the umask is set by a shell wrapper in the minecraft server process only (not supported on windows):
+	// sh -c 'umask 0027 && exec "$0" "$@"' <command> <args>...
+	// (the umask is validated at config load: it contains only octal digits)
+	if mask := config.ConfigRuntime.Commands.StartServerUmask; mask != "" && runtime.GOOS != "windows" {
+		cSplit = append([]string{"sh", "-c", "umask " + mask + ` && exec "$0" "$@"`}, cSplit...)
+	}
+
+	pb.cmd = exec.Command(cSplit[0], cSplit[1:]...)
+	pb.cmd.Dir = pb.dir
+
+	// working directory (relative to server folder) and environment variables of the minecraft server process
+	if wd := config.ConfigRuntime.Commands.StartServerWorkDir; wd != "" {
+		if !filepath.IsAbs(wd) {
+			wd = filepath.Join(pb.dir, wd)
+		}
+		pb.cmd.Dir = wd
+	}
+	pb.cmd.Env = os.Environ()
+	for k, v := range config.ConfigRuntime.Commands.StartServerEnv {
+		pb.cmd.Env = append(pb.cmd.Env, k+"="+v)
+	}
+
+	// launch as new process group so that signals (ex: SIGINT) are sent to msh
+	// (not relayed to the java server child process)
+	pb.cmd.SysProcAttr = opsys.NewProcGroupAttr()
+
+	// set terminal pipes
+	outPipe, err := pb.cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_PIPE_LOAD, errco.LVL_D, "start", "StdoutPipe load: "+err.Error())
+	}
+	errPipe, err := pb.cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_PIPE_LOAD, errco.LVL_D, "start", "StderrPipe load: "+err.Error())
+	}
+	inPipe, err := pb.cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_PIPE_LOAD, errco.LVL_D, "start", "StdinPipe load: "+err.Error())
+	}
+
+	err = pb.cmd.Start()
+	if err != nil {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_TERMINAL_START, errco.LVL_D, "start", err.Error())
+	}
+
+	return outPipe, errPipe, inPipe, nil
+}
+
+func (pb *processBackend) wait() error {
+	doneC := make(chan bool)
+	go pb.proc.track(pb.cmd.Process.Pid, doneC)
+
+	err := pb.cmd.Wait()
+	close(doneC)
+
+	// a wrapper script can exit before the java process it started
+	pb.proc.waitExit()
+
+	return err
+}
+
+func (pb *processBackend) terminate() error {
+	// the minecraft server is started in a new process group:
+	// signal the whole group so that child processes spawned by java are terminated too
+	errMsh := opsys.TerminateGroup(pb.cmd.Process.Pid)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (pb *processBackend) kill() error {
+	errMsh := opsys.KillGroup(pb.cmd.Process.Pid)
+	if errMsh != nil {
+		// fallback on the java process only
+		errco.LogMshErr(errMsh.AddTrace("kill"))
+		return pb.cmd.Process.Kill()
+	}
+
+	return nil
+}
+
+func (pb *processBackend) pid() int {
+	if pb.cmd == nil || pb.cmd.Process == nil {
+		return -1
+	}
+
+	return pb.cmd.Process.Pid
+}
+
+func (pb *processBackend) serverPid() int {
+	pid := pb.pid()
+	if pid < 0 {
+		return -1
+	}
+
+	return pb.proc.get(pid)
+}
+
+// splitCommand splits a start command into arguments separated by spaces.
+// Single or double quoted arguments can contain spaces (ex: sh -c "./run.sh nogui").
+func splitCommand(command string) []string {
+	args := []string{}
+	arg, quote, inArg := "", rune(0), false
+
+	for _, c := range command {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg += string(c)
+		case c == '"' || c == '\'':
+			quote, inArg = c, true
+		case c == ' ':
+			if inArg {
+				args = append(args, arg)
+			}
+			arg, inArg = "", false
+		default:
+			arg += string(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg)
+	}
+
+	return args
+}
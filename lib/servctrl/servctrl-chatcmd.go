@@ -0,0 +1,147 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+)
+
+// chatMessageRegexp matches the content of a player chat message log line (groups: player name, message)
+// (ex: "<alice> !msh status")
+var chatMessageRegexp = regexp.MustCompile(`^<([^<>\s]+)> (.*)$`)
+
+// parseChatCommand returns the player name and the arguments of a msh command sent in game chat
+// (ok is false if the chat message is not a msh command or ChatCommands is disabled)
+func parseChatCommand(lineContent string) (string, []string, bool) {
+	prefix := config.ConfigRuntime.ChatCommands.Prefix
+	if prefix == "" {
+		return "", nil, false
+	}
+
+	m := chatMessageRegexp.FindStringSubmatch(lineContent)
+	if m == nil {
+		return "", nil, false
+	}
+
+	fields := strings.Fields(m[2])
+	if len(fields) == 0 || fields[0] != prefix {
+		return "", nil, false
+	}
+
+	return m[1], fields[1:], true
+}
+
+// chatCommand executes a msh command sent in game chat by an allowed player (ChatCommands.Players or an operator)
+// and replies to the player with /tell:
+//
+//	!msh status
+//	!msh stop
+//	!msh keepalive <duration|off>
+//	!msh help
+//
+// [goroutine]
+func chatCommand(playerName string, args []string) {
+	if !chatCommandAllowed(playerName) {
+		errco.Logln(errco.LVL_B, "chat command refused: %s is not allowed to run msh commands", playerName)
+		tell(playerName, locale.T("chat.cmd-denied"))
+		return
+	}
+
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+
+	errco.Logln(errco.LVL_B, "chat command from %s: %s", playerName, strings.Join(args, " "))
+
+	switch args[0] {
+	case "status":
+		tell(playerName, locale.T("chat.cmd-status", servstats.Stats.PlayerCount, int(idleTimeout(time.Now()).Minutes())))
+		if k := KeepAliveStatus(); k != nil {
+			tell(playerName, locale.T("chat.cmd-keepalive", k.Until.Format("15:04")))
+		}
+
+	case "stop":
+		tell(playerName, locale.T("chat.cmd-stop"))
+		errMsh := StopMS(false, history.Cause{Source: history.SOURCE_CHAT, Player: playerName})
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("chatCommand"))
+			tell(playerName, locale.T("chat.cmd-error", errMsh.Str))
+		}
+
+	case "keepalive":
+		if len(args) < 2 {
+			tell(playerName, locale.T("chat.cmd-help", config.ConfigRuntime.ChatCommands.Prefix))
+			return
+		}
+		k, errMsh := KeepAliveCommand(args[1])
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("chatCommand"))
+			tell(playerName, locale.T("chat.cmd-error", errMsh.Str))
+			return
+		}
+		if k == nil {
+			tell(playerName, locale.T("chat.cmd-keepalive-off"))
+			return
+		}
+		tell(playerName, locale.T("chat.cmd-keepalive", k.Until.Format("15:04")))
+
+	default:
+		tell(playerName, locale.T("chat.cmd-help", config.ConfigRuntime.ChatCommands.Prefix))
+	}
+}
+
+// chatCommandAllowed returns true if the player can run msh commands in game chat:
+// players listed in ChatCommands.Players and, if ChatCommands.Ops is set, the minecraft server operators (ops.json)
+func chatCommandAllowed(playerName string) bool {
+	for _, p := range config.ConfigRuntime.ChatCommands.Players {
+		if strings.EqualFold(p, playerName) {
+			return true
+		}
+	}
+
+	if !config.ConfigRuntime.ChatCommands.Ops {
+		return false
+	}
+
+	// ops.json is read every time since operators can change while the minecraft server is running
+	data, err := ioutil.ReadFile(filepath.Join(config.ConfigRuntime.Server.Folder, "ops.json"))
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_CHAT_COMMAND, errco.LVL_D, "chatCommandAllowed", err.Error()))
+		return false
+	}
+
+	ops := []struct {
+		Name string `json:"name"`
+	}{}
+	err = json.Unmarshal(data, &ops)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_CHAT_COMMAND, errco.LVL_D, "chatCommandAllowed", "ops.json is not valid: "+err.Error()))
+		return false
+	}
+
+	for _, op := range ops {
+		if strings.EqualFold(op.Name, playerName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tell sends a private chat message to the player
+// (the minecraft server does not print a console line for /tell, so the output is not awaited)
+func tell(playerName, message string) {
+	errMsh := execute("tell "+playerName+" "+message, "chatCommand")
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("tell"))
+	}
+}
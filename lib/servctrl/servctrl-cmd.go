@@ -2,14 +2,21 @@ package servctrl
 
 import (
 	"bufio"
+	"fmt"
 	"io"
-	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"msh/lib/chaos"
+	"msh/lib/config"
 	"msh/lib/errco"
-	"msh/lib/opsys"
+	"msh/lib/events"
+	"msh/lib/security"
 	"msh/lib/servstats"
+	"msh/lib/world"
 )
 
 var ServTerm *servTerminal = &servTerminal{}
@@ -18,10 +25,42 @@ var ServTerm *servTerminal = &servTerminal{}
 type servTerminal struct {
 	IsActive bool
 	Wg       sync.WaitGroup
-	cmd      *exec.Cmd
+	backend  backend
 	outPipe  io.ReadCloser
 	errPipe  io.ReadCloser
 	inPipe   io.WriteCloser
+	killed   bool // set when msh kills the server process on purpose
+}
+
+// Pid returns the pid of the minecraft server process (-1 if terminal is not active)
+func (st *servTerminal) Pid() int {
+	if !st.IsActive || st.backend == nil {
+		return -1
+	}
+
+	return st.backend.pid()
+}
+
+// pipeQueueSize is the maximum amount of minecraft server output lines waiting to be processed
+const pipeQueueSize = 4096
+
+// droppedLines is the amount of minecraft server output lines dropped since last logged
+var droppedLines int64
+
+var (
+	capturesM sync.Mutex
+	captures  []chan string // channels of ExecuteCapture calls waiting for output lines
+)
+
+// statusM is used to avoid concurrent status transitions from different sources (ex: console output and backend readiness)
+var statusM sync.Mutex
+
+// worldCorruptionLogs are minecraft server log messages reporting a damaged world
+var worldCorruptionLogs = []string{
+	"Failed to load level",
+	"Exception reading",
+	"Couldn't load chunk",
+	"Failed to read level data",
 }
 
 // lastLine is a channel used to communicate the last line got from the printer function
@@ -30,15 +69,34 @@ var lastLine = make(chan string)
 // Execute executes a command on ServTerm
 // [non-blocking]
 func Execute(command, origin string) (string, *errco.Error) {
+	errMsh := execute(command, origin)
+	if errMsh != nil {
+		return "", errMsh.AddTrace("Execute")
+	}
+
+	return <-lastLine, nil
+}
+
+// execute writes a command to ServTerm input without waiting for its output
+func execute(command, origin string) *errco.Error {
 	if !ServTerm.IsActive {
-		return "", errco.NewErr(errco.ERROR_TERMINAL_NOT_ACTIVE, errco.LVL_C, "Execute", "terminal not active")
+		return errco.NewErr(errco.ERROR_TERMINAL_NOT_ACTIVE, errco.LVL_C, "execute", "terminal not active")
 	}
 
 	commands := strings.Split(command, "\n")
 
+	// all the lines are checked before executing the first one
+	for i, com := range commands {
+		// "\r\n" line endings (ex: config files edited on windows)
+		commands[i] = strings.TrimSuffix(com, "\r")
+		if !ValidCommand(commands[i]) {
+			return errco.NewErr(errco.ERROR_COMMAND_NOT_VALID, errco.LVL_C, "execute", "command contains control characters (origin: "+origin+")")
+		}
+	}
+
 	for _, com := range commands {
 		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
-			return "", errco.NewErr(errco.ERROR_SERVER_NOT_ONLINE, errco.LVL_C, "Execute", "server not online")
+			return errco.NewErr(errco.ERROR_SERVER_NOT_ONLINE, errco.LVL_C, "execute", "server not online")
 		}
 
 		errco.Logln(errco.LVL_C, "terminal execute: %s%s%s\t(origin: %s)", errco.COLOR_YELLOW, com, errco.COLOR_RESET, origin)
@@ -46,11 +104,103 @@ func Execute(command, origin string) (string, *errco.Error) {
 		// write to cmd (\n indicates the enter key)
 		_, err := ServTerm.inPipe.Write([]byte(com + "\n"))
 		if err != nil {
-			return "", errco.NewErr(errco.ERROR_PIPE_INPUT_WRITE, errco.LVL_C, "Execute", err.Error())
+			return errco.NewErr(errco.ERROR_PIPE_INPUT_WRITE, errco.LVL_C, "execute", err.Error())
 		}
 	}
 
-	return <-lastLine, nil
+	return nil
+}
+
+// ValidCommand returns true if the command line does not contain control characters:
+// the minecraft server console would interpret them (ex: "\r" is a line break), running a second command
+// that was not checked (ex: by Api.CommandAllowlist)
+func ValidCommand(line string) bool {
+	for _, c := range line {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExecuteCapture executes a command on ServTerm and returns the console output lines printed after it.
+// Lines are captured until a line matches match (if not nil) or, if quiet > 0, until no line is printed for quiet time.
+// If timeout expires before, the lines captured so far are returned with an error.
+// [blocking]
+func ExecuteCapture(command, origin string, match *regexp.Regexp, quiet, timeout time.Duration) ([]string, *errco.Error) {
+	// start capturing before the command is executed to avoid missing output lines
+	captureC := startCapture()
+	defer stopCapture(captureC)
+
+	errMsh := execute(command, origin)
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("ExecuteCapture")
+	}
+
+	lines := []string{}
+	timeoutC := time.After(timeout)
+
+	// quietC is nil (never fires) until the first line is captured when quiet period is not set
+	var quietC <-chan time.Time
+
+	for {
+		select {
+		case line := <-captureC:
+			lines = append(lines, line)
+
+			if match != nil && match.MatchString(line) {
+				return lines, nil
+			}
+			if quiet > 0 {
+				quietC = time.After(quiet)
+			}
+
+		case <-quietC:
+			return lines, nil
+
+		case <-timeoutC:
+			return lines, errco.NewErr(errco.ERROR_EXECUTE_TIMEOUT, errco.LVL_D, "ExecuteCapture", fmt.Sprintf("command output not completed after %s: %s", timeout, command))
+		}
+	}
+}
+
+// startCapture registers a new channel that receives all minecraft server output lines
+func startCapture() chan string {
+	capturesM.Lock()
+	defer capturesM.Unlock()
+
+	c := make(chan string, pipeQueueSize)
+	captures = append(captures, c)
+
+	return c
+}
+
+// stopCapture unregisters a capture channel
+func stopCapture(c chan string) {
+	capturesM.Lock()
+	defer capturesM.Unlock()
+
+	for i, cc := range captures {
+		if cc == c {
+			captures = append(captures[:i], captures[i+1:]...)
+			return
+		}
+	}
+}
+
+// sendCapture sends a minecraft server output line to all capture channels
+// [non-blocking]
+func sendCapture(line string) {
+	capturesM.Lock()
+	defer capturesM.Unlock()
+
+	for _, c := range captures {
+		select {
+		case c <- line:
+		default:
+		}
+	}
 }
 
 // cmdStart starts a new terminal (non-blocking) and returns a servTerm object
@@ -62,73 +212,68 @@ func cmdStart(dir, command string) *errco.Error {
 
 	go printerOutErr()
 
-	err := ServTerm.cmd.Start()
-	if err != nil {
-		return errco.NewErr(errco.ERROR_TERMINAL_START, errco.LVL_D, "cmdStart", err.Error())
-	}
-
 	go waitForExit()
 
 	// initialization
 	servstats.Stats.Status = errco.SERVER_STATUS_STARTING
 	servstats.Stats.LoadProgress = "0%"
+	servstats.Stats.LoadStage = ""
 	servstats.Stats.PlayerCount = 0
-	errco.Logln(errco.LVL_B, "MINECRAFT SERVER IS STARTING!")
+	resetDiagnosis()
+	errco.LogState("MINECRAFT SERVER IS STARTING!")
+	events.Publish(events.SERVER_STARTING, nil)
+
+	go readinessProbe()
+
+	go startupWatchdog()
 
 	return nil
 }
 
-// loadTerm loads cmd/pipes into ServTerm
+// loadTerm starts the minecraft server backend and loads it with its pipes into ServTerm
 func loadTerm(dir, command string) *errco.Error {
-	cSplit := strings.Split(command, " ")
-
-	// set terminal cmd
-	ServTerm.cmd = exec.Command(cSplit[0], cSplit[1:]...)
-	ServTerm.cmd.Dir = dir
+	backend, errMsh := newBackend(dir, command)
+	if errMsh != nil {
+		return errMsh.AddTrace("loadTerm")
+	}
 
-	// launch as new process group so that signals (ex: SIGINT) are sent to msh
-	// (not relayed to the java server child process)
-	ServTerm.cmd.SysProcAttr = opsys.NewProcGroupAttr()
+	ServTerm.backend = backend
+	ServTerm.killed = false
 
-	// set terminal pipes
-	var err error
-	ServTerm.outPipe, err = ServTerm.cmd.StdoutPipe()
-	if err != nil {
-		return errco.NewErr(errco.ERROR_PIPE_LOAD, errco.LVL_D, "loadTerm", "StdoutPipe load: "+err.Error())
-	}
-	ServTerm.errPipe, err = ServTerm.cmd.StderrPipe()
-	if err != nil {
-		return errco.NewErr(errco.ERROR_PIPE_LOAD, errco.LVL_D, "loadTerm", "StderrPipe load: "+err.Error())
-	}
-	ServTerm.inPipe, err = ServTerm.cmd.StdinPipe()
-	if err != nil {
-		return errco.NewErr(errco.ERROR_PIPE_LOAD, errco.LVL_D, "loadTerm", "StdinPipe load: "+err.Error())
+	ServTerm.outPipe, ServTerm.errPipe, ServTerm.inPipe, errMsh = ServTerm.backend.start()
+	if errMsh != nil {
+		return errMsh.AddTrace("loadTerm")
 	}
 
 	return nil
 }
 
 // printerOutErr manages the communication from StdoutPipe/StderrPipe.
-// Launches 1 goroutine to scan StdoutPipe and 1 goroutine to scan StderrPipe
+// Launches 1 goroutine to read StdoutPipe and 1 goroutine to read StderrPipe: lines are parsed by the reading goroutines
+// (minecraft server state, players), then queued and printed by 1 goroutine for each pipe, so that a slow printing
+// (ex: stalled msh output) never blocks the minecraft server output and drops only printed lines.
 // (Should be called before cmd.Start())
 // [goroutine]
 func printerOutErr() {
+	outLineC := make(chan string, pipeQueueSize)
+	errLineC := make(chan string, pipeQueueSize)
+
+	go readPipe(ServTerm.outPipe, outLineC, parseOutLine)
+	go readPipe(ServTerm.errPipe, errLineC, parseErrLine)
+
 	// add printer-out + printer-err to waitgroup
 	ServTerm.Wg.Add(2)
 
 	// print terminal StdoutPipe
 	// [goroutine]
 	go func() {
-		var line string
-
 		defer ServTerm.Wg.Done()
 
-		scanner := bufio.NewScanner(ServTerm.outPipe)
+		for line := range outLineC {
+			logDroppedLines()
 
-		for scanner.Scan() {
-			line = scanner.Text()
-
-			errco.Logln(errco.LVL_C, "%s%s%s", errco.COLOR_GRAY, line, errco.COLOR_RESET)
+			// terminal, log file and api consumers
+			broadcastConsole(ConsoleLine{time.Now(), line, false})
 
 			// communicate to lastLine so that func Execute() can return the first line after the command
 			select {
@@ -136,100 +281,214 @@ func printerOutErr() {
 			default:
 			}
 
-			switch servstats.Stats.Status {
+			// communicate to capture channels so that func ExecuteCapture() can return the command output
+			sendCapture(line)
 
-			case errco.SERVER_STATUS_STARTING:
-				// for modded server terminal compatibility, use separate check for "INFO" and flag-word
-				// using only "INFO" and not "[Server thread/INFO]"" because paper minecraft servers don't use "[Server thread/INFO]"
+			// lines not adhering to the log profile line regex while online (ex: multiline java exceptions)
+			if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE && !config.LogProfile.Line.MatchString(line) {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_UNEXP_OUTPUT, errco.LVL_C, "printerOutErr", "line does not adhere to expected log format"))
+			}
+		}
+	}()
 
-				// "Preparing spawn area: " -> update ServStats.LoadProgress
-				if strings.Contains(line, "INFO") && strings.Contains(line, "Preparing spawn area: ") {
-					servstats.Stats.LoadProgress = strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]
-				}
+	// print terminal StderrPipe
+	// [goroutine]
+	go func() {
+		defer ServTerm.Wg.Done()
+
+		for line := range errLineC {
+			logDroppedLines()
+
+			broadcastConsole(ConsoleLine{time.Now(), line, true})
+		}
+	}()
+}
+
+// readPipe reads lines from a minecraft server pipe, parses them with parse and queues them in lineC.
+// The pipe is always read: if the queue is full, lines are dropped instead of waiting (they are parsed anyway).
+// lineC is closed when the pipe is closed.
+// [goroutine]
+func readPipe(pipe io.Reader, lineC chan string, parse func(line string)) {
+	defer close(lineC)
+
+	scanner := bufio.NewScanner(pipe)
+
+	for scanner.Scan() {
+		atomic.StoreInt64(&lastOutputT, time.Now().UnixNano())
+
+		// the minecraft server state must not miss lines
+		parse(scanner.Text())
+
+		select {
+		case lineC <- scanner.Text():
+		default:
+			atomic.AddInt64(&droppedLines, 1)
+		}
+	}
+}
+
+// parseOutLine updates the minecraft server state and players with a line of the minecraft server stdout
+func parseOutLine(line string) {
+	switch servstats.Stats.Status {
+
+	case errco.SERVER_STATUS_STARTING:
+		// log lines are parsed with the regexes of the log profile (config LogProfile)
+		// for modded server terminal compatibility, vanilla profile uses separate check for "INFO" and flag-word
+		// using only "INFO" and not "[Server thread/INFO]"" because paper minecraft servers don't use "[Server thread/INFO]"
+
+		// "Preparing spawn area: " -> update ServStats.LoadProgress
+		if m := config.LogProfile.Progress.FindStringSubmatch(line); m != nil {
+			servstats.Stats.LoadProgress = m[1]
+		}
+
+		// startup stage (ex: "Loading 120 mods", "Preparing level") -> update ServStats.LoadStage
+		if config.LogProfile.Stage != nil {
+			if m := config.LogProfile.Stage.FindStringSubmatch(line); m != nil {
+				servstats.Stats.LoadStage = m[1]
+			}
+		}
 
-				// ": Done (" -> set ServStats.Status = ONLINE
-				// using ": Done (" instead of "Done" to avoid false positives (issue #112)
-				if strings.Contains(line, "INFO") && strings.Contains(line, ": Done (") {
-					servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
-					errco.Logln(errco.LVL_B, "MINECRAFT SERVER IS ONLINE!")
+		// common startup failure causes (ex: eula not accepted) -> reported if the server does not go online
+		diagnoseLine(line)
 
-					// launch a StopMSRequests so that if no players connect the server will shutdown
-					StopMSRequest()
+		// world corruption reported while loading the world -> fail the next integrity check
+		if config.ConfigRuntime.World.IntegrityCheck {
+			for _, c := range worldCorruptionLogs {
+				if strings.Contains(line, c) {
+					world.MarkCorrupted(line)
+					break
 				}
+			}
+		}
+
+		// ": Done (" -> set ServStats.Status = ONLINE
+		// using ": Done (" instead of "Done" to avoid false positives (issue #112)
+		// (only if the log readiness probe is used)
+		if probe := config.ConfigRuntime.Commands.ReadinessProbe; (probe == "" || probe == PROBE_LOG) && config.LogProfile.Done.MatchString(line) {
+			setOnline()
+		}
+
+	case errco.SERVER_STATUS_ONLINE:
+		// It is possible that a player could send a message that contains text similar to server output:
+		// 		[14:08:43] [Server thread/INFO]: <player> Stopping
+		// 		[14:09:32] [Server thread/INFO]: [player] Stopping
+		//
+		// These are the correct shutdown logs:
+		// 		[14:09:46] [Server thread/INFO]: Stopping the server
+		// 		[15Mar2021 14:09:46.581] [Server thread/INFO] [net.minecraft.server.dedicated.DedicatedServer/]: Stopping the server
+		//
+		// lineSplit is therefore implemented:
+		//
+		// [14:09:46] [Server thread/INFO]: <player> ciao
+		// ^-----------header------------^##^--content--^
+
+		// Return if line does not match the log profile line regex (vanilla: line does not contain ": ")
+		// (it does not adhere to expected log format or it is a multiline java exception)
+		// (logged by the output printer)
+		lineSplit := config.LogProfile.Line.FindStringSubmatch(line)
+		if lineSplit == nil {
+			return
+		}
+
+		lineHeader := lineSplit[1]
+		lineContent := lineSplit[2]
+
+		if config.LogProfile.Info.MatchString(lineHeader) {
+			// player refused because not whitelisted -> security log (fail2ban)
+			if playerName := refusedPlayer(lineContent); playerName != "" {
+				security.Report(security.REASON_WHITELIST, playerClientIp(playerName), playerName, "not white-listed")
+			}
 
-			case errco.SERVER_STATUS_ONLINE:
-				// It is possible that a player could send a message that contains text similar to server output:
-				// 		[14:08:43] [Server thread/INFO]: <player> Stopping
-				// 		[14:09:32] [Server thread/INFO]: [player] Stopping
-				//
-				// These are the correct shutdown logs:
-				// 		[14:09:46] [Server thread/INFO]: Stopping the server
-				// 		[15Mar2021 14:09:46.581] [Server thread/INFO] [net.minecraft.server.dedicated.DedicatedServer/]: Stopping the server
-				//
-				// lineSplit is therefore implemented:
-				//
-				// [14:09:46] [Server thread/INFO]: <player> ciao
-				// ^-----------header------------^##^--content--^
-
-				// Continue if line does not contain ": "
-				// (it does not adhere to expected log format or it is a multiline java exception)
-				if !strings.Contains(line, ": ") {
-					errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_UNEXP_OUTPUT, errco.LVL_C, "printerOutErr", "line does not adhere to expected log format"))
-					continue
+			switch {
+			// player sends a chat message
+			case config.LogProfile.Chat.MatchString(lineContent):
+				// just log that the line is a chat message
+				errco.Logln(errco.LVL_C, "a chat message was sent")
+
+				// the chat message is a msh command (ChatCommands)
+				if playerName, args, ok := parseChatCommand(lineContent); ok {
+					go chatCommand(playerName, args)
 				}
 
-				lineSplit := strings.SplitN(line, ": ", 2)
-				lineHeader := lineSplit[0]
-				lineContent := lineSplit[1]
-
-				if strings.Contains(lineHeader, "INFO") {
-					switch {
-					// player sends a chat message
-					case strings.HasPrefix(lineContent, "<") || strings.HasPrefix(lineContent, "["):
-						// just log that the line is a chat message
-						errco.Logln(errco.LVL_C, "a chat message was sent")
-
-					// player joins the server
-					// using "UUID of player" since minecraft server v1.12.2 does not use "joined the game"
-					case strings.Contains(lineContent, "UUID of player"):
-						servstats.Stats.PlayerCount++
-						errco.Logln(errco.LVL_C, "A PLAYER JOINED THE SERVER! - %d players online", servstats.Stats.PlayerCount)
-
-					// player leaves the server
-					// using "lost connection" (instead of "left the game") because it's more general (issue #116)
-					case strings.Contains(lineContent, "lost connection"):
-						servstats.Stats.PlayerCount--
-						errco.Logln(errco.LVL_C, "A PLAYER LEFT THE SERVER! - %d players online", servstats.Stats.PlayerCount)
-						StopMSRequest()
-
-					// the server is stopping
-					case strings.Contains(lineContent, "Stopping"):
-						servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
-						errco.Logln(errco.LVL_B, "MINECRAFT SERVER IS STOPPING!")
-					}
+			// player joins the server
+			// using "UUID of player" since minecraft server v1.12.2 does not use "joined the game"
+			case config.LogProfile.Join != nil && config.LogProfile.Join.MatchString(lineContent):
+				servstats.Stats.PlayerCount++
+				errco.Logln(errco.LVL_C, "A PLAYER JOINED THE SERVER! - %d players online", servstats.Stats.PlayerCount)
+
+			// player is logged in (player name and ip are known)
+			// [12:34:56] [Server thread/INFO]: player[/127.0.0.1:51234] logged in with entity id 123 at (...)
+			case config.LogProfile.Login.MatchString(lineContent):
+				// players are counted on login when the log profile has no join regex
+				if config.LogProfile.Join == nil {
+					servstats.Stats.PlayerCount++
+					errco.Logln(errco.LVL_C, "A PLAYER JOINED THE SERVER! - %d players online", servstats.Stats.PlayerCount)
 				}
+				playerName, playerIP := parseLogin(lineContent)
+				servstats.AddPlayer(playerName)
+				events.Publish(events.PLAYER_JOIN, map[string]interface{}{"players": servstats.Stats.PlayerCount, "player": playerName, "ip": playerIP})
+
+			// player leaves the server
+			// using "lost connection" (instead of "left the game") because it's more general (issue #116)
+			case config.LogProfile.Leave.MatchString(lineContent):
+				playerName := config.LogProfile.Leave.FindStringSubmatch(lineContent)[1]
+				servstats.Stats.PlayerCount--
+				servstats.RemovePlayer(playerName)
+				errco.Logln(errco.LVL_C, "A PLAYER LEFT THE SERVER! - %d players online", servstats.Stats.PlayerCount)
+				events.Publish(events.PLAYER_LEAVE, map[string]interface{}{"players": servstats.Stats.PlayerCount, "player": playerName})
+				StopMSRequest()
+
+			// the server is stopping
+			case config.LogProfile.Stopping.MatchString(lineContent):
+				servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
+				errco.LogState("MINECRAFT SERVER IS STOPPING!")
+				events.Publish(events.SERVER_STOPPING, nil)
 			}
 		}
-	}()
+	}
+}
 
-	// print terminal StderrPipe
-	// [goroutine]
-	go func() {
-		var line string
+// parseErrLine diagnoses the startup failures with a line of the minecraft server stderr
+func parseErrLine(line string) {
+	// java errors (ex: wrong java version) are printed to stderr
+	if servstats.Stats.Status == errco.SERVER_STATUS_STARTING {
+		diagnoseLine(line)
+	}
+}
 
-		defer ServTerm.Wg.Done()
+// logDroppedLines logs the amount of minecraft server output lines dropped since the last call
+func logDroppedLines() {
+	if n := atomic.SwapInt64(&droppedLines, 0); n > 0 {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_PIPE_LINE_DROPPED, errco.LVL_C, "logDroppedLines", fmt.Sprintf("%d minecraft server output lines dropped: output processing is too slow", n)))
+	}
+}
 
-		scanner := bufio.NewScanner(ServTerm.errPipe)
+// setOnline sets ServStats.Status = ONLINE for a starting minecraft server
+func setOnline() {
+	// inject slow startup (chaos testing)
+	chaos.SlowStartup()
 
-		for scanner.Scan() {
-			line = scanner.Text()
+	statusM.Lock()
+	defer statusM.Unlock()
 
-			errco.Logln(errco.LVL_C, "%s%s%s", errco.COLOR_GRAY, line, errco.COLOR_RESET)
-		}
-	}()
+	if servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+		return
+	}
+
+	servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
+	servstats.Stats.OnlineTime = time.Now()
+	errco.LogState("MINECRAFT SERVER IS ONLINE!")
+	events.Publish(events.SERVER_ONLINE, nil)
+
+	// launch a StopMSRequests so that if no players connect the server will shutdown
+	StopMSRequest()
+
+	// launch the watchdog that restarts the server if it hangs
+	go hangWatchdog()
 }
 
 // waitForExit manages ServTerm.isActive parameter and set ServStats.Status = OFFLINE when minecraft server process exits.
+// If the process exited without going through the stopping phase or with an exit error, the crash is handled.
 // [goroutine]
 func waitForExit() {
 	ServTerm.IsActive = true
@@ -241,9 +500,31 @@ func waitForExit() {
 	ServTerm.errPipe.Close()
 	ServTerm.inPipe.Close()
 
+	// wait for the process to exit (the exit status is used to detect crashes)
+	exitErr := ServTerm.backend.wait()
+
 	ServTerm.IsActive = false
 	errco.Logln(errco.LVL_D, "waitForExit: terminal exited")
 
+	// the server stopped cleanly only if it went through the stopping phase and exited without errors
+	// (a server killed by msh is not considered crashed)
+	crashed := !ServTerm.killed && (servstats.Stats.Status != errco.SERVER_STATUS_STOPPING || exitErr != nil)
+	startFailed := !ServTerm.killed && servstats.Stats.Status == errco.SERVER_STATUS_STARTING
+
 	servstats.Stats.Status = errco.SERVER_STATUS_OFFLINE
-	errco.Logln(errco.LVL_B, "MINECRAFT SERVER IS OFFLINE!")
+	servstats.ClearPlayers()
+	errco.LogState("MINECRAFT SERVER IS OFFLINE!")
+	events.Publish(events.SERVER_OFFLINE, nil)
+
+	// a startup failure with a recognized cause (ex: eula not accepted) is not fixed by restarting the server
+	if startFailed && reportStartFailure(errco.NewErr(errco.ERROR_START_EXITED, errco.LVL_B, "waitForExit", "minecraft server process exited before going online"), startExitedFix) {
+		return
+	}
+
+	if crashed {
+		go restartAfterCrash(exitErr)
+	} else {
+		crashRestarts = 0
+		crashLoop = false
+	}
 }
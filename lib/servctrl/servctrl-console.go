@@ -0,0 +1,115 @@
+package servctrl
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// ConsoleLine is a line of the minecraft server console output
+type ConsoleLine struct {
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"`
+	Stderr bool      `json:"stderr"`
+}
+
+// consoleSub is a consumer of the minecraft server console output
+type consoleSub struct {
+	name    string
+	c       chan ConsoleLine
+	dropped int // lines dropped since last logged (the consumer does not keep up)
+}
+
+var (
+	consoleM    sync.Mutex
+	consoleSubs = map[*consoleSub]bool{}
+)
+
+// consoleBufferSize is the amount of console lines buffered for each consumer
+const consoleBufferSize = 1024
+
+// SubscribeConsole returns a channel on which the minecraft server console lines are received
+// and a function to unsubscribe (the channel is then closed).
+// Every consumer has its own buffer: a slow consumer loses its lines without delaying the other consumers.
+func SubscribeConsole(name string, buffer int) (chan ConsoleLine, func()) {
+	consoleM.Lock()
+	defer consoleM.Unlock()
+
+	sub := &consoleSub{name: name, c: make(chan ConsoleLine, buffer)}
+	consoleSubs[sub] = true
+
+	unsubscribe := func() {
+		consoleM.Lock()
+		defer consoleM.Unlock()
+
+		if consoleSubs[sub] {
+			delete(consoleSubs, sub)
+			close(sub.c)
+		}
+	}
+
+	return sub.c, unsubscribe
+}
+
+// broadcastConsole sends a console line to all consumers without waiting for them.
+// Secrets printed by the minecraft server are redacted (see errco.AddSecrets).
+func broadcastConsole(line ConsoleLine) {
+	line.Text = errco.Redact(line.Text)
+
+	consoleM.Lock()
+	defer consoleM.Unlock()
+
+	for sub := range consoleSubs {
+		select {
+		case sub.c <- line:
+			if sub.dropped > 0 {
+				errco.LogMshErr(errco.NewErr(errco.ERROR_PIPE_LINE_DROPPED, errco.LVL_D, "broadcastConsole", fmt.Sprintf("%d console lines dropped for consumer %s: it does not keep up", sub.dropped, sub.name)))
+				sub.dropped = 0
+			}
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// ConsoleConsumers subscribes the local terminal and the console log file (Msh.ConsoleLogFile) to the minecraft server console.
+// The log-parsing of printerOutErr is not a consumer: it never loses lines.
+// [non-blocking]
+func ConsoleConsumers() {
+	termC, _ := SubscribeConsole("terminal", consoleBufferSize)
+
+	// [goroutine]
+	go func() {
+		for line := range termC {
+			errco.LogServLine(line.Text, line.Stderr)
+		}
+	}()
+
+	if path := config.ConfigRuntime.Msh.ConsoleLogFile; path != "" {
+		fileC, unsubscribe := SubscribeConsole("file", consoleBufferSize)
+		go consoleFileWriter(path, fileC, unsubscribe)
+	}
+}
+
+// consoleFileWriter appends the console lines received on lineC to the file at path
+// [goroutine]
+func consoleFileWriter(path string, lineC chan ConsoleLine, unsubscribe func()) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_CONSOLE_FILE, errco.LVL_B, "consoleFileWriter", err.Error()))
+		unsubscribe()
+		return
+	}
+	defer f.Close()
+
+	for line := range lineC {
+		_, err = fmt.Fprintf(f, "%s %s\n", line.Time.Format("2006/01/02 15:04:05"), line.Text)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_CONSOLE_FILE, errco.LVL_D, "consoleFileWriter", err.Error()))
+		}
+	}
+}
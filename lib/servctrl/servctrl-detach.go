@@ -0,0 +1,296 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+// detachFileName is the file where the running minecraft server is recorded when msh exits without stopping it
+const detachFileName string = "msh-detach.json"
+
+// detachState is the minecraft server left running by a detached msh instance
+// and a snapshot of its state
+type detachState struct {
+	Backend        string    `json:"backend"`
+	Pid            int       `json:"pid"`
+	Time           time.Time `json:"time"`
+	OnlineTime     time.Time `json:"onlineTime"`
+	LastPlayers    []string  `json:"lastPlayers,omitempty"`
+	LastWakePlayer string    `json:"lastWakePlayer,omitempty"`
+}
+
+// released is true when the minecraft server is managed by a new msh instance (seamless restart):
+// this msh instance does not start, stop or kill it anymore
+var released bool
+
+// attacher is implemented by backends that can reattach to a minecraft server left running by a detached msh instance
+type attacher interface {
+	attach(pid int) (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error)
+}
+
+// Detach records the running minecraft server so that the next msh instance reattaches to it.
+// The minecraft server is not stopped: msh is expected to exit after Detach returns.
+func Detach() *errco.Error {
+	if !ServTerm.IsActive {
+		errco.Logln(errco.LVL_B, "minecraft server is not running: nothing to detach")
+		return nil
+	}
+
+	// process backend is reattached as attachedProcessBackend
+	switch ServTerm.backend.(type) {
+	case attacher, *processBackend:
+	default:
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Detach", "server backend does not support reattaching")
+	}
+
+	servstats.Stats.M.Lock()
+	state := detachState{
+		Backend:        config.ConfigRuntime.Server.Backend,
+		Pid:            ServTerm.Pid(),
+		Time:           time.Now(),
+		OnlineTime:     servstats.Stats.OnlineTime,
+		LastPlayers:    append(append([]string{}, servstats.Stats.Players...), servstats.Stats.LastPlayers...),
+		LastWakePlayer: servstats.Stats.LastWakePlayer,
+	}
+	servstats.Stats.M.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Detach", err.Error())
+	}
+	err = ioutil.WriteFile(detachFileName, data, 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Detach", err.Error())
+	}
+
+	errco.Logln(errco.LVL_A, "detaching from minecraft server (pid %d): it will keep running and the next msh instance will reattach to it", ServTerm.Pid())
+
+	return nil
+}
+
+// Reattach reattaches to the minecraft server left running by a detached msh instance (if any)
+func Reattach() *errco.Error {
+	data, err := ioutil.ReadFile(detachFileName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Reattach", err.Error())
+	}
+
+	// the detach state is used only once
+	os.Remove(detachFileName)
+
+	var state detachState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Reattach", err.Error())
+	}
+	if state.Backend != config.ConfigRuntime.Server.Backend {
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Reattach", fmt.Sprintf("minecraft server was detached from backend \"%s\", current backend is \"%s\"", state.Backend, config.ConfigRuntime.Server.Backend))
+	}
+
+	backend, errMsh := newBackend(config.ConfigRuntime.Server.Folder, config.ConfigRuntime.Commands.StartServer)
+	if errMsh != nil {
+		return errMsh.AddTrace("Reattach")
+	}
+	if _, ok := backend.(*processBackend); ok {
+		backend = &attachedProcessBackend{}
+	}
+	a, ok := backend.(attacher)
+	if !ok {
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Reattach", "server backend does not support reattaching")
+	}
+
+	ServTerm.backend = backend
+	ServTerm.killed = false
+
+	ServTerm.outPipe, ServTerm.errPipe, ServTerm.inPipe, errMsh = a.attach(state.Pid)
+	if errMsh != nil {
+		return errMsh.AddTrace("Reattach")
+	}
+
+	go printerOutErr()
+
+	go waitForExit()
+
+	servstats.Stats.Status = errco.SERVER_STATUS_STARTING
+	servstats.Stats.PlayerCount = 0
+	errco.Logln(errco.LVL_B, "reattached to minecraft server detached on %s", state.Time.Format("2006/01/02 15:04:05"))
+
+	// kubernetes backend sets the server online when the pod is ready,
+	// other backends were detached while online
+	if _, ok := backend.(*k8sBackend); !ok {
+		setOnline()
+	}
+
+	// restore the state snapshot of the detached msh instance
+	servstats.Stats.M.Lock()
+	if !state.OnlineTime.IsZero() {
+		servstats.Stats.OnlineTime = state.OnlineTime
+	}
+	servstats.Stats.LastWakePlayer = state.LastWakePlayer
+	servstats.Stats.M.Unlock()
+	servstats.RestoreLastPlayers(state.LastPlayers)
+
+	return nil
+}
+
+// Release detaches the running minecraft server for a new msh instance (seamless restart):
+// after Release this msh instance does not start, stop or kill the minecraft server anymore
+func Release() *errco.Error {
+	switch servstats.Stats.Status {
+	case errco.SERVER_STATUS_STARTING, errco.SERVER_STATUS_STOPPING:
+		return errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "Release", "minecraft server is "+servstats.StatusName(servstats.Stats.Status)+": retry when it's online or offline")
+	}
+
+	errMsh := Detach()
+	if errMsh != nil {
+		return errMsh.AddTrace("Release")
+	}
+
+	released = true
+
+	return nil
+}
+
+// Retain takes back control of the minecraft server released for a new msh instance that could not be started
+func Retain() {
+	os.Remove(detachFileName)
+	released = false
+}
+
+// checkReleased returns an error if the minecraft server is managed by a new msh instance
+func checkReleased() *errco.Error {
+	if released {
+		return errco.NewErr(errco.ERROR_SERVER_RELEASED, errco.LVL_B, "checkReleased", "minecraft server is managed by the new msh instance")
+	}
+
+	return nil
+}
+
+// attachedProcessBackend is a minecraft server process started by a detached msh instance.
+// Its console is not available: the server is stopped with SIGTERM (the minecraft server saves the world on SIGTERM)
+// and, since player leaves can't be read from the console, empty server checks are requested periodically.
+type attachedProcessBackend struct {
+	attachedPid int
+	doneC       chan bool     // closed when the process exits
+	proc        serverProcess // java process started by the process (ex: by a wrapper script)
+}
+
+func (ab *attachedProcessBackend) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	return nil, nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "start", "attached process can't be started")
+}
+
+func (ab *attachedProcessBackend) attach(pid int) (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	if pid <= 0 || !opsys.ProcessAlive(pid) {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_DETACH, errco.LVL_B, "attach", fmt.Sprintf("minecraft server process %d is not running", pid))
+	}
+
+	ab.attachedPid = pid
+	ab.doneC = make(chan bool)
+
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+
+	trackC := make(chan bool)
+	go ab.proc.track(pid, trackC)
+
+	// pipes are closed when the process (and the java process it started) exits
+	// [goroutine]
+	go func() {
+		for opsys.ProcessAlive(pid) {
+			time.Sleep(time.Second)
+		}
+		close(trackC)
+		ab.proc.waitExit()
+		outW.Close()
+		errW.Close()
+		close(ab.doneC)
+	}()
+
+	// [goroutine]
+	go func() {
+		t := time.NewTicker(time.Duration(config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer+1) * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ab.doneC:
+				return
+			case <-t.C:
+				if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+					StopMSRequest()
+				}
+			}
+		}
+	}()
+
+	return outR, errR, &detachedStdin{}, nil
+}
+
+func (ab *attachedProcessBackend) stop() *errco.Error {
+	errMsh := opsys.TerminateGroup(ab.attachedPid)
+	if errMsh != nil {
+		return errMsh.AddTrace("stop")
+	}
+
+	statusM.Lock()
+	defer statusM.Unlock()
+
+	servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
+	errco.LogState("MINECRAFT SERVER IS STOPPING!")
+	events.Publish(events.SERVER_STOPPING, nil)
+
+	return nil
+}
+
+func (ab *attachedProcessBackend) wait() error {
+	<-ab.doneC
+	return nil
+}
+
+func (ab *attachedProcessBackend) terminate() error {
+	errMsh := opsys.TerminateGroup(ab.attachedPid)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (ab *attachedProcessBackend) kill() error {
+	errMsh := opsys.KillGroup(ab.attachedPid)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (ab *attachedProcessBackend) pid() int {
+	return ab.attachedPid
+}
+
+func (ab *attachedProcessBackend) serverPid() int {
+	return ab.proc.get(ab.attachedPid)
+}
+
+// detachedStdin is the console input of a reattached minecraft server process (not available)
+type detachedStdin struct{}
+
+func (ds *detachedStdin) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("console input is not available for a reattached minecraft server process")
+}
+
+func (ds *detachedStdin) Close() error {
+	return nil
+}
@@ -0,0 +1,165 @@
+package servctrl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/servstats"
+)
+
+// startupCause is a common cause of minecraft server startup failure recognized in the server log
+type startupCause struct {
+	code    int            // msh error code reported
+	match   *regexp.Regexp // log line printed by the minecraft server (or java) when the cause occurs
+	problem string         // description of the cause
+	fix     string         // suggested fix
+}
+
+// startupCauses are the startup failure causes recognized in the output of the starting minecraft server (stdout and stderr)
+var startupCauses = []startupCause{
+	{
+		errco.ERROR_START_EULA,
+		regexp.MustCompile(`You need to agree to the EULA`),
+		"minecraft EULA not accepted",
+		"set eula=true in eula.txt of the server folder (https://aka.ms/MinecraftEULA)",
+	},
+	{
+		errco.ERROR_START_PORT_BIND,
+		regexp.MustCompile(`FAILED TO BIND TO PORT|Address already in use`),
+		"minecraft server port is already in use",
+		"stop the process using server-port (another minecraft server?), change server-port in server.properties or enable Msh.AutoPort",
+	},
+	{
+		errco.ERROR_START_JAVA_VERSION,
+		regexp.MustCompile(`UnsupportedClassVersionError|compiled by a more recent version of the Java Runtime`),
+		"java version is too old for the minecraft server",
+		"install a newer java (java 17 for minecraft 1.18+, java 21 for 1.20.5+) and use it in Commands.StartServer",
+	},
+	{
+		errco.ERROR_START_OUT_OF_MEMORY,
+		regexp.MustCompile(`Could not reserve enough space for|Invalid (maximum|initial) heap size|Cannot allocate memory`),
+		"java can't reserve the memory requested",
+		"lower -Xmx and -Xms in Commands.StartServerParam: the host does not have enough free memory",
+	},
+	{
+		errco.ERROR_START_OUT_OF_MEMORY,
+		regexp.MustCompile(`java\.lang\.OutOfMemoryError`),
+		"minecraft server ran out of memory",
+		"raise -Xmx in Commands.StartServerParam or remove heavy mods/plugins",
+	},
+	{
+		errco.ERROR_START_WORLD,
+		regexp.MustCompile(strings.Join(worldCorruptionLogs, "|")),
+		"world can't be loaded (corrupted world?)",
+		"restore the world from a backup (msh restore) or remove the damaged region files",
+	},
+}
+
+// startExitedFix is the suggested fix of a startup failure whose cause was not recognized
+const startExitedFix = "check the minecraft server log for the error (msh logs)"
+
+var (
+	diagnosisM sync.Mutex
+
+	// diagnosis is the first startup failure cause recognized in the log of the starting minecraft server (nil if none)
+	diagnosis *startupCause
+
+	// startupN counts the minecraft server startups (int32 for atomic operations)
+	startupN int32
+)
+
+// diagnoseLine records the startup failure cause recognized in a line printed by the starting minecraft server.
+// Only the first cause is recorded: the following errors are usually consequences of it.
+func diagnoseLine(line string) {
+	diagnosisM.Lock()
+	defer diagnosisM.Unlock()
+
+	if diagnosis != nil {
+		return
+	}
+
+	for i := range startupCauses {
+		if startupCauses[i].match.MatchString(line) {
+			diagnosis = &startupCauses[i]
+			errco.Logln(errco.LVL_D, "diagnoseLine: startup failure cause recognized: %s", diagnosis.problem)
+			return
+		}
+	}
+}
+
+// resetDiagnosis discards the startup failure diagnosis of the previous minecraft server startup
+func resetDiagnosis() {
+	atomic.AddInt32(&startupN, 1)
+
+	diagnosisM.Lock()
+	diagnosis = nil
+	diagnosisM.Unlock()
+
+	servstats.Stats.StartError = ""
+	servstats.Stats.StartFix = ""
+}
+
+// reportStartFailure reports why the minecraft server did not go online: the cause recognized in the log if any,
+// otherwise errMsh with fix. The failure and its suggested fix are logged, notified (start-failure event)
+// and shown by msh status until the next startup.
+// Returns true if the cause was recognized in the log.
+func reportStartFailure(errMsh *errco.Error, fix string) bool {
+	diagnosisM.Lock()
+	cause := diagnosis
+	diagnosisM.Unlock()
+
+	if cause != nil {
+		errMsh = errco.NewErr(cause.code, errco.LVL_B, "reportStartFailure", cause.problem)
+		fix = cause.fix
+	}
+
+	errco.LogMshErr(errMsh)
+	errco.Logln(errco.LVL_A, "suggested fix: %s", fix)
+
+	name := errco.Info(errMsh.Cod).Name
+	servstats.Stats.StartError = name + ": " + errMsh.Str
+	servstats.Stats.StartFix = fix
+	events.Publish(events.START_FAILURE, map[string]interface{}{"error": errMsh.Str + " (suggested fix: " + fix + ")", "code": name, "fix": fix})
+
+	return cause != nil
+}
+
+// startupWatchdog kills the minecraft server if it does not go online within Commands.StartTimeout seconds:
+// a server stuck in the starting phase never hibernates and is never reported as failed.
+// [goroutine]
+func startupWatchdog() {
+	timeout := config.ConfigRuntime.Commands.StartTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	// the watchdog is bound to the startup that launched it
+	n := atomic.LoadInt32(&startupN)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+
+		if atomic.LoadInt32(&startupN) != n || servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+			return
+		}
+	}
+
+	reportStartFailure(
+		errco.NewErr(errco.ERROR_START_TIMEOUT, errco.LVL_B, "startupWatchdog", fmt.Sprintf("minecraft server did not go online in %d seconds: killing it", timeout)),
+		startExitedFix+" or raise Commands.StartTimeout",
+	)
+
+	ServTerm.killed = true
+	err := ServTerm.backend.kill()
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_KILL, errco.LVL_B, "startupWatchdog", err.Error()))
+	}
+}
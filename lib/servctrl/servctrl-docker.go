@@ -0,0 +1,279 @@
+package servctrl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// dockerBackend runs the minecraft server as a docker container (Docker.Container) using the docker engine api.
+// The container must be created with stdin open (docker run -i / compose stdin_open: true)
+// so that commands can be sent to the minecraft server console.
+type dockerBackend struct {
+	container string
+	conn      net.Conn // attach connection (console stream)
+}
+
+func (db *dockerBackend) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	var info struct {
+		Config struct {
+			Tty       bool `json:"Tty"`
+			OpenStdin bool `json:"OpenStdin"`
+		} `json:"Config"`
+	}
+	errMsh := dockerRequest(http.MethodGet, "/containers/"+url.PathEscape(db.container)+"/json", &info)
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+	if !info.Config.OpenStdin {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "start", "container "+db.container+" stdin is not open: minecraft server commands can't be sent"))
+	}
+
+	// attach before starting the container to receive all console output
+	conn, reader, errMsh := dockerAttach(db.container)
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+	db.conn = conn
+
+	errMsh = dockerRequest(http.MethodPost, "/containers/"+url.PathEscape(db.container)+"/start", nil)
+	if errMsh != nil {
+		conn.Close()
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+
+	outR, errR := dockerStreams(reader, info.Config.Tty)
+
+	return outR, errR, conn, nil
+}
+
+func (db *dockerBackend) attach(pid int) (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	var info struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+		State struct {
+			Running bool `json:"Running"`
+		} `json:"State"`
+	}
+	errMsh := dockerRequest(http.MethodGet, "/containers/"+url.PathEscape(db.container)+"/json", &info)
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("attach")
+	}
+	if !info.State.Running {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "attach", "container "+db.container+" is not running")
+	}
+
+	conn, reader, errMsh := dockerAttach(db.container)
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("attach")
+	}
+	db.conn = conn
+
+	outR, errR := dockerStreams(reader, info.Config.Tty)
+
+	return outR, errR, conn, nil
+}
+
+// dockerStreams returns the stdout and stderr streams of an attach connection reader
+func dockerStreams(reader *bufio.Reader, tty bool) (io.ReadCloser, io.ReadCloser) {
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+
+	// [goroutine]
+	go func() {
+		var err error
+		if tty {
+			// tty containers stream raw output (stderr is merged into stdout)
+			_, err = io.Copy(outW, reader)
+		} else {
+			err = dockerDemux(reader, outW, errW)
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		outW.CloseWithError(err)
+		errW.CloseWithError(err)
+	}()
+
+	return outR, errR
+}
+
+func (db *dockerBackend) wait() error {
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	errMsh := dockerRequest(http.MethodPost, "/containers/"+url.PathEscape(db.container)+"/wait", &result)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+	if result.StatusCode != 0 {
+		return fmt.Errorf("container exited with status %d", result.StatusCode)
+	}
+
+	return nil
+}
+
+func (db *dockerBackend) terminate() error {
+	errMsh := dockerRequest(http.MethodPost, "/containers/"+url.PathEscape(db.container)+"/kill?signal=SIGTERM", nil)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (db *dockerBackend) kill() error {
+	errMsh := dockerRequest(http.MethodPost, "/containers/"+url.PathEscape(db.container)+"/kill", nil)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (db *dockerBackend) pid() int {
+	var info struct {
+		State struct {
+			Pid int `json:"Pid"`
+		} `json:"State"`
+	}
+	errMsh := dockerRequest(http.MethodGet, "/containers/"+url.PathEscape(db.container)+"/json", &info)
+	if errMsh != nil || info.State.Pid <= 0 {
+		return -1
+	}
+
+	return info.State.Pid
+}
+
+// dockerDial opens a connection to the docker engine (Docker.Host, default unix:///var/run/docker.sock)
+func dockerDial() (net.Conn, error) {
+	host := config.ConfigRuntime.Docker.Host
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+
+	switch {
+	case strings.HasPrefix(host, "unix://"):
+		return net.DialTimeout("unix", strings.TrimPrefix(host, "unix://"), 10*time.Second)
+	case strings.HasPrefix(host, "tcp://"):
+		return net.DialTimeout("tcp", strings.TrimPrefix(host, "tcp://"), 10*time.Second)
+	default:
+		return nil, fmt.Errorf("docker host not supported (unix://, tcp://): %s", host)
+	}
+}
+
+// dockerClient is the http client of the docker engine api, shared by all requests
+// so that idle connections to the docker socket are reused instead of leaked
+var dockerClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dockerDial()
+		},
+		MaxIdleConns:    2,
+		IdleConnTimeout: 30 * time.Second,
+	},
+}
+
+// dockerRequest sends a request to the docker engine api and decodes the json response into result (if not nil)
+func dockerRequest(method, path string, result interface{}) *errco.Error {
+	req, err := http.NewRequest(method, "http://docker"+path, nil)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "dockerRequest", err.Error())
+	}
+
+	resp, err := dockerClient.Do(req)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "dockerRequest", err.Error())
+	}
+	defer resp.Body.Close()
+
+	// 304: container already started/stopped
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "dockerRequest", fmt.Sprintf("docker api %s %s: %s %s", method, path, resp.Status, apiErr.Message))
+	}
+
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "dockerRequest", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// dockerAttach attaches to the container console and returns the hijacked connection and its reader
+func dockerAttach(container string) (net.Conn, *bufio.Reader, *errco.Error) {
+	conn, err := dockerDial()
+	if err != nil {
+		return nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "dockerAttach", err.Error())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://docker/containers/"+url.PathEscape(container)+"/attach?stream=1&stdin=1&stdout=1&stderr=1", nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "dockerAttach", err.Error())
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "dockerAttach", err.Error())
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "dockerAttach", err.Error())
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "dockerAttach", "docker api attach: "+resp.Status)
+	}
+
+	return conn, reader, nil
+}
+
+// dockerDemux splits the multiplexed attach stream of a non-tty container into stdout and stderr.
+// Each frame has an 8 byte header: [stream type, 0, 0, 0, size (uint32 big endian)]
+func dockerDemux(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+
+	for {
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+
+		dst := stdout
+		if header[0] == 2 {
+			dst = stderr
+		}
+
+		_, err = io.CopyN(dst, r, size)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/servstats"
+)
+
+// drainFileName is the file where the draining mode is persisted
+const drainFileName string = "msh-drain.json"
+
+// DrainMode is the draining mode: players already connected keep playing, new connections get the maintenance message
+// and the minecraft server is frozen as soon as it's empty (and it does not wake up until the draining mode ends)
+type DrainMode struct {
+	Time   time.Time `json:"time"`   // time the draining mode was set
+	Reason string    `json:"reason"` // reason shown to players
+}
+
+// Drain sets the draining mode (ex: before host maintenance).
+// The draining mode is persisted to the drain file so that it's honored across msh restarts
+// (and by a running msh instance when set from the command line).
+func Drain(reason string) *errco.Error {
+	d := &DrainMode{Time: time.Now(), Reason: reason}
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return errco.NewErr(errco.ERROR_DRAIN_FILE, errco.LVL_B, "Drain", err.Error())
+	}
+
+	err = ioutil.WriteFile(drainFileName, data, 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_DRAIN_FILE, errco.LVL_B, "Drain", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "msh is draining: new connections are refused, the minecraft server is frozen when empty")
+
+	return nil
+}
+
+// Undrain ends the draining mode
+func Undrain() *errco.Error {
+	err := os.Remove(drainFileName)
+	if os.IsNotExist(err) {
+		return errco.NewErr(errco.ERROR_DRAIN_FILE, errco.LVL_B, "Undrain", "msh is not draining")
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_DRAIN_FILE, errco.LVL_B, "Undrain", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "msh is not draining anymore")
+
+	return nil
+}
+
+// DrainStatus returns the active draining mode (nil if msh is not draining)
+func DrainStatus() *DrainMode {
+	data, err := ioutil.ReadFile(drainFileName)
+	if err != nil {
+		return nil
+	}
+
+	d := &DrainMode{}
+	err = json.Unmarshal(data, d)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_DRAIN_FILE, errco.LVL_B, "DrainStatus", "drain file is not valid, msh is draining until it's fixed: "+err.Error()))
+		return &DrainMode{Reason: "drain file is not valid"}
+	}
+
+	return d
+}
+
+// Message returns the message shown to players while msh is draining (Msh.InfoDraining)
+func (d *DrainMode) Message() string {
+	return strings.NewReplacer("<reason>", d.Reason).Replace(config.ConfigRuntime.Msh.InfoDraining)
+}
+
+// checkDrain returns an error if msh is draining
+func checkDrain() *errco.Error {
+	d := DrainStatus()
+	if d == nil {
+		return nil
+	}
+
+	return errco.NewErr(errco.ERROR_SERVER_DRAINING, errco.LVL_B, "checkDrain", d.Message())
+}
+
+// DrainManager freezes the minecraft server as soon as it's empty while msh is draining
+// [goroutine]
+func DrainManager() {
+	for {
+		time.Sleep(5 * time.Second)
+
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.PlayerCount > 0 || DrainStatus() == nil {
+			continue
+		}
+
+		// confirm that the minecraft server is empty (the internal player count might not be reliable)
+		playerCount, method := countPlayerSafe()
+		if playerCount > 0 {
+			errco.Logln(errco.LVL_D, "DrainManager: %d online players - method for player count: %s", playerCount, method)
+			continue
+		}
+
+		errco.Logln(errco.LVL_A, "msh is draining and the minecraft server is empty: freezing minecraft server")
+		errMsh := StopMS(false, history.By(history.SOURCE_DRAIN))
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("DrainManager"))
+		}
+	}
+}
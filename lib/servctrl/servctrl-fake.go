@@ -0,0 +1,367 @@
+package servctrl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// fakeStartupTime is the time the emulated minecraft server takes to start
+const fakeStartupTime = 2 * time.Second
+
+// fakeBackend emulates a minecraft server inside msh (Server.Backend "fake" or -dry-run)
+// so that the msh configuration and its integrations can be tested without a server jar.
+// It prints vanilla log lines, answers status pings, accepts player logins
+// (players are kept connected but never enter the game) and executes stop, list and save-all.
+type fakeBackend struct {
+	m        sync.Mutex
+	outW     *io.PipeWriter
+	errW     *io.PipeWriter
+	listener net.Listener
+	clients  map[string]net.Conn // connected players (name -> connection)
+	stopped  bool
+	exitErr  error         // exit error returned by wait
+	doneC    chan struct{} // closed when the emulated server exits
+}
+
+func (fb *fakeBackend) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(config.TargetHost, strconv.Itoa(config.TargetPort)))
+	if err != nil {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_TERMINAL_START, errco.LVL_B, "start", "fake server: "+err.Error())
+	}
+
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	inR, inW := io.Pipe()
+
+	fb.outW, fb.errW = outW, errW
+	fb.listener = listener
+	fb.clients = map[string]net.Conn{}
+	fb.doneC = make(chan struct{})
+
+	go fb.startup()
+	go fb.console(inR)
+
+	return outR, errR, inW, nil
+}
+
+func (fb *fakeBackend) wait() error {
+	<-fb.doneC
+	return fb.exitErr
+}
+
+func (fb *fakeBackend) terminate() error {
+	fb.stop(nil)
+	return nil
+}
+
+func (fb *fakeBackend) kill() error {
+	fb.stop(errors.New("fake server killed"))
+	return nil
+}
+
+func (fb *fakeBackend) pid() int {
+	// the emulated server runs inside msh
+	return -1
+}
+
+// startup emulates the minecraft server startup and accepts connections once it's done
+// [goroutine]
+func (fb *fakeBackend) startup() {
+	t := time.Now()
+	fb.log("Starting minecraft server version %s", config.ConfigRuntime.Server.Version)
+	fb.log("Loading properties")
+	fb.log("Starting Minecraft server on %s", net.JoinHostPort(config.TargetHost, strconv.Itoa(config.TargetPort)))
+	fb.log("Preparing level \"world\"")
+	for p := 0; p <= 100; p += 50 {
+		time.Sleep(fakeStartupTime / 3)
+		fb.log("Preparing spawn area: %d%%", p)
+	}
+	fb.log("Done (%.3fs)! For help, type \"help\"", time.Since(t).Seconds())
+
+	go fb.serve()
+}
+
+// console executes the commands sent to the emulated minecraft server
+// (the console is read until msh closes it so that writes never block)
+// [goroutine]
+func (fb *fakeBackend) console(inR *io.PipeReader) {
+	scanner := bufio.NewScanner(inR)
+	for scanner.Scan() {
+		command := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "/")
+
+		fb.m.Lock()
+		stopped := fb.stopped
+		fb.m.Unlock()
+		if stopped {
+			continue
+		}
+
+		switch strings.Split(command, " ")[0] {
+		case "":
+		case "stop":
+			fb.stop(nil)
+		case "list":
+			names := fb.players()
+			fb.log("There are %d of a max of %d players online: %s", len(names), fb.maxPlayers(), strings.Join(names, ", "))
+		case "save-all":
+			fb.log("Saving the game (this may take a moment!)")
+			fb.log("Saved the game")
+		case "save-off", "save-on":
+			fb.log("Automatic saving is now %s", map[string]string{"save-off": "disabled", "save-on": "enabled"}[command])
+		default:
+			fb.log("Unknown or incomplete command, see below for error")
+		}
+	}
+}
+
+// stop shuts the emulated minecraft server down (exitErr is returned by wait)
+func (fb *fakeBackend) stop(exitErr error) {
+	fb.m.Lock()
+	if fb.stopped {
+		fb.m.Unlock()
+		return
+	}
+	fb.stopped = true
+	fb.exitErr = exitErr
+	clients := fb.clients
+	fb.clients = map[string]net.Conn{}
+	fb.m.Unlock()
+
+	if exitErr == nil {
+		fb.log("Stopping the server")
+		fb.log("Stopping server")
+		fb.log("Saving players")
+		fb.log("Saving worlds")
+	}
+
+	fb.listener.Close()
+	for _, c := range clients {
+		c.Close()
+	}
+
+	fb.outW.Close()
+	fb.errW.Close()
+	close(fb.doneC)
+}
+
+// serve accepts the connections to the emulated minecraft server
+// [goroutine]
+func (fb *fakeBackend) serve() {
+	for {
+		conn, err := fb.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go fb.handleClient(conn)
+	}
+}
+
+// handleClient answers a status ping or keeps a player connected until the connection is closed
+// [goroutine]
+func (fb *fakeBackend) handleClient(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+
+	// handshake: protocol version, server address, server port, next state
+	handshake, err := fakeReadPacket(r)
+	if err != nil {
+		return
+	}
+	fakeReadVarInt(handshake) // packet id
+	fakeReadVarInt(handshake) // protocol version
+	fakeReadString(handshake) // server address
+	handshake.Next(2)         // server port
+	nextState, err := fakeReadVarInt(handshake)
+	if err != nil {
+		return
+	}
+
+	switch nextState {
+	case 1:
+		// status request -> status response, ping -> pong
+		if _, err := fakeReadPacket(r); err != nil {
+			return
+		}
+		conn.Write(fakePacket(0, fakeString(fb.statusJSON())))
+
+		ping, err := fakeReadPacket(r)
+		if err != nil {
+			return
+		}
+		conn.Write(fakePacket(1, ping.Bytes()[1:]))
+
+	case 2:
+		// login start
+		login, err := fakeReadPacket(r)
+		if err != nil {
+			return
+		}
+		fakeReadVarInt(login) // packet id
+		playerName, err := fakeReadString(login)
+		if err != nil || playerName == "" {
+			return
+		}
+
+		fb.m.Lock()
+		if fb.stopped {
+			fb.m.Unlock()
+			return
+		}
+		fb.clients[playerName] = conn
+		fb.m.Unlock()
+
+		fb.log("UUID of player %s is 00000000-0000-0000-0000-000000000000", playerName)
+		fb.log("%s[/%s] logged in with entity id 1 at (0.5, 64.0, 0.5)", playerName, conn.RemoteAddr().String())
+		fb.log("%s joined the game", playerName)
+
+		// the player is connected until the client closes the connection
+		conn.SetDeadline(time.Time{})
+		io.Copy(ioutil.Discard, r)
+
+		fb.m.Lock()
+		if fb.stopped || fb.clients[playerName] != conn {
+			fb.m.Unlock()
+			return
+		}
+		delete(fb.clients, playerName)
+		fb.m.Unlock()
+
+		fb.log("%s lost connection: Disconnected", playerName)
+		fb.log("%s left the game", playerName)
+	}
+}
+
+// players returns the names of the players connected to the emulated minecraft server
+func (fb *fakeBackend) players() []string {
+	fb.m.Lock()
+	defer fb.m.Unlock()
+
+	names := []string{}
+	for n := range fb.clients {
+		names = append(names, n)
+	}
+
+	return names
+}
+
+// maxPlayers returns the max players of the emulated minecraft server
+func (fb *fakeBackend) maxPlayers() int {
+	if config.MaxPlayers <= 0 {
+		return 20
+	}
+
+	return config.MaxPlayers
+}
+
+// statusJSON returns the status response of the emulated minecraft server
+func (fb *fakeBackend) statusJSON() string {
+	info := model.DataInfo{}
+	info.Description.Text = "msh fake server"
+	info.Players.Max = fb.maxPlayers()
+	info.Players.Online = len(fb.players())
+	info.Version.Name = config.ConfigRuntime.Server.Version
+	info.Version.Protocol = config.ConfigRuntime.Server.Protocol
+
+	data, _ := json.Marshal(info)
+
+	return string(data)
+}
+
+// log prints a vanilla minecraft server log line to the emulated server stdout
+func (fb *fakeBackend) log(format string, a ...interface{}) {
+	fmt.Fprintf(fb.outW, "[%s] [Server thread/INFO]: %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, a...))
+}
+
+// fakeReadPacket reads a length prefixed minecraft protocol packet
+func fakeReadPacket(r *bufio.Reader) (*bytes.Buffer, error) {
+	length, err := fakeReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 || length > 1<<16 {
+		return nil, fmt.Errorf("packet length not valid: %d", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBuffer(data), nil
+}
+
+// fakePacket returns a length prefixed minecraft protocol packet
+func fakePacket(id int, data []byte) []byte {
+	payload := append(fakeVarInt(id), data...)
+	return append(fakeVarInt(len(payload)), payload...)
+}
+
+// fakeReadVarInt reads a minecraft protocol VarInt
+func fakeReadVarInt(r io.ByteReader) (int, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			return int(int32(value)), nil
+		}
+	}
+
+	return 0, io.ErrUnexpectedEOF
+}
+
+// fakeVarInt encodes a minecraft protocol VarInt
+func fakeVarInt(value int) []byte {
+	out := []byte{}
+	uv := uint32(value)
+	for {
+		b := byte(uv & 0x7f)
+		uv >>= 7
+		if uv != 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if uv == 0 {
+			return out
+		}
+	}
+}
+
+// fakeReadString reads a minecraft protocol string (VarInt length prefixed utf-8)
+func fakeReadString(r *bytes.Buffer) (string, error) {
+	length, err := fakeReadVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || length > r.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	return string(r.Next(length)), nil
+}
+
+// fakeString encodes a minecraft protocol string
+func fakeString(s string) []byte {
+	return append(fakeVarInt(len(s)), s...)
+}
@@ -0,0 +1,83 @@
+package servctrl
+
+import (
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+)
+
+// FreezePolicy prevents the minecraft server from flapping (frozen and woken up again and again by players that rejoin
+// immediately after the server freezes): the server stays online at least MinOnlineMinutes and is woken up by clients
+// at most MaxWakesPerHour times per hour.
+
+var (
+	wakeTimesM sync.Mutex
+
+	// wakeTimes contains the times of the recent wakes caused by clients
+	wakeTimes = []time.Time{}
+)
+
+// clientWake returns true if the minecraft server start is caused by a client (not by an admin)
+func clientWake(cause history.Cause) bool {
+	switch cause.Source {
+	case history.SOURCE_PLAYER, history.SOURCE_PING, history.SOURCE_DNS, history.SOURCE_IMAP:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkWakeLimit returns an error if clients woke up the minecraft server FreezePolicy.MaxWakesPerHour times in the last hour
+// (admin starts are not limited)
+func checkWakeLimit(cause history.Cause) *errco.Error {
+	maxWakes := config.ConfigRuntime.FreezePolicy.MaxWakesPerHour
+	if maxWakes <= 0 || !clientWake(cause) {
+		return nil
+	}
+
+	wakeTimesM.Lock()
+	defer wakeTimesM.Unlock()
+
+	// discard wakes older than one hour
+	recent := []time.Time{}
+	for _, t := range wakeTimes {
+		if time.Since(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	wakeTimes = recent
+
+	if len(recent) < maxWakes {
+		return nil
+	}
+
+	// the oldest recent wake expires first
+	retry := time.Hour - time.Since(recent[0])
+	return errco.NewErr(errco.ERROR_WAKE_LIMIT, errco.LVL_B, "checkWakeLimit", locale.T("kick.wake-limit", len(recent), int(retry.Minutes())+1))
+}
+
+// recordWakeLimit records a minecraft server start for the FreezePolicy.MaxWakesPerHour limit (if caused by a client)
+func recordWakeLimit(cause history.Cause) {
+	if !clientWake(cause) {
+		return
+	}
+
+	wakeTimesM.Lock()
+	wakeTimes = append(wakeTimes, time.Now())
+	wakeTimesM.Unlock()
+}
+
+// minOnlineLeft returns the time left before the online minecraft server can be frozen (FreezePolicy.MinOnlineMinutes)
+func minOnlineLeft() time.Duration {
+	minOnline := time.Duration(config.ConfigRuntime.FreezePolicy.MinOnlineMinutes) * time.Minute
+	if left := minOnline - time.Since(servstats.Stats.OnlineTime); left > 0 {
+		return left
+	}
+
+	return 0
+}
@@ -0,0 +1,104 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/servstats"
+)
+
+// stateFileInterval is the time between two state file updates when no event occurs
+const stateFileInterval = 30 * time.Second
+
+// crashLoop is set when the minecraft server keeps crashing and automatic restart is disabled
+var crashLoop bool
+
+// HealthReport describes msh health and minecraft server state.
+// A hibernating minecraft server is healthy, a minecraft server in crash loop is not.
+type HealthReport struct {
+	Time    time.Time `json:"time"`
+	Healthy bool      `json:"healthy"`
+	Status  string    `json:"status"`
+	Players int       `json:"players"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Health returns msh health and minecraft server state
+func Health() HealthReport {
+	h := HealthReport{
+		Time:    time.Now(),
+		Healthy: true,
+		Status:  servstats.StatusName(servstats.Stats.Status),
+		Players: servstats.Stats.PlayerCount,
+	}
+
+	switch {
+	case crashLoop && servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE:
+		h.Healthy = false
+		h.Error = "minecraft server crash loop: automatic restart disabled"
+	case servstats.Stats.StartError != "" && servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE:
+		h.Healthy = false
+		h.Error = "minecraft server startup failed: " + servstats.Stats.StartError
+	case !ServTerm.IsActive && servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE:
+		h.Healthy = false
+		h.Error = "minecraft server process is not running"
+	}
+
+	return h
+}
+
+// StateFileWriter writes the health report to Msh.StateFile at every event and every 30 seconds
+// so that external health checks can verify both msh liveness (file update time) and minecraft server state.
+// [goroutine]
+func StateFileWriter() {
+	path := config.ConfigRuntime.Msh.StateFile
+	if path == "" {
+		return
+	}
+
+	eventC := events.Subscribe(10)
+	ticker := time.NewTicker(stateFileInterval)
+
+	for {
+		errMsh := writeStateFile(path)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("StateFileWriter"))
+		}
+
+		select {
+		case <-eventC:
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeStateFile atomically replaces the state file with the current health report
+func writeStateFile(path string) *errco.Error {
+	data, err := json.Marshal(Health())
+	if err != nil {
+		return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "writeStateFile", err.Error())
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_STATE_FILE, errco.LVL_D, "writeStateFile", err.Error())
+	}
+
+	// write to a temporary file and rename it so that readers never see a partial file
+	err = ioutil.WriteFile(path+".tmp", append(data, '\n'), 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_STATE_FILE, errco.LVL_D, "writeStateFile", err.Error())
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_STATE_FILE, errco.LVL_D, "writeStateFile", err.Error())
+	}
+
+	return nil
+}
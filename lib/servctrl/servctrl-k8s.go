@@ -0,0 +1,704 @@
+package servctrl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/servstats"
+)
+
+// k8sPollInterval is the time between two kubernetes pod status requests
+const k8sPollInterval = 3 * time.Second
+
+// k8sBackend runs the minecraft server as a kubernetes workload (Kubernetes.Kind/Kubernetes.Name)
+// that is scaled to 1 replica to start the server and to 0 replicas to stop it.
+// Pod logs are used as console output, pod readiness sets the server online.
+// Console input is not supported.
+type k8sBackend struct {
+	client   *k8sClient
+	selector string    // label selector of the workload pods
+	doneC    chan bool // closed when the workload is scaled down and the log stream ends
+}
+
+func (kb *k8sBackend) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	var errMsh *errco.Error
+	kb.client, errMsh = newK8sClient()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+
+	kb.selector, errMsh = kb.podSelector()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+
+	errMsh = kb.scale(1)
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+
+	outR, errR, inW := kb.follow()
+
+	return outR, errR, inW, nil
+}
+
+func (kb *k8sBackend) attach(pid int) (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	var errMsh *errco.Error
+	kb.client, errMsh = newK8sClient()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("attach")
+	}
+
+	kb.selector, errMsh = kb.podSelector()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("attach")
+	}
+
+	// the workload is still scaled up: follow its pods without scaling
+	outR, errR, inW := kb.follow()
+
+	return outR, errR, inW, nil
+}
+
+// follow streams the workload pod logs and watches pod readiness
+func (kb *k8sBackend) follow() (io.ReadCloser, io.ReadCloser, io.WriteCloser) {
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	kb.doneC = make(chan bool)
+
+	go kb.followLogs(outW)
+	go kb.watchReadiness()
+
+	// stderr is merged into pod logs
+	errW.Close()
+
+	return outR, errR, &k8sStdin{}
+}
+
+func (kb *k8sBackend) stop() *errco.Error {
+	errMsh := kb.scale(0)
+	if errMsh != nil {
+		return errMsh.AddTrace("stop")
+	}
+
+	statusM.Lock()
+	defer statusM.Unlock()
+
+	if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
+		errco.LogState("MINECRAFT SERVER IS STOPPING!")
+		events.Publish(events.SERVER_STOPPING, nil)
+	}
+
+	return nil
+}
+
+func (kb *k8sBackend) wait() error {
+	<-kb.doneC
+
+	// wait for all the workload pods to be deleted
+	for {
+		pods, errMsh := kb.pods()
+		if errMsh != nil {
+			return fmt.Errorf("%s", errMsh.Str)
+		}
+		if len(pods) == 0 {
+			return nil
+		}
+		time.Sleep(k8sPollInterval)
+	}
+}
+
+func (kb *k8sBackend) terminate() error {
+	// pods of a scaled down workload are terminated gracefully (SIGTERM)
+	errMsh := kb.scale(0)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (kb *k8sBackend) kill() error {
+	errMsh := kb.scale(0)
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	pods, errMsh := kb.pods()
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+	for _, p := range pods {
+		errMsh = kb.client.request(http.MethodDelete, "/api/v1/namespaces/"+kb.namespace()+"/pods/"+p.name+"?gracePeriodSeconds=0", "", nil, nil)
+		if errMsh != nil {
+			return fmt.Errorf("%s", errMsh.Str)
+		}
+	}
+
+	return nil
+}
+
+func (kb *k8sBackend) pid() int {
+	return -1
+}
+
+// followLogs streams the logs of the workload pod to w while the workload is scaled up.
+// If the pod is restarted or replaced, the logs of the new pod are streamed.
+// If the stream of the same pod is interrupted, it's resumed from the last line received.
+// [goroutine]
+func (kb *k8sBackend) followLogs(w *io.PipeWriter) {
+	defer close(kb.doneC)
+	defer w.Close()
+
+	var pod string     // pod of the last log stream
+	var last time.Time // timestamp of the last log line received from pod
+
+	for {
+		replicas, errMsh := kb.replicas()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("followLogs"))
+			time.Sleep(k8sPollInterval)
+			continue
+		}
+		if replicas == 0 {
+			return
+		}
+
+		// wait for a running pod
+		pods, errMsh := kb.pods()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("followLogs"))
+			time.Sleep(k8sPollInterval)
+			continue
+		}
+		var running string
+		for _, p := range pods {
+			if p.phase == "Running" {
+				running = p.name
+				break
+			}
+		}
+		if running == "" {
+			time.Sleep(k8sPollInterval)
+			continue
+		}
+
+		path := "/api/v1/namespaces/" + kb.namespace() + "/pods/" + running + "/log?follow=true&timestamps=true"
+		if running == pod && !last.IsZero() {
+			errco.Logln(errco.LVL_D, "followLogs: resuming logs of pod %s since %s", running, last.Format(time.RFC3339Nano))
+			path += "&sinceTime=" + url.QueryEscape(last.UTC().Format(time.RFC3339))
+		} else {
+			errco.Logln(errco.LVL_D, "followLogs: streaming logs of pod %s", running)
+			pod, last = running, time.Time{}
+		}
+
+		resp, errMsh := kb.client.stream(path)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("followLogs"))
+			time.Sleep(k8sPollInterval)
+			continue
+		}
+		last = copyLogs(w, resp.Body, last)
+		resp.Body.Close()
+	}
+}
+
+// copyLogs writes to w the lines of a pod log stream (timestamps=true) received after since, without timestamp.
+// Returns the timestamp of the last line written.
+func copyLogs(w io.Writer, r io.Reader, since time.Time) time.Time {
+	br := bufio.NewReader(r)
+
+	for {
+		line, err := br.ReadString('\n')
+
+		// "2006-01-02T15:04:05.999999999Z <line>"
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			if t, errT := time.Parse(time.RFC3339Nano, line[:i]); errT == nil {
+				// sinceTime has a precision of seconds: lines already received are streamed again
+				if !t.After(since) {
+					line = ""
+				} else {
+					since = t
+					line = line[i+1:]
+				}
+			}
+		}
+
+		if line != "" {
+			if _, errW := io.WriteString(w, line); errW != nil {
+				return since
+			}
+		}
+		if err != nil {
+			return since
+		}
+	}
+}
+
+// watchReadiness sets the minecraft server online when a workload pod is ready
+// [goroutine]
+func (kb *k8sBackend) watchReadiness() {
+	for {
+		select {
+		case <-kb.doneC:
+			return
+		case <-time.After(k8sPollInterval):
+		}
+
+		if servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+			continue
+		}
+
+		pods, errMsh := kb.pods()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("watchReadiness"))
+			continue
+		}
+		for _, p := range pods {
+			if p.ready {
+				errco.Logln(errco.LVL_D, "watchReadiness: pod %s is ready", p.name)
+				setOnline()
+				break
+			}
+		}
+	}
+}
+
+// k8sPod is the status of a workload pod
+type k8sPod struct {
+	name  string
+	phase string
+	ready bool
+}
+
+// pods returns the workload pods
+func (kb *k8sBackend) pods() ([]k8sPod, *errco.Error) {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Phase      string `json:"phase"`
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	errMsh := kb.client.request(http.MethodGet, "/api/v1/namespaces/"+kb.namespace()+"/pods?labelSelector="+url.QueryEscape(kb.selector), "", nil, &list)
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("pods")
+	}
+
+	pods := []k8sPod{}
+	for _, item := range list.Items {
+		p := k8sPod{name: item.Metadata.Name, phase: item.Status.Phase}
+		for _, c := range item.Status.Conditions {
+			if c.Type == "Ready" && c.Status == "True" {
+				p.ready = true
+			}
+		}
+		pods = append(pods, p)
+	}
+
+	return pods, nil
+}
+
+// podSelector returns the label selector of the workload pods
+func (kb *k8sBackend) podSelector() (string, *errco.Error) {
+	var workload struct {
+		Spec struct {
+			Selector struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"selector"`
+		} `json:"spec"`
+	}
+	errMsh := kb.client.request(http.MethodGet, kb.workloadPath(), "", nil, &workload)
+	if errMsh != nil {
+		return "", errMsh.AddTrace("podSelector")
+	}
+	if len(workload.Spec.Selector.MatchLabels) == 0 {
+		return "", errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "podSelector", "workload has no selector matchLabels")
+	}
+
+	labels := []string{}
+	for k, v := range workload.Spec.Selector.MatchLabels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ","), nil
+}
+
+// replicas returns the desired replicas of the workload
+func (kb *k8sBackend) replicas() (int, *errco.Error) {
+	var scale struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+		} `json:"spec"`
+	}
+	errMsh := kb.client.request(http.MethodGet, kb.workloadPath()+"/scale", "", nil, &scale)
+	if errMsh != nil {
+		return -1, errMsh.AddTrace("replicas")
+	}
+
+	return scale.Spec.Replicas, nil
+}
+
+// scale sets the desired replicas of the workload
+func (kb *k8sBackend) scale(replicas int) *errco.Error {
+	errco.Logln(errco.LVL_D, "scaling %s %s to %d replicas", config.ConfigRuntime.Kubernetes.Kind, config.ConfigRuntime.Kubernetes.Name, replicas)
+
+	body := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	errMsh := kb.client.request(http.MethodPatch, kb.workloadPath()+"/scale", "application/merge-patch+json", body, nil)
+	if errMsh != nil {
+		return errMsh.AddTrace("scale")
+	}
+
+	return nil
+}
+
+// workloadPath returns the api path of the workload (deployment or statefulset)
+func (kb *k8sBackend) workloadPath() string {
+	kind := "deployments"
+	if strings.ToLower(config.ConfigRuntime.Kubernetes.Kind) == "statefulset" {
+		kind = "statefulsets"
+	}
+
+	return "/apis/apps/v1/namespaces/" + kb.namespace() + "/" + kind + "/" + config.ConfigRuntime.Kubernetes.Name
+}
+
+// namespace returns the workload namespace (default "default")
+func (kb *k8sBackend) namespace() string {
+	if config.ConfigRuntime.Kubernetes.Namespace == "" {
+		return "default"
+	}
+
+	return config.ConfigRuntime.Kubernetes.Namespace
+}
+
+// k8sStdin rejects console input since pod attach is not supported
+type k8sStdin struct{}
+
+func (k8sStdin) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("console input is not supported by kubernetes backend")
+}
+
+func (k8sStdin) Close() error {
+	return nil
+}
+
+// k8sClient contains address and credentials of the kubernetes api server
+type k8sClient struct {
+	server     string
+	token      string
+	http       *http.Client // client of the api requests (k8sRequestTimeout)
+	streamHttp *http.Client // client of the streams (no timeout, same transport)
+}
+
+// k8sRequestTimeout is the maximum duration of a kubernetes api request (streams excluded)
+const k8sRequestTimeout = 15 * time.Second
+
+// setTLS builds the http clients of the kubernetes api with the tls config
+func (c *k8sClient) setTLS(tlsConfig *tls.Config) {
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	c.http = &http.Client{Transport: transport, Timeout: k8sRequestTimeout}
+	c.streamHttp = &http.Client{Transport: transport}
+}
+
+// newK8sClient returns a kubernetes api client configured from Kubernetes.Kubeconfig
+// or from the pod service account (in-cluster) if not set
+func newK8sClient() (*k8sClient, *errco.Error) {
+	if config.ConfigRuntime.Kubernetes.Kubeconfig != "" {
+		c, errMsh := kubeconfigClient(config.ConfigRuntime.Kubernetes.Kubeconfig)
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("newK8sClient")
+		}
+		return c, nil
+	}
+
+	const saDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "newK8sClient", "msh is not running in a kubernetes cluster: set Kubernetes.Kubeconfig")
+	}
+
+	token, err := ioutil.ReadFile(saDir + "token")
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "newK8sClient", err.Error())
+	}
+	ca, err := ioutil.ReadFile(saDir + "ca.crt")
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "newK8sClient", err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	c := &k8sClient{
+		server: "https://" + net.JoinHostPort(host, port),
+		token:  strings.TrimSpace(string(token)),
+	}
+	c.setTLS(&tls.Config{RootCAs: pool})
+
+	return c, nil
+}
+
+// kubeconfigClient returns a kubernetes api client configured from a kubeconfig file:
+// the cluster and the user of the current-context are used.
+func kubeconfigClient(path string) (*k8sClient, *errco.Error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigClient", err.Error())
+	}
+
+	kc := parseKubeconfig(data)
+
+	ctxName := kc.currentContext
+	if ctxName == "" && len(kc.lists["contexts"]) == 1 {
+		for name := range kc.lists["contexts"] {
+			ctxName = name
+		}
+	}
+	ctx, ok := kc.lists["contexts"][ctxName]
+	if !ok {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigClient", "current-context not found in kubeconfig: "+ctxName)
+	}
+	cluster, ok := kc.lists["clusters"][ctx["cluster"]]
+	if !ok {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigClient", "cluster of context "+ctxName+" not found in kubeconfig: "+ctx["cluster"])
+	}
+	// the context user is optional (ex: cluster without authentication)
+	user := kc.lists["users"][ctx["user"]]
+
+	errco.Logln(errco.LVL_D, "kubeconfigClient: using context %s (cluster %s, user %s)", ctxName, ctx["cluster"], ctx["user"])
+
+	c := &k8sClient{server: strings.TrimSuffix(cluster["server"], "/"), token: user["token"]}
+	if c.server == "" {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigClient", "server of cluster "+ctx["cluster"]+" not found in kubeconfig")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster["insecure-skip-tls-verify"] == "true"}
+
+	ca, errMsh := kubeconfigData(cluster, "certificate-authority")
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("kubeconfigClient")
+	}
+	if ca != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(ca)
+	}
+
+	cert, errMsh := kubeconfigData(user, "client-certificate")
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("kubeconfigClient")
+	}
+	key, errMsh := kubeconfigData(user, "client-key")
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("kubeconfigClient")
+	}
+	if cert != nil && key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigClient", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	c.setTLS(tlsConfig)
+
+	return c, nil
+}
+
+// kubeconfig contains the values of a kubeconfig file used by msh
+type kubeconfig struct {
+	currentContext string
+	lists          map[string]map[string]map[string]string // clusters, contexts and users: values of each entry by entry name
+}
+
+// parseKubeconfig reads the clusters, contexts and users of a kubeconfig file and its current-context.
+// kubeconfig is yaml: only the block style written by kubectl is supported, the values nested in an entry
+// are read as flat keys (ex: "server" of a cluster, "token" of a user).
+func parseKubeconfig(data []byte) kubeconfig {
+	kc := kubeconfig{lists: map[string]map[string]map[string]string{}}
+
+	var (
+		list        string            // current top level list (empty if not clusters, contexts or users)
+		entry       map[string]string // values of the current list entry
+		entryIndent = -1              // indentation of the "- " of the current list entries
+	)
+
+	// addEntry adds the current entry to its list
+	addEntry := func() {
+		if entry != nil && entry["name"] != "" {
+			kc.lists[list][entry["name"]] = entry
+		}
+		entry = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(text) - len(trimmed)
+
+		kv := strings.SplitN(strings.TrimPrefix(trimmed, "- "), ":", 2)
+		key := strings.TrimSpace(kv[0])
+		value := ""
+		if len(kv) == 2 {
+			value = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		}
+
+		// top level key
+		if indent == 0 && !strings.HasPrefix(trimmed, "- ") {
+			addEntry()
+			list, entryIndent = "", -1
+			switch key {
+			case "clusters", "contexts", "users":
+				list = key
+				kc.lists[list] = map[string]map[string]string{}
+			case "current-context":
+				kc.currentContext = value
+			}
+			continue
+		}
+
+		if list == "" {
+			continue
+		}
+
+		// new list entry
+		if strings.HasPrefix(trimmed, "- ") && (entryIndent == -1 || indent == entryIndent) {
+			addEntry()
+			entryIndent = indent
+			entry = map[string]string{}
+		}
+		if entry == nil || value == "" {
+			continue
+		}
+
+		// the entry name is at the entry level, nested values keep the first occurrence
+		keyIndent := indent
+		if strings.HasPrefix(trimmed, "- ") {
+			keyIndent += 2
+		}
+		if key == "name" {
+			if keyIndent == entryIndent+2 {
+				entry["name"] = value
+			}
+			continue
+		}
+		if _, ok := entry[key]; !ok {
+			entry[key] = value
+		}
+	}
+	addEntry()
+
+	return kc
+}
+
+// kubeconfigData returns the content of a kubeconfig "<key>-data" (base64) or "<key>" (file path) value
+func kubeconfigData(values map[string]string, key string) ([]byte, *errco.Error) {
+	if v, ok := values[key+"-data"]; ok {
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigData", key+"-data is not valid: "+err.Error())
+		}
+		return data, nil
+	}
+
+	if v, ok := values[key]; ok {
+		data, err := ioutil.ReadFile(v)
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "kubeconfigData", err.Error())
+		}
+		return data, nil
+	}
+
+	return nil, nil
+}
+
+// request sends a request to the kubernetes api and decodes the json response into result (if not nil)
+func (c *k8sClient) request(method, path, contentType string, body []byte, result interface{}) *errco.Error {
+	req, err := http.NewRequest(method, c.server+path, bytes.NewReader(body))
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "request", err.Error())
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "request", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "request", fmt.Sprintf("kubernetes api %s %s: %s %s", method, path, resp.Status, apiErr.Message))
+	}
+
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "request", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// stream sends a GET request to the kubernetes api and returns the response to be read as a stream
+func (c *k8sClient) stream(path string) (*http.Response, *errco.Error) {
+	req, err := http.NewRequest(http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "stream", err.Error())
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// streams have no timeout
+	resp, err := c.streamHttp.Do(req)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "stream", err.Error())
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "stream", "kubernetes api GET "+path+": "+resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// keepAliveFileName is the file where the keep-alive override is persisted
+const keepAliveFileName string = "msh-keepalive.json"
+
+// keepAliveInterval is the time between two keep-alive expiration checks
+const keepAliveInterval = 30 * time.Second
+
+// keepAliveBlocked is set to 1 when the hibernation of the empty server is prevented by the keep-alive
+// (accessed atomically)
+var keepAliveBlocked int32
+
+// KeepAliveMode is a keep-alive override: the empty minecraft server is not hibernated until it expires
+// (ex: AFK farms or long automated tasks with no player online)
+type KeepAliveMode struct {
+	Time  time.Time `json:"time"`  // time the keep-alive was set
+	Until time.Time `json:"until"` // time the keep-alive expires
+}
+
+// KeepAlive suspends the hibernation of the empty minecraft server for duration d.
+// The keep-alive is persisted to the keep-alive file so that it's honored across msh restarts
+// (and by a running msh instance when set from the command line).
+func KeepAlive(d time.Duration) (*KeepAliveMode, *errco.Error) {
+	if d <= 0 {
+		return nil, errco.NewErr(errco.ERROR_KEEPALIVE_FILE, errco.LVL_B, "KeepAlive", "keep-alive duration must be positive")
+	}
+
+	k := &KeepAliveMode{Time: time.Now(), Until: time.Now().Add(d)}
+
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_KEEPALIVE_FILE, errco.LVL_B, "KeepAlive", err.Error())
+	}
+
+	err = ioutil.WriteFile(keepAliveFileName, data, 0644)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_KEEPALIVE_FILE, errco.LVL_B, "KeepAlive", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "minecraft server kept alive until %s: hibernation of the empty server suspended", k.Until.Format("2006/01/02 15:04"))
+
+	return k, nil
+}
+
+// EndKeepAlive removes the keep-alive override
+func EndKeepAlive() *errco.Error {
+	err := os.Remove(keepAliveFileName)
+	if os.IsNotExist(err) {
+		return errco.NewErr(errco.ERROR_KEEPALIVE_FILE, errco.LVL_B, "EndKeepAlive", "minecraft server is not kept alive")
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_KEEPALIVE_FILE, errco.LVL_B, "EndKeepAlive", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "keep-alive removed")
+
+	return nil
+}
+
+// KeepAliveCommand sets the keep-alive for the duration arg or, if arg is "off", removes it
+// (console, command line and game chat "keepalive <duration|off>" argument).
+// The keep-alive set is returned (nil if removed).
+func KeepAliveCommand(arg string) (*KeepAliveMode, *errco.Error) {
+	if arg == "off" {
+		errMsh := EndKeepAlive()
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("KeepAliveCommand")
+		}
+		return nil, nil
+	}
+
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_COMMAND_INPUT, errco.LVL_B, "KeepAliveCommand", "specify keep-alive duration or off (ex: keepalive 2h)")
+	}
+
+	k, errMsh := KeepAlive(d)
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("KeepAliveCommand")
+	}
+
+	return k, nil
+}
+
+// KeepAliveStatus returns the active keep-alive override (nil if not set).
+// An expired keep-alive is removed.
+func KeepAliveStatus() *KeepAliveMode {
+	data, err := ioutil.ReadFile(keepAliveFileName)
+	if err != nil {
+		return nil
+	}
+
+	k := &KeepAliveMode{}
+	err = json.Unmarshal(data, k)
+	if err != nil {
+		// a damaged keep-alive file must not keep the server online forever
+		errco.LogMshErr(errco.NewErr(errco.ERROR_KEEPALIVE_FILE, errco.LVL_B, "KeepAliveStatus", "keep-alive file is not valid, ignoring it: "+err.Error()))
+		return nil
+	}
+
+	if time.Now().After(k.Until) {
+		errco.Logln(errco.LVL_B, "keep-alive expired")
+		os.Remove(keepAliveFileName)
+		return nil
+	}
+
+	return k
+}
+
+// KeepAliveManager requests an empty server check when the keep-alive override ends,
+// so that a minecraft server kept online by the keep-alive is hibernated if empty.
+// [goroutine]
+func KeepAliveManager() {
+	for {
+		time.Sleep(keepAliveInterval)
+
+		if atomic.LoadInt32(&keepAliveBlocked) == 0 || KeepAliveStatus() != nil {
+			continue
+		}
+		atomic.StoreInt32(&keepAliveBlocked, 0)
+
+		if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+			errco.Logln(errco.LVL_B, "keep-alive ended: minecraft server will hibernate if empty")
+			StopMSRequest()
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/locale"
+)
+
+// lockFileName is the file where the administrative lock is persisted
+const lockFileName string = "msh-lock.json"
+
+// AdminLock is an administrative lock that prevents the minecraft server from waking up
+type AdminLock struct {
+	Time   time.Time `json:"time"`   // time the lock was set
+	Until  time.Time `json:"until"`  // time the lock expires (zero: until unlocked)
+	Reason string    `json:"reason"` // reason shown to players
+}
+
+// Lock prevents the minecraft server from waking up for duration d (0: until unlocked).
+// The lock is persisted to the lock file so that it's honored across msh restarts
+// (and by a running msh instance when set from the command line).
+func Lock(d time.Duration, reason string) *errco.Error {
+	l := &AdminLock{Time: time.Now(), Reason: reason}
+	if d > 0 {
+		l.Until = l.Time.Add(d)
+	}
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return errco.NewErr(errco.ERROR_LOCK_FILE, errco.LVL_B, "Lock", err.Error())
+	}
+
+	err = ioutil.WriteFile(lockFileName, data, 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_LOCK_FILE, errco.LVL_B, "Lock", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "minecraft server locked by admin until %s", l.untilString())
+
+	return nil
+}
+
+// Unlock removes the administrative lock
+func Unlock() *errco.Error {
+	err := os.Remove(lockFileName)
+	if os.IsNotExist(err) {
+		return errco.NewErr(errco.ERROR_LOCK_FILE, errco.LVL_B, "Unlock", "minecraft server is not locked")
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_LOCK_FILE, errco.LVL_B, "Unlock", err.Error())
+	}
+
+	errco.Logln(errco.LVL_B, "minecraft server unlocked")
+
+	return nil
+}
+
+// LockStatus returns the active administrative lock (nil if the minecraft server is not locked).
+// An expired lock is removed.
+func LockStatus() *AdminLock {
+	data, err := ioutil.ReadFile(lockFileName)
+	if err != nil {
+		return nil
+	}
+
+	l := &AdminLock{}
+	err = json.Unmarshal(data, l)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_LOCK_FILE, errco.LVL_B, "LockStatus", "lock file is not valid, minecraft server is locked until it's fixed: "+err.Error()))
+		return &AdminLock{Reason: "lock file is not valid"}
+	}
+
+	if !l.Until.IsZero() && time.Now().After(l.Until) {
+		errco.Logln(errco.LVL_B, "administrative lock expired")
+		os.Remove(lockFileName)
+		return nil
+	}
+
+	return l
+}
+
+// Message returns the message shown to players while the minecraft server is locked (Msh.InfoLocked)
+func (l *AdminLock) Message() string {
+	return strings.NewReplacer("<until>", l.untilString(), "<reason>", l.Reason).Replace(config.ConfigRuntime.Msh.InfoLocked)
+}
+
+// untilString returns the lock expiration as text
+func (l *AdminLock) untilString() string {
+	if l.Until.IsZero() {
+		return locale.T("lock.no-expiration")
+	}
+
+	return l.Until.Format("2006/01/02 15:04")
+}
+
+// checkLock returns an error if the minecraft server is locked by an admin
+func checkLock() *errco.Error {
+	l := LockStatus()
+	if l == nil {
+		return nil
+	}
+
+	return errco.NewErr(errco.ERROR_SERVER_LOCKED, errco.LVL_B, "checkLock", l.Message())
+}
@@ -0,0 +1,100 @@
+package servctrl
+
+import (
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// periodInterval is the time between two hibernation period checks
+const periodInterval = 30 * time.Second
+
+// hibernationPeriod returns the index of the first HibernationPeriods entry active at t (-1 if none)
+func hibernationPeriod(t time.Time) int {
+	minutes := t.Hour()*60 + t.Minute()
+
+	for i, p := range config.ConfigRuntime.HibernationPeriods {
+		from, err1 := time.Parse("15:04", p.From)
+		to, err2 := time.Parse("15:04", p.To)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		fromM, toM := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+
+		// day on which the period started (periods can span midnight)
+		day := t
+		switch {
+		case fromM <= toM && minutes >= fromM && minutes < toM:
+		case fromM > toM && minutes >= fromM:
+		case fromM > toM && minutes < toM:
+			day = t.AddDate(0, 0, -1)
+		default:
+			continue
+		}
+
+		if len(p.Days) > 0 && !periodDay(p.Days, day) {
+			continue
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// periodDay returns true if the weekday of t is in days ("mon" - "tue" - ... - "sun")
+func periodDay(days []string, t time.Time) bool {
+	for _, d := range days {
+		if strings.EqualFold(d, t.Weekday().String()[:3]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IdleTimeout returns the time an empty minecraft server is kept online now
+func IdleTimeout() time.Duration {
+	return idleTimeout(time.Now())
+}
+
+// idleTimeout returns the time an empty minecraft server is kept online at t
+// (TimeBeforeStoppingEmptyServer of the active hibernation period or of Msh config)
+func idleTimeout(t time.Time) time.Duration {
+	if i := hibernationPeriod(t); i >= 0 && config.ConfigRuntime.HibernationPeriods[i].TimeBeforeStoppingEmptyServer > 0 {
+		return time.Duration(config.ConfigRuntime.HibernationPeriods[i].TimeBeforeStoppingEmptyServer) * time.Second
+	}
+
+	return time.Duration(config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer) * time.Second
+}
+
+// alwaysOn returns true if hibernation is disabled at t by the active hibernation period
+func alwaysOn(t time.Time) bool {
+	i := hibernationPeriod(t)
+	return i >= 0 && config.ConfigRuntime.HibernationPeriods[i].AlwaysOn
+}
+
+// PeriodManager requests an empty server check when an always-on hibernation period ends,
+// so that a minecraft server kept online by the period is hibernated if empty.
+// [goroutine]
+func PeriodManager() {
+	if len(config.ConfigRuntime.HibernationPeriods) == 0 {
+		return
+	}
+
+	wasAlwaysOn := alwaysOn(time.Now())
+
+	for {
+		time.Sleep(periodInterval)
+
+		isAlwaysOn := alwaysOn(time.Now())
+		if wasAlwaysOn && !isAlwaysOn && servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+			errco.Logln(errco.LVL_B, "always-on hibernation period ended: minecraft server will hibernate if empty")
+			StopMSRequest()
+		}
+		wasAlwaysOn = isAlwaysOn
+	}
+}
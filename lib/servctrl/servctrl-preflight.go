@@ -0,0 +1,223 @@
+package servctrl
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// javaVersionRe matches the version printed by "java -version" (ex: version "17.0.2", version "1.8.0_292")
+var javaVersionRe = regexp.MustCompile(`version "(\d+)(?:\.(\d+))?`)
+
+// preflight checks, before the minecraft server is started, that the world volume has enough free space
+// (Preflight.MinFreeDiskMB) and that java meets the minimum version required by the server jar (Preflight.CheckJava).
+// A full disk corrupts the world files that are being saved.
+func preflight() *errco.Error {
+	errMsh := checkDiskSpace()
+	if errMsh != nil {
+		return errMsh.AddTrace("preflight")
+	}
+
+	// java is run by msh only with the process backend
+	if config.ConfigRuntime.Preflight.CheckJava && (config.ConfigRuntime.Server.Backend == "" || config.ConfigRuntime.Server.Backend == "process") {
+		errMsh = checkJava()
+		if errMsh != nil {
+			return errMsh.AddTrace("preflight")
+		}
+	}
+
+	return nil
+}
+
+// checkDiskSpace returns an error if the server folder volume has less than Preflight.MinFreeDiskMB free
+func checkDiskSpace() *errco.Error {
+	if config.ConfigRuntime.Preflight.MinFreeDiskMB <= 0 || config.ConfigRuntime.Server.Backend == "kubernetes" || config.ConfigRuntime.Server.Backend == "pterodactyl" {
+		return nil
+	}
+	minFree := uint64(config.ConfigRuntime.Preflight.MinFreeDiskMB) * 1024 * 1024
+
+	free, errMsh := opsys.DiskFree(config.ConfigRuntime.Server.Folder)
+	if errMsh != nil {
+		// the check can't be performed: it should not prevent the server start
+		errco.LogMshErr(errMsh.AddTrace("checkDiskSpace"))
+		return nil
+	}
+
+	if free < minFree {
+		return errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_B, "checkDiskSpace",
+			fmt.Sprintf("only %d MB free on the server folder volume (%d MB required by Preflight.MinFreeDiskMB): free some space before starting the server", free/1024/1024, config.ConfigRuntime.Preflight.MinFreeDiskMB))
+	}
+
+	return nil
+}
+
+// checkJava returns an error if the java binary of the start command is not found
+// or does not meet the minimum java version (Preflight.JavaMinVersion, or detected from the server jar if 0)
+func checkJava() *errco.Error {
+	cSplit := splitCommand(config.ConfigRuntime.Commands.StartServer)
+	if len(cSplit) == 0 {
+		return nil
+	}
+
+	// the start command might be a script: only java commands are checked
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(cSplit[0]), filepath.Ext(cSplit[0])))
+	if name != "java" && name != "javaw" {
+		errco.Logln(errco.LVL_D, "checkJava: start command does not run java directly, java check skipped")
+		return nil
+	}
+
+	javaPath := cSplit[0]
+	if strings.ContainsAny(javaPath, `/\`) && !filepath.IsAbs(javaPath) {
+		javaPath = filepath.Join(startDir(), javaPath)
+	}
+	javaPath, err := exec.LookPath(javaPath)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_B, "checkJava", "java not found ("+cSplit[0]+"): install java or set its path in Commands.StartServer")
+	}
+
+	version, errMsh := javaVersion(javaPath)
+	if errMsh != nil {
+		// the version can't be detected: it should not prevent the server start
+		errco.LogMshErr(errMsh.AddTrace("checkJava"))
+		return nil
+	}
+
+	required := config.ConfigRuntime.Preflight.JavaMinVersion
+	if required <= 0 {
+		jarPath := filepath.Join(config.ConfigRuntime.Server.Folder, config.ConfigRuntime.Server.FileName)
+		required, errMsh = jarJavaVersion(jarPath)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("checkJava"))
+			return nil
+		}
+	}
+
+	errco.Logln(errco.LVL_D, "checkJava: java %d found (%s), java %d required", version, javaPath, required)
+
+	if version < required {
+		return errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_B, "checkJava",
+			fmt.Sprintf("java %d found (%s) but the minecraft server requires java %d or newer: install it and set its path in Commands.StartServer", version, javaPath, required))
+	}
+
+	return nil
+}
+
+// startDir returns the working directory of the minecraft server process
+func startDir() string {
+	wd := config.ConfigRuntime.Commands.StartServerWorkDir
+	switch {
+	case wd == "":
+		return config.ConfigRuntime.Server.Folder
+	case filepath.IsAbs(wd):
+		return wd
+	default:
+		return filepath.Join(config.ConfigRuntime.Server.Folder, wd)
+	}
+}
+
+// javaVersion returns the major version of the java binary at javaPath
+func javaVersion(javaPath string) (int, *errco.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// "java -version" prints to stderr
+	out, err := exec.CommandContext(ctx, javaPath, "-version").CombinedOutput()
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "javaVersion", "java -version failed: "+err.Error())
+	}
+
+	m := javaVersionRe.FindStringSubmatch(string(out))
+	if m == nil {
+		return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "javaVersion", "java version not found in: "+strings.TrimSpace(string(out)))
+	}
+
+	// java 8 and older report "1.<major>"
+	major, _ := strconv.Atoi(m[1])
+	if major == 1 && m[2] != "" {
+		major, _ = strconv.Atoi(m[2])
+	}
+
+	return major, nil
+}
+
+// jarJavaVersion returns the minimum java version required by the server jar at jarPath
+// (class file version of its main class). Bundler jars (minecraft 1.18+) are inspected through the bundled server jar.
+func jarJavaVersion(jarPath string) (int, *errco.Error) {
+	zr, err := zip.OpenReader(jarPath)
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "jarJavaVersion", err.Error())
+	}
+	defer zr.Close()
+
+	r := &zr.Reader
+
+	// the bundler jar lists the bundled server jar in META-INF/versions.list ("<hash>\t<id>\t<path>")
+	if list, err := readZipFile(r, "META-INF/versions.list"); err == nil {
+		fields := strings.Split(strings.TrimSpace(string(list)), "\t")
+		if len(fields) == 3 {
+			data, err := readZipFile(r, "META-INF/versions/"+fields[2])
+			if err != nil {
+				return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "jarJavaVersion", "bundled server jar: "+err.Error())
+			}
+			r, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "jarJavaVersion", "bundled server jar: "+err.Error())
+			}
+		}
+	}
+
+	// main class of the jar (bundled server jars have no manifest)
+	mainClass := "net.minecraft.server.Main"
+	if manifest, err := readZipFile(r, "META-INF/MANIFEST.MF"); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(manifest))
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "Main-Class:") {
+				mainClass = strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "Main-Class:"))
+			}
+		}
+	}
+
+	class, err := readZipFile(r, strings.ReplaceAll(mainClass, ".", "/")+".class")
+	if err != nil {
+		return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "jarJavaVersion", "main class "+mainClass+": "+err.Error())
+	}
+	if len(class) < 8 || binary.BigEndian.Uint32(class) != 0xcafebabe {
+		return 0, errco.NewErr(errco.ERROR_PREFLIGHT, errco.LVL_D, "jarJavaVersion", "main class "+mainClass+" is not a java class")
+	}
+
+	// class file major version 52 is java 8, 61 is java 17
+	return int(binary.BigEndian.Uint16(class[6:8])) - 44, nil
+}
+
+// readZipFile returns the content of the file at name in the zip archive
+func readZipFile(r *zip.Reader, name string) ([]byte, error) {
+	for _, f := range r.File {
+		if f.Name != name {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		return ioutil.ReadAll(rc)
+	}
+
+	return nil, fmt.Errorf("%s not found", name)
+}
@@ -0,0 +1,73 @@
+package servctrl
+
+import (
+	"fmt"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+// PriorityManager adjusts the minecraft server process priority depending on the server phase:
+// Priority.Starting while starting (to reduce wake up time), Priority.Online while players are online
+// and Priority.Empty while the server is online but empty.
+// If Priority.EmptyCpus is set, the empty server is also restricted to those cpus (restored when a player joins).
+// [goroutine]
+func PriorityManager() {
+	if !config.ConfigRuntime.Priority.Enabled {
+		return
+	}
+
+	eventC := events.Subscribe(10)
+
+	for e := range eventC {
+		var nice int
+		empty := false
+		switch e.Type {
+		case events.SERVER_STARTING:
+			nice = config.ConfigRuntime.Priority.Starting
+		case events.SERVER_ONLINE, events.PLAYER_JOIN, events.PLAYER_LEAVE:
+			nice = config.ConfigRuntime.Priority.Online
+			if servstats.Stats.PlayerCount <= 0 {
+				nice = config.ConfigRuntime.Priority.Empty
+				empty = true
+			}
+		default:
+			continue
+		}
+
+		pid := ServTerm.Pid()
+		if pid <= 0 {
+			continue
+		}
+
+		errMsh := opsys.SetPriority(pid, nice)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("PriorityManager"))
+			continue
+		}
+
+		errco.Logln(errco.LVL_D, "PriorityManager: minecraft server niceness set to %d (%s)", nice, e.Type)
+
+		if len(config.ConfigRuntime.Priority.EmptyCpus) == 0 || e.Type == events.SERVER_STARTING {
+			continue
+		}
+
+		// a new minecraft server process inherits the affinity of msh: only the online server is restricted
+		var cpus []int
+		cpusText := "msh cpus"
+		if empty {
+			cpus = config.ConfigRuntime.Priority.EmptyCpus
+			cpusText = fmt.Sprint(cpus)
+		}
+		errMsh = opsys.SetAffinity(pid, cpus)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("PriorityManager"))
+			continue
+		}
+
+		errco.Logln(errco.LVL_D, "PriorityManager: minecraft server cpu affinity set to %s (%s)", cpusText, e.Type)
+	}
+}
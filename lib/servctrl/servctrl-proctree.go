@@ -0,0 +1,119 @@
+package servctrl
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// treeCheckInterval is the time between two lookups of the minecraft server java process in the process tree
+const treeCheckInterval = 5 * time.Second
+
+// treeBackend is implemented by backends whose minecraft server java process can be a descendant
+// of the process they started (ex: start command running a wrapper script)
+type treeBackend interface {
+	// serverPid returns the pid of the minecraft server java process (-1 if not available)
+	serverPid() int
+}
+
+// ServerPid returns the pid of the minecraft server java process (-1 if terminal is not active).
+// It differs from Pid when the server is started by a wrapper script (ex: run.sh or run.bat of forge modpacks).
+func (st *servTerminal) ServerPid() int {
+	if !st.IsActive || st.backend == nil {
+		return -1
+	}
+
+	if tb, ok := st.backend.(treeBackend); ok {
+		return tb.serverPid()
+	}
+
+	return st.backend.pid()
+}
+
+// serverProcess tracks the minecraft server java process in the process tree of the process started by msh.
+// Modpacks are often started by wrapper scripts that run java as a child process: resource monitoring must
+// sample the java process and msh must wait for it to exit, since the wrapper can exit first.
+type serverProcess struct {
+	m    sync.Mutex
+	root int // pid of the process started by msh
+	java int // pid of the java process (root if java is not found in the tree)
+}
+
+// get returns the pid of the java process in the process tree of root (root if java is not found)
+func (sp *serverProcess) get(root int) int {
+	sp.m.Lock()
+	defer sp.m.Unlock()
+
+	if sp.root == root && sp.java > 0 && opsys.ProcessAlive(sp.java) {
+		return sp.java
+	}
+
+	java := root
+	tree, errMsh := opsys.ProcessTree(root)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("get"))
+	}
+	for _, p := range tree {
+		if isJava(p.Name) {
+			java = p.Pid
+			break
+		}
+	}
+
+	if java != root && (sp.root != root || sp.java != java) {
+		errco.Logln(errco.LVL_B, "minecraft server java process %d is a child of the start command process %d (wrapper script)", java, root)
+	}
+
+	// java is looked up again until found (the wrapper script might not have started it yet)
+	sp.root = root
+	sp.java = java
+	if java == root {
+		sp.java = 0
+	}
+
+	return java
+}
+
+// track looks up the java process in the process tree of root until doneC is closed,
+// so that it is known when the wrapper script exits
+// [goroutine]
+func (sp *serverProcess) track(root int, doneC chan bool) {
+	t := time.NewTicker(treeCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-doneC:
+			return
+		case <-t.C:
+			sp.get(root)
+		}
+	}
+}
+
+// waitExit waits for the java process to exit after the process started by msh exited.
+// [blocking]
+func (sp *serverProcess) waitExit() {
+	sp.m.Lock()
+	java := sp.java
+	sp.m.Unlock()
+
+	if java <= 0 || !opsys.ProcessAlive(java) {
+		return
+	}
+
+	errco.Logln(errco.LVL_B, "start command process exited, waiting for minecraft server java process %d to exit...", java)
+	for opsys.ProcessAlive(java) {
+		time.Sleep(time.Second)
+	}
+}
+
+// isJava returns true if name is the executable name of a java virtual machine (ex: java, java.exe, javaw.exe)
+func isJava(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(filepath.Base(name)), ".exe")
+	return name == "java" || name == "javaw"
+}
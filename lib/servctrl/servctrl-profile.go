@@ -0,0 +1,70 @@
+package servctrl
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/servstats"
+)
+
+// profileStopTimeout is the maximum time waited for the minecraft server of the previous profile to go offline
+const profileStopTimeout = 3 * time.Minute
+
+// UseProfile switches to the config profile name ("base" for the base config):
+// the minecraft server of the active profile is stopped and the minecraft server of the selected profile is started
+// (cause is recorded in the audit file)
+func UseProfile(name string, cause history.Cause) *errco.Error {
+	switch name {
+	case "":
+		return errco.NewErr(errco.ERROR_CONFIG_PROFILE, errco.LVL_B, "UseProfile", "specify the config profile to use (base for the base config)")
+	case "base":
+		name = ""
+	default:
+		if _, ok := config.ConfigDefault.Profiles[name]; !ok {
+			return errco.NewErr(errco.ERROR_CONFIG_PROFILE, errco.LVL_B, "UseProfile", "config profile not found: "+name)
+		}
+	}
+
+	// check that the minecraft server was not released to a new msh instance
+	errMsh := checkReleased()
+	if errMsh != nil {
+		return errMsh.AddTrace("UseProfile")
+	}
+
+	errco.Logln(errco.LVL_B, "switching to config profile \"%s\"...", name)
+
+	// the server folder and commands change: the minecraft server of the active profile must be offline
+	if servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		errMsh = StopMS(false, cause)
+		if errMsh != nil && errMsh.Cod != errco.ERROR_SERVER_NOT_ONLINE {
+			return errMsh.AddTrace("UseProfile")
+		}
+
+		deadline := time.Now().Add(profileStopTimeout)
+		for servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+			if time.Now().After(deadline) {
+				return errco.NewErr(errco.ERROR_CONFIG_PROFILE, errco.LVL_B, "UseProfile", "minecraft server did not stop: config profile not changed")
+			}
+			time.Sleep(time.Second)
+		}
+	}
+
+	errMsh = config.UseProfile(name)
+	if errMsh != nil {
+		return errMsh.AddTrace("UseProfile")
+	}
+
+	// the cached status belongs to the minecraft server of the previous profile
+	resetStatusCache()
+
+	errco.Logln(errco.LVL_A, "config profile \"%s\" active: starting its minecraft server", name)
+
+	errMsh = StartMS(cause)
+	if errMsh != nil {
+		return errMsh.AddTrace("UseProfile")
+	}
+
+	return nil
+}
@@ -0,0 +1,503 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/outbound"
+	"msh/lib/servstats"
+	"msh/lib/websocket"
+)
+
+// pteroRetryInterval is the time between two attempts to reconnect to the pterodactyl websocket console
+const pteroRetryInterval = 5 * time.Second
+
+// pteroBackend runs the minecraft server as a server of a pterodactyl panel (Pterodactyl.ServerId)
+// using the panel client api: power signals start and stop the server, the websocket console
+// provides the console output and receives the console commands.
+// Crash restarts are left to the panel (the server going offline is a clean exit for msh).
+type pteroBackend struct {
+	wsM sync.Mutex
+	ws  *pteroWs // websocket console (nil while disconnected)
+
+	m        sync.Mutex
+	running  bool      // the panel reported the server not offline since start/attach
+	stopping bool      // msh asked the panel to stop the server
+	doneC    chan bool // closed when the server is offline
+	done     bool
+}
+
+func (pb *pteroBackend) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	pb.doneC = make(chan bool)
+
+	// connect before starting the server to receive all console output
+	errMsh := pb.connect()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+
+	outR, errR, inW := pb.follow()
+
+	errMsh = pteroPower("start")
+	if errMsh != nil {
+		pb.finish()
+		return nil, nil, nil, errMsh.AddTrace("start")
+	}
+
+	return outR, errR, inW, nil
+}
+
+func (pb *pteroBackend) attach(pid int) (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.Error) {
+	pb.doneC = make(chan bool)
+
+	state, errMsh := pteroState()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("attach")
+	}
+	if state == "offline" {
+		return nil, nil, nil, errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "attach", "pterodactyl server "+config.ConfigRuntime.Pterodactyl.ServerId+" is not running")
+	}
+	pb.running = true
+
+	errMsh = pb.connect()
+	if errMsh != nil {
+		return nil, nil, nil, errMsh.AddTrace("attach")
+	}
+
+	outR, errR, inW := pb.follow()
+
+	return outR, errR, inW, nil
+}
+
+// follow streams the console output of the websocket console
+func (pb *pteroBackend) follow() (io.ReadCloser, io.ReadCloser, io.WriteCloser) {
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+
+	go pb.readConsole(outW)
+
+	// stderr is merged into the console output
+	errW.Close()
+
+	return outR, errR, &pteroStdin{pb: pb}
+}
+
+func (pb *pteroBackend) stop() *errco.Error {
+	pb.m.Lock()
+	pb.stopping = true
+	pb.m.Unlock()
+
+	// the panel stops the server with the stop command of its egg
+	errMsh := pteroPower("stop")
+	if errMsh != nil {
+		return errMsh.AddTrace("stop")
+	}
+
+	statusM.Lock()
+	defer statusM.Unlock()
+
+	if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
+		errco.LogState("MINECRAFT SERVER IS STOPPING!")
+		events.Publish(events.SERVER_STOPPING, nil)
+	}
+
+	return nil
+}
+
+func (pb *pteroBackend) wait() error {
+	<-pb.doneC
+
+	return nil
+}
+
+func (pb *pteroBackend) terminate() error {
+	pb.m.Lock()
+	pb.stopping = true
+	pb.m.Unlock()
+
+	errMsh := pteroPower("stop")
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (pb *pteroBackend) kill() error {
+	pb.m.Lock()
+	pb.stopping = true
+	pb.m.Unlock()
+
+	errMsh := pteroPower("kill")
+	if errMsh != nil {
+		return fmt.Errorf("%s", errMsh.Str)
+	}
+
+	return nil
+}
+
+func (pb *pteroBackend) pid() int {
+	return -1
+}
+
+// connect opens and authenticates the websocket console
+func (pb *pteroBackend) connect() *errco.Error {
+	token, socket, errMsh := pteroWsCredentials()
+	if errMsh != nil {
+		return errMsh.AddTrace("connect")
+	}
+
+	// wings accepts only connections from the panel origin
+	ws, err := dialPteroWs(socket, strings.TrimSuffix(config.ConfigRuntime.Pterodactyl.PanelUrl, "/"))
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "connect", "pterodactyl websocket: "+err.Error())
+	}
+
+	err = ws.sendEvent("auth", token)
+	if err != nil {
+		ws.Close()
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "connect", "pterodactyl websocket: "+err.Error())
+	}
+
+	pb.wsM.Lock()
+	pb.ws = ws
+	pb.wsM.Unlock()
+
+	errco.Logln(errco.LVL_D, "connect: pterodactyl websocket console connected")
+
+	return nil
+}
+
+// disconnect closes the websocket console (if connected)
+func (pb *pteroBackend) disconnect() {
+	pb.wsM.Lock()
+	defer pb.wsM.Unlock()
+
+	if pb.ws != nil {
+		pb.ws.Close()
+		pb.ws = nil
+	}
+}
+
+// readConsole writes the console output received from the websocket console to w until the server is offline.
+// The websocket console is reconnected if the connection is lost.
+// [goroutine]
+func (pb *pteroBackend) readConsole(w *io.PipeWriter) {
+	defer w.Close()
+
+	for {
+		pb.wsM.Lock()
+		ws := pb.ws
+		pb.wsM.Unlock()
+
+		if ws == nil {
+			select {
+			case <-pb.doneC:
+				return
+			case <-time.After(pteroRetryInterval):
+			}
+
+			errMsh := pb.connect()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("readConsole"))
+			}
+			continue
+		}
+
+		event, args, err := ws.readEvent()
+		if err != nil {
+			select {
+			case <-pb.doneC:
+				return
+			default:
+			}
+			errco.LogMshErr(errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "readConsole", "pterodactyl websocket: "+err.Error()))
+			pb.disconnect()
+			continue
+		}
+
+		switch event {
+		case "console output":
+			for _, line := range args {
+				io.WriteString(w, line+"\n")
+			}
+
+		case "status":
+			if len(args) > 0 {
+				pb.setState(args[0])
+			}
+
+		case "token expiring":
+			// the websocket token is renewed without reconnecting
+			token, _, errMsh := pteroWsCredentials()
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("readConsole"))
+				continue
+			}
+			ws.sendEvent("auth", token)
+
+		case "token expired", "jwt error":
+			errco.LogMshErr(errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "readConsole", "pterodactyl websocket: "+event+" "+strings.Join(args, " ")))
+			pb.disconnect()
+
+		case "daemon error":
+			errco.LogMshErr(errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "readConsole", "pterodactyl daemon: "+strings.Join(args, " ")))
+		}
+	}
+}
+
+// setState records the server state reported by the panel ("offline", "starting", "running", "stopping").
+// The server exits when it's offline after having been started (or after msh asked the panel to stop it).
+func (pb *pteroBackend) setState(state string) {
+	errco.Logln(errco.LVL_D, "setState: pterodactyl server state: %s", state)
+
+	pb.m.Lock()
+	defer pb.m.Unlock()
+
+	switch {
+	case state != "offline":
+		pb.running = true
+	case pb.running || pb.stopping:
+		pb.finishLocked()
+	}
+}
+
+// finish ends the console output and the wait for the server exit
+func (pb *pteroBackend) finish() {
+	pb.m.Lock()
+	defer pb.m.Unlock()
+
+	pb.finishLocked()
+}
+
+// finishLocked is finish with pb.m locked
+func (pb *pteroBackend) finishLocked() {
+	if pb.done {
+		return
+	}
+	pb.done = true
+	close(pb.doneC)
+
+	pb.disconnect()
+}
+
+// pteroStdin sends the lines written to it as console commands through the websocket console
+type pteroStdin struct {
+	pb *pteroBackend
+}
+
+func (ps *pteroStdin) Write(p []byte) (int, error) {
+	ps.pb.wsM.Lock()
+	ws := ps.pb.ws
+	ps.pb.wsM.Unlock()
+
+	if ws == nil {
+		return 0, fmt.Errorf("pterodactyl websocket console is not connected")
+	}
+
+	for _, line := range strings.Split(string(p), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		err := ws.sendEvent("send command", line)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (ps *pteroStdin) Close() error {
+	return nil
+}
+
+// pteroPower sends a power signal ("start", "stop", "restart", "kill") to the pterodactyl server
+func pteroPower(signal string) *errco.Error {
+	errco.Logln(errco.LVL_D, "sending power signal %s to pterodactyl server %s", signal, config.ConfigRuntime.Pterodactyl.ServerId)
+
+	errMsh := pteroRequest(http.MethodPost, "/power", map[string]string{"signal": signal}, nil)
+	if errMsh != nil {
+		return errMsh.AddTrace("pteroPower")
+	}
+
+	return nil
+}
+
+// pteroState returns the state of the pterodactyl server ("offline", "starting", "running", "stopping")
+func pteroState() (string, *errco.Error) {
+	var resources struct {
+		Attributes struct {
+			CurrentState string `json:"current_state"`
+		} `json:"attributes"`
+	}
+	errMsh := pteroRequest(http.MethodGet, "/resources", nil, &resources)
+	if errMsh != nil {
+		return "", errMsh.AddTrace("pteroState")
+	}
+
+	return resources.Attributes.CurrentState, nil
+}
+
+// pteroWsCredentials returns the token and the address of the websocket console of the pterodactyl server
+func pteroWsCredentials() (string, string, *errco.Error) {
+	var creds struct {
+		Data struct {
+			Token  string `json:"token"`
+			Socket string `json:"socket"`
+		} `json:"data"`
+	}
+	errMsh := pteroRequest(http.MethodGet, "/websocket", nil, &creds)
+	if errMsh != nil {
+		return "", "", errMsh.AddTrace("pteroWsCredentials")
+	}
+
+	return creds.Data.Token, creds.Data.Socket, nil
+}
+
+// pteroRequest sends a request about the pterodactyl server to the panel client api
+// and decodes the json response into result (if not nil)
+func pteroRequest(method, path string, body, result interface{}) *errco.Error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "pteroRequest", err.Error())
+		}
+	}
+
+	p := config.ConfigRuntime.Pterodactyl
+	req, err := http.NewRequest(method, strings.TrimSuffix(p.PanelUrl, "/")+"/api/client/servers/"+url.PathEscape(p.ServerId)+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_D, "pteroRequest", err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+p.ApiToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client, errMsh := outbound.Client(15 * time.Second)
+	if errMsh != nil {
+		return errMsh.AddTrace("pteroRequest")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "pteroRequest", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Errors []struct {
+				Detail string `json:"detail"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		detail := ""
+		if len(apiErr.Errors) > 0 {
+			detail = apiErr.Errors[0].Detail
+		}
+		return errco.NewErr(errco.ERROR_BACKEND, errco.LVL_B, "pteroRequest", fmt.Sprintf("pterodactyl api %s %s: %s %s", method, path, resp.Status, detail))
+	}
+
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "pteroRequest", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// pteroWsMaxMessage is the maximum size of a message received from the websocket console
+const pteroWsMaxMessage = 1 << 20
+
+// pteroWs is a client side websocket connection to the pterodactyl websocket console (wings)
+type pteroWs struct {
+	*websocket.Conn
+}
+
+// dialPteroWs connects to the websocket at address (ws:// or wss://) and performs the websocket handshake.
+// The connection is opened as the other outbound connections (Msh.Proxy, Msh.NoProxy and Msh.CACerts apply).
+func dialPteroWs(address, origin string) (*pteroWs, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var useTLS bool
+	switch u.Scheme {
+	case "wss":
+		useTLS = true
+	case "ws":
+	default:
+		return nil, fmt.Errorf("websocket scheme not valid: %s", address)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if useTLS {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	conn, errMsh := outbound.Dial(host, useTLS, 10*time.Second)
+	if errMsh != nil {
+		return nil, fmt.Errorf("%s", errMsh.Str)
+	}
+
+	ws, err := websocket.Handshake(conn, u, origin, pteroWsMaxMessage)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &pteroWs{ws}, nil
+}
+
+// pteroWsEvent is a message of the pterodactyl websocket console
+type pteroWsEvent struct {
+	Event string   `json:"event"`
+	Args  []string `json:"args"`
+}
+
+// sendEvent sends an event to the websocket console
+func (ws *pteroWs) sendEvent(event string, args ...string) error {
+	data, err := json.Marshal(pteroWsEvent{event, args})
+	if err != nil {
+		return err
+	}
+
+	return ws.WriteFrame(websocket.OpText, data)
+}
+
+// readEvent returns the next event received from the websocket console
+func (ws *pteroWs) readEvent() (string, []string, error) {
+	message, err := ws.ReadMessage()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var e pteroWsEvent
+	err = json.Unmarshal(message, &e)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return e.Event, e.Args, nil
+}
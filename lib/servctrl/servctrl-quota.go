@@ -0,0 +1,46 @@
+package servctrl
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+	"msh/lib/usage"
+)
+
+// QuotaEnforcer hibernates the minecraft server when the monthly playtime quota is exceeded
+// [goroutine]
+func QuotaEnforcer() {
+	if config.ConfigRuntime.Quota.MonthlyHours <= 0 {
+		return
+	}
+
+	for {
+		time.Sleep(time.Minute)
+
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			continue
+		}
+
+		errMsh := usage.QuotaExceeded()
+		if errMsh == nil {
+			continue
+		}
+		errco.LogMshErr(errMsh.AddTrace("QuotaEnforcer"))
+
+		// give players some time before hibernating the server
+		_, errMshSay := Execute("say "+locale.T("chat.quota", errMsh.Str), "QuotaEnforcer")
+		if errMshSay != nil {
+			errco.LogMshErr(errMshSay.AddTrace("QuotaEnforcer"))
+		}
+		time.Sleep(time.Minute)
+
+		errMsh = StopMS(false, history.By(history.SOURCE_QUOTA))
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("QuotaEnforcer"))
+		}
+	}
+}
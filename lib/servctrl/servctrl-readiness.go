@@ -0,0 +1,65 @@
+package servctrl
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// readiness probes (Commands.ReadinessProbe)
+const (
+	PROBE_LOG    = "log"    // the minecraft server log matches LogProfile.Done
+	PROBE_TCP    = "tcp"    // the minecraft server port accepts connections
+	PROBE_STATUS = "status" // the minecraft server answers a status ping
+	PROBE_DELAY  = "delay"  // Commands.ReadinessDelay seconds have passed since start
+)
+
+// probeInterval is the time between two readiness probe attempts
+const probeInterval = 2 * time.Second
+
+// readinessProbe sets the starting minecraft server online when the readiness probe specified by Commands.ReadinessProbe succeeds.
+// The log probe is performed by printerOutErr.
+// [goroutine]
+func readinessProbe() {
+	probe := config.ConfigRuntime.Commands.ReadinessProbe
+	if probe == "" || probe == PROBE_LOG {
+		return
+	}
+
+	// tcp and status probes start after the delay too
+	time.Sleep(time.Duration(config.ConfigRuntime.Commands.ReadinessDelay) * time.Second)
+
+	for {
+		// the probe is needed only while the server is starting
+		// (the server is set offline when its process exits)
+		if servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+			return
+		}
+
+		var errMsh *errco.Error
+		switch probe {
+		case PROBE_TCP:
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(config.TargetHost, strconv.Itoa(config.TargetPort)), probeInterval)
+			if err != nil {
+				errMsh = errco.NewErr(errco.ERROR_SERVER_NOT_READY, errco.LVL_D, "readinessProbe", err.Error())
+			} else {
+				conn.Close()
+			}
+		case PROBE_STATUS:
+			_, errMsh = statusPing()
+		}
+
+		if errMsh == nil {
+			errco.Logln(errco.LVL_D, "readiness probe %s succeeded", probe)
+			setOnline()
+			return
+		}
+		errco.LogMshErr(errMsh.AddTrace("readinessProbe"))
+
+		time.Sleep(probeInterval)
+	}
+}
@@ -0,0 +1,140 @@
+package servctrl
+
+import (
+	"fmt"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+)
+
+// scheduleInterval is the time between two scheduled restart checks
+const scheduleInterval = 30 * time.Second
+
+// RestartManager restarts the online minecraft server daily at ScheduledRestart.DailyAt
+// and/or after ScheduledRestart.UptimeHours of uptime.
+// If ScheduledRestart.OnlyWhenEmpty is set, the restart is postponed until no player is online,
+// otherwise players are warned in game chat for ScheduledRestart.WarningSeconds before restarting.
+// [goroutine]
+func RestartManager() {
+	dailyAt := config.ConfigRuntime.ScheduledRestart.DailyAt
+	uptime := time.Duration(config.ConfigRuntime.ScheduledRestart.UptimeHours) * time.Hour
+
+	if dailyAt == "" && uptime <= 0 {
+		return
+	}
+
+	nextDailyT := nextDailyTime(dailyAt, time.Now())
+
+	for {
+		time.Sleep(scheduleInterval)
+
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			// a daily restart is not needed while the server is not running
+			if !nextDailyT.IsZero() && time.Now().After(nextDailyT) {
+				nextDailyT = nextDailyTime(dailyAt, time.Now())
+			}
+			continue
+		}
+
+		var reason string
+		switch {
+		case !nextDailyT.IsZero() && time.Now().After(nextDailyT):
+			reason = "daily restart at " + dailyAt
+		case uptime > 0 && time.Since(servstats.Stats.OnlineTime) > uptime:
+			reason = fmt.Sprintf("restart after %s of uptime", uptime)
+		default:
+			continue
+		}
+
+		if config.ConfigRuntime.ScheduledRestart.OnlyWhenEmpty {
+			playerCount, method := countPlayerSafe()
+			if playerCount > 0 {
+				errco.Logln(errco.LVL_D, "RestartManager: %s postponed, %d players online (method: %s)", reason, playerCount, method)
+				continue
+			}
+		} else {
+			warnRestart(config.ConfigRuntime.ScheduledRestart.WarningSeconds)
+		}
+
+		errco.Logln(errco.LVL_B, "scheduled restart of minecraft server: %s", reason)
+
+		errMsh := RestartMS(history.By(history.SOURCE_SCHEDULE))
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("RestartManager"))
+		}
+
+		nextDailyT = nextDailyTime(dailyAt, time.Now())
+	}
+}
+
+// RestartMS stops the minecraft server (without player check) and starts it again when offline
+// [blocking]
+func RestartMS(cause history.Cause) *errco.Error {
+	errMsh := StopMS(false, cause)
+	if errMsh != nil {
+		return errMsh.AddTrace("RestartMS")
+	}
+
+	// wait for the server to go offline
+	for servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		time.Sleep(time.Second)
+	}
+
+	errMsh = StartMS(cause)
+	if errMsh != nil {
+		return errMsh.AddTrace("RestartMS")
+	}
+
+	return nil
+}
+
+// warnRestart notifies players in game chat that the server is going to restart
+// and returns after the specified amount of seconds
+func warnRestart(seconds int) {
+	for seconds > 0 {
+		// warn players every minute, then at 30, 10 and last 5 seconds
+		if seconds%60 == 0 || seconds == 30 || seconds == 10 || seconds <= 5 {
+			_, errMsh := Execute("say "+locale.T("chat.restart", seconds), "warnRestart")
+			if errMsh != nil {
+				errco.LogMshErr(errMsh.AddTrace("warnRestart"))
+			}
+		}
+
+		seconds--
+		time.Sleep(time.Second)
+	}
+}
+
+// NextRestart returns the time of the next scheduled restart of a minecraft server started now
+// (false if no restart is scheduled)
+func NextRestart() (time.Time, bool) {
+	next := nextDailyTime(config.ConfigRuntime.ScheduledRestart.DailyAt, time.Now())
+
+	if uptime := time.Duration(config.ConfigRuntime.ScheduledRestart.UptimeHours) * time.Hour; uptime > 0 {
+		if byUptime := time.Now().Add(uptime); next.IsZero() || byUptime.Before(next) {
+			next = byUptime
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// nextDailyTime returns the first time after t at the specified time of the day ("15:04").
+// If dailyAt is empty or not valid, zero time is returned.
+func nextDailyTime(dailyAt string, t time.Time) time.Time {
+	clock, err := time.Parse("15:04", dailyAt)
+	if err != nil {
+		return time.Time{}
+	}
+
+	next := time.Date(t.Year(), t.Month(), t.Day(), clock.Hour(), clock.Minute(), 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
@@ -0,0 +1,118 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// statusCacheFileName is the file where the last status response of the online minecraft server is persisted
+// (msh-status-<profile>.json for config profiles)
+const statusCacheFileName string = "msh-status.json"
+
+var (
+	statusCacheM sync.Mutex
+
+	// statusCache is the last status response of the online minecraft server (nil if not loaded yet)
+	statusCache *StatusCache
+)
+
+// StatusCache is the status response of the minecraft server recorded during the last online session.
+// It is replayed by msh while the server is not online so that clients see the real server version and icon.
+type StatusCache struct {
+	Time       time.Time `json:"time"`       // time the status was last recorded
+	Version    string    `json:"version"`    // minecraft server version name
+	Protocol   int       `json:"protocol"`   // minecraft server protocol version
+	MaxPlayers int       `json:"maxPlayers"` // max players of the minecraft server
+	Favicon    string    `json:"favicon"`    // minecraft server icon (data uri, empty if the server has no icon)
+
+	// mod data of forge servers (modded clients check it to show if their mods are compatible)
+	ModInfo   json.RawMessage `json:"modinfo,omitempty"`
+	ForgeData json.RawMessage `json:"forgeData,omitempty"`
+}
+
+// CachedStatus returns the last status response of the online minecraft server (false if never recorded)
+func CachedStatus() (StatusCache, bool) {
+	statusCacheM.Lock()
+	defer statusCacheM.Unlock()
+
+	if statusCache == nil {
+		statusCache = &StatusCache{}
+
+		data, err := ioutil.ReadFile(statusCachePath())
+		if err != nil {
+			return StatusCache{}, false
+		}
+		err = json.Unmarshal(data, statusCache)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_STATUS_CACHE_FILE, errco.LVL_D, "CachedStatus", "status cache file is not valid, ignoring it: "+err.Error()))
+			return StatusCache{}, false
+		}
+	}
+
+	return *statusCache, !statusCache.Time.IsZero()
+}
+
+// cacheStatus records the status response of the online minecraft server.
+// The status cache file is written only if the status changed since it was last recorded.
+func cacheStatus(info *model.DataInfo) *errco.Error {
+	// load the status cache file if not loaded yet
+	old, _ := CachedStatus()
+
+	s := StatusCache{
+		Time:       time.Now(),
+		Version:    info.Version.Name,
+		Protocol:   info.Version.Protocol,
+		MaxPlayers: info.Players.Max,
+		Favicon:    info.Favicon,
+		ModInfo:    info.ModInfo,
+		ForgeData:  info.ForgeData,
+	}
+
+	statusCacheM.Lock()
+	defer statusCacheM.Unlock()
+
+	*statusCache = s
+
+	if old.Version == s.Version && old.Protocol == s.Protocol && old.MaxPlayers == s.MaxPlayers && old.Favicon == s.Favicon &&
+		bytes.Equal(old.ModInfo, s.ModInfo) && bytes.Equal(old.ForgeData, s.ForgeData) {
+		return nil
+	}
+
+	errco.Logln(errco.LVL_D, "caching minecraft server status: version %s, protocol %d, max players %d", s.Version, s.Protocol, s.MaxPlayers)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errco.NewErr(errco.ERROR_JSON_MARSHAL, errco.LVL_D, "cacheStatus", err.Error())
+	}
+
+	err = ioutil.WriteFile(statusCachePath(), data, 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_STATUS_CACHE_FILE, errco.LVL_D, "cacheStatus", err.Error())
+	}
+
+	return nil
+}
+
+// statusCachePath returns the status cache file of the active config profile
+func statusCachePath() string {
+	if config.ConfigDefault.Profile == "" {
+		return statusCacheFileName
+	}
+
+	return strings.TrimSuffix(statusCacheFileName, ".json") + "-" + config.ConfigDefault.Profile + ".json"
+}
+
+// resetStatusCache discards the status cache loaded in memory (it's loaded again from the status cache file)
+func resetStatusCache() {
+	statusCacheM.Lock()
+	statusCache = nil
+	statusCacheM.Unlock()
+}
@@ -3,10 +3,11 @@ package servctrl
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"math/big"
 	"net"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"msh/lib/config"
@@ -39,13 +40,16 @@ func countPlayerSafe() (int, string) {
 	return servstats.Stats.PlayerCount, "internal"
 }
 
+// listComRegexp matches the "list" command output line
+var listComRegexp = regexp.MustCompile(`There are \d+ of a max`)
+
 // getPlayersByListCom returns the number of players using "list" command
 func getPlayersByListCom() (int, *errco.Error) {
-	outStr, errMsh := Execute("list", "getPlayersByListCom")
+	outLines, errMsh := ExecuteCapture("list", "getPlayersByListCom", listComRegexp, 0, 5*time.Second)
 	if errMsh != nil {
 		return 0, errMsh.AddTrace("getPlayersByListCom")
 	}
-	playersStr, errMsh := utility.StrBetween(outStr, "There are ", " of a max")
+	playersStr, errMsh := utility.StrBetween(outLines[len(outLines)-1], "There are ", " of a max")
 	if errMsh != nil {
 		return 0, errMsh.AddTrace("getPlayersByListCom")
 	}
@@ -73,10 +77,46 @@ func getServInfo() (*model.DataInfo, *errco.Error) {
 		return &model.DataInfo{}, errco.NewErr(errco.ERROR_SERVER_NOT_ONLINE, errco.LVL_D, "getServInfo", "")
 	}
 
+	recInfo, errMsh := statusPing()
+	if errMsh != nil {
+		return recInfo, errMsh.AddTrace("getServInfo")
+	}
+
+	// status replayed while the server is not online
+	errMsh = cacheStatus(recInfo)
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("getServInfo"))
+	}
+
+	// update server version and protocol in config
+	if recInfo.Version.Name != config.ConfigRuntime.Server.Version || recInfo.Version.Protocol != config.ConfigRuntime.Server.Protocol {
+		errco.Logln(errco.LVL_D, "server version found! serverVersion: %s serverProtocol: %d", recInfo.Version.Name, recInfo.Version.Protocol)
+
+		// update the runtime config
+		config.ConfigRuntime.Server.Version = recInfo.Version.Name
+		config.ConfigRuntime.Server.Protocol = recInfo.Version.Protocol
+
+		// update the file config (the version of a config profile is not saved)
+		if config.ConfigDefault.Profile == "" {
+			config.ConfigDefault.Server.Version = recInfo.Version.Name
+			config.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
+
+			errMsh := config.ConfigDefaultFileWrite()
+			if errMsh != nil {
+				return nil, errMsh.AddTrace("getServInfo")
+			}
+		}
+	}
+
+	return recInfo, nil
+}
+
+// statusPing emulates a server info request to the minecraft server and returns the server info
+func statusPing() (*model.DataInfo, *errco.Error) {
 	// open connection to minecraft server
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.TargetHost, config.TargetPort))
+	serverSocket, err := net.Dial("tcp", net.JoinHostPort(config.TargetHost, strconv.Itoa(config.TargetPort)))
 	if err != nil {
-		return nil, errco.NewErr(errco.ERROR_SERVER_DIAL, errco.LVL_D, "getServInfo", err.Error())
+		return nil, errco.NewErr(errco.ERROR_SERVER_DIAL, errco.LVL_D, "statusPing", err.Error())
 	}
 	defer serverSocket.Close()
 
@@ -105,7 +145,7 @@ func getServInfo() (*model.DataInfo, *errco.Error) {
 			if err, ok := err.(net.Error); ok && err.Timeout() {
 				break
 			}
-			return &model.DataInfo{}, errco.NewErr(errco.ERROR_SERVER_REQUEST_INFO, errco.LVL_D, "getServInfo", err.Error())
+			return &model.DataInfo{}, errco.NewErr(errco.ERROR_SERVER_REQUEST_INFO, errco.LVL_D, "statusPing", err.Error())
 		}
 
 		errco.Logln(errco.LVL_E, "%sserver --> msh%s:%v", errco.COLOR_PURPLE, errco.COLOR_RESET, buf[:dataLen])
@@ -113,36 +153,82 @@ func getServInfo() (*model.DataInfo, *errco.Error) {
 		recInfoData = append(recInfoData, buf[:dataLen]...)
 	}
 
-	// remove first 5 bytes that are used as header to get only the json data
+	// remove the header (packet length, packet id and json length VarInts) to get only the json data
 	// [178 88 0 175 88]{"description":{ ...
-	if len(recInfoData) < 5 {
-		return &model.DataInfo{}, errco.NewErr(errco.ERROR_SERVER_REQUEST_INFO, errco.LVL_D, "getServInfo", "received data unexpected format")
+	// (the header is longer than 5 bytes for big responses, ex: forge servers with many mods)
+	r := bytes.NewReader(recInfoData)
+	for i := 0; i < 3; i++ {
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return &model.DataInfo{}, errco.NewErr(errco.ERROR_SERVER_REQUEST_INFO, errco.LVL_D, "statusPing", "received data unexpected format")
+			}
+			if b&0x80 == 0 {
+				break
+			}
+		}
 	}
-	recInfoData = recInfoData[5:]
+	recInfoData = recInfoData[len(recInfoData)-r.Len():]
 
 	recInfo := &model.DataInfo{}
 	err = json.Unmarshal(recInfoData, recInfo)
 	if err != nil {
-		return &model.DataInfo{}, errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "getServInfo", err.Error())
+		return &model.DataInfo{}, errco.NewErr(errco.ERROR_JSON_UNMARSHAL, errco.LVL_D, "statusPing", err.Error())
 	}
 
-	// update server version and protocol in config
-	if recInfo.Version.Name != config.ConfigRuntime.Server.Version || recInfo.Version.Protocol != config.ConfigRuntime.Server.Protocol {
-		errco.Logln(errco.LVL_D, "server version found! serverVersion: %s serverProtocol: %d", recInfo.Version.Name, recInfo.Version.Protocol)
+	return recInfo, nil
+}
 
-		// update the runtime config
-		config.ConfigRuntime.Server.Version = recInfo.Version.Name
-		config.ConfigRuntime.Server.Protocol = recInfo.Version.Protocol
+// parseLogin returns player name and ip from the content of a minecraft server login log line
+// (ex: "player[/127.0.0.1:51234] logged in with entity id 123 at (...)" -> "player", "127.0.0.1")
+func parseLogin(lineContent string) (string, string) {
+	bi := strings.Index(lineContent, "[/")
+	if bi < 0 {
+		return strings.Split(lineContent, " ")[0], ""
+	}
 
-		// update the file config
-		config.ConfigDefault.Server.Version = recInfo.Version.Name
-		config.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
+	playerName := lineContent[:bi]
+	address := strings.Split(lineContent[bi+2:], "]")[0]
 
-		errMsh := config.ConfigDefaultFileWrite()
-		if errMsh != nil {
-			return nil, errMsh.AddTrace("getServInfo")
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return playerName, address
+	}
+
+	return playerName, host
+}
+
+// notWhitelistedRegexp matches the log line of a player refused because not whitelisted and captures the player name
+// (ex: "bob (/127.0.0.1:51234) lost connection: You are not white-listed on this server!",
+// "com.mojang.authlib.GameProfile@1a2b[id=<null>,name=bob,...] (/127.0.0.1:51234) lost connection: You are not white-listed on this server!")
+var notWhitelistedRegexp = regexp.MustCompile(`^(?:.*GameProfile@.*?name=([^,\]]+).*|(\S+) .*lost connection): You are not white-listed`)
+
+// refusedPlayer returns the name of the player refused because not whitelisted (empty string if lineContent is not a refusal)
+func refusedPlayer(lineContent string) string {
+	m := notWhitelistedRegexp.FindStringSubmatch(lineContent)
+	if m == nil {
+		return ""
+	}
+	if m[1] != "" {
+		return m[1]
+	}
+
+	return m[2]
+}
+
+// playerClientIp returns the ip of the client connection of the player proxied by msh
+// (the minecraft server only sees the address of msh)
+func playerClientIp(playerName string) string {
+	for _, c := range servstats.Conns() {
+		if !strings.EqualFold(c.Player, playerName) {
+			continue
 		}
+		host, _, err := net.SplitHostPort(c.Client)
+		if err != nil {
+			return c.Client
+		}
+		return host
 	}
 
-	return recInfo, nil
+	return ""
 }
@@ -0,0 +1,82 @@
+package servctrl
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/history"
+	"msh/lib/servstats"
+)
+
+// lastOutputT is the time (unix nano) of the last line printed by the minecraft server (int64 for atomic operations)
+var lastOutputT int64
+
+// watchdogInterval is the time between two hang checks
+const watchdogInterval = 10 * time.Second
+
+// hangWatchdog checks periodically that the online minecraft server is responsive.
+// The server is considered hung when there has been no log output and no successful status ping
+// for Commands.HangTimeout seconds: the server process is then killed and the server restarted.
+// [goroutine]
+func hangWatchdog() {
+	timeout := time.Duration(config.ConfigRuntime.Commands.HangTimeout) * time.Second
+	if timeout <= 0 {
+		return
+	}
+
+	lastPingOkT := time.Now()
+
+	for {
+		time.Sleep(watchdogInterval)
+
+		// the watchdog is needed only while the server is online
+		if !ServTerm.IsActive || servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			return
+		}
+
+		lastOutT := time.Unix(0, atomic.LoadInt64(&lastOutputT))
+
+		// a server that is printing logs is not hung
+		if time.Since(lastOutT) < watchdogInterval {
+			continue
+		}
+
+		// a server that answers a status ping is not hung
+		_, errMsh := getServInfo()
+		if errMsh == nil {
+			lastPingOkT = time.Now()
+			continue
+		}
+		errco.LogMshErr(errMsh.AddTrace("hangWatchdog"))
+
+		if time.Since(lastOutT) < timeout || time.Since(lastPingOkT) < timeout {
+			continue
+		}
+
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_HANG, errco.LVL_B, "hangWatchdog", fmt.Sprintf("minecraft server is not responding since %s: killing and restarting it", lastOutT.Format("15:04:05"))))
+		events.Publish(events.SERVER_HANG, map[string]interface{}{"lastOutput": lastOutT})
+
+		ServTerm.killed = true
+		err := ServTerm.backend.kill()
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_KILL, errco.LVL_B, "hangWatchdog", err.Error()))
+			return
+		}
+
+		// wait for the killed server to go offline
+		for servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+			time.Sleep(time.Second)
+		}
+
+		errMsh = StartMS(history.By(history.SOURCE_WATCHDOG))
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("hangWatchdog"))
+		}
+
+		return
+	}
+}
@@ -2,28 +2,132 @@ package servctrl
 
 import (
 	"fmt"
+	"regexp"
 	"sync/atomic"
 	"time"
 
+	"msh/lib/chaos"
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/history"
+	"msh/lib/hooks"
+	"msh/lib/plugin"
 	"msh/lib/servstats"
+	"msh/lib/usage"
+	"msh/lib/world"
 )
 
-// StartMS starts the minecraft server
-func StartMS() *errco.Error {
-	// start server terminal
-	errMsh := cmdStart(config.ConfigRuntime.Server.Folder, config.ConfigRuntime.Commands.StartServer)
+// crashResetTime is the time after which a new crash is not considered part of the previous crash sequence
+const crashResetTime = 30 * time.Minute
+
+var (
+	crashRestarts int       // consecutive restarts after a crash (reset after a clean stop)
+	lastCrashT    time.Time // time of the last crash
+)
+
+// StartMS starts the minecraft server (cause is recorded in the audit file)
+func StartMS(cause history.Cause) *errco.Error {
+	// check that the minecraft server was not released to a new msh instance
+	errMsh := checkReleased()
+	if errMsh != nil {
+		return errMsh.AddTrace("StartMS")
+	}
+
+	// check that the minecraft server is not locked by an admin
+	errMsh = checkLock()
+	if errMsh != nil {
+		return errMsh.AddTrace("StartMS")
+	}
+
+	// check that msh is not draining
+	errMsh = checkDrain()
+	if errMsh != nil {
+		return errMsh.AddTrace("StartMS")
+	}
+
+	// check that the monthly playtime quota is not exceeded
+	errMsh = usage.QuotaExceeded()
 	if errMsh != nil {
 		return errMsh.AddTrace("StartMS")
 	}
 
+	// check that clients did not wake up the server too many times in the last hour
+	errMsh = checkWakeLimit(cause)
+	if errMsh != nil {
+		return errMsh.AddTrace("StartMS")
+	}
+
+	// check that no plugin vetoes the wake-up
+	errMsh = plugin.VetoWake(cause)
+	if errMsh != nil {
+		return errMsh.AddTrace("StartMS")
+	}
+
+	// lock, drain, quota, wake limit and plugin refusals are expected, other errors are start failures
+	errMsh = startServer()
+	if errMsh != nil {
+		events.Publish(events.START_FAILURE, map[string]interface{}{"error": errMsh.Str})
+		return errMsh.AddTrace("StartMS")
+	}
+
+	recordWakeLimit(cause)
+
+	history.Audit(history.AUDIT_WAKE, cause)
+
 	return nil
 }
 
-// StopMS executes "stop" command on the minecraft server.
+// startServer runs the pre-start checks and starts the minecraft server terminal
+func startServer() *errco.Error {
+	// inject start failure (chaos testing)
+	errMsh := chaos.StartFailure()
+	if errMsh != nil {
+		return errMsh.AddTrace("startServer")
+	}
+
+	// run pre-start hook (a failing hook prevents the server start)
+	errMsh = hooks.Run(hooks.PRE_START, nil)
+	if errMsh != nil {
+		return errMsh.AddTrace("startServer")
+	}
+
+	// refuse to boot onto a corrupted world
+	errMsh = world.Check()
+	if errMsh != nil {
+		return errMsh.AddTrace("startServer")
+	}
+
+	// the minecraft server port must be free (it's changed if Msh.AutoPort is set)
+	errMsh = config.CheckTargetPort()
+	if errMsh != nil {
+		return errMsh.AddTrace("startServer")
+	}
+
+	// refuse to start on a full disk or with a java version too old for the server jar
+	errMsh = preflight()
+	if errMsh != nil {
+		return errMsh.AddTrace("startServer")
+	}
+
+	// start server terminal
+	errMsh = cmdStart(config.ConfigRuntime.Server.Folder, config.StartCommand())
+	if errMsh != nil {
+		return errMsh.AddTrace("startServer")
+	}
+
+	return nil
+}
+
+// StopMS executes "stop" command on the minecraft server (cause is recorded in the audit file).
 // When playersCheck == true, it checks for StopMSRequests/Players and orders the server shutdown
-func StopMS(playersCheck bool) *errco.Error {
+func StopMS(playersCheck bool, cause history.Cause) *errco.Error {
+	// check that the minecraft server was not released to a new msh instance
+	errMsh := checkReleased()
+	if errMsh != nil {
+		return errMsh.AddTrace("StopMS")
+	}
+
 	// wait for the starting server to go online
 	for servstats.Stats.Status == errco.SERVER_STATUS_STARTING {
 		time.Sleep(1 * time.Second)
@@ -51,14 +155,55 @@ func StopMS(playersCheck bool) *errco.Error {
 		if atomic.LoadInt32(&servstats.Stats.StopMSRequests) > 0 {
 			return errco.NewErr(errco.ERROR_SERVER_MUST_WAIT, errco.LVL_D, "StopMS", fmt.Sprintf("not enough time has passed since last player disconnected (StopMSRequests: %d )", servstats.Stats.StopMSRequests))
 		}
+
+		// the server must stay online at least FreezePolicy.MinOnlineMinutes (a StopMSRequest is scheduled when it elapses)
+		if left := minOnlineLeft(); left > 0 {
+			return errco.NewErr(errco.ERROR_SERVER_MIN_ONLINE, errco.LVL_D, "StopMS", fmt.Sprintf("minecraft server must stay online for %s more (FreezePolicy.MinOnlineMinutes)", left.Round(time.Second)))
+		}
+
+		// hibernation is disabled during always-on hibernation periods
+		if alwaysOn(time.Now()) {
+			return errco.NewErr(errco.ERROR_SERVER_ALWAYS_ON, errco.LVL_D, "StopMS", "hibernation is disabled by an always-on hibernation period")
+		}
+
+		// hibernation is suspended while the server is kept alive
+		if k := KeepAliveStatus(); k != nil {
+			atomic.StoreInt32(&keepAliveBlocked, 1)
+			return errco.NewErr(errco.ERROR_SERVER_KEEPALIVE, errco.LVL_D, "StopMS", "hibernation is suspended by a keep-alive until "+k.Until.Format("2006/01/02 15:04"))
+		}
 	}
 
-	// execute stop command
-	_, errMsh := Execute(config.ConfigRuntime.Commands.StopServer, "StopMS")
+	// run pre-stop hook (a failing hook does not prevent the server stop)
+	errMsh = hooks.Run(hooks.PRE_STOP, nil)
 	if errMsh != nil {
-		return errMsh.AddTrace("StopMS")
+		errco.LogMshErr(errMsh.AddTrace("StopMS"))
+	}
+
+	// execute pre-stop commands in order (a failing command does not prevent the server stop)
+	for _, c := range config.ConfigRuntime.Commands.PreStopCommands {
+		errMsh = preStopCommand(c.Command, c.Match, c.Timeout)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("StopMS"))
+		}
+		time.Sleep(time.Duration(c.Delay) * time.Second)
 	}
 
+	if s, ok := ServTerm.backend.(stopper); ok {
+		// stop the minecraft server through the backend
+		errMsh = s.stop()
+		if errMsh != nil {
+			return errMsh.AddTrace("StopMS")
+		}
+	} else {
+		// execute stop command
+		_, errMsh = Execute(config.ConfigRuntime.Commands.StopServer, "StopMS")
+		if errMsh != nil {
+			return errMsh.AddTrace("StopMS")
+		}
+	}
+
+	history.Audit(history.AUDIT_FREEZE, cause)
+
 	// if sigint is allowed, launch a function to check the shutdown of minecraft server
 	if config.ConfigRuntime.Commands.StopServerAllowKill > 0 {
 		go killMSifOnlineAfterTimeout()
@@ -67,16 +212,53 @@ func StopMS(playersCheck bool) *errco.Error {
 	return nil
 }
 
+// preStopCommand executes a pre-stop command and, if match is set, waits for the console line matching it
+// (ex: "Saved the game" after "save-all flush") for at most timeout seconds (0 for 30 seconds)
+func preStopCommand(command, match string, timeout int) *errco.Error {
+	if match == "" {
+		errMsh := execute(command, "StopMS pre-stop")
+		if errMsh != nil {
+			return errMsh.AddTrace("preStopCommand")
+		}
+		return nil
+	}
+
+	// the regex is validated when the config is loaded
+	matchRe, err := regexp.Compile(match)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_PRE_STOP_COMMAND, errco.LVL_B, "preStopCommand", fmt.Sprintf("%q: match is not valid: %s", command, err.Error()))
+	}
+	if timeout <= 0 {
+		timeout = 30
+	}
+
+	startT := time.Now()
+	_, errMsh := ExecuteCapture(command, "StopMS pre-stop", matchRe, 0, time.Duration(timeout)*time.Second)
+	if errMsh != nil {
+		return errco.NewErr(errco.ERROR_PRE_STOP_COMMAND, errco.LVL_B, "preStopCommand", fmt.Sprintf("%q: %s", command, errMsh.Str))
+	}
+
+	errco.Logln(errco.LVL_B, "pre-stop command %q completed in %.1f seconds", command, time.Since(startT).Seconds())
+
+	return nil
+}
+
 // StopMSRequest increases StopMSRequests by one and starts the timer to execute StopMS(true) (with playersCheck)
 // [goroutine]
 func StopMSRequest() {
 	atomic.AddInt32(&servstats.Stats.StopMSRequests, 1)
 
+	// the server is not frozen before FreezePolicy.MinOnlineMinutes elapsed
+	delay := idleTimeout(time.Now())
+	if left := minOnlineLeft(); left > delay {
+		delay = left
+	}
+
 	// [goroutine]
 	time.AfterFunc(
-		time.Duration(config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)*time.Second,
+		delay,
 		func() {
-			errMsh := StopMS(true)
+			errMsh := StopMS(true, history.By(history.SOURCE_IDLE))
 			if errMsh != nil {
 				// avoid logging "server is not online" error since it can be very frequent
 				if errMsh.Cod != errco.ERROR_SERVER_NOT_ONLINE {
@@ -107,10 +289,97 @@ func killMSifOnlineAfterTimeout() {
 	// give time to save word
 	time.Sleep(10 * time.Second)
 
+	terminateMS("killMSifOnlineAfterTimeout")
+}
+
+// KillMS forcefully kills the minecraft server process group without waiting for it to exit
+func KillMS() *errco.Error {
+	if !ServTerm.IsActive || ServTerm.backend == nil || released {
+		return nil
+	}
+
+	ServTerm.killed = true
+	err := ServTerm.backend.kill()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_SERVER_KILL, errco.LVL_B, "KillMS", err.Error())
+	}
+
+	return nil
+}
+
+// terminateMS terminates the minecraft server process group (SIGTERM) and, if the server does not exit
+// within Commands.StopServerTermGrace seconds, kills it (SIGKILL)
+// [blocking]
+func terminateMS(origin string) {
+	ServTerm.killed = true
+
+	if grace := config.ConfigRuntime.Commands.StopServerTermGrace; grace > 0 {
+		errco.Logln(errco.LVL_D, "%s: minecraft server process won't stop normally: sending terminate signal", origin)
+		err := ServTerm.backend.terminate()
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_KILL, errco.LVL_D, "terminateMS", err.Error()).AddTrace(origin))
+		}
+
+		for i := 0; i < grace; i++ {
+			if servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}
+
 	// send kill signal to server
-	errco.Logln(errco.LVL_D, "minecraft server process won't stop normally: sending kill signal")
-	err := ServTerm.cmd.Process.Kill()
+	errco.Logln(errco.LVL_D, "%s: minecraft server process won't stop normally: sending kill signal", origin)
+	err := ServTerm.backend.kill()
 	if err != nil {
-		errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_KILL, errco.LVL_D, "killMSifOnlineAfterTimeout", err.Error()))
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_KILL, errco.LVL_D, "terminateMS", err.Error()).AddTrace(origin))
+	}
+}
+
+// restartAfterCrash restarts the minecraft server after a crash waiting an exponential backoff time.
+// When Commands.CrashRestartMax consecutive restarts are reached, the crash loop is reported and the server is left offline.
+// [goroutine]
+func restartAfterCrash(exitErr error) {
+	exitStr := "process exited during normal operation"
+	if exitErr != nil {
+		exitStr = exitErr.Error()
+	}
+	errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_CRASHED, errco.LVL_B, "restartAfterCrash", "minecraft server crashed: "+exitStr))
+	events.Publish(events.SERVER_CRASH, map[string]interface{}{"exit": exitStr})
+	history.Audit(history.AUDIT_CRASH, history.By(history.SOURCE_SERVER))
+
+	// a crash that happens long after the previous one starts a new crash sequence
+	if time.Since(lastCrashT) > crashResetTime {
+		crashRestarts = 0
+	}
+	lastCrashT = time.Now()
+
+	if config.ConfigRuntime.Commands.CrashRestartMax <= 0 {
+		return
+	}
+
+	if crashRestarts >= config.ConfigRuntime.Commands.CrashRestartMax {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_SERVER_CRASH_LOOP, errco.LVL_A, "restartAfterCrash", fmt.Sprintf("minecraft server crashed %d times in a row: automatic restart disabled", crashRestarts+1)))
+		events.Publish(events.SERVER_CRASH_LOOP, map[string]interface{}{"crashes": crashRestarts + 1})
+		crashLoop = true
+		return
+	}
+
+	// backoff doubles at every consecutive restart: delay, 2*delay, 4*delay, ...
+	backoff := time.Duration(config.ConfigRuntime.Commands.CrashRestartDelay) * time.Second << uint(crashRestarts)
+	crashRestarts++
+
+	errco.Logln(errco.LVL_B, "restarting minecraft server in %s (attempt %d/%d)", backoff, crashRestarts, config.ConfigRuntime.Commands.CrashRestartMax)
+	time.Sleep(backoff)
+
+	// the server might have been started in the meantime (player join or user input)
+	if servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		errco.Logln(errco.LVL_D, "restartAfterCrash: minecraft server is not offline, restart canceled")
+		return
+	}
+
+	errMsh := StartMS(history.By(history.SOURCE_CRASH))
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("restartAfterCrash"))
 	}
 }
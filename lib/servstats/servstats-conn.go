@@ -0,0 +1,149 @@
+package servstats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats contains the traffic of a proxied connection.
+// Packets are the reads of the buffered forward: they are not counted by the zero-copy fast path.
+type ConnStats struct {
+	// 64 bit counters are first for atomic operations (alignment on 32 bit systems)
+	BytesToServer   uint64 `json:"bytesToServer"`
+	BytesToClient   uint64 `json:"bytesToClient"`
+	PacketsToServer uint64 `json:"packetsToServer"`
+	PacketsToClient uint64 `json:"packetsToClient"`
+	RateToServer    uint64 `json:"rateToServer"` // bytes/s forwarded to the minecraft server (last measure)
+	RateToClient    uint64 `json:"rateToClient"` // bytes/s forwarded to the client (last measure)
+	LatencyUs       uint64 `json:"latencyUs"`    // tcp round trip time of the client connection in microseconds (linux)
+	Stalled         uint64 `json:"stalled"`      // connections closed because stalled (1 if the connection was closed because stalled)
+	lastFromClient  int64  // unix nanoseconds of the last data received from the client
+
+	Id          int       `json:"id"`
+	Client      string    `json:"client"`
+	Player      string    `json:"player,omitempty"`
+	Since       time.Time `json:"since"`
+	IdleSeconds float64   `json:"idleSeconds"` // seconds since the client sent data (set by Snapshot)
+
+	// bytes counted at the previous measure (used by the stall monitor only)
+	measuredToServer uint64
+	measuredToClient uint64
+}
+
+// ProxyTotals contains the traffic of all proxied connections since msh started
+var ProxyTotals ConnStats
+
+var (
+	connsM sync.Mutex
+	conns  = map[int]*ConnStats{} // open proxied connections by id
+	connId int                    // id of the last opened connection
+)
+
+// OpenConn registers a new proxied connection and returns its traffic counters
+func OpenConn(client, player string) *ConnStats {
+	connsM.Lock()
+	defer connsM.Unlock()
+
+	connId++
+	c := &ConnStats{Id: connId, Client: client, Player: player, Since: time.Now(), lastFromClient: time.Now().UnixNano()}
+	conns[c.Id] = c
+
+	return c
+}
+
+// CloseConn removes a proxied connection from the open connections
+func CloseConn(c *ConnStats) {
+	connsM.Lock()
+	defer connsM.Unlock()
+
+	delete(conns, c.Id)
+}
+
+// Count adds the bytes and packets forwarded to the connection counters
+// (isServerToClient used to know the forward direction)
+func (c *ConnStats) Count(isServerToClient bool, bytes, packets int) {
+	if isServerToClient {
+		atomic.AddUint64(&c.BytesToClient, uint64(bytes))
+		atomic.AddUint64(&c.PacketsToClient, uint64(packets))
+		atomic.AddUint64(&ProxyTotals.BytesToClient, uint64(bytes))
+		atomic.AddUint64(&ProxyTotals.PacketsToClient, uint64(packets))
+	} else {
+		atomic.StoreInt64(&c.lastFromClient, time.Now().UnixNano())
+		atomic.AddUint64(&c.BytesToServer, uint64(bytes))
+		atomic.AddUint64(&c.PacketsToServer, uint64(packets))
+		atomic.AddUint64(&ProxyTotals.BytesToServer, uint64(bytes))
+		atomic.AddUint64(&ProxyTotals.PacketsToServer, uint64(packets))
+	}
+}
+
+// Snapshot returns a copy of the connection counters
+func (c *ConnStats) Snapshot() ConnStats {
+	return ConnStats{
+		BytesToServer:   atomic.LoadUint64(&c.BytesToServer),
+		BytesToClient:   atomic.LoadUint64(&c.BytesToClient),
+		PacketsToServer: atomic.LoadUint64(&c.PacketsToServer),
+		PacketsToClient: atomic.LoadUint64(&c.PacketsToClient),
+		RateToServer:    atomic.LoadUint64(&c.RateToServer),
+		RateToClient:    atomic.LoadUint64(&c.RateToClient),
+		LatencyUs:       atomic.LoadUint64(&c.LatencyUs),
+		Stalled:         atomic.LoadUint64(&c.Stalled),
+		Id:              c.Id,
+		Client:          c.Client,
+		Player:          c.Player,
+		Since:           c.Since,
+		IdleSeconds:     c.Idle().Seconds(),
+	}
+}
+
+// Idle returns the time since the client sent data.
+// Data forwarded by the zero-copy fast path is counted by chunk: its idle time is measured by the kernel (SetIdle).
+func (c *ConnStats) Idle() time.Duration {
+	if c.Since.IsZero() {
+		// ProxyTotals
+		return 0
+	}
+
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastFromClient)))
+}
+
+// SetIdle sets the time since the client sent data (measured by the kernel)
+func (c *ConnStats) SetIdle(idle time.Duration) {
+	atomic.StoreInt64(&c.lastFromClient, time.Now().Add(-idle).UnixNano())
+}
+
+// SetLatency sets the round trip time of the client connection
+func (c *ConnStats) SetLatency(rtt time.Duration) {
+	atomic.StoreUint64(&c.LatencyUs, uint64(rtt/time.Microsecond))
+}
+
+// Measure sets the forward rates of the connection from the bytes forwarded since the previous measure
+// (interval is the time elapsed since the previous measure)
+func (c *ConnStats) Measure(interval time.Duration) {
+	toServer, toClient := atomic.LoadUint64(&c.BytesToServer), atomic.LoadUint64(&c.BytesToClient)
+
+	atomic.StoreUint64(&c.RateToServer, uint64(float64(toServer-c.measuredToServer)/interval.Seconds()))
+	atomic.StoreUint64(&c.RateToClient, uint64(float64(toClient-c.measuredToClient)/interval.Seconds()))
+	c.measuredToServer, c.measuredToClient = toServer, toClient
+}
+
+// MarkStalled counts the connection as closed because stalled
+func (c *ConnStats) MarkStalled() {
+	atomic.StoreUint64(&c.Stalled, 1)
+	atomic.AddUint64(&ProxyTotals.Stalled, 1)
+}
+
+// Conns returns a copy of the open proxied connections (oldest first)
+func Conns() []ConnStats {
+	connsM.Lock()
+	defer connsM.Unlock()
+
+	list := []ConnStats{}
+	for _, c := range conns {
+		list = append(list, c.Snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+
+	return list
+}
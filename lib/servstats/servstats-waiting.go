@@ -0,0 +1,70 @@
+package servstats
+
+import (
+	"sync"
+	"time"
+)
+
+// WaitingPlayer is a player that tried to join while the minecraft server was starting
+type WaitingPlayer struct {
+	Name     string    `json:"name"`
+	Since    time.Time `json:"since"`    // time of the first join attempt
+	Attempts int       `json:"attempts"` // number of join attempts
+}
+
+var (
+	waitingM sync.Mutex
+	waiting  []*WaitingPlayer // players waiting for the starting minecraft server (first join attempt first)
+)
+
+// AddWaiting records a join attempt of a player waiting for the starting minecraft server
+func AddWaiting(name string) {
+	waitingM.Lock()
+	defer waitingM.Unlock()
+
+	for _, w := range waiting {
+		if w.Name == name {
+			w.Attempts++
+			return
+		}
+	}
+
+	waiting = append(waiting, &WaitingPlayer{Name: name, Since: time.Now(), Attempts: 1})
+}
+
+// RemoveWaiting removes a player from the waiting players.
+// Returns false if the player was not waiting.
+func RemoveWaiting(name string) bool {
+	waitingM.Lock()
+	defer waitingM.Unlock()
+
+	for i, w := range waiting {
+		if w.Name == name {
+			waiting = append(waiting[:i:i], waiting[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClearWaiting removes all waiting players (ex: server offline)
+func ClearWaiting() {
+	waitingM.Lock()
+	defer waitingM.Unlock()
+
+	waiting = nil
+}
+
+// Waiting returns a copy of the players waiting for the starting minecraft server (first join attempt first)
+func Waiting() []WaitingPlayer {
+	waitingM.Lock()
+	defer waitingM.Unlock()
+
+	list := []WaitingPlayer{}
+	for _, w := range waiting {
+		list = append(list, *w)
+	}
+
+	return list
+}
@@ -1,6 +1,7 @@
 package servstats
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -12,12 +13,21 @@ var Stats *serverStats
 
 type serverStats struct {
 	M              *sync.Mutex
-	Status         int     // represent the status of the minecraft server
-	PlayerCount    int     // tracks players connected to the server
-	StopMSRequests int32   // tracks active StopMSRequest() instances. (int32 for atomic operations)
-	LoadProgress   string  // tracks loading percentage of starting server
-	BytesToClients float64 // tracks bytes/s server->clients
-	BytesToServer  float64 // tracks bytes/s clients->server
+	Status         int       // represent the status of the minecraft server
+	PlayerCount    int       // tracks players connected to the server
+	Players        []string  // names of players online on the server
+	LastPlayers    []string  // names of players that were online most recently (most recent first)
+	LastWakePlayer string    // name of the player that triggered the last wake
+	StopMSRequests int32     // tracks active StopMSRequest() instances. (int32 for atomic operations)
+	LoadProgress   string    // tracks loading percentage of starting server
+	LoadStage      string    // tracks startup stage of starting server (ex: "Preparing level")
+	StartError     string    // cause of the last startup failure (empty if the server went online)
+	StartFix       string    // suggested fix of the last startup failure
+	OnlineTime     time.Time // time at which the server went online
+	BytesToClients float64   // tracks bytes/s server->clients
+	BytesToServer  float64   // tracks bytes/s clients->server
+	CPUUsage       float64   // cpu usage of the server process (percentage of 1 core)
+	MemoryUsage    uint64    // resident memory of the server process (bytes)
 }
 
 func init() {
@@ -34,6 +44,93 @@ func init() {
 	go printDataUsage()
 }
 
+// StatusName returns the name of a minecraft server status
+func StatusName(status int) string {
+	switch status {
+	case errco.SERVER_STATUS_OFFLINE:
+		return "offline"
+	case errco.SERVER_STATUS_STARTING:
+		return "starting"
+	case errco.SERVER_STATUS_ONLINE:
+		return "online"
+	case errco.SERVER_STATUS_STOPPING:
+		return "stopping"
+	default:
+		return "unknown"
+	}
+}
+
+// ProgressText returns the startup stage and loading percentage of the starting server (ex: "Preparing start region 45%")
+func ProgressText() string {
+	return strings.TrimSpace(Stats.LoadStage + " " + Stats.LoadProgress)
+}
+
+// maxLastPlayers is the maximum number of players remembered in LastPlayers
+const maxLastPlayers = 5
+
+// AddPlayer adds a player to the online players
+func AddPlayer(name string) {
+	Stats.M.Lock()
+	defer Stats.M.Unlock()
+
+	Stats.Players = append(Stats.Players, name)
+}
+
+// RemovePlayer removes a player from the online players and remembers it in the last online players
+func RemovePlayer(name string) {
+	Stats.M.Lock()
+	defer Stats.M.Unlock()
+
+	for i, p := range Stats.Players {
+		if p == name {
+			Stats.Players = append(Stats.Players[:i:i], Stats.Players[i+1:]...)
+			rememberPlayer(name)
+			return
+		}
+	}
+}
+
+// ClearPlayers removes all online players (ex: server offline) remembering them in the last online players
+func ClearPlayers() {
+	Stats.M.Lock()
+	defer Stats.M.Unlock()
+
+	for _, p := range Stats.Players {
+		rememberPlayer(p)
+	}
+	Stats.Players = nil
+}
+
+// PlayerLists returns a copy of the online players and last online players
+func PlayerLists() ([]string, []string) {
+	Stats.M.Lock()
+	defer Stats.M.Unlock()
+
+	return append([]string{}, Stats.Players...), append([]string{}, Stats.LastPlayers...)
+}
+
+// RestoreLastPlayers sets the last online players (most recent first) from a state snapshot
+func RestoreLastPlayers(names []string) {
+	Stats.M.Lock()
+	defer Stats.M.Unlock()
+
+	for i := len(names) - 1; i >= 0; i-- {
+		rememberPlayer(names[i])
+	}
+}
+
+// rememberPlayer puts a player at the top of the last online players
+// (Stats.M must be locked)
+func rememberPlayer(name string) {
+	last := []string{name}
+	for _, p := range Stats.LastPlayers {
+		if p != name && len(last) < maxLastPlayers {
+			last = append(last, p)
+		}
+	}
+	Stats.LastPlayers = last
+}
+
 // printDataUsage prints each second bytes/s to clients and to server.
 // (must be launched after ServTerm.IsActive has been set to true)
 // [goroutine]
@@ -0,0 +1,49 @@
+// +build linux
+
+package sysmon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// clockTicks is the number of clock ticks per second used in /proc/<pid>/stat (USER_HZ)
+const clockTicks = 100
+
+// sampleProc returns the resource usage of the process reading /proc/<pid>/stat
+func sampleProc(pid int) (*procSample, *errco.Error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", err.Error())
+	}
+
+	// process name (2nd field) can contain spaces: parse fields after the closing parenthesis
+	// fields after ")" start from field 3 (state): utime is field 14, stime 15, rss 24
+	i := strings.LastIndex(string(data), ")")
+	if i == -1 {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", "unexpected /proc/<pid>/stat format")
+	}
+	fields := strings.Fields(string(data)[i+1:])
+	if len(fields) < 22 {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", "unexpected /proc/<pid>/stat format")
+	}
+
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	rss, err3 := strconv.ParseUint(fields[21], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", "unexpected /proc/<pid>/stat values")
+	}
+
+	return &procSample{
+		cpuTime: time.Duration(utime+stime) * time.Second / clockTicks,
+		memory:  rss * uint64(os.Getpagesize()),
+		t:       time.Now(),
+	}, nil
+}
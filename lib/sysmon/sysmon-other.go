@@ -0,0 +1,12 @@
+// +build !linux,!windows
+
+package sysmon
+
+import (
+	"msh/lib/errco"
+)
+
+// sampleProc returns the resource usage of the process (not supported on this OS)
+func sampleProc(pid int) (*procSample, *errco.Error) {
+	return nil, errco.NewErr(errco.ERROR_SYSMON_NOT_SUPPORTED, errco.LVL_D, "sampleProc", "resource monitoring is not supported on this OS")
+}
@@ -0,0 +1,63 @@
+//go:build windows
+// +build windows
+
+package sysmon
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"msh/lib/errco"
+)
+
+var (
+	kernel32                    = syscall.NewLazyDLL("kernel32.dll")
+	procK32GetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+)
+
+// sampleProc returns the resource usage of the process reading its cpu times and working set
+func sampleProc(pid int) (*procSample, *errco.Error) {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", err.Error())
+	}
+	defer syscall.CloseHandle(h)
+
+	var creation, exit, kernel, user syscall.Filetime
+	err = syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", err.Error())
+	}
+
+	// PROCESS_MEMORY_COUNTERS structure
+	var mem struct {
+		cb                         uint32
+		pageFaultCount             uint32
+		peakWorkingSetSize         uintptr
+		workingSetSize             uintptr
+		quotaPeakPagedPoolUsage    uintptr
+		quotaPagedPoolUsage        uintptr
+		quotaPeakNonPagedPoolUsage uintptr
+		quotaNonPagedPoolUsage     uintptr
+		pagefileUsage              uintptr
+		peakPagefileUsage          uintptr
+	}
+	mem.cb = uint32(unsafe.Sizeof(mem))
+
+	r, _, err := procK32GetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&mem)), uintptr(mem.cb))
+	if r == 0 {
+		return nil, errco.NewErr(errco.ERROR_SYSMON_READ, errco.LVL_D, "sampleProc", err.Error())
+	}
+
+	return &procSample{
+		cpuTime: filetimeDuration(kernel) + filetimeDuration(user),
+		memory:  uint64(mem.workingSetSize),
+		t:       time.Now(),
+	}, nil
+}
+
+// filetimeDuration returns the duration of a FILETIME interval (100-nanosecond units)
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,91 @@
+package sysmon
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/opsys"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// monitorInterval is the time between two resource usage samples
+const monitorInterval = 5 * time.Second
+
+// procSample is a resource usage sample of a process
+type procSample struct {
+	cpuTime time.Duration // total cpu time used by the process
+	memory  uint64        // resident memory of the process (bytes)
+	t       time.Time     // time of sampling
+}
+
+// ResourceMonitor samples the minecraft server cpu/memory usage into servstats.Stats.
+// If host available memory drops below Msh.HostMemoryFreezeThreshold MB and no player is online, the server is frozen.
+// [goroutine]
+func ResourceMonitor() {
+	var last *procSample
+
+	for {
+		time.Sleep(monitorInterval)
+
+		// the java process, not the wrapper script that started it (ex: run.sh of forge modpacks)
+		pid := servctrl.ServTerm.ServerPid()
+		if pid < 0 {
+			last = nil
+			servstats.Stats.M.Lock()
+			servstats.Stats.CPUUsage = 0
+			servstats.Stats.MemoryUsage = 0
+			servstats.Stats.M.Unlock()
+			continue
+		}
+
+		sample, errMsh := sampleProc(pid)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("ResourceMonitor"))
+			// resource monitoring is not supported: stop monitoring
+			if errMsh.Cod == errco.ERROR_SYSMON_NOT_SUPPORTED {
+				return
+			}
+			continue
+		}
+
+		servstats.Stats.M.Lock()
+		servstats.Stats.MemoryUsage = sample.memory
+		if last != nil {
+			// cpu usage as percentage of 1 core
+			servstats.Stats.CPUUsage = 100 * float64(sample.cpuTime-last.cpuTime) / float64(sample.t.Sub(last.t))
+		}
+		servstats.Stats.M.Unlock()
+		last = sample
+
+		checkMemoryPressure()
+	}
+}
+
+// checkMemoryPressure freezes the minecraft server if host available memory
+// is below Msh.HostMemoryFreezeThreshold MB and no player is online
+func checkMemoryPressure() {
+	threshold := uint64(config.ConfigRuntime.Msh.HostMemoryFreezeThreshold) * 1024 * 1024
+	if threshold == 0 || servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.PlayerCount > 0 {
+		return
+	}
+
+	available, errMsh := opsys.HostMemAvailable()
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("checkMemoryPressure"))
+		return
+	}
+
+	if available >= threshold {
+		return
+	}
+
+	errco.Logln(errco.LVL_B, "host available memory is low (%d MB): freezing empty minecraft server", available/1024/1024)
+
+	errMsh = servctrl.StopMS(true, history.By(history.SOURCE_MEMORY))
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("checkMemoryPressure"))
+	}
+}
@@ -0,0 +1,224 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/locale"
+	"msh/lib/servstats"
+)
+
+// usageFileName is the file where server usage is persisted
+const usageFileName string = "msh-usage.json"
+
+// trackInterval is the time between two usage updates
+const trackInterval = time.Minute
+
+var (
+	m sync.Mutex
+
+	// usage contains the server usage per month ("2006-01")
+	usage = map[string]*monthUsage{}
+
+	// overrideUntil is the time until which the playtime quota is not enforced
+	overrideUntil time.Time
+)
+
+// monthUsage is the server usage in a month
+type monthUsage struct {
+	Online     int64 `json:"online"`     // seconds of minecraft server activity (starting, online, stopping)
+	Hibernated int64 `json:"hibernated"` // seconds of msh activity while minecraft server is offline
+}
+
+// MonthReport is the server usage in a calendar month expressed in hours
+type MonthReport struct {
+	Month           string  `json:"month"`
+	OnlineHours     float64 `json:"onlineHours"`
+	HibernatedHours float64 `json:"hibernatedHours"`
+}
+
+// UsageTracker accounts the time the minecraft server is running (starting, online, stopping)
+// and the time it's hibernated to the current month and persists it to the usage file.
+// The same samples are accounted to the daily uptime of the history.
+// [goroutine]
+func UsageTracker() {
+	errMsh := load()
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("UsageTracker"))
+	}
+
+	lastT := time.Now()
+
+	for {
+		time.Sleep(trackInterval)
+
+		now := time.Now()
+		elapsed := now.Sub(lastT)
+		online := servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE
+
+		m.Lock()
+		month := now.Format("2006-01")
+		if usage[month] == nil {
+			usage[month] = &monthUsage{}
+		}
+		if online {
+			usage[month].Online += int64(elapsed.Seconds())
+		} else {
+			usage[month].Hibernated += int64(elapsed.Seconds())
+		}
+		m.Unlock()
+
+		history.AddUptime(now, elapsed, online)
+
+		errMsh := save()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("UsageTracker"))
+		}
+
+		lastT = now
+	}
+}
+
+// OnlineHours returns the hours of server activity in the specified month ("2006-01")
+func OnlineHours(month string) float64 {
+	m.Lock()
+	defer m.Unlock()
+
+	if usage[month] == nil {
+		return 0
+	}
+
+	return float64(usage[month].Online) / 3600
+}
+
+// Report returns the server usage per calendar month (from oldest to newest).
+// If the usage tracker is not running, usage is loaded from the usage file.
+func Report() ([]MonthReport, *errco.Error) {
+	m.Lock()
+	empty := len(usage) == 0
+	m.Unlock()
+
+	if empty {
+		errMsh := load()
+		if errMsh != nil {
+			return nil, errMsh.AddTrace("Report")
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	months := []string{}
+	for month := range usage {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+
+	report := []MonthReport{}
+	for _, month := range months {
+		report = append(report, MonthReport{month, float64(usage[month].Online) / 3600, float64(usage[month].Hibernated) / 3600})
+	}
+
+	return report, nil
+}
+
+// ReportCSV returns the server usage per calendar month in csv format
+func ReportCSV() (string, *errco.Error) {
+	report, errMsh := Report()
+	if errMsh != nil {
+		return "", errMsh.AddTrace("ReportCSV")
+	}
+
+	csv := "month,online_hours,hibernated_hours\n"
+	for _, r := range report {
+		csv += fmt.Sprintf("%s,%.2f,%.2f\n", r.Month, r.OnlineHours, r.HibernatedHours)
+	}
+
+	return csv, nil
+}
+
+// QuotaExceeded returns an error if the monthly playtime quota (Quota.MonthlyHours) is exceeded
+// and no override is active
+func QuotaExceeded() *errco.Error {
+	quota := config.ConfigRuntime.Quota.MonthlyHours
+	if quota <= 0 {
+		return nil
+	}
+
+	m.Lock()
+	overridden := time.Now().Before(overrideUntil)
+	m.Unlock()
+
+	hours := OnlineHours(time.Now().Format("2006-01"))
+	if hours < float64(quota) || overridden {
+		return nil
+	}
+
+	// the quota is reset at the beginning of next month
+	now := time.Now()
+	nextPeriod := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+
+	return errco.NewErr(errco.ERROR_QUOTA_EXCEEDED, errco.LVL_B, "QuotaExceeded", locale.T("quota.exceeded", quota, nextPeriod.Format("2006/01/02")))
+}
+
+// Override suspends the playtime quota enforcement for the specified duration
+// if token is one of Quota.OverrideTokens
+func Override(token string, d time.Duration) *errco.Error {
+	for _, t := range config.ConfigRuntime.Quota.OverrideTokens {
+		if t != "" && t == token {
+			m.Lock()
+			overrideUntil = time.Now().Add(d)
+			m.Unlock()
+
+			errco.Logln(errco.LVL_B, "playtime quota overridden until %s", overrideUntil.Format("2006/01/02 15:04:05"))
+			return nil
+		}
+	}
+
+	return errco.NewErr(errco.ERROR_QUOTA_TOKEN, errco.LVL_B, "Override", "quota override token is not valid")
+}
+
+// load reads the usage file (if present)
+func load() *errco.Error {
+	data, err := ioutil.ReadFile(usageFileName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_USAGE_LOAD, errco.LVL_D, "load", err.Error())
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	err = json.Unmarshal(data, &usage)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_USAGE_LOAD, errco.LVL_D, "load", err.Error())
+	}
+
+	return nil
+}
+
+// save writes the usage file
+func save() *errco.Error {
+	m.Lock()
+	data, err := json.MarshalIndent(usage, "", "  ")
+	m.Unlock()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_USAGE_SAVE, errco.LVL_D, "save", err.Error())
+	}
+
+	err = ioutil.WriteFile(usageFileName, data, 0644)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_USAGE_SAVE, errco.LVL_D, "save", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package wake
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/servstats"
+)
+
+const (
+	dnsTypeTXT = 16  // TXT record type
+	dnsTypeANY = 255 // ANY query type
+
+	dnsRcodeRefused = 5 // query refused (names not handled by msh)
+)
+
+// DnsListener answers DNS queries on Wake.Dns.ListenAddress (udp) and starts the minecraft server
+// when a TXT query for Wake.Dns.Name is received (the answer contains the minecraft server status).
+// Delegate a zone to the msh host (NS record) to wake the server from networks that only allow DNS.
+// [goroutine]
+func DnsListener() {
+	if config.ConfigRuntime.Wake.Dns.ListenAddress == "" {
+		return
+	}
+
+	// use the socket passed by the previous msh process (seamless restart) if any
+	pc, err := handover.ListenPacket("dns", config.ConfigRuntime.Wake.Dns.ListenAddress)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_WAKE_DNS, errco.LVL_B, "DnsListener", err.Error()))
+		return
+	}
+	defer pc.Close()
+
+	errco.Logln(errco.LVL_D, "DnsListener: listening for dns wake queries on %s", config.ConfigRuntime.Wake.Dns.ListenAddress)
+
+	wakeName := strings.ToLower(strings.TrimSuffix(config.ConfigRuntime.Wake.Dns.Name, "."))
+	buf := make([]byte, 512)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			// the socket was passed to a new msh process (seamless restart)
+			if handover.HandedOver() {
+				return
+			}
+
+			errco.LogMshErr(errco.NewErr(errco.ERROR_WAKE_DNS, errco.LVL_D, "DnsListener", err.Error()))
+			continue
+		}
+
+		name, qtype, question, ok := parseQuery(buf[:n])
+		if !ok {
+			errco.Logln(errco.LVL_E, "DnsListener: malformed dns query from %s", addr.String())
+			continue
+		}
+
+		var resp []byte
+		switch {
+		case name != wakeName:
+			resp = buildResponse(buf[:n], question, dnsRcodeRefused, "")
+		case qtype == dnsTypeTXT || qtype == dnsTypeANY:
+			errco.Logln(errco.LVL_D, "DnsListener: dns wake query from %s", addr.String())
+			wakeServer(history.SOURCE_DNS)
+			resp = buildResponse(buf[:n], question, 0, "msh: minecraft server "+servstats.StatusName(servstats.Stats.Status))
+		default:
+			// other record types of the wake name have no data
+			resp = buildResponse(buf[:n], question, 0, "")
+		}
+
+		_, err = pc.WriteTo(resp, addr)
+		if err != nil {
+			errco.LogMshErr(errco.NewErr(errco.ERROR_WAKE_DNS, errco.LVL_D, "DnsListener", err.Error()))
+		}
+	}
+}
+
+// parseQuery returns the lowercase name and type of the first question of a dns query
+// and the question section bytes (ok is false if the query is malformed)
+func parseQuery(msg []byte) (string, uint16, []byte, bool) {
+	// header: id, flags, qdcount, ancount, nscount, arcount
+	if len(msg) < 12 || msg[2]&0x80 != 0 || binary.BigEndian.Uint16(msg[4:6]) == 0 {
+		return "", 0, nil, false
+	}
+
+	labels := []string{}
+	i := 12
+	for {
+		if i >= len(msg) {
+			return "", 0, nil, false
+		}
+		l := int(msg[i])
+		i++
+		if l == 0 {
+			break
+		}
+		// compression pointers are not expected in the question name
+		if l > 63 || i+l > len(msg) {
+			return "", 0, nil, false
+		}
+		labels = append(labels, string(msg[i:i+l]))
+		i += l
+	}
+
+	// question type and class
+	if i+4 > len(msg) {
+		return "", 0, nil, false
+	}
+	qtype := binary.BigEndian.Uint16(msg[i : i+2])
+
+	return strings.ToLower(strings.Join(labels, ".")), qtype, msg[12 : i+4], true
+}
+
+// buildResponse returns the authoritative response to query with the specified rcode
+// and, if txt is not empty, a TXT answer record
+func buildResponse(query, question []byte, rcode byte, txt string) []byte {
+	if len(txt) > 255 {
+		txt = txt[:255]
+	}
+
+	ancount := 0
+	if txt != "" {
+		ancount = 1
+	}
+
+	resp := make([]byte, 12, 12+len(question)+16+len(txt))
+	copy(resp[0:2], query[0:2])
+	resp[2] = 0x84 | query[2]&0x01 // QR, AA and RD copied from query
+	resp[3] = rcode
+	binary.BigEndian.PutUint16(resp[4:6], 1)
+	binary.BigEndian.PutUint16(resp[6:8], uint16(ancount))
+	resp = append(resp, question...)
+
+	if txt != "" {
+		// name pointer to the question name, type TXT, class IN, ttl 0 (status must not be cached)
+		resp = append(resp, 0xc0, 0x0c, 0, dnsTypeTXT, 0, 1, 0, 0, 0, 0)
+		resp = append(resp, byte((len(txt)+1)>>8), byte(len(txt)+1), byte(len(txt)))
+		resp = append(resp, txt...)
+	}
+
+	return resp
+}
@@ -0,0 +1,189 @@
+package wake
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/outbound"
+)
+
+// imapTimeout is the timeout of the imap mailbox poll
+const imapTimeout = 30 * time.Second
+
+// literalRe matches the literal size at the end of an imap response line (ex: "{42}")
+var literalRe = regexp.MustCompile(`\{(\d+)\}$`)
+
+// imapConn is a connection to the imap server
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// ImapPoller polls the Wake.Imap mailbox every Wake.Imap.Interval seconds (default 60) and starts the minecraft server
+// when an unseen message with Wake.Imap.Subject in the subject is found (messages found are marked as seen).
+// The imap server is contacted over TLS (Msh.CACerts are trusted in addition to the system certificates).
+// [goroutine]
+func ImapPoller() {
+	if config.ConfigRuntime.Wake.Imap.Server == "" {
+		return
+	}
+
+	interval := time.Duration(config.ConfigRuntime.Wake.Imap.Interval) * time.Second
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+
+	errco.Logln(errco.LVL_D, "ImapPoller: polling imap mailbox %s every %s", config.ConfigRuntime.Wake.Imap.Server, interval)
+
+	for {
+		found, errMsh := pollMailbox()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("ImapPoller"))
+		} else if found {
+			wakeServer(history.SOURCE_IMAP)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// pollMailbox returns true if the mailbox contains unseen wake messages (and marks them as seen)
+func pollMailbox() (bool, *errco.Error) {
+	c, errMsh := dialImap()
+	if errMsh != nil {
+		return false, errMsh.AddTrace("pollMailbox")
+	}
+	defer c.conn.Close()
+
+	mailbox := config.ConfigRuntime.Wake.Imap.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	_, errMsh = c.command("LOGIN " + quote(config.ConfigRuntime.Wake.Imap.Username) + " " + quote(config.ConfigRuntime.Wake.Imap.Password))
+	if errMsh != nil {
+		return false, errMsh.AddTrace("pollMailbox")
+	}
+
+	_, errMsh = c.command("SELECT " + quote(mailbox))
+	if errMsh != nil {
+		return false, errMsh.AddTrace("pollMailbox")
+	}
+
+	lines, errMsh := c.command("SEARCH UNSEEN SUBJECT " + quote(config.ConfigRuntime.Wake.Imap.Subject))
+	if errMsh != nil {
+		return false, errMsh.AddTrace("pollMailbox")
+	}
+
+	ids := []string{}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "* SEARCH") {
+			ids = append(ids, strings.Fields(strings.TrimPrefix(l, "* SEARCH"))...)
+		}
+	}
+
+	if len(ids) > 0 {
+		// wake messages are marked as seen so that they trigger a single wake
+		_, errMsh = c.command("STORE " + strings.Join(ids, ",") + ` +FLAGS.SILENT (\Seen)`)
+		if errMsh != nil {
+			return false, errMsh.AddTrace("pollMailbox")
+		}
+	}
+
+	c.command("LOGOUT")
+
+	return len(ids) > 0, nil
+}
+
+// dialImap connects to the imap server and reads its greeting
+func dialImap() (*imapConn, *errco.Error) {
+	tlsConfig, errMsh := outbound.TLSConfig()
+	if errMsh != nil {
+		return nil, errMsh.AddTrace("dialImap")
+	}
+
+	address := config.ConfigRuntime.Wake.Imap.Server
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "993")
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: imapTimeout}, "tcp", address, tlsConfig)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_D, "dialImap", err.Error())
+	}
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+
+	greeting, err := c.r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_D, "dialImap", err.Error())
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_D, "dialImap", "unexpected imap greeting: "+strings.TrimSpace(greeting))
+	}
+
+	return c, nil
+}
+
+// command sends an imap command and returns the untagged response lines
+// (an error is returned if the command does not complete with OK)
+func (c *imapConn) command(com string) ([]string, *errco.Error) {
+	c.tag++
+	tag := fmt.Sprintf("m%d", c.tag)
+
+	_, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, com)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_D, "command", err.Error())
+	}
+
+	lines := []string{}
+	for {
+		l, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_D, "command", err.Error())
+		}
+		l = strings.TrimRight(l, "\r\n")
+
+		// skip literal data sent after the response line
+		if m := literalRe.FindStringSubmatch(l); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			_, err = io.CopyN(ioutil.Discard, c.r, int64(n))
+			if err != nil {
+				return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_D, "command", err.Error())
+			}
+		}
+
+		if !strings.HasPrefix(l, tag+" ") {
+			lines = append(lines, l)
+			continue
+		}
+
+		if !strings.HasPrefix(l, tag+" OK") {
+			// do not log the credentials sent with LOGIN
+			verb := strings.SplitN(com, " ", 2)[0]
+			return nil, errco.NewErr(errco.ERROR_WAKE_IMAP, errco.LVL_B, "command", "imap "+verb+" failed: "+strings.TrimPrefix(l, tag+" "))
+		}
+
+		return lines, nil
+	}
+}
+
+// quote returns s as an imap quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,23 @@
+package wake
+
+import (
+	"msh/lib/errco"
+	"msh/lib/history"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// wakeServer starts the minecraft server (if offline) on a wake request received via channel (history.SOURCE_DNS - history.SOURCE_IMAP)
+func wakeServer(channel string) {
+	if servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		errco.Logln(errco.LVL_D, "wake request received via %s: minecraft server is already %s", channel, servstats.StatusName(servstats.Stats.Status))
+		return
+	}
+
+	errco.Logln(errco.LVL_B, "wake request received via %s: starting minecraft server", channel)
+
+	errMsh := servctrl.StartMS(history.By(channel))
+	if errMsh != nil {
+		errco.LogMshErr(errMsh.AddTrace("wakeServer"))
+	}
+}
@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocket package implements the websocket protocol (RFC 6455) used by the api websocket console (server side)
+// and by the pterodactyl websocket console (client side).
+// Messages are read whole (up to a maximum size), frames are written unfragmented.
+
+// websocket opcodes
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xa
+)
+
+// guid is appended to the client key to compute the handshake accept key
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// handshakeTimeout is the maximum duration of the client handshake
+const handshakeTimeout = 10 * time.Second
+
+// Conn is a websocket connection
+type Conn struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	w          *bufio.Writer
+	client     bool       // client side connection: frames sent are masked, frames received are not
+	maxMessage int        // maximum size of a received message
+	m          sync.Mutex // protects writes
+}
+
+// Upgrade performs the server side websocket handshake and takes over the http connection
+// (maxMessage is the maximum size of a message received from the client)
+func Upgrade(w http.ResponseWriter, r *http.Request, maxMessage int) (*Conn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("websocket version not supported: %s", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("websocket key missing")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	err = rw.Flush()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, r: rw.Reader, w: rw.Writer, maxMessage: maxMessage}, nil
+}
+
+// Handshake performs the client side websocket handshake for the websocket at u (ws:// or wss://)
+// on conn, already connected to the websocket host (maxMessage is the maximum size of a message received from the server)
+func Handshake(conn net.Conn, u *url.URL, origin string, maxMessage int) (*Conn, error) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	_, err := conn.Write([]byte("GET " + u.RequestURI() + " HTTP/1.1\r\n" +
+		"Host: " + u.Host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + encodedKey + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Origin: " + origin + "\r\n\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(encodedKey) {
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &Conn{conn: conn, r: r, w: bufio.NewWriter(conn), client: true, maxMessage: maxMessage}, nil
+}
+
+// acceptKey returns the handshake accept key of a client key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains returns true if one of the comma separated values of the header is value (case insensitive)
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h[name] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ReadMessage returns the next text or binary message received.
+// Pings are answered, a close frame is answered and returns io.EOF.
+func (ws *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+
+	for {
+		fin, opcode, payload, err := ws.readFrame(len(message))
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case OpPing:
+			err = ws.WriteFrame(OpPong, payload)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			ws.WriteFrame(OpClose, payload)
+			return nil, io.EOF
+		case OpText, OpBinary:
+			message = payload
+		case OpContinuation:
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("websocket opcode not valid: %d", opcode)
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a frame (received is the size of the message fragments already received).
+// Frames sent by the client are always masked, frames sent by the server never are.
+func (ws *Conn) readFrame(received int) (bool, byte, []byte, error) {
+	head := make([]byte, 2)
+	_, err := io.ReadFull(ws.r, head)
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	if !ws.client && !masked {
+		return false, 0, nil, fmt.Errorf("websocket client frame not masked")
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(ws.r, ext)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(ws.r, ext)
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if length > uint64(ws.maxMessage) || uint64(received)+length > uint64(ws.maxMessage) {
+		return false, 0, nil, fmt.Errorf("websocket message too big")
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		_, err = io.ReadFull(ws.r, mask)
+		if err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(ws.r, payload)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteFrame sends a single (unfragmented) frame
+func (ws *Conn) WriteFrame(opcode byte, payload []byte) error {
+	ws.m.Lock()
+	defer ws.m.Unlock()
+
+	maskBit := byte(0)
+	if ws.client {
+		maskBit = 0x80
+	}
+
+	head := []byte{0x80 | opcode}
+	switch l := len(payload); {
+	case l < 126:
+		head = append(head, maskBit|byte(l))
+	case l <= 0xffff:
+		head = append(head, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(head[2:], uint16(l))
+	default:
+		head = append(head, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(l))
+	}
+	ws.w.Write(head)
+
+	if ws.client {
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		ws.w.Write(mask)
+		payload = masked
+	}
+	ws.w.Write(payload)
+
+	return ws.w.Flush()
+}
+
+// Close closes the websocket connection
+func (ws *Conn) Close() error {
+	return ws.conn.Close()
+}
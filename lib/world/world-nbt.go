@@ -0,0 +1,202 @@
+package world
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"msh/lib/errco"
+)
+
+// nbt tag types
+const (
+	tagEnd       = 0
+	tagByte      = 1
+	tagShort     = 2
+	tagInt       = 3
+	tagLong      = 4
+	tagFloat     = 5
+	tagDouble    = 6
+	tagByteArray = 7
+	tagString    = 8
+	tagList      = 9
+	tagCompound  = 10
+	tagIntArray  = 11
+	tagLongArray = 12
+)
+
+// maximum nbt nesting depth (same limit as the minecraft server)
+const nbtMaxDepth = 512
+
+// checkLevelDat verifies that level.dat is a gzip compressed nbt compound containing the "Data" compound
+func checkLevelDat(path string) *errco.Error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is missing")
+	} else if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", err.Error())
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is not gzip compressed: "+err.Error())
+	}
+	r := bufio.NewReader(gz)
+
+	// root: named compound tag
+	typ, err := r.ReadByte()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is truncated: "+err.Error())
+	}
+	if typ != tagCompound {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat root is not a compound tag")
+	}
+	if _, err = nbtString(r); err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is truncated: "+err.Error())
+	}
+
+	// walk root compound entries, looking for "Data"
+	hasData := false
+	for {
+		typ, err = r.ReadByte()
+		if err != nil {
+			return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is truncated: "+err.Error())
+		}
+		if typ == tagEnd {
+			break
+		}
+
+		name, err := nbtString(r)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is truncated: "+err.Error())
+		}
+		if name == "Data" && typ == tagCompound {
+			hasData = true
+		}
+
+		err = nbtSkip(r, typ, 1)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is not valid: "+err.Error())
+		}
+	}
+
+	if !hasData {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat does not contain the Data compound")
+	}
+
+	// reading till the end verifies the gzip checksum
+	_, err = io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkLevelDat", "level.dat is not valid: "+err.Error())
+	}
+
+	return nil
+}
+
+// nbtString reads an nbt string (unsigned short length + modified utf-8)
+func nbtString(r *bufio.Reader) (string, error) {
+	var l uint16
+	err := binary.Read(r, binary.BigEndian, &l)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// nbtSkip reads and discards the payload of a tag of type typ
+func nbtSkip(r *bufio.Reader, typ byte, depth int) error {
+	if depth > nbtMaxDepth {
+		return fmt.Errorf("nbt nesting is too deep")
+	}
+
+	switch typ {
+	case tagByte:
+		return discard(r, 1)
+	case tagShort:
+		return discard(r, 2)
+	case tagInt, tagFloat:
+		return discard(r, 4)
+	case tagLong, tagDouble:
+		return discard(r, 8)
+	case tagByteArray, tagIntArray, tagLongArray:
+		n, err := nbtLength(r)
+		if err != nil {
+			return err
+		}
+		size := map[byte]int64{tagByteArray: 1, tagIntArray: 4, tagLongArray: 8}[typ]
+		return discard(r, n*size)
+	case tagString:
+		_, err := nbtString(r)
+		return err
+	case tagList:
+		elemTyp, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		n, err := nbtLength(r)
+		if err != nil {
+			return err
+		}
+		if n > 0 && (elemTyp == tagEnd || elemTyp > tagLongArray) {
+			return fmt.Errorf("unknown nbt list element type %d", elemTyp)
+		}
+		for i := int64(0); i < n; i++ {
+			err = nbtSkip(r, elemTyp, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case tagCompound:
+		for {
+			t, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if t == tagEnd {
+				return nil
+			}
+			if _, err = nbtString(r); err != nil {
+				return err
+			}
+			err = nbtSkip(r, t, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown nbt tag type %d", typ)
+	}
+}
+
+// nbtLength reads a signed int length of an nbt array or list
+func nbtLength(r *bufio.Reader) (int64, error) {
+	var n int32
+	err := binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative nbt length %d", n)
+	}
+
+	return int64(n), nil
+}
+
+// discard skips n bytes of r returning an error if r ends before
+func discard(r *bufio.Reader, n int64) error {
+	_, err := io.CopyN(ioutil.Discard, r, n)
+	return err
+}
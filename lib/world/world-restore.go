@@ -0,0 +1,286 @@
+package world
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+)
+
+var (
+	corruptedM sync.Mutex
+	corrupted  string // reason of the world corruption reported by the minecraft server log (empty if not reported)
+)
+
+// MarkCorrupted records that the minecraft server log reported a world corruption:
+// the next integrity check fails with reason
+func MarkCorrupted(reason string) {
+	corruptedM.Lock()
+	defer corruptedM.Unlock()
+
+	errco.LogMshErr(errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "MarkCorrupted", "minecraft server reported a world corruption: "+reason))
+	corrupted = reason
+}
+
+// Restore replaces the world folder with the most recent backup that passes the integrity check.
+// The damaged world is moved aside to <world>.corrupted-<time>.
+// The minecraft server must be offline.
+func Restore() *errco.Error {
+	if config.ConfigRuntime.World.BackupFolder == "" {
+		return errco.NewErr(errco.ERROR_WORLD_RESTORE, errco.LVL_B, "Restore", "World.BackupFolder is not set")
+	}
+
+	worldPath := Path()
+	stagePath := worldPath + ".msh-restore"
+	defer os.RemoveAll(stagePath)
+
+	backups, errMsh := backupsByTime()
+	if errMsh != nil {
+		return errMsh.AddTrace("Restore")
+	}
+
+	// stage backups (newest first) until one passes the integrity check
+	backup, stagedWorld := "", ""
+	for _, b := range backups {
+		os.RemoveAll(stagePath)
+
+		errMsh = stage(b, stagePath)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("Restore"))
+			continue
+		}
+
+		root := findWorldRoot(stagePath)
+		if root == "" {
+			errco.Logln(errco.LVL_B, "backup does not contain a world: %s", b)
+			continue
+		}
+		errMsh = check(root)
+		if errMsh != nil {
+			errco.Logln(errco.LVL_B, "backup failed the integrity check: %s (%s)", b, errMsh.Str)
+			continue
+		}
+
+		backup, stagedWorld = b, root
+		break
+	}
+	if backup == "" {
+		return errco.NewErr(errco.ERROR_WORLD_RESTORE, errco.LVL_B, "Restore", "no backup passed the integrity check")
+	}
+
+	// archive the damaged world aside
+	archivePath := ""
+	if _, err := os.Stat(worldPath); err == nil {
+		archivePath = worldPath + ".corrupted-" + time.Now().Format("20060102-150405")
+		err = os.Rename(worldPath, archivePath)
+		if err != nil {
+			return errco.NewErr(errco.ERROR_WORLD_RESTORE, errco.LVL_B, "Restore", "error while archiving the damaged world: "+err.Error())
+		}
+	}
+
+	err := os.Rename(stagedWorld, worldPath)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_RESTORE, errco.LVL_B, "Restore", "error while moving the restored world: "+err.Error())
+	}
+
+	corruptedM.Lock()
+	corrupted = ""
+	corruptedM.Unlock()
+
+	errco.Logln(errco.LVL_A, "world restored from backup %s (damaged world archived to %s)", backup, archivePath)
+	events.Publish(events.WORLD_RESTORED, map[string]interface{}{"backup": backup, "archive": archivePath})
+
+	return nil
+}
+
+// backupsByTime returns the paths of the backups in BackupFolder sorted from the newest
+func backupsByTime() ([]string, *errco.Error) {
+	infos, err := ioutil.ReadDir(config.ConfigRuntime.World.BackupFolder)
+	if err != nil {
+		return nil, errco.NewErr(errco.ERROR_WORLD_BACKUP, errco.LVL_B, "backupsByTime", err.Error())
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+
+	backups := []string{}
+	for _, info := range infos {
+		backups = append(backups, filepath.Join(config.ConfigRuntime.World.BackupFolder, info.Name()))
+	}
+
+	return backups, nil
+}
+
+// stage copies (folders) or extracts (zip, tar, tar.gz archives) backup into stagePath
+func stage(backup, stagePath string) *errco.Error {
+	info, err := os.Stat(backup)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_BACKUP, errco.LVL_D, "stage", err.Error())
+	}
+
+	switch {
+	case info.IsDir():
+		err = filepath.Walk(backup, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(backup, path)
+			if info.IsDir() {
+				return os.MkdirAll(filepath.Join(stagePath, rel), 0755)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return writeFile(filepath.Join(stagePath, rel), f, info.Mode())
+		})
+	case strings.HasSuffix(backup, ".zip"):
+		err = extractZip(backup, stagePath)
+	case strings.HasSuffix(backup, ".tar"), strings.HasSuffix(backup, ".tar.gz"), strings.HasSuffix(backup, ".tgz"):
+		err = extractTar(backup, stagePath)
+	default:
+		return errco.NewErr(errco.ERROR_WORLD_BACKUP, errco.LVL_D, "stage", "backup format not supported: "+backup)
+	}
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_BACKUP, errco.LVL_B, "stage", fmt.Sprintf("error while staging backup %s: %s", backup, err.Error()))
+	}
+
+	return nil
+}
+
+// extractZip extracts the zip archive at path into dst
+func extractZip(path, dst string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		target, err := safeJoin(dst, zf.Name)
+		if err != nil {
+			return err
+		}
+		if zf.FileInfo().IsDir() {
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, zf.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTar extracts the (optionally gzip compressed) tar archive at path into dst
+func extractTar(path, dst string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(path, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dst, h.Name)
+		if err != nil {
+			return err
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeFile(target, tr, os.FileMode(h.Mode))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// safeJoin joins name to dst refusing archive entries that point outside of dst
+func safeJoin(dst, name string) (string, error) {
+	target := filepath.Join(dst, name)
+	if target != filepath.Clean(dst) && !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry points outside of the destination: %s", name)
+	}
+
+	return target, nil
+}
+
+// writeFile writes the content of r to a new file at path
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// findWorldRoot returns the folder containing level.dat: stagePath or one of its direct subfolders
+// (empty if level.dat is not found)
+func findWorldRoot(stagePath string) string {
+	if _, err := os.Stat(filepath.Join(stagePath, "level.dat")); err == nil {
+		return stagePath
+	}
+
+	infos, _ := ioutil.ReadDir(stagePath)
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(stagePath, info.Name(), "level.dat")); err == nil {
+			return filepath.Join(stagePath, info.Name())
+		}
+	}
+
+	return ""
+}
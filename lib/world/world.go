@@ -0,0 +1,194 @@
+package world
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/opsys"
+)
+
+// world package checks the minecraft server world files (World config section)
+
+// region file header: 1024 chunk locations of 4 bytes followed by 1024 timestamps of 4 bytes
+const (
+	sectorSize    = 4096
+	regionHeader  = 2 * sectorSize
+	regionEntries = 1024
+)
+
+// Check verifies the integrity of the world folder before the minecraft server is started.
+// It returns an error, pointing at the latest good backup, if the world should not be booted.
+func Check() *errco.Error {
+	if !config.ConfigRuntime.World.IntegrityCheck {
+		return nil
+	}
+
+	worldPath := Path()
+
+	errco.Logln(errco.LVL_D, "checking world integrity: %s", worldPath)
+
+	errMsh := check(worldPath)
+	if errMsh == nil {
+		corruptedM.Lock()
+		if corrupted != "" {
+			errMsh = errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "Check", "minecraft server reported a world corruption: "+corrupted)
+		}
+		corruptedM.Unlock()
+	}
+	if errMsh == nil {
+		return nil
+	}
+
+	events.Publish(events.WORLD_CORRUPTED, map[string]interface{}{"error": errMsh.Str})
+
+	if config.ConfigRuntime.World.AutoRestore {
+		errco.LogMshErr(errMsh.AddTrace("Check"))
+		errco.Logln(errco.LVL_A, "restoring world from backup...")
+
+		errMshRestore := Restore()
+		if errMshRestore == nil {
+			return nil
+		}
+		return errMshRestore.AddTrace("Check")
+	}
+
+	if backup := latestGoodBackup(); backup != "" {
+		errMsh.Str += fmt.Sprintf(" (latest good backup: %s, restore it with \"msh restore\")", backup)
+	} else {
+		errMsh.Str += " (no good backup found)"
+	}
+	return errMsh.AddTrace("Check")
+}
+
+// Path returns the path of the world folder (level-name in server.properties)
+func Path() string {
+	levelName := "world"
+
+	props, errMsh := config.ReadServerProperties()
+	if errMsh == nil && props["level-name"] != "" {
+		levelName = props["level-name"]
+	}
+
+	return filepath.Join(config.ConfigRuntime.Server.Folder, levelName)
+}
+
+// check verifies session.lock, level.dat and region files of the world at worldPath
+func check(worldPath string) *errco.Error {
+	// a world that does not exist yet is generated by the minecraft server
+	if _, err := os.Stat(worldPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	// session.lock is kept after shutdown by recent minecraft versions:
+	// the world is in use only if the file is locked
+	lockPath := filepath.Join(worldPath, "session.lock")
+	if _, err := os.Stat(lockPath); err == nil {
+		locked, errMsh := opsys.FileLocked(lockPath)
+		if errMsh != nil {
+			return errMsh.AddTrace("check")
+		}
+		if locked {
+			return errco.NewErr(errco.ERROR_WORLD_LOCKED, errco.LVL_B, "check", "world is in use by another process (session.lock is locked)")
+		}
+	}
+
+	errMsh := checkLevelDat(filepath.Join(worldPath, "level.dat"))
+	if errMsh != nil {
+		return errMsh.AddTrace("check")
+	}
+
+	// overworld, nether and end region folders
+	for _, dim := range []string{"", "DIM-1", "DIM1"} {
+		regions, _ := filepath.Glob(filepath.Join(worldPath, dim, "region", "*.mca"))
+		for _, r := range regions {
+			errMsh = checkRegion(r)
+			if errMsh != nil {
+				return errMsh.AddTrace("check")
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkRegion verifies that the chunk locations in the region file header point inside the file
+func checkRegion(path string) *errco.Error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkRegion", err.Error())
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkRegion", err.Error())
+	}
+
+	// empty region files are created by the minecraft server and are valid
+	if info.Size() == 0 {
+		return nil
+	}
+	if info.Size() < regionHeader {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkRegion", fmt.Sprintf("region file header is truncated: %s", path))
+	}
+
+	header := make([]byte, sectorSize)
+	_, err = f.ReadAt(header, 0)
+	if err != nil {
+		return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkRegion", err.Error())
+	}
+
+	sectors := (info.Size() + sectorSize - 1) / sectorSize
+	for i := 0; i < regionEntries; i++ {
+		loc := binary.BigEndian.Uint32(header[i*4:])
+		offset, count := int64(loc>>8), int64(loc&0xff)
+
+		// chunk not generated
+		if loc == 0 {
+			continue
+		}
+
+		if offset < 2 || offset+count > sectors {
+			return errco.NewErr(errco.ERROR_WORLD_CORRUPTED, errco.LVL_B, "checkRegion", fmt.Sprintf("region file chunk %d points outside of the file: %s", i, path))
+		}
+	}
+
+	return nil
+}
+
+// latestGoodBackup returns the most recent backup in BackupFolder.
+// Backup folders that fail the integrity check are skipped (archives are not checked).
+func latestGoodBackup() string {
+	if config.ConfigRuntime.World.BackupFolder == "" {
+		return ""
+	}
+
+	infos, err := ioutil.ReadDir(config.ConfigRuntime.World.BackupFolder)
+	if err != nil {
+		errco.LogMshErr(errco.NewErr(errco.ERROR_WORLD_BACKUP, errco.LVL_D, "latestGoodBackup", err.Error()))
+		return ""
+	}
+
+	latest, latestTime := "", time.Time{}
+	for _, info := range infos {
+		if !info.ModTime().After(latestTime) {
+			continue
+		}
+
+		backupPath := filepath.Join(config.ConfigRuntime.World.BackupFolder, info.Name())
+		if info.IsDir() && check(backupPath) != nil {
+			continue
+		}
+
+		latest, latestTime = backupPath, info.ModTime()
+	}
+
+	return latest
+}
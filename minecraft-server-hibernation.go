@@ -2,15 +2,30 @@ package main
 
 import (
 	"fmt"
-	"net"
 	"os"
+	"strings"
 
+	"msh/lib/api"
+	"msh/lib/cli"
 	"msh/lib/config"
 	"msh/lib/conn"
+	"msh/lib/ddns"
 	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/handover"
+	"msh/lib/history"
+	"msh/lib/hooks"
 	"msh/lib/input"
+	"msh/lib/mqtt"
+	"msh/lib/notify"
+	"msh/lib/plugin"
 	"msh/lib/progmgr"
+	"msh/lib/provision"
+	"msh/lib/servctrl"
+	"msh/lib/sysmon"
+	"msh/lib/usage"
 	"msh/lib/utility"
+	"msh/lib/wake"
 )
 
 // script version
@@ -28,6 +43,16 @@ var intro []string = []string{
 }
 
 func main() {
+	// execute msh subcommand (if specified) instead of running msh
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		errMsh := cli.Run(os.Args[1:], version)
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("main"))
+			os.Exit(errco.ExitCode(errMsh))
+		}
+		os.Exit(errco.EXIT_OK)
+	}
+
 	// print program intro
 	// not using errco.Logln since log time is not needed
 	fmt.Println(utility.Boxify(intro))
@@ -37,10 +62,28 @@ func main() {
 	// LoadConfig is the second function to be called
 	errMsh := config.LoadConfig()
 	if errMsh != nil {
+		// the exit code tells supervisors the cause (ex: bad config or port in use)
 		errco.LogMshErr(errMsh.AddTrace("main"))
-		os.Exit(1)
+		os.Exit(errco.ExitCode(errMsh))
 	}
 
+	// download the server jar on first run if it's provisioned by msh
+	if config.ConfigRuntime.Mirror.PrimaryApi == "" {
+		errMsh = provision.Provision()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("main"))
+			os.Exit(errco.ExitCode(errMsh))
+		}
+	}
+
+	// launch event file and webhook exporters
+	go events.FileExporter()
+	go events.WebhookExporter()
+	// launch notifier to deliver events to telegram/pushover/gotify
+	go notify.Notifier()
+	// launch telegram bot to receive the admin commands
+	go notify.TelegramBot()
+
 	// launch update manager to check for updates
 	go progmgr.UpdateManager(version)
 	// wait for the initial update check
@@ -49,14 +92,91 @@ func main() {
 	// listen for interrupt signals
 	go progmgr.InterruptListener()
 
-	// launch GetInput()
-	go input.GetInput()
+	// a mirror msh instance does not manage a minecraft server:
+	// it answers clients with the status of the primary msh instance
+	handleClientSocket := conn.HandleClientSocket
+	if config.ConfigRuntime.Mirror.PrimaryApi != "" {
+		go conn.MirrorManager()
+		handleClientSocket = conn.HandleMirrorClientSocket
+	} else {
+		// launch GetInput()
+		go input.GetInput()
+		// launch command fifo reader (console commands of msh running as service)
+		go input.FifoInput()
+		// launch plugin command reader (console commands sent by plugins)
+		go input.PluginInput()
+		// subscribe terminal and console log file to the minecraft server console
+		servctrl.ConsoleConsumers()
+
+		// launch terminal notifier (bell on player join and server wake)
+		go progmgr.TerminalNotifier()
+
+		// launch scheduled restart manager
+		go servctrl.RestartManager()
+
+		// launch hibernation period manager (always-on periods)
+		go servctrl.PeriodManager()
+
+		// launch drain manager to freeze the empty minecraft server while draining
+		go servctrl.DrainManager()
+
+		// launch keep-alive manager to hibernate the empty minecraft server when the keep-alive ends
+		go servctrl.KeepAliveManager()
+
+		// launch server resource monitor and process priority manager
+		go sysmon.ResourceMonitor()
+		go servctrl.PriorityManager()
 
-	// open a listener
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", config.ListenHost, config.ListenPort))
+		// launch mqtt manager to publish status and receive commands
+		go mqtt.MqttManager()
+
+		// launch wake-by-dns listener and wake-by-email poller
+		go wake.DnsListener()
+		go wake.ImapPoller()
+
+		// launch auxiliary forwarder (ports of services bound while the minecraft server is online)
+		go conn.AuxForwarder()
+		// launch stall monitor (throughput and latency of the proxied connections, stalled clients closed)
+		go conn.StallMonitor()
+		// launch waiting list (players that tried to join while the server was starting are welcomed back)
+		go conn.WaitingList()
+
+		// launch dynamic dns updater (public ip on start and wake)
+		go ddns.Updater()
+
+		// launch state file writer for external health checks
+		go servctrl.StateFileWriter()
+
+		// launch hook manager to run event hook commands
+		go hooks.HookManager()
+		// launch plugin manager to run the plugin executables and send them the events
+		go plugin.PluginManager()
+
+		// launch history recorder (wakes, player sessions)
+		go history.HistoryRecorder()
+
+		// launch usage tracker (monthly usage and daily uptime) and playtime quota enforcer
+		go usage.UsageTracker()
+		go servctrl.QuotaEnforcer()
+
+		// reattach to the minecraft server left running by a detached msh instance
+		errMsh = servctrl.Reattach()
+		if errMsh != nil {
+			errco.LogMshErr(errMsh.AddTrace("main"))
+		}
+	}
+
+	// launch api server
+	go api.ApiManager()
+	// launch grpc api server
+	go api.GrpcManager()
+
+	// open a listener (or use the listener passed by the previous msh process)
+	listener, err := handover.Listen("client", fmt.Sprintf("%s:%d", config.ListenHost, config.ListenPort))
 	if err != nil {
-		errco.LogMshErr(errco.NewErr(errco.ERROR_CLIENT_LISTEN, errco.LVL_D, "main", err.Error()))
-		os.Exit(1)
+		errMsh := errco.NewErr(errco.ERROR_CLIENT_LISTEN, errco.LVL_D, "main", err.Error())
+		errco.LogMshErr(errMsh)
+		os.Exit(errco.ExitCode(errMsh))
 	}
 
 	errco.Logln(errco.LVL_D, "listening for new clients to connect on %s:%d...", config.ListenHost, config.ListenPort)
@@ -65,10 +185,16 @@ func main() {
 	for {
 		clientSocket, err := listener.Accept()
 		if err != nil {
+			// the listener was passed to a new msh process (seamless restart):
+			// msh exits when the proxied connections are closed
+			if handover.HandedOver() {
+				select {}
+			}
+
 			errco.LogMshErr(errco.NewErr(errco.ERROR_CLIENT_ACCEPT, errco.LVL_D, "main", err.Error()))
 			continue
 		}
 
-		go conn.HandleClientSocket(clientSocket)
+		go handleClientSocket(clientSocket)
 	}
 }